@@ -0,0 +1,149 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Aldebaran (.aut) Format
+// Reads and writes LTSs in the Aldebaran format used by CADP and mCRL2
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, ActionDeclaration, getAllStates } from './transpiler';
+import { normalizeSpec, unfoldVariables } from './transforms';
+import { flattenSpec } from './analysis';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Labels CADP uses for the internal action
+ */
+const INTERNAL_LABELS = new Set(['i', 'tau']);
+
+const HEADER_PATTERN = /^des\s*\(\s*(\d+)\s*,\s*(\d+)\s*,\s*(\d+)\s*\)$/;
+const TRANSITION_PATTERN = /^\(\s*(\d+)\s*,\s*("(?:[^"\\]|\\.)*"|[^,]*?)\s*,\s*(\d+)\s*\)$/;
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Import
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Parse an Aldebaran file into a single-process specification.
+ * States keep their numeric names. A `!` or `?` suffix on a label marks this
+ * process as the sender or a receiver of the action; the suffix is dropped
+ * from the action name. CADP's internal action `i` becomes a hidden step.
+ * @param text Contents of the .aut file
+ * @param processName Name of the resulting process
+ */
+export function readAut(text: string, processName = 'AUT'): LTSSpec {
+  const lines = text.split(/\r?\n/).map(l => l.trim()).filter(l => l.length > 0);
+  if (lines.length === 0) {
+    throw new Error('Empty Aldebaran file');
+  }
+
+  const header = HEADER_PATTERN.exec(lines[0]);
+  if (!header) {
+    throw new Error(`Invalid Aldebaran header "${lines[0]}", expected des (initial, transitions, states)`);
+  }
+  const [initial, transitionCount, stateCount] = header.slice(1).map(Number);
+
+  const transitions: Transition[] = [];
+  const actions: Record<string, ActionDeclaration> = {};
+
+  for (let i = 1; i < lines.length; i++) {
+    const match = TRANSITION_PATTERN.exec(lines[i]);
+    if (!match) {
+      throw new Error(`Line ${i + 1}: invalid Aldebaran transition "${lines[i]}"`);
+    }
+
+    const [from, to] = [Number(match[1]), Number(match[3])];
+    for (const state of [from, to]) {
+      if (state >= stateCount) {
+        throw new Error(`Line ${i + 1}: state ${state} out of range (header declares ${stateCount} states)`);
+      }
+    }
+
+    let label = match[2].startsWith('"') ? JSON.parse(match[2]) as string : match[2];
+    const transition: Transition = { fromState: String(from), toState: String(to), action: label };
+
+    if (label.endsWith('!') || label.endsWith('?')) {
+      const direction = label.slice(-1);
+      label = label.slice(0, -1).trim();
+      transition.action = label;
+      if (direction === '!') {
+        actions[label] = { sender: processName };
+      }
+    }
+    if (INTERNAL_LABELS.has(label)) {
+      transition.hidden = true;
+    }
+
+    transitions.push(transition);
+  }
+
+  if (transitions.length !== transitionCount) {
+    throw new Error(`Aldebaran header declares ${transitionCount} transitions but the file contains ${transitions.length}`);
+  }
+  if (initial >= stateCount) {
+    throw new Error(`Initial state ${initial} out of range (header declares ${stateCount} states)`);
+  }
+
+  const spec: LTSSpec = {
+    processes: [{ name: processName, initialState: String(initial), transitions }],
+  };
+  if (Object.keys(actions).length > 0) {
+    spec.actions = actions;
+  }
+  return spec;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Export
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Assign an integer id to every state of a process. Processes whose states
+ * are already numbered from an initial `0` (such as imported .aut files) keep
+ * their numbers; otherwise states are numbered in breadth-first order.
+ */
+function stateIds(proc: ProcessDefinition): Map<string, number> {
+  const states = Array.from(new Set([proc.initialState, ...getAllStates(proc)]));
+  const ids = new Map<string, number>();
+
+  if (proc.initialState === '0' && states.every(s => /^(0|[1-9]\d*)$/.test(s))) {
+    for (const state of states) ids.set(state, Number(state));
+    return ids;
+  }
+
+  const queue = [proc.initialState];
+  ids.set(proc.initialState, 0);
+  for (let i = 0; i < queue.length; i++) {
+    for (const t of proc.transitions) {
+      if (t.fromState !== queue[i] || ids.has(t.toState)) continue;
+      ids.set(t.toState, ids.size);
+      queue.push(t.toState);
+    }
+  }
+  // States unreachable from the initial state still get an id
+  for (const state of states) {
+    if (!ids.has(state)) ids.set(state, ids.size);
+  }
+  return ids;
+}
+
+/**
+ * Write a specification in Aldebaran format. A multi-process specification
+ * is first composed into a single flat LTS. Hidden actions are written as `i`.
+ * @param source The specification to export
+ * @returns The .aut file contents
+ */
+export function writeAut(source: LTSSpec): string {
+  const spec = normalizeSpec(source);
+  const proc = spec.processes.length === 1 ? unfoldVariables(spec.processes[0]) : flattenSpec(spec);
+  const ids = stateIds(proc);
+  const stateCount = Math.max(...ids.values()) + 1;
+
+  const lines: string[] = [`des (0, ${proc.transitions.length}, ${stateCount})`];
+  for (const t of proc.transitions) {
+    const label = t.hidden ? 'i' : JSON.stringify(t.action);
+    lines.push(`(${ids.get(t.fromState)}, ${label}, ${ids.get(t.toState)})`);
+  }
+
+  return lines.join('\n') + '\n';
+}
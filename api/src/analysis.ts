@@ -0,0 +1,1090 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTS Analysis
+// Explores the synchronized product of an LTS specification to find
+// deadlocks and other behavioural problems before any Go code is generated
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, ActionPriority, getAllStates } from './transpiler';
+import { applyPriority, coversAction, normalizeSpec, unfoldVariables } from './transforms';
+import { LTLFormula, parseLTL, progress, isViolated, formatLTL } from './ltl';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A state of the composed system: process name -> local state
+ */
+export type GlobalState = Record<string, string>;
+
+/**
+ * One step of a counterexample: an action (`tau` when hidden) and the
+ * global state it leads to
+ */
+export interface TraceStep {
+  action: string;
+  state: GlobalState;
+}
+
+/**
+ * A reachable global state in which no action can fire although
+ * at least one process still has somewhere to go
+ */
+export interface Deadlock {
+  state: GlobalState;
+  trace: string[];
+  /** The trace with the global state after each action */
+  steps: TraceStep[];
+}
+
+/**
+ * A reachable global state in which a process has entered its ERROR state
+ */
+export interface ErrorState {
+  process: string;
+  /** The process is a safety property, so the trace violates it */
+  property?: boolean;
+  state: GlobalState;
+  trace: string[];
+  steps: TraceStep[];
+}
+
+/**
+ * Result of analyzing a specification
+ */
+export interface AnalysisResult {
+  stateCount: number;
+  transitionCount: number;
+  /** Externally visible actions of the system (hidden actions excluded) */
+  alphabet: string[];
+  deadlocks: Deadlock[];
+  /** The first ERROR reached by each process, with its shortest trace */
+  errors: ErrorState[];
+}
+
+/**
+ * A reachable cycle of hidden actions: once there, the system can keep
+ * moving forever without any observable progress
+ */
+export interface Divergence {
+  /** Where the cycle is first entered */
+  state: GlobalState;
+  /** Shortest trace to that state */
+  trace: string[];
+  steps: TraceStep[];
+  /** Hidden actions around the cycle, back to `state` */
+  cycle: string[];
+}
+
+/**
+ * A reachable execution that violates a safety property
+ */
+export interface Violation {
+  property: string;
+  state: GlobalState;
+  trace: string[];
+  steps: TraceStep[];
+}
+
+/**
+ * An action that can be starved: from `state` on, the system can cycle
+ * forever without firing it
+ */
+export interface ProgressViolation {
+  action: string;
+  /** Nearest state of a terminal cycle that never fires the action */
+  state: GlobalState;
+  trace: string[];
+  steps: TraceStep[];
+}
+
+/**
+ * One step of an exported counterexample: the TraceStep's action, and the
+ * state of every process after it
+ */
+export interface CounterexampleStep {
+  action: TraceStep['action'];
+  states: TraceStep['state'];
+}
+
+/**
+ * A failed check in structured form, for tools that show where it fails
+ */
+export interface Counterexample {
+  kind: 'deadlock' | 'error' | 'property' | 'progress' | 'divergence';
+  /** The process that reaches ERROR (`error`) */
+  process?: string;
+  /** The violated property: a property process or an LTL formula (`property`) */
+  property?: string;
+  /** The action that can be starved (`progress`) */
+  action?: string;
+  /** The hidden actions around the cycle (`divergence`) */
+  cycle?: string[];
+  trace: CounterexampleStep[];
+}
+
+/**
+ * How big a specification is, for judging whether exhaustive analysis will finish
+ */
+export interface SpecStats {
+  /** States and transitions of each process, with variables unfolded */
+  processes: { name: string; states: number; transitions: number }[];
+  /** Actions in the alphabet of more than one process, sorted */
+  sharedActions: string[];
+  /** Reachable global states, or `maxStates` when `capped` */
+  reachableStates: number;
+  /** Exploration stopped at `maxStates`, so at least that many states are reachable */
+  capped: boolean;
+}
+
+/**
+ * Options bounding state-space exploration
+ */
+export interface ExploreOptions {
+  /** Maximum number of global states to visit (default 100000) */
+  maxStates?: number;
+  /**
+   * Skip interleavings of independent actions (analyze, reachableStates and
+   * specStats only). Every reachable deadlock is still found, but fewer
+   * states are visited, and traces need not be the shortest.
+   */
+  partialOrder?: boolean;
+  /**
+   * Count global states that differ only by a permutation of identical
+   * processes, such as the copies `forall` makes, as one (analyze,
+   * reachableStates, specStats and checkLTL). Deadlock, ERROR and property
+   * verdicts are kept; each deadlock is found once per permutation.
+   */
+  symmetry?: boolean;
+}
+
+/**
+ * Thrown when exploration reaches `maxStates` before covering the state space
+ */
+export class StateLimitError extends Error {
+  constructor(public readonly maxStates: number) {
+    super(`State space exceeds ${maxStates} states`);
+    this.name = 'StateLimitError';
+  }
+}
+
+/**
+ * A run of the composed system from its initial state back to it
+ */
+export interface SystemCycle {
+  /** The actions of the run in order, hidden ones under their own names */
+  trace: string[];
+  /** Actions of the run that every return to the initial state fires */
+  unavoidable: string[];
+}
+
+/**
+ * Where a simulation stands: still running, stopped because every process
+ * has terminated, stuck in a deadlock, or ended by a process entering ERROR
+ */
+export type SimulationStatus = 'running' | 'terminated' | 'deadlock' | 'error';
+
+/**
+ * A global step a simulation can take next
+ */
+export interface SimulationChoice {
+  action: string;
+  hidden: boolean;
+  /** The global state the step leads to */
+  state: GlobalState;
+}
+
+/**
+ * A walk through the composed system, one global step at a time
+ */
+export interface Simulation {
+  /** The current global state */
+  readonly state: GlobalState;
+  /** Actions taken so far, hidden ones under their own names */
+  readonly trace: string[];
+  /** Steps enabled in the current state, sorted by action */
+  readonly choices: SimulationChoice[];
+  readonly status: SimulationStatus;
+  /** Take one of `choices` by its position */
+  step(choice: number): void;
+}
+
+/**
+ * Synchronized product of all processes, ready for exploration
+ */
+interface Product {
+  processes: ProcessDefinition[];
+  alphabets: Set<string>[];
+  outgoing: Map<string, Transition[]>[];
+  initial: string[];
+  hidden: Set<string>;
+  /** Actions declared shared that a single process uses, which never fire */
+  unmatched: Set<string>;
+  priority?: ActionPriority;
+}
+
+/**
+ * A global step: an action and the combined state it leads to
+ */
+interface Step {
+  action: string;
+  next: string[];
+}
+
+/**
+ * A node discovered during breadth-first exploration
+ */
+interface ExploredNode {
+  state: string[];
+  parent: number;
+  action: string | null;
+}
+
+/**
+ * The reachable part of the product graph
+ */
+interface ExploredGraph {
+  nodes: ExploredNode[];
+  edges: { from: number; action: string; to: number }[];
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+const DEFAULT_MAX_STATES = 100000;
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Product Construction
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Build the synchronized product of the processes in a spec
+ */
+function buildProduct(source: LTSSpec): Product {
+  const spec = normalizeSpec(source);
+  const normalized = spec.processes;
+  // Alphabets come from the declared transitions and any alphabet extension:
+  // an action a guard always refuses still blocks the peers that offer it
+  const alphabets = normalized.map(p => new Set([...p.transitions.map(t => t.action), ...(p.extraAlphabet ?? [])]));
+  const processes = normalized.map(p => unfoldVariables(p));
+  const outgoing = processes.map(p => {
+    const map = new Map<string, Transition[]>();
+    for (const t of p.transitions) {
+      if (!map.has(t.fromState)) map.set(t.fromState, []);
+      map.get(t.fromState)!.push(t);
+    }
+    return map;
+  });
+
+  const hidden = new Set<string>();
+  for (const p of processes) {
+    for (const t of p.transitions) {
+      if (t.hidden) hidden.add(t.action);
+    }
+  }
+
+  const unmatched = new Set(Array.from(new Set(alphabets.flatMap(a => Array.from(a)))).filter(action =>
+    spec.shared !== undefined && coversAction(action, spec.shared) && alphabets.filter(a => a.has(action)).length === 1));
+
+  return {
+    processes,
+    alphabets,
+    outgoing,
+    initial: processes.map(p => p.initialState),
+    hidden,
+    unmatched,
+    priority: spec.composition?.priority,
+  };
+}
+
+/**
+ * A local state is terminal when the process has nothing left to do.
+ * ERROR is terminal too: the process has failed and takes no further part.
+ */
+function isTerminal(product: Product, index: number, local: string): boolean {
+  return local === 'STOP' || local === 'ERROR' || !product.outgoing[index].has(local);
+}
+
+/**
+ * Compute every global step enabled in a product state.
+ * An action fires only when every process with it in its alphabet can take it,
+ * and only if the system's priority lets it go ahead of the others. A
+ * declared shared action that a single process uses never fires.
+ */
+function enabledSteps(product: Product, state: string[]): Step[] {
+  const candidates = new Set<string>();
+  state.forEach((local, i) => {
+    if (isTerminal(product, i, local)) return;
+    for (const t of product.outgoing[i].get(local)!) {
+      candidates.add(t.action);
+    }
+  });
+
+  const steps: Step[] = [];
+  for (const action of Array.from(candidates).sort()) {
+    if (product.unmatched.has(action)) continue;
+    // Each participant contributes its possible targets for this action
+    let partials: string[][] = [state.slice()];
+    let blocked = false;
+
+    for (let i = 0; i < state.length && !blocked; i++) {
+      if (!product.alphabets[i].has(action)) continue;
+
+      const targets = isTerminal(product, i, state[i])
+        ? []
+        : product.outgoing[i].get(state[i])!.filter(t => t.action === action).map(t => t.toState);
+
+      if (targets.length === 0) {
+        blocked = true;
+        break;
+      }
+
+      const expanded: string[][] = [];
+      for (const partial of partials) {
+        for (const target of targets) {
+          const next = partial.slice();
+          next[i] = target;
+          expanded.push(next);
+        }
+      }
+      partials = expanded;
+    }
+
+    if (!blocked) {
+      for (const next of partials) {
+        steps.push({ action, next });
+      }
+    }
+  }
+
+  return applyPriority(steps, product.priority);
+}
+
+/**
+ * Actions that only one process has in its alphabet, leaving out declared
+ * shared ones, which never fire. Such an action is
+ * independent of every action of the other processes: neither can enable,
+ * disable or change the outcome of the other.
+ */
+function localActions(product: Product): Set<string> {
+  const owners = new Map<string, number>();
+  for (const alphabet of product.alphabets) {
+    for (const action of alphabet) owners.set(action, (owners.get(action) ?? 0) + 1);
+  }
+  return new Set(Array.from(owners).filter(([action, count]) => count === 1 && !product.unmatched.has(action)).map(([action]) => action));
+}
+
+/**
+ * An ample set of steps for partial-order reduction: those of the first
+ * process whose every transition from its current state is a local action.
+ * The process can take them whatever the others do, and the others' steps
+ * commute with them, so firing only them loses no deadlock. A set with a
+ * step into an already discovered state is passed over, so that the other
+ * processes are not put off around a cycle forever. With no such process
+ * every step is ample.
+ */
+function ampleSteps(product: Product, state: string[], steps: Step[], local: Set<string>, index: Map<string, number>): Step[] {
+  for (let i = 0; i < state.length; i++) {
+    if (isTerminal(product, i, state[i])) continue;
+    const transitions = product.outgoing[i].get(state[i])!;
+    if (!transitions.every(t => local.has(t.action))) continue;
+    const actions = new Set(transitions.map(t => t.action));
+    const ample = steps.filter(step => actions.has(step.action));
+    if (ample.every(step => !index.has(stateKey(step.next)))) return ample;
+  }
+  return steps;
+}
+
+/**
+ * Groups of identical processes: same states, transitions, variables and
+ * alphabet, under different names. Swapping two of them maps every run of
+ * the system onto another run with the same actions.
+ */
+function symmetryGroups(product: Product): number[][] {
+  const groups = new Map<string, number[]>();
+  product.processes.forEach((p, i) => {
+    const { name: _, ...definition } = p;
+    const key = JSON.stringify([definition, Array.from(product.alphabets[i]).sort()]);
+    if (!groups.has(key)) groups.set(key, []);
+    groups.get(key)!.push(i);
+  });
+  return Array.from(groups.values()).filter(group => group.length > 1);
+}
+
+/**
+ * Representative of a product state under symmetry: within each group of
+ * identical processes, the local states in sorted order
+ */
+function canonicalState(groups: number[][], state: string[]): string[] {
+  if (groups.length === 0) return state;
+  const canonical = state.slice();
+  for (const group of groups) {
+    const locals = group.map(i => state[i]).sort();
+    group.forEach((i, k) => { canonical[i] = locals[k]; });
+  }
+  return canonical;
+}
+
+/**
+ * Breadth-first exploration of the reachable product graph, or with
+ * `reduce` of a part of it that keeps every reachable deadlock: under
+ * `partialOrder` by skipping interleavings, and under `symmetry` by keeping
+ * one state per permutation of identical processes. Partial-order reduction
+ * is skipped under a priority, which lets any action disable another.
+ */
+function explore(product: Product, options: ExploreOptions = {}, reduce = false): ExploredGraph {
+  const maxStates = options.maxStates ?? DEFAULT_MAX_STATES;
+  const groups = reduce && options.symmetry ? symmetryGroups(product) : [];
+  const initial = canonicalState(groups, product.initial);
+  const nodes: ExploredNode[] = [{ state: initial, parent: -1, action: null }];
+  const edges: ExploredGraph['edges'] = [];
+  const index = new Map<string, number>([[stateKey(initial), 0]]);
+  const local = reduce && options.partialOrder && !product.priority ? localActions(product) : undefined;
+
+  for (let current = 0; current < nodes.length; current++) {
+    const enabled = enabledSteps(product, nodes[current].state)
+      .map(step => ({ action: step.action, next: canonicalState(groups, step.next) }));
+    const steps = local ? ampleSteps(product, nodes[current].state, enabled, local, index) : enabled;
+    for (const step of steps) {
+      const key = stateKey(step.next);
+      let target = index.get(key);
+      if (target === undefined) {
+        if (nodes.length >= maxStates) {
+          throw new StateLimitError(maxStates);
+        }
+        target = nodes.length;
+        index.set(key, target);
+        nodes.push({ state: step.next, parent: current, action: step.action });
+      }
+      edges.push({ from: current, action: step.action, to: target });
+    }
+  }
+
+  return { nodes, edges };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Stable key for a product state
+ */
+function stateKey(state: string[]): string {
+  return JSON.stringify(state);
+}
+
+/**
+ * Convert a product state to a process-name keyed record
+ */
+function toGlobalState(product: Product, state: string[]): GlobalState {
+  const global: GlobalState = {};
+  product.processes.forEach((p, i) => {
+    global[p.name] = state[i];
+  });
+  return global;
+}
+
+/**
+ * Reconstruct the shortest run that reaches a node, with the global state
+ * after each action. Hidden actions appear as `tau`.
+ */
+function stepsTo(product: Product, graph: ExploredGraph, node: number): TraceStep[] {
+  const steps: TraceStep[] = [];
+  for (let n = node; graph.nodes[n].parent !== -1; n = graph.nodes[n].parent) {
+    const action = graph.nodes[n].action!;
+    steps.push({ action: product.hidden.has(action) ? 'tau' : action, state: toGlobalState(product, graph.nodes[n].state) });
+  }
+  return steps.reverse();
+}
+
+/**
+ * Reconstruct the shortest action trace that reaches a node.
+ * Hidden actions appear as `tau`.
+ */
+function traceTo(product: Product, graph: ExploredGraph, node: number): string[] {
+  return stepsTo(product, graph, node).map(s => s.action);
+}
+
+/**
+ * Format a global state as a readable tuple
+ */
+export function formatGlobalState(state: GlobalState): string {
+  return `(${Object.entries(state).map(([p, s]) => `${p}=${s}`).join(', ')})`;
+}
+
+/**
+ * Format a counterexample as an indented, numbered sequence of steps, one
+ * line per action with the global state it leads to
+ */
+export function formatTrace(steps: TraceStep[]): string {
+  if (steps.length === 0) return '  <initial state>';
+  return steps.map((s, i) => `  ${i + 1}. ${s.action} -> ${formatGlobalState(s.state)}`).join('\n');
+}
+
+/**
+ * Format a property violation as a human-readable message
+ */
+export function formatViolation(violation: Violation): string {
+  return `Property ${violation.property} violated in state ${formatGlobalState(violation.state)}\n  trace: ${violation.trace.join(' -> ')}`;
+}
+
+/**
+ * Format a reachable ERROR as a human-readable message
+ */
+export function formatErrorState(error: ErrorState): string {
+  const trace = error.trace.length > 0 ? error.trace.join(' -> ') : '<initial state>';
+  if (error.property) {
+    return `Property ${error.process} is violated in state ${formatGlobalState(error.state)}\n  trace: ${trace}`;
+  }
+  return `Process ${error.process} reaches ERROR in state ${formatGlobalState(error.state)}\n  trace: ${trace}`;
+}
+
+/**
+ * Format a divergence as a human-readable message
+ */
+export function formatDivergence(divergence: Divergence): string {
+  const trace = divergence.trace.length > 0 ? divergence.trace.join(' -> ') : '<initial state>';
+  return `Divergence in state ${formatGlobalState(divergence.state)}: hidden cycle ${divergence.cycle.join(' -> ')}\n  trace: ${trace}`;
+}
+
+/**
+ * Format a progress violation as a human-readable message
+ */
+export function formatProgressViolation(violation: ProgressViolation): string {
+  const trace = violation.trace.length > 0 ? violation.trace.join(' -> ') : '<initial state>';
+  return `Action ${violation.action} can be starved from state ${formatGlobalState(violation.state)}\n  trace: ${trace}`;
+}
+
+/**
+ * Format a deadlock as a human-readable message
+ */
+export function formatDeadlock(deadlock: Deadlock): string {
+  const trace = deadlock.trace.length > 0 ? deadlock.trace.join(' -> ') : '<initial state>';
+  return `Deadlock reachable in state ${formatGlobalState(deadlock.state)}\n  trace: ${trace}`;
+}
+
+/**
+ * Collect the counterexamples of failed checks in structured form, in the
+ * order deadlocks, ERROR states, LTL violations, progress violations and
+ * divergences
+ */
+export function counterexamples(found: {
+  deadlocks?: Deadlock[];
+  errors?: ErrorState[];
+  violations?: Violation[];
+  progress?: ProgressViolation[];
+  divergences?: Divergence[];
+}): Counterexample[] {
+  const trace = (steps: TraceStep[]): CounterexampleStep[] => steps.map(s => ({ action: s.action, states: s.state }));
+  return [
+    ...(found.deadlocks ?? []).map((d): Counterexample => ({ kind: 'deadlock', trace: trace(d.steps) })),
+    ...(found.errors ?? []).map((e): Counterexample => e.property
+      ? { kind: 'property', property: e.process, trace: trace(e.steps) }
+      : { kind: 'error', process: e.process, trace: trace(e.steps) }),
+    ...(found.violations ?? []).map((v): Counterexample => ({ kind: 'property', property: v.property, trace: trace(v.steps) })),
+    ...(found.progress ?? []).map((p): Counterexample => ({ kind: 'progress', action: p.action, trace: trace(p.steps) })),
+    ...(found.divergences ?? []).map((d): Counterexample => ({ kind: 'divergence', cycle: d.cycle, trace: trace(d.steps) })),
+  ];
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Analysis
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Compose all processes of a specification into one flat LTS over the
+ * reachable product states. States are named by their breadth-first
+ * discovery order, so the initial state is always `0`.
+ * @param spec The specification to compose
+ * @param name Name of the resulting process (default: the composition name, else `SYSTEM`)
+ */
+export function flattenSpec(spec: LTSSpec, name?: string, options: ExploreOptions = {}): ProcessDefinition {
+  const product = buildProduct(spec);
+  const graph = explore(product, options);
+
+  return {
+    name: name ?? spec.composition?.name ?? 'SYSTEM',
+    initialState: '0',
+    transitions: graph.edges.map(e => ({
+      fromState: String(e.from),
+      toState: String(e.to),
+      action: e.action,
+      ...(product.hidden.has(e.action) ? { hidden: true } : {}),
+    })),
+  };
+}
+
+/**
+ * Enumerate every reachable global state of the composed system, in
+ * breadth-first order starting with the initial state. With
+ * `partialOrder`, only the states the reduced exploration visits.
+ * @param spec The LTS specification to explore
+ * @param options Exploration bounds
+ * @throws StateLimitError when more than `maxStates` states are reachable
+ */
+export function reachableStates(spec: LTSSpec, options: ExploreOptions = {}): GlobalState[] {
+  const product = buildProduct(spec);
+  const graph = explore(product, options, true);
+  return graph.nodes.map(node => toGlobalState(product, node.state));
+}
+
+/**
+ * Measure a specification: the size of each process as the product sees it,
+ * the actions processes synchronize on, and the number of reachable global
+ * states. Exploration stops at `maxStates` instead of failing, and the
+ * result says so.
+ * @param spec The LTS specification to measure
+ * @param options Exploration bounds
+ */
+export function specStats(spec: LTSSpec, options: ExploreOptions = {}): SpecStats {
+  const product = buildProduct(spec);
+  const processes = product.processes.map(p => ({
+    name: p.name,
+    states: new Set([p.initialState, ...getAllStates(p)]).size,
+    transitions: p.transitions.length,
+  }));
+  const actions = new Set(product.alphabets.flatMap(alphabet => Array.from(alphabet)));
+  const sharedActions = Array.from(actions).filter(a => product.alphabets.filter(alphabet => alphabet.has(a)).length > 1).sort();
+
+  try {
+    return { processes, sharedActions, reachableStates: reachableStates(spec, options).length, capped: false };
+  } catch (err) {
+    if (!(err instanceof StateLimitError)) throw err;
+    return { processes, sharedActions, reachableStates: err.maxStates, capped: true };
+  }
+}
+
+/**
+ * Find a shortest run of the composed system that starts in its initial
+ * state and comes back to it, and which of its actions every such run fires
+ * @param spec The LTS specification to explore
+ * @param options Exploration bounds
+ * @returns The cycle, or null when the system never returns to its initial state
+ * @throws StateLimitError when more than `maxStates` states are reachable
+ */
+export function shortestCycle(spec: LTSSpec, options: ExploreOptions = {}): SystemCycle | null {
+  const product = buildProduct(spec);
+  const graph = explore(product, options);
+
+  // Breadth-first parents are shortest paths, so close the shallowest one
+  const depth = (node: number) => {
+    let d = 0;
+    for (let n = node; graph.nodes[n].parent !== -1; n = graph.nodes[n].parent) d++;
+    return d;
+  };
+  let best: { from: number; action: string } | undefined;
+  for (const edge of graph.edges) {
+    if (edge.to === 0 && (best === undefined || depth(edge.from) < depth(best.from))) best = edge;
+  }
+  if (best === undefined) return null;
+
+  const trace: string[] = [best.action];
+  for (let n = best.from; graph.nodes[n].parent !== -1; n = graph.nodes[n].parent) {
+    trace.push(graph.nodes[n].action!);
+  }
+  trace.reverse();
+
+  // An action is unavoidable when the initial state cannot be re-entered without it
+  const returnsWithout = (action: string): boolean => {
+    const reached = new Set([0]);
+    const queue = [0];
+    for (let i = 0; i < queue.length; i++) {
+      for (const edge of graph.edges) {
+        if (edge.from !== queue[i] || edge.action === action) continue;
+        if (edge.to === 0) return true;
+        if (!reached.has(edge.to)) {
+          reached.add(edge.to);
+          queue.push(edge.to);
+        }
+      }
+    }
+    return false;
+  };
+  const unavoidable = Array.from(new Set(trace)).filter(action => !returnsWithout(action)).sort();
+
+  return { trace, unavoidable };
+}
+
+/**
+ * Analyze a specification by exploring all reachable global states
+ * @param spec The LTS specification to analyze
+ * @param options Exploration bounds
+ * @returns State-space size, every reachable deadlock and every process that
+ *          can reach ERROR, each with its shortest trace (with `partialOrder`,
+ *          the size of the reduced graph and a trace through it)
+ * @throws StateLimitError when more than `maxStates` states are reachable
+ */
+export function analyze(spec: LTSSpec, options: ExploreOptions = {}): AnalysisResult {
+  const product = buildProduct(spec);
+  const graph = explore(product, options, true);
+  const deadlocks: Deadlock[] = [];
+  const errors: ErrorState[] = [];
+
+  // Nodes are in breadth-first order, so the first hit has the shortest trace.
+  // Under symmetry a process can reach ERROR if any process identical to it can.
+  const groups = options.symmetry ? symmetryGroups(product) : [];
+  product.processes.forEach((proc, p) => {
+    const peers = groups.find(group => group.includes(p)) ?? [p];
+    const node = graph.nodes.findIndex(n => peers.some(q => n.state[q] === 'ERROR'));
+    if (node !== -1) {
+      errors.push({
+        process: proc.name,
+        ...(proc.property ? { property: true } : {}),
+        state: toGlobalState(product, graph.nodes[node].state),
+        trace: traceTo(product, graph, node),
+        steps: stepsTo(product, graph, node),
+      });
+    }
+  });
+
+  const hasSuccessor = new Set(graph.edges.map(e => e.from));
+  graph.nodes.forEach((node, i) => {
+    // A process in ERROR is reported as an error above, not as a deadlock
+    if (hasSuccessor.has(i) || node.state.includes('ERROR')) return;
+    const allTerminal = node.state.every((local, p) => isTerminal(product, p, local));
+    if (!allTerminal) {
+      deadlocks.push({
+        state: toGlobalState(product, node.state),
+        trace: traceTo(product, graph, i),
+        steps: stepsTo(product, graph, i),
+      });
+    }
+  });
+
+  const visible = new Set<string>();
+  for (const alphabet of product.alphabets) {
+    for (const action of alphabet) {
+      if (!product.hidden.has(action)) visible.add(action);
+    }
+  }
+
+  return {
+    stateCount: graph.nodes.length,
+    transitionCount: graph.edges.length,
+    alphabet: Array.from(visible).sort(),
+    deadlocks,
+    errors,
+  };
+}
+
+/**
+ * Check an LTL safety property over every reachable execution. The system is
+ * explored in product with the property's monitor (the formula progressed
+ * along the trace so far); hidden actions do not advance the monitor.
+ * @param spec The LTS specification to check
+ * @param property A formula such as `G(consume -> !put)`, or an already parsed one
+ * @param options Exploration bounds
+ * @returns A shortest violating execution, or null when the property holds
+ * @throws StateLimitError when the product has more than `maxStates` states
+ */
+export function checkLTL(spec: LTSSpec, property: string | LTLFormula, options: ExploreOptions = {}): Violation | null {
+  const formula = typeof property === 'string' ? parseLTL(property) : property;
+  const product = buildProduct(spec);
+  const maxStates = options.maxStates ?? DEFAULT_MAX_STATES;
+  // Identical processes take the same actions, so swapping them keeps every trace
+  const groups = options.symmetry ? symmetryGroups(product) : [];
+  const initial = canonicalState(groups, product.initial);
+
+  const nodes: { state: string[]; monitor: LTLFormula; parent: number; action: string | null }[] = [
+    { state: initial, monitor: formula, parent: -1, action: null },
+  ];
+  const seen = new Set([`${stateKey(initial)}|${formatLTL(formula)}`]);
+
+  for (let current = 0; current < nodes.length; current++) {
+    const node = nodes[current];
+    for (const { action, next } of enabledSteps(product, node.state)) {
+      const step = { action, next: canonicalState(groups, next) };
+      const monitor = product.hidden.has(step.action) ? node.monitor : progress(node.monitor, step.action);
+
+      if (isViolated(monitor)) {
+        const path = [{ action: step.action, state: step.next }];
+        for (let n = current; nodes[n].parent !== -1; n = nodes[n].parent) {
+          path.push({ action: nodes[n].action!, state: nodes[n].state });
+        }
+        const steps = path.reverse().map(s => ({
+          action: product.hidden.has(s.action) ? 'tau' : s.action,
+          state: toGlobalState(product, s.state),
+        }));
+        return {
+          property: typeof property === 'string' ? property : formatLTL(property),
+          state: toGlobalState(product, step.next),
+          trace: steps.map(s => s.action),
+          steps,
+        };
+      }
+
+      const key = `${stateKey(step.next)}|${formatLTL(monitor)}`;
+      if (seen.has(key)) continue;
+      if (nodes.length >= maxStates) {
+        throw new StateLimitError(maxStates);
+      }
+      seen.add(key);
+      nodes.push({ state: step.next, monitor, parent: current, action: step.action });
+    }
+  }
+
+  return null;
+}
+
+/**
+ * Strongly connected components of the explored graph (iterative Tarjan)
+ * @param edges The edges to follow (default: all of them)
+ * @returns The component number of every node
+ */
+function components(graph: ExploredGraph, edges = graph.edges): number[] {
+  const successors: number[][] = graph.nodes.map(() => []);
+  for (const e of edges) successors[e.from].push(e.to);
+
+  const index: number[] = new Array(graph.nodes.length).fill(-1);
+  const low: number[] = new Array(graph.nodes.length).fill(0);
+  const component: number[] = new Array(graph.nodes.length).fill(-1);
+  const onStack: boolean[] = new Array(graph.nodes.length).fill(false);
+  const stack: number[] = [];
+  let counter = 0;
+  let componentCount = 0;
+
+  for (let root = 0; root < graph.nodes.length; root++) {
+    if (index[root] !== -1) continue;
+    const work: { node: number; next: number }[] = [{ node: root, next: 0 }];
+    index[root] = low[root] = counter++;
+    stack.push(root);
+    onStack[root] = true;
+
+    while (work.length > 0) {
+      const frame = work[work.length - 1];
+      if (frame.next < successors[frame.node].length) {
+        const to = successors[frame.node][frame.next++];
+        if (index[to] === -1) {
+          index[to] = low[to] = counter++;
+          stack.push(to);
+          onStack[to] = true;
+          work.push({ node: to, next: 0 });
+        } else if (onStack[to]) {
+          low[frame.node] = Math.min(low[frame.node], index[to]);
+        }
+        continue;
+      }
+
+      work.pop();
+      if (work.length > 0) {
+        const parent = work[work.length - 1].node;
+        low[parent] = Math.min(low[parent], low[frame.node]);
+      }
+      if (low[frame.node] === index[frame.node]) {
+        let member: number;
+        do {
+          member = stack.pop()!;
+          onStack[member] = false;
+          component[member] = componentCount;
+        } while (member !== frame.node);
+        componentCount++;
+      }
+    }
+  }
+
+  return component;
+}
+
+/**
+ * Check FSP-style progress: under fair scheduling every execution eventually
+ * ends up cycling in a terminal strongly connected component of the product
+ * graph, so an action that is missing from some terminal cycle can be
+ * starved forever. Deadlocked states are left to `analyze`.
+ * @param spec The LTS specification to check
+ * @param actions Actions that must keep making progress (default: every visible action)
+ * @param options Exploration bounds
+ * @returns The actions that can be starved, sorted; empty when all make progress
+ */
+export function checkProgress(spec: LTSSpec, actions?: string[], options: ExploreOptions = {}): string[] {
+  return progressViolations(spec, actions, options).map(v => v.action);
+}
+
+/**
+ * Like `checkProgress`, but with a counterexample for each starved action:
+ * the shortest trace into a terminal cycle that never fires it
+ * @returns One violation per starved action, sorted by action
+ */
+export function progressViolations(spec: LTSSpec, actions?: string[], options: ExploreOptions = {}): ProgressViolation[] {
+  const product = buildProduct(spec);
+  const graph = explore(product, options);
+  const component = components(graph);
+
+  const visible = new Set<string>();
+  for (const alphabet of product.alphabets) {
+    for (const action of alphabet) {
+      if (!product.hidden.has(action)) visible.add(action);
+    }
+  }
+  const required = actions ?? Array.from(visible);
+
+  // Actions occurring inside each component, and components with an exit
+  const occurring = new Map<number, Set<string>>();
+  const exits = new Set<number>();
+  const cyclic = new Set<number>();
+  for (const e of graph.edges) {
+    const from = component[e.from];
+    if (from !== component[e.to]) {
+      exits.add(from);
+      continue;
+    }
+    cyclic.add(from);
+    if (!occurring.has(from)) occurring.set(from, new Set());
+    occurring.get(from)!.add(e.action);
+  }
+
+  // Nodes are in breadth-first order, so a component's first node is its nearest
+  const entries = new Map<number, number>();
+  graph.nodes.forEach((_, n) => {
+    if (!entries.has(component[n])) entries.set(component[n], n);
+  });
+
+  const starved = new Map<string, number>();
+  for (const c of cyclic) {
+    if (exits.has(c)) continue;
+    const entry = entries.get(c)!;
+    for (const action of required) {
+      if (occurring.get(c)!.has(action)) continue;
+      starved.set(action, Math.min(starved.get(action) ?? entry, entry));
+    }
+  }
+
+  return Array.from(starved.keys()).sort().map(action => {
+    const node = starved.get(action)!;
+    return {
+      action,
+      state: toGlobalState(product, graph.nodes[node].state),
+      trace: traceTo(product, graph, node),
+      steps: stepsTo(product, graph, node),
+    };
+  });
+}
+
+/**
+ * Find divergences: reachable cycles made only of hidden actions, on which
+ * the system avoids deadlock yet makes no observable progress. Each
+ * strongly connected component of hidden steps is reported once, at the
+ * state of the component that is closest to the initial state.
+ * @param spec The LTS specification to check
+ * @param options Exploration bounds
+ * @returns One divergence per hidden cycle, nearest first; empty when there is none
+ * @throws StateLimitError when more than `maxStates` states are reachable
+ */
+export function checkDivergence(spec: LTSSpec, options: ExploreOptions = {}): Divergence[] {
+  const product = buildProduct(spec);
+  const graph = explore(product, options);
+  const hiddenEdges = graph.edges.filter(e => product.hidden.has(e.action));
+  const component = components(graph, hiddenEdges);
+
+  // Nodes are numbered in breadth-first order, so the first one seen is nearest
+  const entries = new Map<number, number>();
+  for (const e of hiddenEdges) {
+    const c = component[e.from];
+    if (c !== component[e.to]) continue;
+    entries.set(c, Math.min(entries.get(c) ?? e.from, e.from));
+  }
+
+  const divergences: Divergence[] = [];
+  for (const [c, entry] of Array.from(entries).sort(([, a], [, b]) => a - b)) {
+    // Shortest way around: breadth-first inside the component, back to the entry
+    const via = new Map<number, { from: number; action: string }>();
+    const queue = [entry];
+    let closing: { from: number; action: string } | undefined;
+    for (let i = 0; i < queue.length && !closing; i++) {
+      for (const e of hiddenEdges) {
+        if (e.from !== queue[i] || component[e.to] !== c) continue;
+        if (e.to === entry) {
+          closing = e;
+          break;
+        }
+        if (!via.has(e.to)) {
+          via.set(e.to, e);
+          queue.push(e.to);
+        }
+      }
+    }
+
+    const cycle = [closing!.action];
+    for (let n = closing!.from; n !== entry; n = via.get(n)!.from) {
+      cycle.push(via.get(n)!.action);
+    }
+    divergences.push({
+      state: toGlobalState(product, graph.nodes[entry].state),
+      trace: traceTo(product, graph, entry),
+      steps: stepsTo(product, graph, entry),
+      cycle: cycle.reverse(),
+    });
+  }
+
+  return divergences;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Simulation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Start a step-by-step simulation of the composed system in its initial
+ * state. Each step is a synchronized action of the product, exactly as the
+ * analysis explores it, so the simulation can only go where analysis looks.
+ * @param spec The LTS specification to simulate
+ */
+export function simulate(spec: LTSSpec): Simulation {
+  const product = buildProduct(spec);
+  let current = product.initial;
+  let steps = enabledSteps(product, current);
+  const trace: string[] = [];
+
+  return {
+    get state() {
+      return toGlobalState(product, current);
+    },
+    get trace() {
+      return trace.slice();
+    },
+    get choices() {
+      return steps.map(s => ({ action: s.action, hidden: product.hidden.has(s.action), state: toGlobalState(product, s.next) }));
+    },
+    get status(): SimulationStatus {
+      // A process in ERROR has failed, so the run ends there
+      if (current.includes('ERROR')) return 'error';
+      if (steps.length > 0) return 'running';
+      return current.every((local, p) => isTerminal(product, p, local)) ? 'terminated' : 'deadlock';
+    },
+    step(choice: number) {
+      if (current.includes('ERROR')) {
+        throw new Error('The simulation has ended in ERROR');
+      }
+      if (!Number.isInteger(choice) || choice < 0 || choice >= steps.length) {
+        throw new Error(`No step ${choice}: ${steps.length} step(s) are enabled`);
+      }
+      trace.push(steps[choice].action);
+      current = steps[choice].next;
+      steps = enabledSteps(product, current);
+    },
+  };
+}
+
+/**
+ * Generate a random run of the composed system, for feeding other test
+ * harnesses. Each step picks uniformly among the synchronized actions
+ * enabled in the current global state; the run ends early at a deadlock,
+ * once every process has terminated, or when a process reaches ERROR.
+ * @param spec The LTS specification to walk
+ * @param steps Maximum number of actions in the trace
+ * @param random Source of numbers in [0, 1), e.g. a seeded generator (default `Math.random`)
+ * @returns The actions taken, hidden ones under their own names
+ */
+export function randomTrace(spec: LTSSpec, steps: number, random: () => number = Math.random): string[] {
+  if (!Number.isInteger(steps) || steps < 0) {
+    throw new Error(`steps must be a non-negative integer, got ${steps}`);
+  }
+
+  const sim = simulate(spec);
+  for (let i = 0; i < steps && sim.status === 'running'; i++) {
+    const count = sim.choices.length;
+    sim.step(Math.min(Math.floor(random() * count), count - 1));
+  }
+  return sim.trace;
+}
@@ -0,0 +1,92 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Code Generator Backends
+// A registry of the generators that `generate --backend` can select, so that
+// other targets can be plugged in next to the built-in Go ones
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { transpile, BACKENDS, Backend, GeneratorOptions, LTSSpec } from './transpiler';
+import { generateRust } from './rust';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A code generator selectable by name
+ */
+export interface CodeBackend {
+  /** Name given to `--backend` */
+  name: string;
+  /** One line shown by `--list-backends` */
+  description: string;
+  /**
+   * Generate the source for a specification. Generator options a backend
+   * has no use for are ignored; those it cannot honour should be rejected.
+   */
+  generate(spec: LTSSpec, options: GeneratorOptions): string;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Registry
+// ─────────────────────────────────────────────────────────────────────────────
+
+const registry = new Map<string, CodeBackend>();
+
+/**
+ * Make a backend selectable by its name
+ */
+export function registerBackend(backend: CodeBackend): void {
+  if (!/^[a-z][a-z0-9_-]*$/.test(backend.name)) {
+    throw new Error(`Backend name ${JSON.stringify(backend.name)} must be lowercase letters, digits, - or _`);
+  }
+  if (registry.has(backend.name)) {
+    throw new Error(`Backend ${backend.name} is already registered; rename one of them`);
+  }
+  registry.set(backend.name, backend);
+}
+
+/**
+ * Look up a backend by name
+ */
+export function findBackend(name: string): CodeBackend {
+  const backend = registry.get(name);
+  if (!backend) {
+    throw new Error(`Unknown backend "${name}". Available: ${Array.from(registry.keys()).join(', ')}`);
+  }
+  return backend;
+}
+
+/**
+ * Every registered backend, built-in ones first, then in registration order
+ */
+export function listBackends(): CodeBackend[] {
+  return Array.from(registry.values());
+}
+
+/**
+ * Whether a backend is one of the Go concurrency models of the transpiler
+ * itself, which the Go-only features (split output, tests, ...) support
+ */
+export function isGoBackend(name: string): name is Backend {
+  return (BACKENDS as string[]).includes(name);
+}
+
+const DESCRIPTIONS: Record<Backend, string> = {
+  channels: 'Go, a channel per shared action (default)',
+  actor: 'Go, an inbox of tagged messages per process',
+  mutex: 'Go, every state in one struct stepped under a lock',
+};
+
+for (const name of BACKENDS) {
+  registerBackend({
+    name,
+    description: DESCRIPTIONS[name],
+    generate: (spec, options) => transpile(spec, { ...options, backend: name }),
+  });
+}
+
+registerBackend({
+  name: 'rust',
+  description: 'Rust, a std::thread per process and a sync_channel per shared action',
+  generate: generateRust,
+});
@@ -0,0 +1,250 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Spec Builder
+// Fluent construction of specifications in code, for tools that generate
+// models and would rather not print a spec only to have it parsed again
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, ActionDeclaration, ActionKind } from './transpiler';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * What a transition may declare besides its source, action and target
+ */
+export type TransitionOptions = Pick<Transition, 'guard' | 'update' | 'variable' | 'weight' | 'hidden'>;
+
+/**
+ * States every process may enter without declaring them
+ */
+const TERMINAL_STATES = ['STOP', 'ERROR'];
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Processes
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Builds one process. A state is declared by making it the initial state,
+ * by naming it in addState, or by an earlier transition leading to it, and
+ * transitions may only leave declared states.
+ */
+export class ProcessBuilder {
+  private initialState?: string;
+  private readonly states = new Set<string>(TERMINAL_STATES);
+  private readonly transitions: Transition[] = [];
+  private readonly variables: Record<string, number | string> = {};
+  /** How the process takes part in each action it declared a kind for */
+  readonly kinds = new Map<string, ActionKind>();
+
+  constructor(readonly name: string) {
+    if (!name) throw new Error('A process needs a name');
+  }
+
+  /**
+   * Set the state the process starts in, declaring it
+   */
+  withInitial(state: string): this {
+    if (this.initialState !== undefined && this.initialState !== state) {
+      throw new Error(`Process ${this.name}: initial state is already ${this.initialState}`);
+    }
+    this.initialState = state;
+    this.states.add(state);
+    return this;
+  }
+
+  /**
+   * Declare states up front, so that transitions may leave them before any
+   * transition leads to them
+   */
+  addState(...states: string[]): this {
+    for (const state of states) this.states.add(state);
+    return this;
+  }
+
+  /**
+   * Declare an integer variable of the process with its initial value
+   */
+  withVariable(name: string, initial: number | string): this {
+    if (name in this.variables) throw new Error(`Process ${this.name}: variable ${name} is declared twice`);
+    this.variables[name] = initial;
+    return this;
+  }
+
+  /**
+   * Add a transition `from -action-> to`, declaring its target
+   * @param kind How the process takes part in the action: `send` makes it
+   *   the action's sender, `internal` keeps the action to this process alone;
+   *   left out, the generator classifies the action as usual
+   */
+  addTransition(from: string, action: string, to: string, kind?: ActionKind, options: TransitionOptions = {}): this {
+    if (!this.states.has(from)) {
+      throw new Error(`Process ${this.name}: transition ${from} -${action}-> ${to} leaves undeclared state ${from}; declare it with withInitial or addState first`);
+    }
+    if (TERMINAL_STATES.includes(from)) {
+      throw new Error(`Process ${this.name}: ${from} is terminal and cannot have outgoing transitions`);
+    }
+    if (!action) throw new Error(`Process ${this.name}: transition from ${from} needs an action`);
+    if (kind !== undefined) {
+      const declared = this.kinds.get(action);
+      if (declared !== undefined && declared !== kind) {
+        throw new Error(`Process ${this.name}: action ${action} is declared both ${declared} and ${kind}`);
+      }
+      this.kinds.set(action, kind);
+    }
+    this.transitions.push({ fromState: from, toState: to, action, ...options });
+    this.states.add(to);
+    return this;
+  }
+
+  /**
+   * The process definition built so far
+   */
+  build(): ProcessDefinition {
+    if (this.initialState === undefined) throw new Error(`Process ${this.name} has no initial state`);
+    const proc: ProcessDefinition = {
+      name: this.name,
+      initialState: this.initialState,
+      transitions: this.transitions.map(t => ({ ...t })),
+    };
+    if (Object.keys(this.variables).length > 0) proc.variables = { ...this.variables };
+    return proc;
+  }
+}
+
+/**
+ * Start building a process
+ */
+export function newProcess(name: string): ProcessBuilder {
+  return new ProcessBuilder(name);
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Specifications
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Builds a specification from processes, action declarations and an
+ * optional composition, checking each addition against what is already there
+ */
+export class SpecBuilder {
+  private readonly processes: ProcessDefinition[] = [];
+  private readonly kinds = new Map<string, Map<string, ActionKind>>();
+  private readonly actions: Record<string, ActionDeclaration> = {};
+  private readonly constants: Record<string, number> = {};
+  private composition?: { name: string; processes: string[] };
+
+  /**
+   * Add a process, from a builder or as a finished definition
+   */
+  addProcess(process: ProcessBuilder | ProcessDefinition): this {
+    const proc = process instanceof ProcessBuilder ? process.build() : process;
+    if (this.processes.some(p => p.name === proc.name)) {
+      throw new Error(`Process ${proc.name} is added twice`);
+    }
+    const kinds = process instanceof ProcessBuilder ? process.kinds : new Map<string, ActionKind>();
+
+    for (const [action, kind] of kinds) {
+      const others = this.processes.filter(p => p.transitions.some(t => t.action === action)).map(p => p.name);
+      if (kind === 'internal' && others.length > 0) {
+        throw new Error(`Process ${proc.name}: action ${action} is declared internal but ${others.join(', ')} also use(s) it`);
+      }
+      if (kind === 'send') {
+        const sender = this.sender(action);
+        if (sender !== undefined) throw new Error(`Action ${action} has two senders, ${sender} and ${proc.name}`);
+      }
+    }
+    for (const action of new Set(proc.transitions.map(t => t.action))) {
+      const owner = Array.from(this.kinds).find(([, k]) => k.get(action) === 'internal');
+      if (owner) throw new Error(`Process ${proc.name}: action ${action} is internal to ${owner[0]}`);
+    }
+
+    this.processes.push(proc);
+    this.kinds.set(proc.name, new Map(kinds));
+    return this;
+  }
+
+  /**
+   * Declare the properties of an action, such as its payload or buffer
+   */
+  declareAction(name: string, declaration: ActionDeclaration): this {
+    this.actions[name] = { ...this.actions[name], ...declaration };
+    return this;
+  }
+
+  /**
+   * Declare a named integer constant
+   */
+  withConstant(name: string, value: number): this {
+    if (!Number.isInteger(value)) throw new Error(`Constant ${name} must be an integer`);
+    this.constants[name] = value;
+    return this;
+  }
+
+  /**
+   * Compose processes already added into the system to run
+   */
+  compose(name: string, ...processes: string[]): this {
+    if (this.composition) throw new Error(`The spec already composes ${this.composition.name}`);
+    for (const proc of processes) {
+      if (!this.processes.some(p => p.name === proc)) {
+        throw new Error(`Composition ${name} refers to process ${proc}, which has not been added`);
+      }
+    }
+    this.composition = { name, processes };
+    return this;
+  }
+
+  /**
+   * Process that declared itself the sender of an action, if any
+   */
+  private sender(action: string): string | undefined {
+    return Array.from(this.kinds).find(([, k]) => k.get(action) === 'send')?.[0];
+  }
+
+  /**
+   * Sender of an action no process claimed, when some declared themselves
+   * receivers: the first of the others alphabetically, as the generator
+   * would pick among them
+   */
+  private defaultSender(spec: LTSSpec, action: string): string | undefined {
+    const receivers = Array.from(this.kinds).filter(([, k]) => k.get(action) === 'receive').map(([name]) => name);
+    if (receivers.length === 0) return undefined;
+    const users = spec.processes.filter(p => p.transitions.some(t => t.action === action)).map(p => p.name);
+    const candidates = users.filter(name => !receivers.includes(name)).sort();
+    if (candidates.length === 0) throw new Error(`Action ${action} has receivers but no process that can send it`);
+    return candidates[0];
+  }
+
+  /**
+   * The specification built so far, ready for transpile and the other
+   * commands that take a spec
+   */
+  build(): LTSSpec {
+    if (this.processes.length === 0) throw new Error('A spec needs at least one process');
+    const spec: LTSSpec = { processes: this.processes.map(p => ({ ...p, transitions: p.transitions.map(t => ({ ...t })) })) };
+
+    const actions: Record<string, ActionDeclaration> = {};
+    for (const [name, declaration] of Object.entries(this.actions)) actions[name] = { ...declaration };
+    for (const action of new Set(spec.processes.flatMap(p => p.transitions.map(t => t.action)))) {
+      const sender = this.sender(action) ?? this.defaultSender(spec, action);
+      if (sender === undefined) continue;
+      if (actions[action]?.sender !== undefined && actions[action].sender !== sender) {
+        throw new Error(`Action ${action} is declared with sender ${actions[action].sender}, but ${sender} sends it`);
+      }
+      actions[action] = { ...actions[action], sender };
+    }
+
+    if (Object.keys(this.constants).length > 0) spec.constants = { ...this.constants };
+    if (Object.keys(actions).length > 0) spec.actions = actions;
+    if (this.composition) spec.composition = { name: this.composition.name, processes: [...this.composition.processes] };
+    return spec;
+  }
+}
+
+/**
+ * Start building a specification
+ */
+export function newSpec(): SpecBuilder {
+  return new SpecBuilder();
+}
@@ -0,0 +1,109 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Build Cache
+// Reuses the output of an earlier build when neither the inputs, the options
+// nor the generator have changed since
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { createHash } from 'crypto';
+import { mkdirSync, readdirSync, readFileSync, writeFileSync } from 'fs';
+import { tmpdir } from 'os';
+import { dirname, extname, join } from 'path';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A file written by a build
+ */
+export interface CachedFile {
+  /** Where it was written; none for standard output */
+  path?: string;
+  content: string;
+}
+
+/**
+ * Everything a build produced, replayed on a cache hit
+ */
+export interface CacheEntry {
+  files: CachedFile[];
+  /** Warnings the build printed, printed again on a hit */
+  warnings: string[];
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Bumped whenever the layout of a cache entry changes
+ */
+const CACHE_FORMAT = '1';
+
+/**
+ * Where entries are kept when no cache directory is given
+ */
+export const DEFAULT_CACHE_DIR = join(tmpdir(), 'anvilts-cache');
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Keys
+// ─────────────────────────────────────────────────────────────────────────────
+
+let fingerprint: string | undefined;
+
+/**
+ * Hash of the generator's own sources, so that a changed generator never
+ * reuses output of the old one
+ */
+function generatorFingerprint(): string {
+  if (fingerprint === undefined) {
+    // Loaders that run the sources as ES modules leave __dirname undefined
+    const dir = typeof __dirname === 'string' ? __dirname : dirname(process.argv[1]);
+    const hash = createHash('sha256');
+    for (const file of readdirSync(dir).sort()) {
+      if (extname(file) === '.ts' || extname(file) === '.js') {
+        hash.update(file).update(readFileSync(join(dir, file)));
+      }
+    }
+    fingerprint = hash.digest('hex');
+  }
+  return fingerprint;
+}
+
+/**
+ * Key of a build: a SHA-256 over everything that affects its output, such as
+ * the input contents and the command line, together with the generator
+ */
+export function cacheKey(parts: string[]): string {
+  const hash = createHash('sha256').update(CACHE_FORMAT).update(generatorFingerprint());
+  for (const part of parts) {
+    // Length prefixes keep ['ab', 'c'] and ['a', 'bc'] apart
+    hash.update(`${part.length}:`).update(part);
+  }
+  return hash.digest('hex');
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Storage
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Look up a build in the cache
+ * @returns The stored entry, or undefined on a miss (or an unreadable entry)
+ */
+export function readCache(dir: string, key: string): CacheEntry | undefined {
+  try {
+    const entry = JSON.parse(readFileSync(join(dir, `${key}.json`), 'utf-8'));
+    return Array.isArray(entry.files) && Array.isArray(entry.warnings) ? entry : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+/**
+ * Store the output of a build, creating the cache directory if needed
+ */
+export function writeCache(dir: string, key: string, entry: CacheEntry): void {
+  mkdirSync(dir, { recursive: true });
+  writeFileSync(join(dir, `${key}.json`), JSON.stringify(entry), 'utf-8');
+}
@@ -0,0 +1,1224 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// AnvilTS Command Line Interface
+// Generate Go code, analyze and visualize LTS specifications
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { mkdirSync, readFileSync, writeFileSync } from 'fs';
+import { basename, dirname, extname, join, resolve } from 'path';
+import { parseArgs } from 'util';
+import { createInterface } from 'readline';
+import { transpile, transpileBench, transpileFiles, transpileFilesParallel, transpileParallel, transpileTests, toSpec, GeneratorOptions, LoggerMode, LTSSpec } from './transpiler';
+import { analyze, formatDeadlock, formatErrorState, checkLTL, formatViolation, Violation, progressViolations, formatProgressViolation, checkDivergence, formatDivergence, simulate, formatGlobalState, Simulation, randomTrace, specStats, counterexamples } from './analysis';
+import { autoNamespace, expandSpec, mergeSpecs } from './transforms';
+import { generateDOT, generateDOTFrames, generateMermaid, generatePlantUML, generateSVG, readTrace } from './graph';
+import { isIR, fromIR, writeJSON } from './json-ir';
+import { generatePromela } from './promela';
+import { generateTLA } from './tla';
+import { writeCSV, writeTable } from './table';
+import { readAut, writeAut } from './aldebaran';
+import { parseFSP, writeFSP } from './fsp';
+import { formatFSP } from './format';
+import { validateSpec, formatDiagnostic } from './validate';
+import { minimizeSpec, minimizeWeakSpec, determinizeSpec, divergentStates, traceEquivalent } from './equivalence';
+import { watchInput, timestamp } from './watch';
+import { CacheEntry, DEFAULT_CACHE_DIR, cacheKey, readCache, writeCache } from './cache';
+import { findBackend, isGoBackend, listBackends } from './backends';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+const USAGE = `
+AnvilTS - LTS-to-Go Transpiler
+
+Usage:
+  npx tsx src/cli.ts [generate] [options] <input.json> [output.go]
+  npx tsx src/cli.ts [generate] [options] <a.lts> <b.lts> ... -o <output.go>
+  npx tsx src/cli.ts graph [--format=dot|svg|mermaid|plantuml] <input.json> [output]
+  npx tsx src/cli.ts graph --animate --trace <trace.jsonl> <input.json> <frames-dir>
+  npx tsx src/cli.ts export [--format=json|promela|tla|aut|fsp] <input.json> [output]
+  npx tsx src/cli.ts compare [--max-depth=N] <a.json> <b.json>
+  npx tsx src/cli.ts table <input.json> [-o transitions.csv]
+  npx tsx src/cli.ts show <input.json>
+  npx tsx src/cli.ts simulate <input.json>
+  npx tsx src/cli.ts trace [--steps=N] [--seed=N] <input.json>
+  npx tsx src/cli.ts stats [--max-states=N] [--por] [--symmetry] <input.json>
+  npx tsx src/cli.ts check [--output=text|json] [--property LTL] <input.json>
+  npx tsx src/cli.ts fmt [--check] <input.lts>
+
+Commands:
+  generate     Transpile the LTS specification to Go (default command)
+  graph        Export each process's state machine as a diagram
+  export       Convert the specification to another model format
+  compare      Check that two specifications have the same visible traces
+  table        List every transition as CSV (process,from_state,action,kind,to_state)
+  show         Print an aligned table of each process's transitions
+  simulate     Step through the composed system interactively, one action at a time
+  trace        Print a random run of the composed system, one action per line
+  stats        Count each process's states and transitions, the shared
+               actions, and the reachable global states
+  check        Run every model check and print the counterexamples, as text
+               or as JSON for other tools
+  fmt          Print an FSP specification in canonical layout; with --check,
+               print nothing and fail if it is not already formatted
+
+An input file of - reads the specification from standard input; generate
+also reads it when no input file is given and the output goes to stdout.
+Given several input files (with -o), generate merges them into one system.
+
+Generate Options:
+  --buffer-size N   Capacity of shared action channels (default: 0, unbuffered)
+  --context         Thread a cancelable context.Context through every process
+  --run-for D       Stop the whole system after duration D, e.g. 2s (turns on
+                    --context)
+  --signals         Stop the system cleanly on Ctrl-C or SIGTERM (turns on --context)
+  --shutdown-after-steps N
+                    Stop each process after N transitions, unwinding blocked peers
+  --action-timeout D
+                    Give up on a channel operation after duration D (e.g. 5s, 10ms)
+  --nonblocking     Wait on channel operations in short attempts; a process that
+                    makes no progress for deadlockThreshold attempts returns
+  --logger MODE     Log runtime events with fmt (default) or slog
+  --package NAME    Name of the generated Go package (default: main)
+  --no-main         Export Run(ctx) error instead of func main (needs --package)
+  --counters        Count action occurrences, readable through ActionCounts()
+  --expvar ADDR     Publish action counts and process states under expvar,
+                    served at http://ADDR/debug/vars
+  --prometheus ADDR Serve action counters and process state gauges for
+                    Prometheus at http://ADDR/metrics
+  --hooks           Report every transition to a package-level Observer, if set
+  --trace-file PATH Write every transition the program takes to PATH, one JSON
+                    object per line, to reproduce the run later
+  --replay PATH     Follow a trace written with --trace-file: take each
+                    recorded choice and fire transitions in recorded order
+  --seed N          Make choices in an order drawn from seed N, so runs repeat
+  --fair            Make choices prefer the actions they have fired least often
+  --int-states      Switch on typed integer state constants instead of strings
+  --backend NAME    Communicate over a channel per action (channels, default),
+                    an inbox per process (actor) or one locked struct (mutex),
+                    write Rust instead (rust), or generate with a backend
+                    registered by a plugin
+  --plugin FILE     Load a module that registers more backends (repeatable)
+  --list-backends   List the available backends and exit
+  --supervise       Run a process that panics again from its initial state
+  --max-restarts N  Give up on a supervised process after N restarts (default 3)
+  --split           Write one file per process plus channels.go and main.go
+                    into the output directory
+  --emit-tests      Also write a Go test per process next to the output
+                    (output_test.go, or main_test.go with --split)
+  --emit-bench      Also write a benchmark of full system cycles next to the
+                    output (turns on --context and --counters)
+  -o, --output PATH Output file (or directory with --split), instead of [output.go]
+  --watch           Regenerate whenever the input file changes (needs an output)
+  --cache-dir DIR   Keep the build cache in DIR (default: anvilts-cache in the
+                    system temp directory)
+  --no-cache        Always regenerate, without reading or writing the cache
+  --jobs N          Generate the process functions on N worker threads; the
+                    output is the same for any N
+  --check-deadlock  Refuse to generate code if a deadlock or ERROR is reachable
+  --verify[=warn]   Run the deadlock, ERROR, safety property and progress checks
+                    first and refuse to generate code if one fails; with =warn,
+                    print what they find and generate anyway
+  --check-progress  Refuse to generate code if some action can be starved forever
+  --por             Explore with partial-order reduction for --check-deadlock
+  --symmetry        Count states that only permute identical processes once,
+                    for --check-deadlock and --property
+  --check-divergence
+                    Refuse to generate code if the system can cycle on hidden
+                    actions forever
+  --property LTL    Refuse to generate code if a safety property is violated,
+                    e.g. "G(put -> X !put)" (repeatable)
+  --const NAME=N    Override a spec constant (repeatable)
+  --auto-namespace[=apply]
+                    Report actions that several processes use without being
+                    declared shared; with =apply, give each process its own
+                    copy, prefixed with its name (P.tick)
+  --strict          Treat validation warnings (e.g. unreachable states) as errors
+
+Common Options:
+  --minimize        Minimize each process modulo strong bisimulation first
+  --minimize-weak   Compose the system and minimize it modulo weak bisimulation,
+                    treating hidden actions as tau
+  --determinize     Make each process deterministic by subset construction first
+  --dialect NAME    Input dialect: json, aut, fsp (default: from the file
+                    extension, .aut -> aut, .lts/.fsp -> fsp, otherwise json)
+
+Graph Options:
+  --format FORMAT   Diagram format: dot, svg, mermaid, plantuml (default: dot)
+  --animate         Write one DOT file per step of a run recorded with
+                    generate --trace-file, highlighting the states the system
+                    is in and the transitions it just took
+  --trace PATH      The trace file to animate
+
+Export Options:
+  --format FORMAT   Model format: json (versioned IR, default), promela (SPIN),
+                    tla (TLA+ for TLC), aut (Aldebaran; multiple processes
+                    are composed first), fsp (the system that runs, as FSP)
+
+Input Format (Structured):
+{
+  "processes": [
+    {
+      "name": "P",
+      "initialState": "0",
+      "transitions": [
+        { "fromState": "0", "toState": "1", "action": "a" },
+        { "fromState": "1", "toState": "0", "action": "b" }
+      ]
+    }
+  ]
+}
+
+Input Format (Flat):
+[
+  { "process": "P", "fromState": "0", "toState": "1", "action": "a" },
+  { "process": "P", "fromState": "1", "toState": "0", "action": "b" }
+]
+
+Input Format (FSP):
+  BUFF = (in -> out -> BUFF).
+  ||SYS = (P || Q)/{new/old}\\{hidden}.
+
+Input Format (Aldebaran):
+  Files ending in .aut are read as a single process: des (0, 2, 2) / (0, "a", 1) / ...
+
+Examples:
+  npx tsx src/cli.ts spec.json output.go
+  npx tsx src/cli.ts graph --format=dot spec.json spec.dot
+`;
+
+/**
+ * Diagram exporters selectable with `graph --format`
+ */
+const GRAPH_FORMATS: Record<string, (spec: LTSSpec) => string> = {
+  dot: generateDOT,
+  svg: source => generateSVG(source),
+  mermaid: generateMermaid,
+  plantuml: generatePlantUML,
+};
+
+/**
+ * Model exporters selectable with `export --format`
+ */
+const EXPORT_FORMATS: Record<string, (spec: LTSSpec) => string> = {
+  json: writeJSON,
+  promela: generatePromela,
+  tla: generateTLA,
+  aut: writeAut,
+  fsp: writeFSP,
+};
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Record the line that declares each transition of a structured JSON spec,
+ * and the line of its composition, for diagnostics. JSON.parse keeps no
+ * positions, so the transitions are matched in document order with their
+ * `"fromState"` keys; when the counts disagree the spec is left without lines.
+ */
+function recordLines(spec: LTSSpec, content: string): LTSSpec {
+  const lines: number[] = [];
+  let line = 1;
+  let scanned = 0;
+  for (const match of content.matchAll(/"fromState"\s*:/g)) {
+    for (; scanned < match.index!; scanned++) {
+      if (content[scanned] === '\n') line++;
+    }
+    lines.push(line);
+  }
+
+  const transitions = spec.processes.flatMap(p => p.transitions);
+  if (transitions.length === lines.length) {
+    transitions.forEach((t, i) => { t.line = lines[i]; });
+  }
+  const composition = content.match(/"composition"\s*:/);
+  if (spec.composition && composition) {
+    spec.composition.line = content.slice(0, composition.index!).split('\n').length;
+  }
+  return spec;
+}
+
+/**
+ * Input dialects selectable with `--dialect`, each turning file contents into a spec
+ */
+const DIALECTS: Record<string, (content: string, inputFile: string, partial: boolean) => LTSSpec> = {
+  json: content => {
+    const data = JSON.parse(content);
+    if (isIR(data)) return fromIR(data);
+    return Array.isArray(data) ? toSpec(data) : recordLines(toSpec(data), content);
+  },
+  // The single process of an .aut file is named after the file
+  aut: (content, inputFile) => inputFile === STDIN
+    ? readAut(content)
+    : readAut(content, basename(inputFile, extname(inputFile)).toUpperCase().replace(/[^A-Z0-9_]/g, '_')),
+  fsp: (content, _, partial) => parseFSP(content, { partial }),
+};
+
+/**
+ * Dialect implied by a file extension when `--dialect` is not given
+ */
+const EXTENSION_DIALECTS: Record<string, string> = {
+  '.aut': 'aut',
+  '.lts': 'fsp',
+  '.fsp': 'fsp',
+};
+
+/**
+ * Input file argument that stands for standard input
+ */
+const STDIN = '-';
+
+/**
+ * Parse the contents of a specification in the given dialect
+ * @param inputFile Where the contents came from, used for naming and errors
+ * @param partial The contents are one of several files making up the system
+ */
+function parseSpec(content: string, dialect: string, inputFile: string, partial = false): LTSSpec {
+  const reader = DIALECTS[dialect];
+  if (!reader) {
+    throw new Error(`Unknown dialect "${dialect}". Available: ${Object.keys(DIALECTS).join(', ')}`);
+  }
+  if (content.trim().length === 0) {
+    throw new Error(`${inputFile === STDIN ? 'Standard input' : inputFile} contains no specification`);
+  }
+  return reader(content, inputFile, partial);
+}
+
+/**
+ * Read a specification in any supported dialect: JSON (structured, flat or
+ * IR), Aldebaran `.aut` or FSP. `-` reads standard input, which is JSON
+ * unless `--dialect` says otherwise.
+ */
+function loadSpec(inputFile: string, dialect?: string, partial = false): LTSSpec {
+  const name = dialect ?? EXTENSION_DIALECTS[extname(inputFile)] ?? 'json';
+  const content = readFileSync(inputFile === STDIN ? 0 : inputFile, 'utf-8');
+  return parseSpec(content, name, inputFile, partial);
+}
+
+/**
+ * Read a system split over several files, each in its own dialect, and
+ * merge them into one specification
+ */
+function loadSpecs(inputFiles: string[], dialect?: string): LTSSpec {
+  if (inputFiles.length === 1) return loadSpec(inputFiles[0], dialect);
+  return mergeSpecs(inputFiles.map(file => loadSpec(file, dialect, true)), inputFiles);
+}
+
+/**
+ * Parse repeated `NAME=VALUE` constant overrides
+ */
+function parseConstants(pairs: string[] = []): Record<string, number> {
+  const constants: Record<string, number> = {};
+  for (const pair of pairs) {
+    const match = /^([A-Za-z_][A-Za-z0-9_]*)=(-?\d+)$/.exec(pair);
+    if (!match) {
+      throw new Error(`Invalid constant "${pair}", expected NAME=INTEGER`);
+    }
+    constants[match[1]] = Number(match[2]);
+  }
+  return constants;
+}
+
+/**
+ * Format a count with the singular or plural form of its noun
+ */
+function countOf(count: number, singular: string, plural = `${singular}s`): string {
+  return `${count} ${count === 1 ? singular : plural}`;
+}
+
+/**
+ * A repeatable source of numbers in [0, 1) (mulberry32)
+ */
+function seededRandom(seed: number): () => number {
+  let s = seed >>> 0;
+  return () => {
+    s = (s + 0x6d2b79f5) >>> 0;
+    let t = s;
+    t = Math.imul(t ^ (t >>> 15), t | 1);
+    t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+    return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+  };
+}
+
+/**
+ * Apply the minimization requested on the command line
+ */
+function applyMinimization(
+  source: LTSSpec,
+  flags: { 'minimize'?: boolean; 'minimize-weak'?: boolean; 'determinize'?: boolean }
+): LTSSpec {
+  const spec = flags['determinize'] ? determinizeSpec(source) : source;
+  if (flags['minimize-weak']) {
+    const minimized = minimizeWeakSpec(spec);
+    for (const proc of minimized.processes) {
+      const divergent = divergentStates(proc);
+      if (divergent.length > 0) {
+        console.error(`Warning: Process ${proc.name}: divergent (tau cycle) in ${divergent.length === 1 ? 'state' : 'states'} ${divergent.join(', ')}`);
+      }
+    }
+    return minimized;
+  }
+  return flags['minimize'] ? minimizeSpec(spec) : spec;
+}
+
+/**
+ * Write command output to a file, or stdout when no file is given
+ */
+function writeOutput(content: string, outputFile: string | undefined, description: string): void {
+  if (outputFile) {
+    writeFileSync(outputFile, content, 'utf-8');
+    console.log(`✓ ${description} written to: ${outputFile}`);
+  } else {
+    process.stdout.write(content);
+  }
+}
+
+/**
+ * Load a plugin module, which registers its backends as it is loaded
+ */
+function loadPlugin(file: string): void {
+  try {
+    require(resolve(file));
+  } catch (err) {
+    throw new Error(`Cannot load plugin ${file}: ${err instanceof Error ? err.message : err}`);
+  }
+}
+
+/**
+ * Write generated files into a directory, creating it if needed
+ */
+function writeFiles(files: Map<string, string>, outputDir: string): void {
+  mkdirSync(outputDir, { recursive: true });
+  for (const [name, content] of files) {
+    writeFileSync(join(outputDir, name), content, 'utf-8');
+  }
+  console.log(`✓ Generated Go code written to: ${outputDir} (${Array.from(files.keys()).join(', ')})`);
+}
+
+/**
+ * Write out a cached build again: its warnings, then its files
+ */
+function replayBuild(entry: CacheEntry): void {
+  for (const warning of entry.warnings) {
+    console.error(warning);
+  }
+  const paths: string[] = [];
+  for (const file of entry.files) {
+    if (file.path === undefined) {
+      process.stdout.write(file.content);
+      continue;
+    }
+    mkdirSync(dirname(file.path), { recursive: true });
+    writeFileSync(file.path, file.content, 'utf-8');
+    paths.push(file.path);
+  }
+  if (paths.length > 0) {
+    console.log(`✓ Unchanged, cached output written to: ${paths.join(', ')}`);
+  }
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Commands
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * generate: transpile a specification to Go
+ */
+async function runGenerate(argv: string[]): Promise<void> {
+  const { values: flags, positionals: args } = parseArgs({
+    // A bare --auto-namespace only reports, and a bare --verify fails on any problem
+    args: argv.map(arg => arg === '--auto-namespace' ? '--auto-namespace=report' : arg === '--verify' ? '--verify=fail' : arg),
+    allowPositionals: true,
+    options: {
+      'buffer-size': { type: 'string' },
+      'context': { type: 'boolean' },
+      'run-for': { type: 'string' },
+      'signals': { type: 'boolean' },
+      'shutdown-after-steps': { type: 'string' },
+      'action-timeout': { type: 'string' },
+      'nonblocking': { type: 'boolean' },
+      'logger': { type: 'string' },
+      'package': { type: 'string' },
+      'no-main': { type: 'boolean' },
+      'split': { type: 'boolean' },
+      'emit-tests': { type: 'boolean' },
+      'emit-bench': { type: 'boolean' },
+      'counters': { type: 'boolean' },
+      'expvar': { type: 'string' },
+      'prometheus': { type: 'string' },
+      'hooks': { type: 'boolean' },
+      'trace-file': { type: 'string' },
+      'replay': { type: 'string' },
+      'seed': { type: 'string' },
+      'fair': { type: 'boolean' },
+      'int-states': { type: 'boolean' },
+      'backend': { type: 'string' },
+      'plugin': { type: 'string', multiple: true },
+      'list-backends': { type: 'boolean' },
+      'supervise': { type: 'boolean' },
+      'max-restarts': { type: 'string' },
+      'output': { type: 'string', short: 'o' },
+      'watch': { type: 'boolean' },
+      'check-deadlock': { type: 'boolean' },
+      'verify': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+      'dialect': { type: 'string' },
+      'auto-namespace': { type: 'string' },
+      'strict': { type: 'boolean' },
+      'minimize': { type: 'boolean' },
+      'minimize-weak': { type: 'boolean' },
+      'determinize': { type: 'boolean' },
+      'property': { type: 'string', multiple: true },
+      'check-progress': { type: 'boolean' },
+      'por': { type: 'boolean' },
+      'symmetry': { type: 'boolean' },
+      'check-divergence': { type: 'boolean' },
+      'cache-dir': { type: 'string' },
+      'no-cache': { type: 'boolean' },
+      'jobs': { type: 'string' },
+    },
+  });
+
+  for (const plugin of flags['plugin'] ?? []) {
+    loadPlugin(plugin);
+  }
+  if (flags['list-backends']) {
+    const backends = listBackends();
+    const width = Math.max(...backends.map(b => b.name.length));
+    for (const backend of backends) {
+      console.log(`${backend.name.padEnd(width)}  ${backend.description}`);
+    }
+    return;
+  }
+  const backend = findBackend(flags['backend'] ?? 'channels');
+  if (!isGoBackend(backend.name)) {
+    for (const flag of ['split', 'emit-tests', 'emit-bench', 'jobs'] as const) {
+      if (flags[flag] !== undefined) {
+        throw new Error(`generate --${flag} needs a Go backend, not ${backend.name}`);
+      }
+    }
+  }
+
+  // Without an input file, read a piped specification
+  if (args.length < 1 && process.stdin.isTTY) {
+    throw new Error('generate requires an input file (or - for standard input)');
+  }
+  // With -o every argument is an input; otherwise a second one is the output
+  if (flags['output'] === undefined && args.length > 2) {
+    throw new Error('generate takes several input files only when the output is given with -o');
+  }
+  const inputs = flags['output'] !== undefined && args.length > 0 ? args : [args[0] ?? STDIN];
+  const output = flags['output'] ?? args[1];
+  if (flags['split'] && output === undefined) {
+    throw new Error('generate --split requires an output directory');
+  }
+  if (flags['emit-tests'] && output === undefined) {
+    throw new Error('generate --emit-tests requires an output file');
+  }
+  if (flags['emit-bench'] && output === undefined) {
+    throw new Error('generate --emit-bench requires an output file');
+  }
+  if (flags['watch'] && output === undefined) {
+    throw new Error('generate --watch requires an output file');
+  }
+  if (flags['watch'] && inputs.includes(STDIN)) {
+    throw new Error('generate --watch cannot watch standard input');
+  }
+  const namespacing = flags['auto-namespace'];
+  if (namespacing !== undefined && namespacing !== 'report' && namespacing !== 'apply') {
+    throw new Error(`generate --auto-namespace takes no value or apply, not ${namespacing}`);
+  }
+  const verify = flags['verify'];
+  if (verify !== undefined && verify !== 'fail' && verify !== 'warn') {
+    throw new Error(`generate --verify takes no value or warn, not ${verify}`);
+  }
+
+  const options: GeneratorOptions = {};
+  if (flags['buffer-size'] !== undefined) {
+    options.bufferSize = Number(flags['buffer-size']);
+  }
+  if (flags['context']) {
+    options.context = true;
+  }
+  if (flags['run-for'] !== undefined) {
+    // The run time is up when main cancels the processes' context
+    options.context = true;
+    options.runFor = flags['run-for'];
+  }
+  if (flags['signals']) {
+    // A signal cancels the processes' context
+    options.context = true;
+    options.signals = true;
+  }
+  if (flags['shutdown-after-steps'] !== undefined) {
+    options.shutdownAfterSteps = Number(flags['shutdown-after-steps']);
+  }
+  if (flags['action-timeout'] !== undefined) {
+    options.actionTimeout = flags['action-timeout'];
+  }
+  if (flags['nonblocking']) {
+    options.nonblocking = true;
+  }
+  if (flags['logger'] !== undefined) {
+    options.logger = flags['logger'] as LoggerMode;
+  }
+  if (flags['package'] !== undefined) {
+    options.package = flags['package'];
+  }
+  if (flags['no-main']) {
+    options.noMain = true;
+  }
+  if (flags['counters']) {
+    options.counters = true;
+  }
+  if (flags['expvar'] !== undefined) {
+    options.expvar = flags['expvar'];
+  }
+  if (flags['prometheus'] !== undefined) {
+    options.prometheus = flags['prometheus'];
+  }
+  if (flags['hooks']) {
+    options.hooks = true;
+  }
+  if (flags['trace-file'] !== undefined) {
+    options.traceFile = flags['trace-file'];
+  }
+  if (flags['replay'] !== undefined) {
+    options.replay = flags['replay'];
+  }
+  if (flags['seed'] !== undefined) {
+    options.seed = Number(flags['seed']);
+  }
+  if (flags['fair']) {
+    options.fair = true;
+  }
+  if (flags['int-states']) {
+    options.intStates = true;
+  }
+  if (flags['backend'] !== undefined && isGoBackend(backend.name)) {
+    options.backend = backend.name;
+  }
+  if (flags['supervise']) {
+    options.supervise = true;
+  }
+  if (flags['max-restarts'] !== undefined) {
+    options.maxRestarts = Number(flags['max-restarts']);
+  }
+  if (flags['emit-bench']) {
+    // The benchmark stops the system through its context and counts cycles
+    options.context = true;
+    options.counters = true;
+  }
+
+  // Standard input cannot be hashed up front, so it is always generated afresh
+  const cacheDir = flags['no-cache'] || inputs.includes(STDIN) ? undefined : flags['cache-dir'] ?? DEFAULT_CACHE_DIR;
+  const settings = { ...flags, 'cache-dir': undefined, 'no-cache': undefined, 'watch': undefined, 'jobs': undefined };
+  const jobs = flags['jobs'] === undefined ? undefined : Number(flags['jobs']);
+
+  // Runs the whole pipeline; in watch mode it runs again on every change
+  const build = async (): Promise<void> => {
+    const key = cacheDir === undefined ? undefined : cacheKey([
+      JSON.stringify({ inputs, output, settings }),
+      ...inputs.map(file => readFileSync(file, 'utf-8')),
+      ...(flags['plugin'] ?? []).map(file => readFileSync(file, 'utf-8')),
+    ]);
+    const cached = key === undefined ? undefined : readCache(cacheDir!, key);
+    if (cached) {
+      replayBuild(cached);
+      return;
+    }
+
+    const entry: CacheEntry = { files: [], warnings: [] };
+    const emit = (content: string, file: string | undefined, description: string) => {
+      writeOutput(content, file, description);
+      entry.files.push({ path: file, content });
+    };
+
+    let spec = expandSpec(loadSpecs(inputs, flags['dialect']), parseConstants(flags['const']));
+
+    // Actions that only share a name are reported, and renamed apart with =apply
+    if (namespacing !== undefined) {
+      const namespaced = autoNamespace(spec);
+      for (const { action, names } of namespaced.renamed) {
+        const users = Object.keys(names).join(', ');
+        const targets = Object.values(names).join(', ');
+        const line = namespacing === 'apply'
+          ? `Renamed action ${action}, which ${users} use without declaring it shared, to ${targets}`
+          : `Warning: action ${action} is used by ${users} without being declared shared; --auto-namespace=apply renames it to ${targets}`;
+        console.error(line);
+        entry.warnings.push(line);
+      }
+      if (namespacing === 'apply') spec = namespaced.spec;
+    }
+
+    const diagnostics = validateSpec(spec);
+    for (const diagnostic of diagnostics) {
+      console.error(formatDiagnostic(diagnostic));
+      entry.warnings.push(formatDiagnostic(diagnostic));
+    }
+    const fatal = diagnostics.filter(d => d.severity === 'error' || flags['strict']);
+    if (fatal.length > 0) {
+      throw new Error(`${countOf(fatal.length, 'problem')} found, no code generated`);
+    }
+
+    spec = applyMinimization(spec, flags);
+
+    // A failed check prints its counterexamples and stops generation, except
+    // that under --verify=warn the checks it turned on only warn
+    const report = (details: string[], summary: string, fatal: boolean) => {
+      for (const detail of details) {
+        console.error(detail);
+      }
+      if (fatal) {
+        throw new Error(`${summary}, no code generated`);
+      }
+      console.error(`Warning: ${summary}`);
+      entry.warnings.push(...details, `Warning: ${summary}`);
+    };
+
+    if (flags['check-deadlock'] || verify !== undefined) {
+      const result = analyze(spec, { partialOrder: flags['por'], symmetry: flags['symmetry'] });
+      if (result.deadlocks.length > 0 || result.errors.length > 0) {
+        report(
+          [...result.deadlocks.map(formatDeadlock), ...result.errors.map(formatErrorState)],
+          `${countOf(result.deadlocks.length, 'deadlock')} and ${countOf(result.errors.length, 'ERROR state')} found`,
+          flags['check-deadlock'] || verify === 'fail',
+        );
+      }
+    }
+
+    if (flags['check-progress'] || verify !== undefined) {
+      const starved = progressViolations(spec);
+      if (starved.length > 0) {
+        report(
+          starved.map(formatProgressViolation),
+          `Progress violation: ${starved.map(v => v.action).join(', ')} can be starved`,
+          flags['check-progress'] || verify === 'fail',
+        );
+      }
+    }
+
+    if (flags['check-divergence']) {
+      const divergences = checkDivergence(spec);
+      if (divergences.length > 0) {
+        for (const divergence of divergences) {
+          console.error(formatDivergence(divergence));
+        }
+        throw new Error(`${countOf(divergences.length, 'divergence')} found, no code generated`);
+      }
+    }
+
+    const violations = (flags['property'] ?? [])
+      .map(property => checkLTL(spec, property, { symmetry: flags['symmetry'] }))
+      .filter((violation): violation is Violation => violation !== null);
+    if (violations.length > 0) {
+      report(violations.map(formatViolation), `${countOf(violations.length, 'property violation')} found`, verify !== 'warn');
+    }
+
+    if (flags['split']) {
+      const files = jobs === undefined ? transpileFiles(spec, options) : await transpileFilesParallel(spec, options, jobs);
+      writeFiles(files, output!);
+      for (const [name, content] of files) {
+        entry.files.push({ path: join(output!, name), content });
+      }
+    } else if (!isGoBackend(backend.name)) {
+      emit(backend.generate(spec, options), output, `Generated ${backend.name} code`);
+    } else {
+      const code = jobs === undefined ? transpile(spec, options) : await transpileParallel(spec, options, jobs);
+      emit(code, output, 'Generated Go code');
+    }
+    if (flags['emit-tests']) {
+      const testFile = flags['split']
+        ? join(output!, options.noMain ? 'run_test.go' : 'main_test.go')
+        : output!.replace(/(\.go)?$/, '_test.go');
+      emit(transpileTests(spec, options), testFile, 'Generated tests');
+    }
+    if (flags['emit-bench']) {
+      const benchFile = flags['split']
+        ? join(output!, 'bench_test.go')
+        : output!.replace(/(\.go)?$/, '_bench_test.go');
+      emit(transpileBench(spec, options), benchFile, 'Generated benchmark');
+    }
+
+    if (key !== undefined) {
+      writeCache(cacheDir!, key, entry);
+    }
+  };
+
+  if (!flags['watch']) {
+    await build();
+    return;
+  }
+
+  const rebuild = async () => {
+    try {
+      await build();
+      console.log(`[${timestamp()}] ✓ Regenerated from ${inputs.join(', ')}`);
+    } catch (err) {
+      console.error(`[${timestamp()}] ✗ ${err instanceof Error ? err.message : err} (previous output kept)`);
+    }
+  };
+  await rebuild();
+  console.log(`Watching ${inputs.join(', ')} for changes (Ctrl-C to stop)`);
+  for (const input of inputs) {
+    watchInput(input, rebuild);
+  }
+}
+
+/**
+ * Shared body of the commands that render a spec with a `--format` exporter
+ */
+function runFormatCommand(
+  command: string,
+  argv: string[],
+  formats: Record<string, (spec: LTSSpec) => string>,
+  defaultFormat: string,
+  description: string
+): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'format': { type: 'string', default: defaultFormat },
+      'dialect': { type: 'string' },
+      'minimize': { type: 'boolean' },
+      'minimize-weak': { type: 'boolean' },
+      'determinize': { type: 'boolean' },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error(`${command} requires an input file`);
+  }
+
+  const format = flags['format'] as string;
+  const exporter = formats[format];
+  if (!exporter) {
+    throw new Error(`Unknown ${command} format "${format}". Available: ${Object.keys(formats).join(', ')}`);
+  }
+
+  const spec = applyMinimization(loadSpec(args[0], flags['dialect']), flags);
+  writeOutput(exporter(spec), args[1], description);
+}
+
+/**
+ * graph: export process state machines as diagrams
+ */
+function runGraph(argv: string[]): void {
+  if (argv.includes('--animate')) {
+    runAnimation(argv);
+    return;
+  }
+  runFormatCommand('graph', argv, GRAPH_FORMATS, 'dot', 'Graph');
+}
+
+/**
+ * graph --animate: write a DOT frame per step of a recorded trace
+ */
+function runAnimation(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'animate': { type: 'boolean' },
+      'trace': { type: 'string' },
+      'format': { type: 'string', default: 'dot' },
+      'dialect': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+    },
+  });
+
+  if (flags['trace'] === undefined) {
+    throw new Error('graph --animate requires a trace file (--trace PATH)');
+  }
+  if (args.length < 2) {
+    throw new Error('graph --animate requires an input file and an output directory');
+  }
+  if (flags['format'] !== 'dot') {
+    throw new Error(`graph --animate writes DOT frames, not ${flags['format']}`);
+  }
+
+  const spec = expandSpec(loadSpec(args[0], flags['dialect']), parseConstants(flags['const']));
+  const frames = generateDOTFrames(spec, readTrace(readFileSync(flags['trace'], 'utf-8')));
+  if (frames.length === 0) {
+    throw new Error(`${flags['trace']} records no steps`);
+  }
+  const width = Math.max(3, String(frames.length).length);
+  mkdirSync(args[1], { recursive: true });
+  frames.forEach((frame, i) => {
+    writeFileSync(join(args[1], `step-${String(i + 1).padStart(width, '0')}.dot`), frame, 'utf-8');
+  });
+  console.log(`✓ ${countOf(frames.length, 'frame')} written to: ${args[1]}`);
+}
+
+/**
+ * export: convert the specification to another model format
+ */
+function runExport(argv: string[]): void {
+  runFormatCommand('export', argv, EXPORT_FORMATS, 'json', 'Model');
+}
+
+/**
+ * compare: check that two specifications have the same visible traces
+ */
+function runCompare(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'dialect': { type: 'string' },
+      'max-depth': { type: 'string' },
+    },
+  });
+
+  if (args.length < 2) {
+    throw new Error('compare requires two input files');
+  }
+
+  const maxDepth = flags['max-depth'] !== undefined ? Number(flags['max-depth']) : undefined;
+  const result = traceEquivalent(loadSpec(args[0], flags['dialect']), loadSpec(args[1], flags['dialect']), { maxDepth });
+
+  if (result.equivalent) {
+    console.log(`✓ ${args[0]} and ${args[1]} are trace equivalent`);
+    return;
+  }
+  const only = result.possibleIn === 'first' ? args[0] : args[1];
+  throw new Error(`Not trace equivalent: ${result.trace!.join(' -> ')} is only possible in ${only}`);
+}
+
+/**
+ * table: list every transition as CSV
+ */
+function runTable(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'output': { type: 'string', short: 'o' },
+      'dialect': { type: 'string' },
+      'minimize': { type: 'boolean' },
+      'minimize-weak': { type: 'boolean' },
+      'determinize': { type: 'boolean' },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('table requires an input file');
+  }
+
+  const spec = applyMinimization(loadSpec(args[0], flags['dialect']), flags);
+  writeOutput(writeCSV(spec), flags['output'] ?? args[1], 'Transition table');
+}
+
+/**
+ * show: print each process's transitions as an aligned text table
+ */
+function runShow(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'output': { type: 'string', short: 'o' },
+      'dialect': { type: 'string' },
+      'minimize': { type: 'boolean' },
+      'minimize-weak': { type: 'boolean' },
+      'determinize': { type: 'boolean' },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('show requires an input file');
+  }
+
+  const spec = applyMinimization(loadSpec(args[0], flags['dialect']), flags);
+  writeOutput(writeTable(spec), flags['output'] ?? args[1], 'Transition table');
+}
+
+/**
+ * Print where a simulation stands: the actions it can take next, or why it has ended
+ */
+function printSimulation(sim: Simulation): void {
+  switch (sim.status) {
+    case 'running': {
+      console.log('Enabled actions:');
+      const counts = new Map<string, number>();
+      for (const c of sim.choices) counts.set(c.action, (counts.get(c.action) ?? 0) + 1);
+      sim.choices.forEach((c, i) => {
+        // The same action can lead to several states; tell them apart
+        const target = counts.get(c.action)! > 1 ? ` -> ${formatGlobalState(c.state)}` : '';
+        console.log(`  ${i + 1}. ${c.action}${c.hidden ? ' (hidden)' : ''}${target}`);
+      });
+      break;
+    }
+    case 'terminated':
+      console.log('✓ Every process has stopped');
+      break;
+    case 'deadlock':
+      console.log(`✗ Deadlock: no action is enabled in state ${formatGlobalState(sim.state)}`);
+      break;
+    case 'error': {
+      const failed = Object.entries(sim.state).filter(([, local]) => local === 'ERROR').map(([name]) => name);
+      console.log(`✗ Process ${failed.join(', ')} reached ERROR`);
+      break;
+    }
+  }
+}
+
+/**
+ * simulate: step through the composed system, reading the chosen step
+ * numbers from standard input
+ */
+function runSimulate(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'dialect': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('simulate requires an input file');
+  }
+  if (args[0] === STDIN) {
+    throw new Error('simulate reads its steps from standard input, so the specification must come from a file');
+  }
+
+  const sim = simulate(expandSpec(loadSpec(args[0], flags['dialect']), parseConstants(flags['const'])));
+  console.log(`State: ${formatGlobalState(sim.state)}`);
+  printSimulation(sim);
+  if (sim.status !== 'running') return;
+
+  const interactive = process.stdin.isTTY;
+  const rl = createInterface({ input: process.stdin, output: process.stdout, terminal: interactive, prompt: '> ' });
+  const prompt = () => interactive && rl.prompt();
+  console.log('Pick an action by number, or q to quit');
+  prompt();
+
+  rl.on('line', line => {
+    // Lines piped in after the system stopped may still arrive once closed
+    if (sim.status !== 'running') return;
+    const answer = line.trim();
+    if (answer === 'q' || answer === 'quit') {
+      rl.close();
+      return;
+    }
+    const choice = Number(answer);
+    if (!Number.isInteger(choice) || choice < 1 || choice > sim.choices.length) {
+      console.log(`Pick a number from 1 to ${sim.choices.length}`);
+      prompt();
+      return;
+    }
+
+    const before = sim.state;
+    const action = sim.choices[choice - 1].action;
+    sim.step(choice - 1);
+    console.log(`${action}:`);
+    for (const [name, local] of Object.entries(sim.state)) {
+      console.log(`  ${name}: ${before[name] === local ? local : `${before[name]} -> ${local}`}`);
+    }
+    printSimulation(sim);
+    if (sim.status === 'running') {
+      prompt();
+    } else {
+      rl.close();
+    }
+  });
+}
+
+/**
+ * trace: print a random run of the composed system
+ */
+function runTrace(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'steps': { type: 'string', default: '20' },
+      'seed': { type: 'string' },
+      'dialect': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('trace requires an input file');
+  }
+  const seed = flags['seed'] !== undefined ? Number(flags['seed']) : undefined;
+  if (seed !== undefined && !Number.isSafeInteger(seed)) {
+    throw new Error(`--seed must be an integer, got ${flags['seed']}`);
+  }
+
+  const spec = expandSpec(loadSpec(args[0], flags['dialect']), parseConstants(flags['const']));
+  const trace = randomTrace(spec, Number(flags['steps']), seed !== undefined ? seededRandom(seed) : Math.random);
+  for (const action of trace) {
+    console.log(action);
+  }
+}
+
+/**
+ * stats: report how big the specification and its state space are
+ */
+function runStats(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'max-states': { type: 'string' },
+      'por': { type: 'boolean' },
+      'symmetry': { type: 'boolean' },
+      'dialect': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('stats requires an input file');
+  }
+  const maxStates = flags['max-states'] !== undefined ? Number(flags['max-states']) : undefined;
+  if (maxStates !== undefined && (!Number.isInteger(maxStates) || maxStates < 1)) {
+    throw new Error(`--max-states must be a positive integer, got ${flags['max-states']}`);
+  }
+
+  const stats = specStats(expandSpec(loadSpec(args[0], flags['dialect']), parseConstants(flags['const'])), {
+    maxStates,
+    partialOrder: flags['por'],
+    symmetry: flags['symmetry'],
+  });
+  const width = Math.max(...stats.processes.map(p => p.name.length));
+  console.log(`Processes: ${stats.processes.length}`);
+  for (const p of stats.processes) {
+    console.log(`  ${p.name.padEnd(width)}  ${p.states} states, ${p.transitions} transitions`);
+  }
+  const shared = stats.sharedActions.length > 0 ? ` (${stats.sharedActions.join(', ')})` : '';
+  console.log(`Shared actions: ${stats.sharedActions.length}${shared}`);
+  const reductions = [flags['por'] ? 'partial-order' : '', flags['symmetry'] ? 'symmetry' : ''].filter(Boolean);
+  const label = reductions.length > 0 ? `States visited with ${reductions.join(' and ')} reduction` : 'Reachable states';
+  console.log(`${label}: ${stats.capped ? '>= ' : ''}${stats.reachableStates}`);
+}
+
+/**
+ * check: run every model check and report the counterexamples
+ */
+function runCheck(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'output': { type: 'string', default: 'text' },
+      'property': { type: 'string', multiple: true },
+      'por': { type: 'boolean' },
+      'symmetry': { type: 'boolean' },
+      'dialect': { type: 'string' },
+      'const': { type: 'string', multiple: true },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('check requires an input file');
+  }
+  if (flags['output'] !== 'text' && flags['output'] !== 'json') {
+    throw new Error(`check --output must be text or json, got ${flags['output']}`);
+  }
+
+  const spec = expandSpec(loadSpec(args[0], flags['dialect']), parseConstants(flags['const']));
+  const result = analyze(spec, { partialOrder: flags['por'], symmetry: flags['symmetry'] });
+  const violations = (flags['property'] ?? [])
+    .map(property => checkLTL(spec, property, { symmetry: flags['symmetry'] }))
+    .filter((violation): violation is Violation => violation !== null);
+  const progress = progressViolations(spec);
+  const divergences = checkDivergence(spec);
+
+  const problems = result.deadlocks.length + result.errors.length + violations.length + progress.length + divergences.length;
+  if (flags['output'] === 'json') {
+    const found = counterexamples({ deadlocks: result.deadlocks, errors: result.errors, violations, progress, divergences });
+    console.log(JSON.stringify(found, null, 2));
+  } else {
+    for (const line of [
+      ...result.deadlocks.map(formatDeadlock),
+      ...result.errors.map(formatErrorState),
+      ...violations.map(formatViolation),
+      ...progress.map(formatProgressViolation),
+      ...divergences.map(formatDivergence),
+    ]) {
+      console.log(line);
+    }
+  }
+  if (problems > 0) {
+    throw new Error(`${countOf(problems, 'problem')} found`);
+  }
+  if (flags['output'] === 'text') {
+    console.log(`✓ No deadlock, ERROR, property, progress or divergence problem in ${countOf(result.stateCount, 'state')}`);
+  }
+}
+
+/**
+ * fmt: print an FSP specification in canonical layout, or check that it is
+ */
+function runFmt(argv: string[]): void {
+  const { values: flags, positionals: args } = parseArgs({
+    args: argv,
+    allowPositionals: true,
+    options: {
+      'check': { type: 'boolean' },
+      'dialect': { type: 'string' },
+    },
+  });
+
+  if (args.length < 1) {
+    throw new Error('fmt requires an input file');
+  }
+  const dialect = flags['dialect'] ?? EXTENSION_DIALECTS[extname(args[0])] ?? (args[0] === STDIN ? 'fsp' : 'json');
+  if (dialect !== 'fsp') {
+    throw new Error(`fmt only formats FSP; ${args[0]} is read as ${dialect} (use --dialect=fsp to format it anyway)`);
+  }
+
+  const source = readFileSync(args[0] === STDIN ? 0 : args[0], 'utf-8');
+  const formatted = formatFSP(source);
+  if (!flags['check']) {
+    process.stdout.write(formatted);
+  } else if (formatted !== source) {
+    throw new Error(`${args[0] === STDIN ? 'Standard input' : args[0]} is not formatted; run fmt to see the canonical layout`);
+  }
+}
+
+const COMMANDS: Record<string, (argv: string[]) => void | Promise<void>> = {
+  generate: runGenerate,
+  graph: runGraph,
+  export: runExport,
+  compare: runCompare,
+  table: runTable,
+  show: runShow,
+  simulate: runSimulate,
+  trace: runTrace,
+  stats: runStats,
+  check: runCheck,
+  fmt: runFmt,
+};
+
+// ─────────────────────────────────────────────────────────────────────────────
+// CLI Entry Point
+// ─────────────────────────────────────────────────────────────────────────────
+
+if (require.main === module) {
+  const argv = process.argv.slice(2);
+
+  if ((argv.length < 1 && process.stdin.isTTY) || argv[0] === '--help' || argv[0] === '-h') {
+    console.log(USAGE);
+    process.exit(1);
+  }
+
+  // Without a known command name, behave like `generate`
+  const command = COMMANDS[argv[0]];
+
+  // Commands may finish asynchronously, so their errors are caught either way
+  Promise.resolve()
+    .then(() => command ? command(argv.slice(1)) : runGenerate(argv))
+    .catch(err => {
+      console.error(`Error: ${err instanceof Error ? err.message : err}`);
+      process.exit(1);
+    });
+}
@@ -0,0 +1,377 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTS Equivalences
+// Strong and weak bisimulation minimization and related behavioural equivalences
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, analyzeActionUsage, getAllStates, isSharedAction } from './transpiler';
+import { normalizeSpec, unfoldVariables } from './transforms';
+import { flattenSpec } from './analysis';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A labelled successor of a state
+ */
+interface Successor {
+  label: string;
+  to: string;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Every state of a process, initial state first
+ */
+function statesOf(proc: ProcessDefinition): string[] {
+  return Array.from(new Set([proc.initialState, ...getAllStates(proc)]));
+}
+
+/**
+ * Natural ordering so that `2` sorts before `10`
+ */
+function compareStates(a: string, b: string): number {
+  return a.localeCompare(b, undefined, { numeric: true });
+}
+
+/**
+ * Equivalence label of a transition: transitions only match when they agree
+ * on the action, on being hidden and on the payload variable they bind
+ */
+function transitionLabel(t: Transition): string {
+  return JSON.stringify([t.action, t.hidden ?? false, t.variable ?? null]);
+}
+
+/**
+ * Outgoing labelled transitions of every state
+ */
+function successors(proc: ProcessDefinition): Map<string, Successor[]> {
+  const map = new Map<string, Successor[]>(statesOf(proc).map(s => [s, []]));
+  for (const t of proc.transitions) {
+    map.get(t.fromState)!.push({ label: transitionLabel(t), to: t.toState });
+  }
+  return map;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Partition Refinement
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Compute the coarsest stable partition of `states` with respect to `edges`:
+ * two states stay in one block only while, for every label, they can move
+ * into the same set of blocks. Blocks are split by successor signature until
+ * no block splits any further.
+ * @returns The block number of every state
+ */
+function refinePartition(states: string[], edges: Map<string, Successor[]>): Map<string, number> {
+  let blockOf = new Map<string, number>(states.map(s => [s, 0]));
+  let blockCount = 1;
+
+  for (;;) {
+    const signatures = new Map<string, number>();
+    const next = new Map<string, number>();
+
+    for (const state of states) {
+      const moves = new Set(edges.get(state)!.map(e => `${e.label}>${blockOf.get(e.to)}`));
+      const signature = `${blockOf.get(state)}|${Array.from(moves).sort().join(',')}`;
+      if (!signatures.has(signature)) signatures.set(signature, signatures.size);
+      next.set(state, signatures.get(signature)!);
+    }
+
+    blockOf = next;
+    if (signatures.size === blockCount) return blockOf;
+    blockCount = signatures.size;
+  }
+}
+
+/**
+ * Build the quotient of a process under a partition. A merged state is named
+ * by joining its members with `+` in natural order (e.g. `1+3`); a block that
+ * contains `STOP` is named `STOP` so it stays terminal.
+ */
+function quotient(proc: ProcessDefinition, blockOf: Map<string, number>, transitions: Transition[]): ProcessDefinition {
+  const members = new Map<number, string[]>();
+  for (const state of statesOf(proc)) {
+    const block = blockOf.get(state)!;
+    if (!members.has(block)) members.set(block, []);
+    members.get(block)!.push(state);
+  }
+
+  const names = new Map<number, string>();
+  for (const [block, states] of members) {
+    names.set(block, states.includes('STOP') ? 'STOP' : states.sort(compareStates).join('+'));
+  }
+  const nameOf = (state: string) => names.get(blockOf.get(state)!)!;
+
+  const seen = new Set<string>();
+  const merged: Transition[] = [];
+  for (const t of transitions) {
+    const from = nameOf(t.fromState);
+    const to = nameOf(t.toState);
+    const key = `${from}|${transitionLabel(t)}|${to}`;
+    if (seen.has(key)) continue;
+    seen.add(key);
+    merged.push({ ...t, fromState: from, toState: to });
+  }
+
+  return { ...proc, initialState: nameOf(proc.initialState), transitions: merged };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Minimization
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Minimize a process modulo strong bisimulation, merging states whose
+ * action-labelled behaviour is identical. Hidden steps count as ordinary
+ * actions here.
+ * @param proc The process to minimize
+ * @returns The smallest strongly bisimilar process; states that were not
+ *          merged keep their names
+ */
+export function minimize(proc: ProcessDefinition): ProcessDefinition {
+  const blockOf = refinePartition(statesOf(proc), successors(proc));
+  return quotient(proc, blockOf, proc.transitions);
+}
+
+/**
+ * States reachable from `state` through hidden steps alone, including itself
+ */
+function tauClosure(proc: ProcessDefinition, state: string): Set<string> {
+  const closure = new Set([state]);
+  const queue = [state];
+  for (let i = 0; i < queue.length; i++) {
+    for (const t of proc.transitions) {
+      if (t.hidden && t.fromState === queue[i] && !closure.has(t.toState)) {
+        closure.add(t.toState);
+        queue.push(t.toState);
+      }
+    }
+  }
+  return closure;
+}
+
+/**
+ * Find divergent states: states on a cycle of hidden steps, from which the
+ * process can keep moving forever without any visible action
+ * @returns Divergent state names in natural order
+ */
+export function divergentStates(proc: ProcessDefinition): string[] {
+  return statesOf(proc)
+    .filter(state => proc.transitions.some(t =>
+      t.hidden && t.fromState === state && tauClosure(proc, t.toState).has(state)
+    ))
+    .sort(compareStates);
+}
+
+/**
+ * Minimize a process modulo weak bisimulation. Hidden steps are treated as
+ * unobservable `tau`: chains of them collapse, and only the visible actions
+ * (and the choices hidden steps resolve) remain. Divergence is not lost: a
+ * merged state that contains a tau cycle keeps a hidden self-loop, and
+ * `divergentStates` reports where such cycles are.
+ * Hidden actions of a single process may still synchronize with its peers,
+ * so apply this to a composed system (see `minimizeWeakSpec`).
+ * @param proc The process to minimize
+ * @returns The smallest weakly bisimilar process
+ */
+export function minimizeWeak(proc: ProcessDefinition): ProcessDefinition {
+  const states = statesOf(proc);
+  const closures = new Map(states.map(s => [s, tauClosure(proc, s)]));
+
+  // Weak moves: s =a=> t is tau* a tau*, and s =tau=> t is tau*
+  const weak = new Map<string, Successor[]>();
+  for (const state of states) {
+    const moves: Successor[] = [];
+    for (const via of closures.get(state)!) {
+      moves.push({ label: 'tau', to: via });
+      for (const t of proc.transitions) {
+        if (t.hidden || t.fromState !== via) continue;
+        for (const target of closures.get(t.toState)!) {
+          moves.push({ label: transitionLabel(t), to: target });
+        }
+      }
+    }
+    weak.set(state, moves);
+  }
+
+  const blockOf = refinePartition(states, weak);
+  const divergent = new Set(divergentStates(proc));
+
+  // Hidden steps inside a block disappear, except on a cycle (divergence)
+  const kept = proc.transitions.filter(t =>
+    !t.hidden ||
+    blockOf.get(t.fromState) !== blockOf.get(t.toState) ||
+    (divergent.has(t.fromState) && divergent.has(t.toState))
+  );
+  return quotient(proc, blockOf, kept);
+}
+
+/**
+ * Compose a specification into a single flat process and minimize it modulo
+ * weak bisimulation, leaving only the system's observable behaviour
+ */
+export function minimizeWeakSpec(source: LTSSpec): LTSSpec {
+  const spec = normalizeSpec(source);
+  const system = spec.processes.length === 1 ? unfoldVariables(spec.processes[0]) : flattenSpec(spec);
+  const { composition: _, ...rest } = spec;
+  return { ...rest, processes: [minimizeWeak(system)] };
+}
+
+/**
+ * Minimize every process of a specification. Strong bisimulation is preserved
+ * by parallel composition, so the composed system behaves exactly the same.
+ * Integer variables are unfolded into states first.
+ */
+export function minimizeSpec(source: LTSSpec): LTSSpec {
+  const spec = normalizeSpec(source);
+  return { ...spec, processes: spec.processes.map(p => minimize(unfoldVariables(p))) };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Trace Equivalence
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Result of comparing the traces of two specifications
+ */
+export interface TraceComparison {
+  equivalent: boolean;
+  /** A shortest trace only one of the two systems can perform */
+  trace?: string[];
+  /** Which system can perform the distinguishing trace */
+  possibleIn?: 'first' | 'second';
+}
+
+/**
+ * Options bounding a trace comparison
+ */
+export interface TraceOptions {
+  /** Only compare traces up to this length (default: all traces) */
+  maxDepth?: number;
+}
+
+/**
+ * Determinize a process by subset construction over its visible actions.
+ * Hidden steps are absorbed into the subsets, so the result has the same
+ * visible traces and at most one transition per action from every state.
+ * Each state is named after the original states it stands for, joined with `+`.
+ */
+export function determinize(proc: ProcessDefinition): ProcessDefinition {
+  const closureOf = (states: Iterable<string>): string[] => {
+    const closure = new Set<string>();
+    for (const state of states) {
+      for (const reached of tauClosure(proc, state)) closure.add(reached);
+    }
+    return Array.from(closure).sort(compareStates);
+  };
+
+  const initial = closureOf([proc.initialState]);
+  const name = (subset: string[]) => subset.join('+');
+  const seen = new Set([name(initial)]);
+  const queue = [initial];
+  const transitions: Transition[] = [];
+
+  for (let i = 0; i < queue.length; i++) {
+    const subset = queue[i];
+    const targets = new Map<string, Set<string>>();
+    for (const t of proc.transitions) {
+      if (t.hidden || !subset.includes(t.fromState)) continue;
+      if (!targets.has(t.action)) targets.set(t.action, new Set());
+      targets.get(t.action)!.add(t.toState);
+    }
+
+    for (const [action, states] of targets) {
+      const next = closureOf(states);
+      if (!seen.has(name(next))) {
+        seen.add(name(next));
+        queue.push(next);
+      }
+      transitions.push({ fromState: name(subset), toState: name(next), action });
+    }
+  }
+
+  return { name: proc.name, initialState: name(initial), transitions };
+}
+
+/**
+ * Determinize every process of a specification (see `determinize`). Integer
+ * variables are unfolded into states first. Absorbing a hidden action that
+ * processes synchronize on would change the system, so when there is one the
+ * system is composed into a single flat process and determinized as a whole.
+ * Either way the visible traces stay the same.
+ */
+export function determinizeSpec(source: LTSSpec): LTSSpec {
+  const spec = normalizeSpec(source);
+  const usage = analyzeActionUsage(spec);
+  const hiddenShared = spec.processes.some(p =>
+    p.transitions.some(t => t.hidden && isSharedAction(usage.get(t.action)!))
+  );
+  if (hiddenShared) {
+    const { composition: _, ...rest } = spec;
+    return { ...rest, processes: [determinize(flattenSpec(spec))] };
+  }
+  return {
+    ...spec,
+    processes: spec.processes.map(proc => {
+      // Keep what determinizing does not touch, such as an extended alphabet
+      const { variables: _, ...kept } = proc;
+      return { ...kept, ...determinize(unfoldVariables(proc)) };
+    }),
+  };
+}
+
+/**
+ * Compare the visible traces of two composed systems. Both are flattened and
+ * determinized, then explored in lock step; the first action enabled on one
+ * side only yields a shortest distinguishing trace.
+ * @param a The first specification
+ * @param b The second specification
+ * @param options Optional depth bound
+ */
+export function traceEquivalent(a: LTSSpec, b: LTSSpec, options: TraceOptions = {}): TraceComparison {
+  const left = determinize(flattenSpec(a));
+  const right = determinize(flattenSpec(b));
+
+  const outgoing = (proc: ProcessDefinition) => {
+    const map = new Map<string, Map<string, string>>();
+    for (const t of proc.transitions) {
+      if (!map.has(t.fromState)) map.set(t.fromState, new Map());
+      map.get(t.fromState)!.set(t.action, t.toState);
+    }
+    return (state: string) => map.get(state) ?? new Map<string, string>();
+  };
+  const leftMoves = outgoing(left);
+  const rightMoves = outgoing(right);
+
+  const start = { left: left.initialState, right: right.initialState, trace: [] as string[] };
+  const seen = new Set([`${start.left}|${start.right}`]);
+  const queue = [start];
+
+  for (let i = 0; i < queue.length; i++) {
+    const { left: l, right: r, trace } = queue[i];
+    if (options.maxDepth !== undefined && trace.length >= options.maxDepth) continue;
+
+    const lm = leftMoves(l);
+    const rm = rightMoves(r);
+    const actions = Array.from(new Set([...lm.keys(), ...rm.keys()])).sort();
+
+    for (const action of actions) {
+      if (!rm.has(action)) return { equivalent: false, trace: [...trace, action], possibleIn: 'first' };
+      if (!lm.has(action)) return { equivalent: false, trace: [...trace, action], possibleIn: 'second' };
+
+      const next = { left: lm.get(action)!, right: rm.get(action)!, trace: [...trace, action] };
+      const key = `${next.left}|${next.right}`;
+      if (!seen.has(key)) {
+        seen.add(key);
+        queue.push(next);
+      }
+    }
+  }
+
+  return { equivalent: true };
+}
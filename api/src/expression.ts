@@ -0,0 +1,185 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Integer Expressions
+// A tiny expression language used for index ranges, constants and labels
+// ═══════════════════════════════════════════════════════════════════════════
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Variable bindings available while evaluating an expression
+ */
+export type Environment = Record<string, number>;
+
+/**
+ * Parsed expression tree
+ */
+export type Expr =
+  | { kind: 'number'; value: number }
+  | { kind: 'name'; name: string }
+  | { kind: 'unary'; op: string; operand: Expr }
+  | { kind: 'binary'; op: string; left: Expr; right: Expr };
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Parser
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Binary operators from lowest to highest precedence
+ */
+const PRECEDENCE: string[][] = [
+  ['||'],
+  ['&&'],
+  ['==', '!='],
+  ['<', '<=', '>', '>='],
+  ['+', '-'],
+  ['*', '/', '%'],
+];
+
+const TOKEN_PATTERN = /\s*(\d+|[A-Za-z_][A-Za-z0-9_]*|\|\||&&|==|!=|<=|>=|[-+*/%<>!()])/y;
+
+/**
+ * Split an expression into tokens
+ */
+function tokenize(source: string): string[] {
+  const tokens: string[] = [];
+  TOKEN_PATTERN.lastIndex = 0;
+
+  while (TOKEN_PATTERN.lastIndex < source.length) {
+    if (/^\s*$/.test(source.slice(TOKEN_PATTERN.lastIndex))) break;
+    const at = TOKEN_PATTERN.lastIndex;
+    const match = TOKEN_PATTERN.exec(source);
+    if (!match) {
+      throw new Error(`Unexpected character '${source[at]}' in expression "${source}"`);
+    }
+    tokens.push(match[1]);
+  }
+
+  return tokens;
+}
+
+/**
+ * Parse an expression such as `i+1` or `count < N && ready`
+ */
+export function parseExpression(source: string): Expr {
+  const tokens = tokenize(source);
+  let pos = 0;
+
+  const fail = (message: string): never => {
+    throw new Error(`${message} in expression "${source}"`);
+  };
+
+  const parseLevel = (level: number): Expr => {
+    if (level === PRECEDENCE.length) return parseUnary();
+
+    let left = parseLevel(level + 1);
+    while (pos < tokens.length && PRECEDENCE[level].includes(tokens[pos])) {
+      const op = tokens[pos++];
+      left = { kind: 'binary', op, left, right: parseLevel(level + 1) };
+    }
+    return left;
+  };
+
+  const parseUnary = (): Expr => {
+    if (tokens[pos] === '-' || tokens[pos] === '!') {
+      const op = tokens[pos++];
+      return { kind: 'unary', op, operand: parseUnary() };
+    }
+    return parsePrimary();
+  };
+
+  const parsePrimary = (): Expr => {
+    const token = tokens[pos++];
+    if (token === undefined) return fail('Unexpected end');
+    if (token === '(') {
+      const inner = parseLevel(0);
+      if (tokens[pos++] !== ')') fail(`Expected ')'`);
+      return inner;
+    }
+    if (/^\d+$/.test(token)) return { kind: 'number', value: Number(token) };
+    if (/^[A-Za-z_]/.test(token)) return { kind: 'name', name: token };
+    return fail(`Unexpected '${token}'`);
+  };
+
+  const expr = parseLevel(0);
+  if (pos < tokens.length) fail(`Unexpected '${tokens[pos]}'`);
+  return expr;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Evaluation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Evaluate a parsed expression; booleans are represented as 1 and 0
+ */
+export function evaluate(expr: Expr, env: Environment): number {
+  switch (expr.kind) {
+    case 'number':
+      return expr.value;
+    case 'name':
+      if (!(expr.name in env)) {
+        throw new Error(`Undefined name '${expr.name}'`);
+      }
+      return env[expr.name];
+    case 'unary': {
+      const v = evaluate(expr.operand, env);
+      return expr.op === '-' ? -v : Number(!v);
+    }
+    case 'binary': {
+      const l = evaluate(expr.left, env);
+      const r = evaluate(expr.right, env);
+      switch (expr.op) {
+        case '+': return l + r;
+        case '-': return l - r;
+        case '*': return l * r;
+        case '/':
+          if (r === 0) throw new Error('Division by zero');
+          return Math.trunc(l / r);
+        case '%':
+          if (r === 0) throw new Error('Division by zero');
+          return l % r;
+        case '<': return Number(l < r);
+        case '<=': return Number(l <= r);
+        case '>': return Number(l > r);
+        case '>=': return Number(l >= r);
+        case '==': return Number(l === r);
+        case '!=': return Number(l !== r);
+        case '&&': return Number(Boolean(l) && Boolean(r));
+        case '||': return Number(Boolean(l) || Boolean(r));
+      }
+      throw new Error(`Unknown operator '${expr.op}'`);
+    }
+  }
+}
+
+/**
+ * Names an expression reads, in order of first use
+ */
+export function freeNames(expr: Expr): string[] {
+  switch (expr.kind) {
+    case 'number':
+      return [];
+    case 'name':
+      return [expr.name];
+    case 'unary':
+      return freeNames(expr.operand);
+    case 'binary':
+      return Array.from(new Set([...freeNames(expr.left), ...freeNames(expr.right)]));
+  }
+}
+
+/**
+ * Parse and evaluate an expression in one step.
+ * Numbers pass straight through so callers can accept `number | string`.
+ */
+export function evaluateExpression(source: number | string, env: Environment): number {
+  if (typeof source === 'number') return source;
+  try {
+    return evaluate(parseExpression(source), env);
+  } catch (err) {
+    const message = err instanceof Error ? err.message : String(err);
+    throw new Error(message.includes(`"${source}"`) ? message : `${message} in expression "${source}"`);
+  }
+}
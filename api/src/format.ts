@@ -0,0 +1,300 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// FSP Formatter
+// Rewrites FSP source in one canonical layout, keeping its definitions,
+// line breaks and comments where the author put them
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { SourceComment, Token, lexFSP } from './fsp';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A token or comment, in source order
+ */
+type Item = { kind: 'token'; token: Token } | { kind: 'comment'; comment: SourceComment };
+
+/**
+ * What an open bracket encloses: an index or an expression, whose tokens
+ * are spaced differently from process bodies, a label set, or a namespace
+ */
+type Nesting = 'index' | 'expression' | 'body' | 'set' | 'namespace';
+
+/**
+ * One source line of items, with what is needed to lay it out
+ */
+interface Line {
+  items: Item[];
+  /** Brackets open where the line starts, innermost last */
+  open: Nesting[];
+  /** The line continues the definition of an earlier one */
+  continuation: boolean;
+  /** A blank line separates it from the line before */
+  blankBefore: boolean;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Indentation of one nesting level
+ */
+const INDENT = '    ';
+
+/**
+ * Tokens that can close a line without the definition going on
+ */
+const DEFINITION_ENDS = ['.', ',', ')', ']', '}'];
+
+/**
+ * Lowest gap between code and a trailing comment
+ */
+const COMMENT_GAP = 2;
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+function isSymbol(token: Token | undefined, ...texts: string[]): boolean {
+  return token !== undefined && token.kind === 'symbol' && (texts.length === 0 || texts.includes(token.text));
+}
+
+function lastLine(item: Item): number {
+  return item.kind === 'token' ? item.token.pos.line : item.comment.endLine;
+}
+
+function firstLine(item: Item): number {
+  return item.kind === 'token' ? item.token.pos.line : item.comment.pos.line;
+}
+
+/**
+ * Whether the tokens of a nesting are written without spaces
+ */
+function tight(open: Nesting[]): boolean {
+  return open[open.length - 1] === 'index';
+}
+
+/**
+ * Whether a space goes between two tokens of a line
+ * @param before The token before `prev`, if any
+ * @param next The token after `cur`, if any
+ * @param open The brackets open at `cur`
+ * @param leading `prev` is the first token of its line
+ */
+function spaced(before: Token | undefined, prev: Token, cur: Token, next: Token | undefined, open: Nesting[], leading: boolean): boolean {
+  if (tight(open)) return false;
+  if (isSymbol(cur, ')', ']', '}', ',', '.', '..', ':')) return false;
+  if (isSymbol(prev, '(', '[', '{', '.', '..', '@', '!', '?')) return false;
+
+  // Label sets relabel as `{new/old}`
+  if (open[open.length - 1] === 'set' && (isSymbol(cur, '/') || isSymbol(prev, '/'))) return false;
+  // Relabelling and hiding attach to the composition: `(P || Q)/{new/old}\{a}`
+  if (isSymbol(cur, '/', '\\') && isSymbol(next, '{')) return false;
+  if (isSymbol(prev, '/', '\\') && isSymbol(cur, '{')) return false;
+
+  // An index follows its label or process: `in[j:T]`, `RW[0][0]`
+  if (isSymbol(cur, '[')) return !(prev.kind === 'ident' && prev.text !== 'forall') && !isSymbol(prev, ']');
+  // `@buffer(2)`, and the delay `tick@100ms`
+  if (isSymbol(cur, '(') && prev.text === 'buffer' && isSymbol(before, '@')) return false;
+  if (isSymbol(cur, '@') && (prev.kind === 'ident' || isSymbol(prev, ']'))) return false;
+  if (prev.kind === 'number' && cur.kind === 'ident' && isSymbol(before, '@')) return false;
+
+  // A line that starts an alternative or a composition runs on: `|when`, `||SYS`
+  if (leading && isSymbol(prev, '|')) return false;
+  if (leading && isSymbol(prev, '||') && open.length === 0) return false;
+  // Unary minus and plus
+  if (isSymbol(prev, '-', '+') && (before === undefined || (before.kind === 'symbol' && !isSymbol(before, ')', ']', '}')))) {
+    return false;
+  }
+  return true;
+}
+
+/**
+ * What each opening bracket of the source encloses
+ */
+function nestings(tokens: Token[]): Map<Token, Nesting> {
+  const opened = new Map<Token, Nesting>();
+  const open: Nesting[] = [];
+  tokens.forEach((token, i) => {
+    if (isSymbol(token, ')', ']', '}')) {
+      open.pop();
+      return;
+    }
+    if (!isSymbol(token, '(', '[', '{')) return;
+    const inner = open[open.length - 1];
+    const before = tokens[i - 1];
+    let nesting: Nesting;
+    if (inner === 'index' || token.text === '[') {
+      nesting = 'index';
+    } else if (token.text === '{') {
+      nesting = tokens[i - 2]?.text === 'namespace' && tokens[i - 2].kind === 'ident' ? 'namespace' : 'set';
+    } else {
+      nesting = inner === 'expression' || before?.text === 'when' || before?.text === 'buffer' ? 'expression' : 'body';
+    }
+    opened.set(token, nesting);
+    open.push(nesting);
+  });
+  return opened;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Layout
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Group the items into source lines, noting the brackets open at the
+ * start of each
+ */
+function splitLines(items: Item[], opened: Map<Token, Nesting>): Line[] {
+  const lines: Line[] = [];
+  const open: Nesting[] = [];
+  let previous: Token | undefined;
+  let end = 0;
+
+  for (const item of items) {
+    if (lines.length === 0 || firstLine(item) > end) {
+      const first = item.kind === 'token' ? item.token : undefined;
+      const closesNamespace = isSymbol(first, '}') && open[open.length - 1] === 'namespace';
+      const continuation = !closesNamespace && (open.some(n => n !== 'namespace') ||
+        (first !== undefined && isSymbol(first) && !isSymbol(first, '||')) ||
+        (previous !== undefined && isSymbol(previous) && !isSymbol(previous, ...DEFINITION_ENDS) &&
+          !(isSymbol(previous, '{') && open[open.length - 1] === 'namespace')));
+      lines.push({ items: [], open: [...open], continuation, blankBefore: lines.length > 0 && firstLine(item) > end + 1 });
+    }
+    lines[lines.length - 1].items.push(item);
+    end = Math.max(end, lastLine(item));
+    if (item.kind === 'comment') continue;
+
+    const token = item.token;
+    if (opened.has(token)) {
+      open.push(opened.get(token)!);
+    } else if (isSymbol(token, ')', ']', '}')) {
+      open.pop();
+    }
+    previous = token;
+  }
+  return lines;
+}
+
+/**
+ * Indentation of a line with code: definitions start at their namespace's
+ * level, and a continuation goes one level in, or as deep as the brackets
+ * open at its start. A line that starts by closing a bracket goes back out
+ * by one, so a choice's `(`, its `|` alternatives and its `)` line up.
+ */
+function indentOf(line: Line): string {
+  const first = line.items.find((item): item is { kind: 'token'; token: Token } => item.kind === 'token')!.token;
+  const namespaces = line.open.filter(n => n === 'namespace').length;
+  const brackets = line.open.length - namespaces;
+  if (!line.continuation) {
+    return INDENT.repeat(namespaces - (isSymbol(first, '}') && line.items[0].kind === 'token' ? 1 : 0));
+  }
+  const closing = isSymbol(first, ')', ']', '}') && line.items[0].kind === 'token' ? 1 : 0;
+  return INDENT.repeat(namespaces + Math.max(1, brackets - closing));
+}
+
+/**
+ * Write the items of one line with canonical spacing
+ * @returns The code, and its trailing `//` comment if any
+ */
+function renderLine(line: Line, opened: Map<Token, Nesting>): { code: string; comment?: string } {
+  const open = [...line.open];
+  let code = '';
+  let before: Token | undefined;
+  let prev: Token | undefined;
+  let prevLeading = false;
+  let afterComment = false;
+
+  const items = line.items;
+  const trailing = items.length > 1 && items[items.length - 1].kind === 'comment' &&
+    (items[items.length - 1] as { kind: 'comment'; comment: SourceComment }).comment.text.startsWith('//')
+    ? (items.pop() as { kind: 'comment'; comment: SourceComment }).comment.text
+    : undefined;
+
+  items.forEach((item, i) => {
+    if (item.kind === 'comment') {
+      code += (code === '' ? '' : ' ') + item.comment.text;
+      afterComment = true;
+      return;
+    }
+    const token = item.token;
+    if (code !== '') {
+      const next = items.slice(i + 1).find((other): other is { kind: 'token'; token: Token } => other.kind === 'token')?.token;
+      if (afterComment || prev === undefined || spaced(before, prev, token, next, open, prevLeading)) code += ' ';
+    }
+    code += token.text;
+    prevLeading = prev === undefined;
+    before = prev;
+    prev = token;
+    afterComment = false;
+
+    if (opened.has(token)) {
+      open.push(opened.get(token)!);
+    } else if (isSymbol(token, ')', ']', '}')) {
+      open.pop();
+    }
+  });
+  return { code, comment: trailing };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Formatting
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Format FSP source canonically. Every definition keeps its place and its
+ * line breaks; what changes is the spacing between tokens, the indentation
+ * of continuation lines and comments, and runs of blank lines, which shrink
+ * to one. Trailing comments on consecutive lines are aligned. Formatting
+ * formatted source leaves it as it is.
+ * @throws FSPParseError when the source does not parse
+ */
+export function formatFSP(source: string): string {
+  const { tokens, comments } = lexFSP(source);
+  const items: Item[] = [
+    ...tokens.map((token): Item => ({ kind: 'token', token })),
+    ...comments.map((comment): Item => ({ kind: 'comment', comment })),
+  ].sort((a, b) => {
+    const pa = a.kind === 'token' ? a.token.pos : a.comment.pos;
+    const pb = b.kind === 'token' ? b.token.pos : b.comment.pos;
+    return pa.line - pb.line || pa.column - pb.column;
+  });
+  const opened = nestings(tokens);
+  const lines = splitLines(items, opened);
+
+  // A line of comments only is indented like the code line after it
+  const indents: string[] = new Array(lines.length).fill('');
+  let next = '';
+  for (let i = lines.length - 1; i >= 0; i--) {
+    if (lines[i].items.some(item => item.kind === 'token')) next = indentOf(lines[i]);
+    indents[i] = next;
+  }
+
+  const rendered = lines.map((line, i) => ({ ...renderLine(line, opened), indent: indents[i], blankBefore: line.blankBefore }));
+  const out: string[] = [];
+  for (let i = 0; i < rendered.length; i++) {
+    // Align the trailing comments of a run of consecutive lines
+    let j = i;
+    while (j + 1 < rendered.length && rendered[j].comment !== undefined && rendered[j + 1].comment !== undefined &&
+      !rendered[j + 1].blankBefore) {
+      j++;
+    }
+    const width = Math.max(...rendered.slice(i, j + 1).map(r => r.indent.length + r.code.length)) + COMMENT_GAP;
+    for (let k = i; k <= j; k++) {
+      const r = rendered[k];
+      if (r.blankBefore) out.push('');
+      const code = r.indent + r.code;
+      out.push(r.comment === undefined ? code : code.padEnd(width) + r.comment);
+    }
+    i = j;
+  }
+
+  const formatted = out.join('\n') + '\n';
+  const same = lexFSP(formatted).tokens.map(token => token.text).join(' ') === tokens.map(token => token.text).join(' ');
+  if (!same) {
+    throw new Error('Formatting would change the meaning of the source; please report this as a bug');
+  }
+  return formatted;
+}
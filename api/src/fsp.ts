@@ -0,0 +1,1536 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// FSP Dialect
+// Parses the Finite State Processes notation of the LTSA tool
+// (Magee & Kramer) and lowers it to the LTS specification IR, and writes
+// specifications back in it
+// ═══════════════════════════════════════════════════════════════════════════
+
+import {
+  LTSSpec,
+  ProcessDefinition,
+  Transition,
+  Composition,
+  IndexRange,
+  RangeDeclaration,
+  ActionPriority,
+  ActionDeclaration,
+  ActionDirection,
+} from './transpiler';
+import { evaluateExpression } from './expression';
+import {
+  DEFAULT_SILENT_ACTION,
+  composeSpec,
+  expandSpec,
+  interruptProcess,
+  lowerDirections,
+  sequenceProcesses,
+  unfoldVariables,
+} from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Location of a token in the source, 1-based
+ */
+export interface SourcePosition {
+  line: number;
+  column: number;
+}
+
+/**
+ * A lexical token
+ */
+export interface Token {
+  kind: 'ident' | 'number' | 'symbol' | 'eof';
+  text: string;
+  pos: SourcePosition;
+}
+
+/**
+ * A line or block comment, which the parser skips but a formatter keeps
+ */
+export interface SourceComment {
+  text: string;
+  pos: SourcePosition;
+  /** Line the comment ends on; only block comments span several */
+  endLine: number;
+}
+
+/**
+ * A local process expression: what a process does from some point onwards
+ */
+export type ProcessExpr =
+  | { kind: 'stop'; pos: SourcePosition }
+  | { kind: 'error'; pos: SourcePosition }
+  | { kind: 'ref'; name: string; indices: string[]; pos: SourcePosition }
+  | { kind: 'choice'; branches: Branch[]; pos: SourcePosition }
+  | { kind: 'seq'; parts: ProcessExpr[]; pos: SourcePosition }
+  | { kind: 'interrupt'; parts: ProcessExpr[]; pos: SourcePosition };
+
+/**
+ * One alternative of a choice: `action -> next`, optionally guarded as
+ * `when (cond) action -> next`. An action range such as `in[i:T]` offers
+ * one alternative per value, with `i` bound in `next`.
+ */
+export interface Branch {
+  action: string;
+  index?: IndexRange;
+  /** `when (cond)` in front of the action */
+  guard?: string;
+  /** `0.7:` in front of the alternative, its chance in a weighted choice */
+  weight?: number;
+  /** `!` (output) or `?` (input) in front of the action */
+  direction?: ActionDirection;
+  next: ProcessExpr;
+  pos: SourcePosition;
+}
+
+/**
+ * A primitive process definition, `NAME = body.`, or a process family
+ * `NAME[i:T] = body.` with one instance per index value
+ */
+export interface ProcessDef {
+  name: string;
+  index?: IndexRange;
+  body: ProcessExpr;
+  locals: LocalDef[];
+  /** Alphabet extension `+ {a, b}` after the last definition */
+  extraAlphabet: string[];
+  /** Declared `property NAME = ...` */
+  property: boolean;
+  pos: SourcePosition;
+}
+
+/**
+ * A local definition following its process, as `Q` in `P = (a -> Q), Q = (b -> P).`
+ * It becomes a state of the process; an indexed one such as
+ * `Q[i:T][j:0..1]` becomes one state per combination of values.
+ */
+export interface LocalDef {
+  name: string;
+  indices: IndexRange[];
+  body: ProcessExpr;
+  pos: SourcePosition;
+}
+
+/**
+ * A composite process definition, `||NAME = (P || Q)/{new/old}\{hidden}.`,
+ * optionally followed by a priority `<< {high}` or `>> {low}`
+ */
+export interface CompositeDef {
+  name: string;
+  /** Composed processes, each replicated over `forall` when given */
+  processes: { name: string; forall?: IndexRange; pos: SourcePosition }[];
+  relabel: Record<string, string>;
+  hide: string[];
+  priority?: ActionPriority;
+  pos: SourcePosition;
+}
+
+/**
+ * A parsed FSP source file
+ */
+export interface FSPProgram {
+  /** `const N = 3` declarations, evaluated */
+  constants: Record<string, number>;
+  /** `range T = 0..N` declarations; bounds stay expressions over the constants */
+  ranges: Record<string, RangeDeclaration>;
+  processes: ProcessDef[];
+  composites: CompositeDef[];
+  /** Channel capacities from `@buffer(n)` annotations, by action */
+  buffers: Record<string, number>;
+  /** Actions annotated `@broadcast`, with the process that sends them */
+  broadcasts: Record<string, string>;
+  /** Delays from `tick@100ms`, by action */
+  delays: Record<string, string>;
+  /** Actions listed in `shared { ... }` declarations, in order */
+  shared: string[];
+}
+
+/**
+ * An action label and the index range it binds, if any
+ */
+interface Label {
+  text: string;
+  index?: IndexRange;
+}
+
+/**
+ * An `@` annotation in front of an action
+ */
+type Annotation = { kind: 'buffer'; capacity: number } | { kind: 'broadcast' };
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Lexer
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Symbols, multi-character ones first
+ */
+const SYMBOLS = [
+  '||', '->', '..', '/\\', '&&', '==', '!=', '<<', '>>', '<=', '>=',
+  '(', ')', '{', '}', '[', ']', '|', '=', '.', ',', ';', '/', '\\', ':',
+  '+', '-', '*', '%', '<', '>', '!', '?', '@',
+];
+
+/**
+ * Binary operators inside index expressions, from lowest to highest precedence
+ */
+const EXPRESSION_LEVELS: string[][] = [
+  ['||'],
+  ['&&'],
+  ['==', '!='],
+  ['<', '<=', '>', '>='],
+  ['+', '-'],
+  ['*', '/', '%'],
+];
+
+/**
+ * An error found at a source position
+ */
+export interface SourceError {
+  pos: SourcePosition;
+  message: string;
+}
+
+/**
+ * An error that points at a source position, as raised while parsing
+ */
+class PositionedError extends Error {
+  constructor(public readonly pos: SourcePosition, public readonly reason: string) {
+    super(`Line ${pos.line}, column ${pos.column}: ${reason}`);
+  }
+}
+
+/**
+ * Build an error message that points at a source position
+ */
+function errorAt(pos: SourcePosition, message: string): Error {
+  return new PositionedError(pos, message);
+}
+
+/**
+ * Format an error with the line it was found on, reprinted with a `^`
+ * under the offending column
+ */
+export function formatSourceError(source: string, error: SourceError): string {
+  const text = (source.split('\n')[error.pos.line - 1] ?? '').replace(/\r$/, '');
+  // Tabs are kept so that the caret lines up however they are displayed
+  const indent = text.slice(0, error.pos.column - 1).replace(/[^\t]/g, ' ');
+  return `Line ${error.pos.line}, column ${error.pos.column}: ${error.message}\n${text}\n${indent}^`;
+}
+
+/**
+ * Thrown when FSP source does not parse, with every error found in it
+ */
+export class FSPParseError extends Error {
+  constructor(public readonly errors: SourceError[], source: string) {
+    super(errors.map(error => formatSourceError(source, error)).join('\n'));
+    this.name = 'FSPParseError';
+  }
+}
+
+/**
+ * Split FSP source into tokens, skipping whitespace and comments. An
+ * unexpected character is recorded in `errors` and skipped. Comments are
+ * collected in `comments` when it is given.
+ */
+function tokenize(source: string, errors: SourceError[], comments?: SourceComment[]): Token[] {
+  const tokens: Token[] = [];
+  let i = 0;
+  let line = 1;
+  let lineStart = 0;
+
+  const advance = (count: number) => {
+    for (let k = 0; k < count; k++) {
+      if (source[i] === '\n') {
+        line++;
+        lineStart = i + 1;
+      }
+      i++;
+    }
+  };
+
+  while (i < source.length) {
+    const pos = { line, column: i - lineStart + 1 };
+    const rest = source.slice(i);
+
+    if (/^\s/.test(rest)) {
+      advance(1);
+      continue;
+    }
+    if (rest.startsWith('//')) {
+      const end = source.indexOf('\n', i);
+      const text = source.slice(i, end === -1 ? source.length : end);
+      comments?.push({ text: text.trimEnd(), pos, endLine: line });
+      advance(text.length);
+      continue;
+    }
+    if (rest.startsWith('/*')) {
+      const end = source.indexOf('*/', i + 2);
+      if (end === -1) {
+        errors.push({ pos, message: 'Unterminated comment' });
+        break;
+      }
+      const text = source.slice(i, end + 2);
+      advance(text.length);
+      comments?.push({ text, pos, endLine: line });
+      continue;
+    }
+
+    const word = /^[A-Za-z_][A-Za-z0-9_]*/.exec(rest);
+    if (word) {
+      tokens.push({ kind: 'ident', text: word[0], pos });
+      advance(word[0].length);
+      continue;
+    }
+    const number = /^\d+/.exec(rest);
+    if (number) {
+      tokens.push({ kind: 'number', text: number[0], pos });
+      advance(number[0].length);
+      continue;
+    }
+    const symbol = SYMBOLS.find(s => rest.startsWith(s));
+    if (symbol) {
+      tokens.push({ kind: 'symbol', text: symbol, pos });
+      advance(symbol.length);
+      continue;
+    }
+
+    errors.push({ pos, message: `Unexpected character '${source[i]}'` });
+    advance(1);
+  }
+
+  tokens.push({ kind: 'eof', text: '<end of input>', pos: { line, column: i - lineStart + 1 } });
+  return tokens;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Parser
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Process names start with an upper-case letter, action labels with a lower-case one
+ */
+function isProcessName(token: Token): boolean {
+  return token.kind === 'ident' && /^[A-Z]/.test(token.text);
+}
+
+function isActionName(token: Token): boolean {
+  return token.kind === 'ident' && /^[a-z]/.test(token.text);
+}
+
+/**
+ * Recursive-descent parser over the token stream
+ */
+class Parser {
+  private pos = 0;
+  private constants: Record<string, number> = {};
+  private ranges: Record<string, RangeDeclaration> = {};
+  private buffers: Record<string, number> = {};
+  private broadcasts: Record<string, string> = {};
+  private delays: Record<string, string> = {};
+  /** The process definition being parsed, and whether it is a family */
+  private process: { name: string; family: boolean } | undefined;
+  /** Enclosing namespaces, outermost first; they prefix every action defined inside */
+  private namespaces: string[] = [];
+  /** Index variables in scope: a family's index and enclosing action ranges */
+  private variables = new Set<string>();
+  /** The action range in scope, if any; ranges do not nest yet */
+  private actionRange: string | undefined;
+
+  constructor(private tokens: Token[], private errors: SourceError[]) {}
+
+  private peek(offset = 0): Token {
+    return this.tokens[Math.min(this.pos + offset, this.tokens.length - 1)];
+  }
+
+  private next(): Token {
+    const token = this.peek();
+    if (token.kind !== 'eof') this.pos++;
+    return token;
+  }
+
+  private at(text: string): boolean {
+    const token = this.peek();
+    return token.kind === 'symbol' && token.text === text;
+  }
+
+  private accept(text: string): boolean {
+    if (!this.at(text)) return false;
+    this.next();
+    return true;
+  }
+
+  private expect(text: string): Token {
+    if (!this.at(text)) {
+      this.fail(`Expected '${text}'`);
+    }
+    return this.next();
+  }
+
+  private fail(message: string): never {
+    const token = this.peek();
+    throw errorAt(token.pos, `${message} but found '${token.text}'`);
+  }
+
+  private atKeyword(keyword: string): boolean {
+    const token = this.peek();
+    return token.kind === 'ident' && token.text === keyword;
+  }
+
+  /**
+   * program := (constDef | rangeDef | sharedDef | namespace | processDef | compositeDef)*
+   */
+  parseProgram(): FSPProgram {
+    const program: FSPProgram = {
+      constants: this.constants,
+      ranges: this.ranges,
+      processes: [],
+      composites: [],
+      buffers: this.buffers,
+      broadcasts: this.broadcasts,
+      delays: this.delays,
+      shared: [],
+    };
+
+    while (this.peek().kind !== 'eof') {
+      this.recovering(() => {
+        if (this.atKeyword('const')) {
+          this.parseConstDef();
+        } else if (this.atKeyword('range')) {
+          this.parseRangeDef();
+        } else if (this.atKeyword('shared')) {
+          program.shared.push(...this.parseSharedDef());
+        } else if (this.atKeyword('namespace')) {
+          this.parseNamespace(program);
+        } else if (this.at('||')) {
+          program.composites.push(this.parseCompositeDef());
+        } else {
+          program.processes.push(this.parseProcessDef());
+        }
+      });
+    }
+
+    return program;
+  }
+
+  /**
+   * Parse one definition, recording an error in it instead of giving up.
+   * Parsing then resumes after the `.` that ends the definition, so that
+   * the errors of later definitions are reported as well.
+   */
+  private recovering(parse: () => void): void {
+    const namespaces = this.namespaces.length;
+    try {
+      parse();
+    } catch (err) {
+      if (!(err instanceof PositionedError)) throw err;
+      this.errors.push({ pos: err.pos, message: err.reason });
+      this.process = undefined;
+      this.namespaces.length = namespaces;
+      this.variables.clear();
+      this.actionRange = undefined;
+      while (this.peek().kind !== 'eof' && !(this.namespaces.length > 0 && this.at('}'))) {
+        if (this.next().text === '.' && this.startsDefinition()) break;
+      }
+    }
+  }
+
+  /**
+   * Whether the next token can start a definition, after the `.` of the last
+   */
+  private startsDefinition(): boolean {
+    const token = this.peek();
+    return token.kind === 'eof' || this.at('||') || this.at('}') || isProcessName(token) ||
+      ['const', 'range', 'shared', 'namespace', 'property'].some(keyword => this.atKeyword(keyword));
+  }
+
+  /**
+   * namespace := 'namespace' NAME '{' (constDef | rangeDef | namespace | processDef)* '}'
+   * Every action of a process defined inside is prefixed with the namespace,
+   * as in `lib1.put`, so it only synchronizes with processes of other
+   * namespaces once relabelled to a common name. Process, constant and range
+   * names stay global.
+   */
+  private parseNamespace(program: FSPProgram): void {
+    this.next();
+    const token = this.peek();
+    if (token.kind !== 'ident') {
+      this.fail('Expected a namespace name');
+    }
+    this.next();
+    this.expect('{');
+    this.namespaces.push(token.text);
+
+    while (!this.at('}')) {
+      if (this.peek().kind === 'eof') {
+        this.fail(`Expected '}' to close namespace ${token.text}`);
+      }
+      this.recovering(() => {
+        if (this.atKeyword('const')) {
+          this.parseConstDef();
+        } else if (this.atKeyword('range')) {
+          this.parseRangeDef();
+        } else if (this.atKeyword('namespace')) {
+          this.parseNamespace(program);
+        } else if (this.at('||')) {
+          throw errorAt(this.peek().pos, `A composition cannot be declared inside namespace ${token.text}`);
+        } else {
+          program.processes.push(this.parseProcessDef());
+        }
+      });
+    }
+
+    this.next();
+    this.namespaces.pop();
+  }
+
+  /**
+   * Qualify an action defined in the current namespaces. The silent action
+   * `tau` is never prefixed, as it does not synchronize anyway.
+   */
+  private qualify(action: string): string {
+    if (this.namespaces.length === 0 || action === 'tau') return action;
+    return `${this.namespaces.join('.')}.${action}`;
+  }
+
+  /**
+   * Name being declared by `const` or `range`
+   */
+  private parseDeclaredName(): Token {
+    this.next();
+    const token = this.peek();
+    if (token.kind !== 'ident') {
+      this.fail('Expected a name');
+    }
+    if (token.text in this.constants || token.text in this.ranges) {
+      throw errorAt(token.pos, `${token.text} is declared more than once`);
+    }
+    this.next();
+    this.expect('=');
+    return token;
+  }
+
+  /**
+   * constDef := 'const' NAME '=' expr
+   */
+  private parseConstDef(): void {
+    const token = this.parseDeclaredName();
+    const start = this.peek().pos;
+    // `||` is left out so that a composite definition can follow directly
+    const expr = this.parseExpr(1);
+    try {
+      this.constants[token.text] = evaluateExpression(expr, this.constants);
+    } catch (err) {
+      throw errorAt(start, err instanceof Error ? err.message : String(err));
+    }
+  }
+
+  /**
+   * sharedDef := 'shared' labelSet
+   * The listed actions synchronize; once a program declares any, no other
+   * action does.
+   */
+  private parseSharedDef(): string[] {
+    this.next();
+    return this.parseLabelSet();
+  }
+
+  /**
+   * rangeDef := 'range' NAME '=' expr '..' expr
+   */
+  private parseRangeDef(): void {
+    const token = this.parseDeclaredName();
+    const from = this.parseExpr(1);
+    this.expect('..');
+    this.ranges[token.text] = { from, to: this.parseExpr(1) };
+  }
+
+  /**
+   * The range of an index binding: a declared range name or `expr '..' expr`
+   */
+  private parseRangeSpec(): RangeDeclaration | { range: string } {
+    const token = this.peek();
+    if (token.kind === 'ident' && !this.at('..') && this.peek(1).text !== '..' && !(token.text in this.constants)) {
+      if (!(token.text in this.ranges)) {
+        throw errorAt(token.pos, `Undefined range ${token.text}`);
+      }
+      this.next();
+      return { range: token.text };
+    }
+    const from = this.parseExpr(1);
+    this.expect('..');
+    return { from, to: this.parseExpr(1) };
+  }
+
+  /**
+   * Index binding `NAME ':' rangeSpec` inside brackets
+   */
+  private parseBinding(): IndexRange {
+    const variable = this.next();
+    if (variable.text in this.constants || this.variables.has(variable.text)) {
+      throw errorAt(variable.pos, `Index variable ${variable.text} is already defined`);
+    }
+    this.expect(':');
+    return { variable: variable.text, ...this.parseRangeSpec() };
+  }
+
+  /**
+   * Whether the tokens ahead start an index binding `NAME ':'`
+   */
+  private atBinding(): boolean {
+    const next = this.peek(1);
+    return this.peek().kind === 'ident' && next.kind === 'symbol' && next.text === ':';
+  }
+
+  /**
+   * expr := unary (op unary)*, with the usual precedence. Returns the
+   * expression's source text, checking that every name is a declared
+   * constant or an index variable in scope.
+   */
+  private parseExpr(level = 0): string {
+    if (level === EXPRESSION_LEVELS.length) return this.parseUnaryExpr();
+
+    let text = this.parseExpr(level + 1);
+    while (this.peek().kind === 'symbol' && EXPRESSION_LEVELS[level].includes(this.peek().text)) {
+      text += this.next().text + this.parseExpr(level + 1);
+    }
+    return text;
+  }
+
+  private parseUnaryExpr(): string {
+    if (this.at('-') || this.at('!')) {
+      return this.next().text + this.parseUnaryExpr();
+    }
+    const token = this.peek();
+    if (this.accept('(')) {
+      const inner = this.parseExpr();
+      this.expect(')');
+      return `(${inner})`;
+    }
+    if (token.kind === 'number') {
+      return this.next().text;
+    }
+    if (token.kind === 'ident') {
+      if (!(token.text in this.constants) && !this.variables.has(token.text)) {
+        throw errorAt(token.pos, `Undefined constant ${token.text}`);
+      }
+      return this.next().text;
+    }
+    return this.fail('Expected an expression');
+  }
+
+  /**
+   * processDef := 'property'? NAME bindings '=' sequence (',' NAME bindings '=' processExpr)* ('+' labelSet)? '.'
+   * The first clause defines the process, or a process family when it has
+   * one index. The others are local definitions that may refer to each other
+   * and to the process in any order. A trailing label set extends the
+   * alphabet of the whole process, and a leading `property` makes it a
+   * safety property.
+   */
+  private parseProcessDef(): ProcessDef {
+    const property = this.atKeyword('property');
+    if (property) this.next();
+    const token = this.peek();
+    if (!isProcessName(token)) {
+      this.fail('Expected a process definition');
+    }
+    this.next();
+
+    const indices = this.parseBindings();
+    if (indices.length > 1) {
+      throw errorAt(token.pos, 'A process family takes a single index; use local definitions for more');
+    }
+    const index = indices[0];
+    const family = index ? [index.variable] : [];
+    this.process = { name: token.text, family: index !== undefined };
+    this.expect('=');
+    const body = this.parseSequence();
+
+    const locals: LocalDef[] = [];
+    while (this.accept(',')) {
+      const local = this.peek();
+      if (!isProcessName(local)) {
+        this.fail('Expected a local definition');
+      }
+      this.next();
+      this.variables = new Set(family);
+      const localIndices = this.parseBindings();
+      if (locals.some(l => l.name === local.text && l.indices.length === localIndices.length) ||
+        (local.text === token.text && localIndices.length === 0)) {
+        throw errorAt(local.pos, `Local definition ${local.text} is defined more than once`);
+      }
+      this.expect('=');
+      locals.push({ name: local.text, indices: localIndices, body: this.parseProcessExpr(), pos: local.pos });
+    }
+
+    this.variables.clear();
+    const extraAlphabet = this.accept('+') ? this.parseLabelSet().map(a => this.qualify(a)) : [];
+    this.expect('.');
+    return { name: token.text, index, body, locals, extraAlphabet, property, pos: token.pos };
+  }
+
+  /**
+   * sequence := interrupt (';' interrupt)*, a sequential composition `P ; Q`
+   */
+  private parseSequence(): ProcessExpr {
+    const first = this.parseInterrupt();
+    const parts = [first];
+    while (this.accept(';')) {
+      parts.push(this.parseInterrupt());
+    }
+    return parts.length > 1 ? { kind: 'seq', parts, pos: first.pos } : first;
+  }
+
+  /**
+   * interrupt := processExpr ('/\' processExpr)*, where `P /\ Q` behaves as
+   * `P` until `Q` takes over
+   */
+  private parseInterrupt(): ProcessExpr {
+    const first = this.parseProcessExpr();
+    const parts = [first];
+    while (this.accept('/\\')) {
+      parts.push(this.parseProcessExpr());
+    }
+    return parts.length > 1 ? { kind: 'interrupt', parts, pos: first.pos } : first;
+  }
+
+  /**
+   * bindings := ('[' NAME ':' rangeSpec ']')*, each variable in scope from then on
+   */
+  private parseBindings(): IndexRange[] {
+    const indices: IndexRange[] = [];
+    while (this.accept('[')) {
+      if (!this.atBinding()) {
+        this.fail('Expected an index binding such as i:0..N');
+      }
+      const index = this.parseBinding();
+      this.variables.add(index.variable);
+      indices.push(index);
+      this.expect(']');
+    }
+    return indices;
+  }
+
+  /**
+   * processExpr := 'STOP' | 'ERROR' | NAME ('[' expr ']')* | '(' choice ')'
+   */
+  private parseProcessExpr(): ProcessExpr {
+    const token = this.peek();
+
+    if (this.accept('(')) {
+      const branches = this.parseChoice();
+      this.expect(')');
+      return { kind: 'choice', branches, pos: token.pos };
+    }
+    if (token.kind === 'ident' && token.text === 'STOP') {
+      this.next();
+      return { kind: 'stop', pos: token.pos };
+    }
+    if (token.kind === 'ident' && token.text === 'ERROR') {
+      this.next();
+      return { kind: 'error', pos: token.pos };
+    }
+    if (isProcessName(token)) {
+      this.next();
+      const indices: string[] = [];
+      while (this.accept('[')) {
+        indices.push(this.parseExpr());
+        this.expect(']');
+      }
+      return { kind: 'ref', name: token.text, indices, pos: token.pos };
+    }
+    return this.fail('Expected STOP, ERROR, a process name or a parenthesized choice');
+  }
+
+  /**
+   * choice := prefix ('|' prefix)*
+   */
+  private parseChoice(): Branch[] {
+    const branches = [this.parsePrefix()];
+    while (this.accept('|')) {
+      branches.push(this.parsePrefix());
+    }
+    return branches;
+  }
+
+  /**
+   * prefix := (weight ':')? ('when' expr)? annotation* ('!' | '?')? label ('@' duration)? '->' (prefix | processExpr)
+   * An index range in the label stays bound for the rest of the prefix. A
+   * weight such as `0.7` or `3` makes the alternative's choice a weighted one,
+   * a duration such as `tick@100ms` delays the action, and `!put` or `?put`
+   * marks the process as the writer or a reader of its channel.
+   */
+  private parsePrefix(): Branch {
+    const pos = this.peek().pos;
+    let weight: number | undefined;
+    if (this.peek().kind === 'number') {
+      let text = this.next().text;
+      if (this.at('.') && this.peek(1).kind === 'number') {
+        this.next();
+        text += `.${this.next().text}`;
+      }
+      weight = Number(text);
+      this.expect(':');
+    }
+    let guard: string | undefined;
+    if (this.atKeyword('when')) {
+      this.next();
+      guard = this.parseExpr();
+    }
+    const annotations: [Annotation, SourcePosition][] = [];
+    while (this.at('@')) {
+      const annotationPos = this.peek().pos;
+      annotations.push([this.parseAnnotation(), annotationPos]);
+    }
+    const direction: ActionDirection | undefined = this.accept('!') ? 'output' : this.accept('?') ? 'input' : undefined;
+    const label = this.parseLabel(true);
+    const { index } = label;
+    const action = this.qualify(label.text);
+    for (const [annotation, annotationPos] of annotations) {
+      if (annotation.kind === 'buffer') {
+        this.recordBuffer(action, annotation.capacity, annotationPos);
+      } else {
+        this.recordBroadcast(action, annotationPos);
+      }
+    }
+    const delayPos = this.peek().pos;
+    if (this.accept('@')) {
+      this.recordDelay(action, this.parseDuration(), delayPos);
+    }
+    this.expect('->');
+
+    let next: ProcessExpr;
+    if (isActionName(this.peek()) || this.at('@') || this.at('!') || this.at('?')) {
+      const inner = this.parsePrefix();
+      next = { kind: 'choice', branches: [inner], pos: inner.pos };
+    } else {
+      next = this.parseProcessExpr();
+    }
+
+    if (index) {
+      this.variables.delete(index.variable);
+      this.actionRange = undefined;
+    }
+    return {
+      action,
+      ...(index ? { index } : {}),
+      ...(guard !== undefined ? { guard } : {}),
+      ...(weight !== undefined ? { weight } : {}),
+      ...(direction ? { direction } : {}),
+      next,
+      pos,
+    };
+  }
+
+  /**
+   * annotation := '@' 'buffer' '(' expr ')' | '@' 'broadcast'
+   * `@buffer` sets the capacity of the channel of the action it precedes; its
+   * expression may only use constants. `@broadcast` makes the action a
+   * broadcast sent by the process being defined.
+   */
+  private parseAnnotation(): Annotation {
+    this.expect('@');
+    if (this.atKeyword('broadcast')) {
+      this.next();
+      return { kind: 'broadcast' };
+    }
+    if (!this.atKeyword('buffer')) {
+      this.fail('Expected an annotation such as @buffer(4) or @broadcast');
+    }
+    this.next();
+    this.expect('(');
+    const start = this.peek().pos;
+    const expr = this.parseExpr();
+    let capacity: number;
+    try {
+      capacity = evaluateExpression(expr, this.constants);
+    } catch (err) {
+      throw errorAt(start, err instanceof Error ? err.message : String(err));
+    }
+    if (!Number.isInteger(capacity) || capacity < 0) {
+      throw errorAt(start, `Buffer capacity must be a non-negative integer, got ${capacity}`);
+    }
+    this.expect(')');
+    return { kind: 'buffer', capacity };
+  }
+
+  /**
+   * Remember the capacity annotated on an action; every annotation of the
+   * same action must agree
+   */
+  private recordBuffer(action: string, capacity: number, pos: SourcePosition): void {
+    if (action.includes('[')) {
+      throw errorAt(pos, `@buffer cannot annotate the indexed action ${action}`);
+    }
+    const known = this.buffers[action];
+    if (known !== undefined && known !== capacity) {
+      throw errorAt(pos, `Action ${action} is annotated with both @buffer(${known}) and @buffer(${capacity})`);
+    }
+    this.buffers[action] = capacity;
+  }
+
+  /**
+   * duration := NUMBER UNIT, with a Go unit such as `ms` or `s`
+   */
+  private parseDuration(): string {
+    if (this.peek().kind !== 'number') {
+      this.fail('Expected a duration such as 100ms');
+    }
+    const text = this.next().text;
+    const unit = this.peek();
+    if (unit.kind !== 'ident' || !['ns', 'us', 'ms', 's', 'm', 'h'].includes(unit.text)) {
+      this.fail('Expected a unit of time: ns, us, ms, s, m or h');
+    }
+    this.next();
+    return text + unit.text;
+  }
+
+  /**
+   * Remember the delay of an action; every occurrence must agree on it
+   */
+  private recordDelay(action: string, delay: string, pos: SourcePosition): void {
+    if (action.includes('[')) {
+      throw errorAt(pos, `A delay cannot be given to the indexed action ${action}`);
+    }
+    const known = this.delays[action];
+    if (known !== undefined && known !== delay) {
+      throw errorAt(pos, `Action ${action} is delayed by both ${known} and ${delay}`);
+    }
+    this.delays[action] = delay;
+  }
+
+  /**
+   * Remember that an action is broadcast by the current process; only one
+   * process may send it
+   */
+  private recordBroadcast(action: string, pos: SourcePosition): void {
+    if (action.includes('[')) {
+      throw errorAt(pos, `@broadcast cannot annotate the indexed action ${action}`);
+    }
+    const process = this.process!;
+    if (process.family) {
+      throw errorAt(pos, `@broadcast cannot be used in the process family ${process.name}, whose instances would all send ${action}`);
+    }
+    const known = this.broadcasts[action];
+    if (known !== undefined && known !== process.name) {
+      throw errorAt(pos, `Action ${action} is broadcast by both ${known} and ${process.name}`);
+    }
+    this.broadcasts[action] = process.name;
+  }
+
+  /**
+   * label := action ('.' (action | number) | '[' (binding | expr) ']')*
+   * In a prefix, `[i:T]` binds an action range and `[expr]` stays symbolic
+   * until expansion. Elsewhere (relabelling, hiding) only `[expr]` over
+   * constants is allowed, and it is evaluated straight away.
+   */
+  private parseLabel(inPrefix = false): Label {
+    if (!isActionName(this.peek())) {
+      this.fail('Expected an action label');
+    }
+    let text = this.next().text;
+    let index: IndexRange | undefined;
+
+    for (;;) {
+      if (this.at('.') && ['ident', 'number'].includes(this.peek(1).kind)) {
+        this.next();
+        text += `.${this.next().text}`;
+      } else if (this.at('[')) {
+        const open = this.next();
+        if (this.atBinding()) {
+          if (!inPrefix) {
+            throw errorAt(open.pos, 'Index ranges are only allowed in action prefixes');
+          }
+          if (index || this.actionRange !== undefined) {
+            throw errorAt(open.pos, 'Nested index ranges are not supported');
+          }
+          index = this.parseBinding();
+          this.variables.add(index.variable);
+          this.actionRange = index.variable;
+          text += `[${index.variable}]`;
+        } else {
+          const expr = this.parseExpr();
+          text += inPrefix ? `[${expr}]` : `.${evaluateExpression(expr, this.constants)}`;
+        }
+        this.expect(']');
+      } else {
+        return { text, index };
+      }
+    }
+  }
+
+  /**
+   * compositeDef := '||' NAME '=' '(' member ('||' member)* ')' relabel? hide? priority? '.'
+   * member := ('forall' '[' NAME ':' rangeSpec ']')? NAME
+   */
+  private parseCompositeDef(): CompositeDef {
+    this.expect('||');
+    const token = this.peek();
+    if (!isProcessName(token)) {
+      this.fail('Expected a composite process name');
+    }
+    this.next();
+    this.expect('=');
+    this.expect('(');
+
+    const processes: CompositeDef['processes'] = [];
+    do {
+      let forall: IndexRange | undefined;
+      if (this.atKeyword('forall')) {
+        this.next();
+        this.expect('[');
+        if (!this.atBinding()) {
+          this.fail("Expected an index binding such as 'i:1..N' after forall");
+        }
+        forall = this.parseBinding();
+        this.expect(']');
+      }
+      const proc = this.peek();
+      if (!isProcessName(proc)) {
+        this.fail('Expected a process name');
+      }
+      this.next();
+      processes.push({ name: proc.text, ...(forall ? { forall } : {}), pos: proc.pos });
+    } while (this.accept('||'));
+    this.expect(')');
+
+    const relabel: Record<string, string> = {};
+    if (this.accept('/')) {
+      this.expect('{');
+      do {
+        const target = this.parseLabel().text;
+        this.expect('/');
+        relabel[this.parseLabel().text] = target;
+      } while (this.accept(','));
+      this.expect('}');
+    }
+
+    const hide: string[] = [];
+    if (this.accept('\\')) {
+      hide.push(...this.parseLabelSet());
+    }
+
+    let priority: ActionPriority | undefined;
+    if (this.accept('<<')) {
+      priority = { high: this.parseLabelSet() };
+    } else if (this.accept('>>')) {
+      priority = { low: this.parseLabelSet() };
+    }
+
+    this.expect('.');
+    return { name: token.text, processes, relabel, hide, ...(priority ? { priority } : {}), pos: token.pos };
+  }
+
+  /**
+   * labelSet := '{' label (',' label)* '}'
+   */
+  private parseLabelSet(): string[] {
+    const labels: string[] = [];
+    this.expect('{');
+    do {
+      labels.push(this.parseLabel().text);
+    } while (this.accept(','));
+    this.expect('}');
+    return labels;
+  }
+}
+
+/**
+ * Parse FSP source into its syntax tree
+ * @throws FSPParseError listing every error found, each under its source line
+ */
+export function parseFSPProgram(source: string): FSPProgram {
+  const errors: SourceError[] = [];
+  const program = new Parser(tokenize(source, errors), errors).parseProgram();
+  if (errors.length > 0) {
+    throw new FSPParseError(errors.sort((a, b) => a.pos.line - b.pos.line || a.pos.column - b.pos.column), source);
+  }
+  return program;
+}
+
+/**
+ * Split FSP source into its tokens and comments, for tools that rewrite the
+ * source rather than lower it
+ * @throws FSPParseError when the source does not parse
+ */
+export function lexFSP(source: string): { tokens: Token[]; comments: SourceComment[] } {
+  parseFSPProgram(source);
+  const comments: SourceComment[] = [];
+  const tokens = tokenize(source, [], comments).filter(token => token.kind !== 'eof');
+  return { tokens, comments };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Lowering
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Lower a primitive process to an LTS. The initial state is named after the
+ * process and the others are numbered in breadth-first order from `1`;
+ * `STOP` and `ERROR` keep their names, and
+ * a local definition's state is named after it (`Q`, or `Q[i][j]` when
+ * indexed, one state per value after expansion). A reference to another
+ * definition continues with that definition's behaviour, so recursion
+ * through any number of names produces a finite state machine. States
+ * inside an action range carry its variable, e.g. `1[i]`. The parts of a
+ * sequential composition `P ; Q` or an interrupt `P /\ Q` are lowered on
+ * their own and then combined, the states of each after the first prefixed
+ * with its position (`2.0`).
+ */
+function lowerProcess(
+  def: ProcessDef,
+  definitions: Map<string, ProcessDef>,
+  sequencing = new Set<string>(),
+): ProcessDefinition {
+  const transitions: Transition[] = [];
+  const entries = new Map<string, string>();
+  const resolving = new Set<string>();
+  const pending: { state: string; branches: Branch[]; scope: IndexRange[]; owner: ProcessDef }[] = [];
+  let stateCount = 0;
+
+  const bracketed = (parts: string[]) => parts.map(p => `[${p}]`).join('');
+
+  const stateOf = (expr: ProcessExpr, scope: IndexRange[], owner: ProcessDef, name?: string): string => {
+    switch (expr.kind) {
+      case 'stop':
+        return 'STOP';
+      case 'error':
+        return 'ERROR';
+      case 'choice': {
+        const state = name ?? `${stateCount++}${bracketed(scope.map(r => r.variable))}`;
+        pending.push({ state, branches: expr.branches, scope, owner });
+        return state;
+      }
+      case 'ref':
+        return expr.indices.length > 0 ? indexedState(expr, owner) : namedState(expr, owner);
+      case 'seq':
+      case 'interrupt':
+        return combinedState(expr, owner);
+    }
+  };
+
+  // `P ; Q` and `P /\ Q`: the parts lowered as processes of their own, then combined
+  const combinedState = (expr: Extract<ProcessExpr, { kind: 'seq' | 'interrupt' }>, owner: ProcessDef): string => {
+    if (sequencing.has(owner.name)) {
+      const operator = expr.kind === 'seq' ? 'sequential composition' : 'interrupt';
+      throw errorAt(expr.pos, `Process ${owner.name} recurses through its own ${operator}`);
+    }
+    sequencing.add(owner.name);
+    const parts = expr.parts.map((body, i) => {
+      const part: ProcessDef = { ...owner, name: `${owner.name}.${i + 1}`, index: undefined, body, extraAlphabet: [], property: false };
+      return lowerProcess(part, new Map(definitions).set(part.name, part), sequencing);
+    });
+    sequencing.delete(owner.name);
+
+    const combine = expr.kind === 'seq' ? sequenceProcesses : interruptProcess;
+    const combined = parts.reduce((first, second, i) => combine(first, second, `${i + 1}.`));
+    // Inside an inlined definition the states are qualified to keep them apart
+    const qualify = (state: string) =>
+      owner === def || state === 'STOP' || state === 'ERROR' ? state : `${owner.name}.${state}`;
+    for (const t of combined.transitions) {
+      transitions.push({ ...t, fromState: qualify(t.fromState), toState: qualify(t.toState) });
+    }
+    return qualify(combined.initialState);
+  };
+
+  // `NAME`: a local definition of the owner, or the entry of a definition
+  const namedState = (expr: Extract<ProcessExpr, { kind: 'ref' }>, owner: ProcessDef): string => {
+    const local = owner.locals.find(l => l.name === expr.name && l.indices.length === 0);
+    const key = local ? `${owner.name}/${expr.name}` : expr.name;
+    const known = entries.get(key);
+    if (known !== undefined) return known;
+
+    let state: string;
+    if (local) {
+      if (resolving.has(key)) {
+        throw errorAt(expr.pos, `Local definition ${expr.name} is defined only in terms of itself`);
+      }
+      resolving.add(key);
+      // Locals of an inlined definition are qualified to keep them apart
+      const name = owner === def ? local.name : `${owner.name}.${local.name}`;
+      state = stateOf(local.body, [], owner, name);
+      resolving.delete(key);
+    } else {
+      const target = definitions.get(expr.name);
+      if (!target) {
+        throw errorAt(expr.pos, `Undefined process ${expr.name}`);
+      }
+      if (target.index && target !== def) {
+        throw errorAt(expr.pos, `Process family ${expr.name} can only be composed, not referenced`);
+      }
+      if (resolving.has(key)) {
+        throw errorAt(expr.pos, `Process ${expr.name} is defined only in terms of itself`);
+      }
+      resolving.add(key);
+      state = stateOf(target.body, [], target);
+      resolving.delete(key);
+    }
+    entries.set(key, state);
+    return state;
+  };
+
+  // `NAME[e]...`: an indexed local definition, or a family's own instance
+  const indexedState = (expr: Extract<ProcessExpr, { kind: 'ref' }>, owner: ProcessDef): string => {
+    const local = owner.locals.find(l => l.name === expr.name && l.indices.length === expr.indices.length);
+    if (!local) {
+      if (expr.name === owner.name && owner.index && expr.indices.length === 1 &&
+        expr.indices[0] === owner.index.variable) {
+        return namedState({ ...expr, indices: [] }, owner);
+      }
+      throw errorAt(expr.pos, `No local definition ${expr.name} with ${expr.indices.length} index(es)`);
+    }
+
+    const key = `${owner.name}/${expr.name}/${expr.indices.length}`;
+    let entry = entries.get(key);
+    if (entry === undefined) {
+      const template = `${owner === def ? '' : `${owner.name}.`}${local.name}${bracketed(local.indices.map(r => r.variable))}`;
+      if (local.body.kind === 'ref') {
+        throw errorAt(local.pos, `Indexed local definition ${local.name} must start with a choice, STOP or ERROR`);
+      }
+      entries.set(key, template);
+      entry = stateOf(local.body, local.indices, owner, template);
+      entries.set(key, entry);
+    }
+    // Every index value names its own state; STOP and ERROR stay shared
+    if (entry === 'STOP' || entry === 'ERROR') return entry;
+    return `${owner === def ? '' : `${owner.name}.`}${local.name}${bracketed(expr.indices)}`;
+  };
+
+  const initialState = stateOf({ kind: 'ref', name: def.name, indices: [], pos: def.pos }, [], def);
+
+  for (let i = 0; i < pending.length; i++) {
+    const { state, branches, scope, owner } = pending[i];
+    for (const branch of branches) {
+      const index = branch.index ? [...scope, branch.index] : scope;
+      transitions.push({
+        fromState: state,
+        toState: stateOf(branch.next, index, owner),
+        action: branch.action,
+        ...(index.length > 0 ? { index: index.length === 1 ? index[0] : index } : {}),
+        ...(branch.guard !== undefined ? { guard: branch.guard } : {}),
+        ...(branch.weight !== undefined ? { weight: branch.weight } : {}),
+        ...(branch.direction ? { direction: branch.direction } : {}),
+        line: branch.pos.line,
+      });
+    }
+  }
+
+  // The parts of a composition are only renamed as the whole
+  const entry = sequencing.size === 0 ? entryState(def.name, initialState, transitions) : initialState;
+  const renamed = (state: string) => state === initialState ? entry : state;
+  const proc: ProcessDefinition = {
+    name: def.name,
+    initialState: entry,
+    transitions: transitions.map(t => ({ ...t, fromState: renamed(t.fromState), toState: renamed(t.toState) })),
+  };
+  if (def.index) proc.index = def.index;
+  if (def.extraAlphabet.length > 0) proc.extraAlphabet = def.extraAlphabet;
+  if (def.property) proc.property = true;
+  return proc;
+}
+
+/**
+ * Name for the initial state of a process: the process's own name when the
+ * state is a numbered one, unless a local definition already has that name
+ */
+function entryState(name: string, initialState: string, transitions: Transition[]): string {
+  if (!/^\d+$/.test(initialState)) return initialState;
+  if (transitions.some(t => t.fromState === name || t.toState === name)) return initialState;
+  return name;
+}
+
+/**
+ * Options for lowering an FSP program
+ */
+export interface LowerOptions {
+  /**
+   * The program is one of several files that make up a system, so its
+   * composition may name processes defined in the others
+   */
+  partial?: boolean;
+}
+
+/**
+ * Lower a parsed FSP program to an LTS specification. Every primitive process
+ * becomes a process and every family an indexed process; the last composite
+ * definition, if any, becomes the composition that selects the running
+ * system. Constants and ranges are carried over so that they can still be
+ * overridden before expansion.
+ */
+export function lowerFSP(program: FSPProgram, options: LowerOptions = {}): LTSSpec {
+  const definitions = new Map<string, ProcessDef>();
+  for (const def of program.processes) {
+    if (definitions.has(def.name)) {
+      throw errorAt(def.pos, `Process ${def.name} is defined more than once`);
+    }
+    definitions.set(def.name, def);
+  }
+
+  const processes = program.processes.map(def => lowerProcess(def, definitions));
+  const spec: LTSSpec = { processes };
+  if (Object.keys(program.constants).length > 0) spec.constants = program.constants;
+  if (Object.keys(program.ranges).length > 0) spec.ranges = program.ranges;
+  const actions: Record<string, ActionDeclaration> = {};
+  for (const [action, buffer] of Object.entries(program.buffers)) {
+    actions[action] = { buffer };
+  }
+  for (const [action, sender] of Object.entries(program.broadcasts)) {
+    actions[action] = { ...actions[action], broadcast: true, sender };
+  }
+  for (const [action, delay] of Object.entries(program.delays)) {
+    actions[action] = { ...actions[action], delay };
+  }
+  if (Object.keys(actions).length > 0) spec.actions = actions;
+  if (program.shared.length > 0) spec.shared = Array.from(new Set(program.shared));
+
+  const composite = program.composites[program.composites.length - 1];
+  if (composite) {
+    for (const proc of composite.processes) {
+      if (!definitions.has(proc.name) && !options.partial) {
+        throw errorAt(proc.pos, `Undefined process ${proc.name}`);
+      }
+    }
+
+    const composition: Composition = {
+      name: composite.name,
+      processes: composite.processes.map(p => p.name),
+      line: composite.pos.line,
+    };
+    if (Object.keys(composite.relabel).length > 0) composition.relabel = composite.relabel;
+    if (composite.hide.length > 0) composition.hide = composite.hide;
+    if (composite.priority) composition.priority = composite.priority;
+    const replicated = composite.processes.filter(p => p.forall);
+    if (replicated.length > 0) {
+      composition.forall = Object.fromEntries(replicated.map(p => [p.name, p.forall!]));
+    }
+    spec.composition = composition;
+  }
+
+  return spec;
+}
+
+/**
+ * Parse FSP source and lower it to an LTS specification
+ * @param source FSP text, e.g. `BUFF = (in -> out -> BUFF).`
+ */
+export function parseFSP(source: string, options: LowerOptions = {}): LTSSpec {
+  const program = parseFSPProgram(source);
+  try {
+    return lowerFSP(program, options);
+  } catch (err) {
+    // Errors of lowering point at the source too, so they get the same form
+    if (err instanceof PositionedError) {
+      throw new FSPParseError([{ pos: err.pos, message: err.reason }], source);
+    }
+    throw err;
+  }
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Writing
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Action labels FSP can read back: a lower-case name, then `.`-separated
+ * names or numbers, as in `lib1.put` or `move.0`
+ */
+const FSP_LABEL = /^[a-z][A-Za-z0-9_]*(\.([A-Za-z_][A-Za-z0-9_]*|\d+))*$/;
+
+/**
+ * Process and local definition names
+ */
+const FSP_NAME = /^[A-Z][A-Za-z0-9_]*$/;
+
+/**
+ * Check that an action can be written as an FSP label
+ */
+function fspLabel(action: string): string {
+  if (!FSP_LABEL.test(action) || action === 'when') {
+    throw new Error(`Action ${action} cannot be written in FSP, where a label starts with a lower-case letter; relabel it first`);
+  }
+  return action;
+}
+
+/**
+ * A label set, `{a, b}`
+ */
+function fspLabelSet(actions: string[]): string {
+  return `{${actions.map(fspLabel).join(', ')}}`;
+}
+
+/**
+ * States of a process reachable from its initial state, breadth first
+ */
+function reachableStates(proc: ProcessDefinition): string[] {
+  const states = [proc.initialState];
+  const seen = new Set(states);
+  for (let i = 0; i < states.length; i++) {
+    for (const t of proc.transitions) {
+      if (t.fromState === states[i] && !seen.has(t.toState)) {
+        seen.add(t.toState);
+        states.push(t.toState);
+      }
+    }
+  }
+  return states;
+}
+
+/**
+ * Names of the reachable states of a process in FSP. The initial state is
+ * the process itself, and a state with a valid name that nothing else uses
+ * keeps it; the others become `Q1`, `Q2`, ... in breadth-first order. A
+ * state without transitions behaves as STOP, so it is written as STOP.
+ * @param taken Names the process must not use for its states
+ */
+function stateNames(proc: ProcessDefinition, taken: Set<string>): Map<string, string> {
+  const states = reachableStates(proc);
+  const names = new Map<string, string>([['STOP', 'STOP'], ['ERROR', 'ERROR']]);
+  const used = new Set([...taken, proc.name]);
+  for (const state of states) {
+    if (state === proc.initialState) {
+      names.set(state, proc.name);
+    } else if (!names.has(state) && !proc.transitions.some(t => t.fromState === state)) {
+      names.set(state, 'STOP');
+    }
+  }
+  const rest = states.filter(state => !names.has(state));
+  for (const state of rest) {
+    if (FSP_NAME.test(state) && !used.has(state)) {
+      names.set(state, state);
+      used.add(state);
+    }
+  }
+  let next = 1;
+  for (const state of rest.filter(state => !names.has(state))) {
+    while (used.has(`Q${next}`)) next++;
+    names.set(state, `Q${next}`);
+    used.add(`Q${next}`);
+  }
+  return names;
+}
+
+/**
+ * Write a specification in FSP, so that the result of composing,
+ * relabelling or minimizing can be read as a spec. What is written is the
+ * system that runs: index ranges are expanded, variables unfolded into
+ * states, and only the composed processes are kept, with the composition's
+ * relabelling applied. Each reachable state becomes a local definition of
+ * its process; hidden actions become the composition's `\{...}` and silent
+ * ones `tau`. Channel capacities, broadcasts, delays, senders and `shared`
+ * are kept as annotations, `!` markers and a declaration. Parsing the result
+ * gives the same system up to the names of states.
+ * @param source The specification to write
+ * @returns FSP source, as `fmt` would lay it out
+ * @throws Error when the spec uses what FSP cannot express: payloads,
+ *   labels that are not FSP labels, or actions hidden on only some of
+ *   their transitions
+ */
+export function writeFSP(source: LTSSpec): string {
+  const composed = composeSpec(expandSpec(lowerDirections(source)));
+  const processes = composed.processes.map(proc => unfoldVariables(proc));
+  const silent = composed.silent ?? DEFAULT_SILENT_ACTION;
+  const actions = composed.actions ?? {};
+
+  for (const proc of processes) {
+    if (!FSP_NAME.test(proc.name) || proc.name === 'STOP' || proc.name === 'ERROR') {
+      throw new Error(`Process ${proc.name} cannot be written in FSP, where a process name starts with an upper-case letter`);
+    }
+  }
+  for (const [action, declaration] of Object.entries(actions)) {
+    if (declaration.payload !== undefined) {
+      throw new Error(`Action ${action} carries a payload of type ${declaration.payload}, which FSP cannot express; export the spec as JSON instead`);
+    }
+  }
+
+  // Hiding applies to every transition of an action, as `\{...}` does
+  const hidden = new Set<string>();
+  const visible = new Set<string>();
+  for (const t of processes.flatMap(proc => proc.transitions)) {
+    if (t.variable !== undefined) {
+      throw new Error(`Action ${t.action} passes a value in ${t.variable}, which FSP cannot express; export the spec as JSON instead`);
+    }
+    if (t.action !== silent) (t.hidden ? hidden : visible).add(t.action);
+  }
+  const partly = Array.from(hidden).find(action => visible.has(action));
+  if (partly !== undefined) {
+    throw new Error(`Action ${partly} is hidden on some of its transitions only, which FSP cannot express`);
+  }
+
+  // Every occurrence carries the delay; the first of the sender carries the rest
+  const annotated = new Set<string>();
+  const label = (proc: ProcessDefinition, t: Transition): string => {
+    if (t.action === silent) return 'tau';
+    const declaration = actions[t.action] ?? {};
+    const parts: string[] = [];
+    let direction = t.direction;
+    if (!annotated.has(t.action) && (declaration.buffer !== undefined || declaration.broadcast) &&
+      (!declaration.broadcast || declaration.sender === proc.name)) {
+      if (declaration.buffer !== undefined) parts.push(`@buffer(${declaration.buffer})`);
+      if (declaration.broadcast) parts.push('@broadcast');
+      annotated.add(t.action);
+    }
+    if (direction === undefined && !declaration.broadcast && declaration.sender === proc.name) {
+      direction = proc.transitions.some(other => other.action === t.action && other.direction === 'input') ? undefined : 'output';
+    }
+    const delay = declaration.delay !== undefined ? `@${declaration.delay}` : '';
+    parts.push(`${direction === 'output' ? '!' : direction === 'input' ? '?' : ''}${fspLabel(t.action)}${delay}`);
+    return parts.join(' ');
+  };
+
+  const prefix = (proc: ProcessDefinition, t: Transition, names: Map<string, string>): string => {
+    const weight = t.weight !== undefined ? `${t.weight}: ` : '';
+    if (weight !== '' && !/^\d+(\.\d+)?: $/.test(weight)) {
+      throw new Error(`Process ${proc.name}: the weight ${t.weight} of ${t.action} cannot be written in FSP`);
+    }
+    const guard = t.guard !== undefined ? `when (${t.guard}) ` : '';
+    return `${weight}${guard}${label(proc, t)} -> ${names.get(t.toState)}`;
+  };
+
+  const taken = new Set(processes.map(proc => proc.name));
+  const blocks: string[] = [];
+  if (composed.shared !== undefined) {
+    blocks.push(`shared ${fspLabelSet(composed.shared)}`);
+  }
+
+  for (const proc of processes) {
+    const names = stateNames(proc, taken);
+    const clauses: string[] = [];
+    const written = new Set<string>();
+    for (const state of reachableStates(proc)) {
+      const name = names.get(state)!;
+      if (written.has(name) || ((name === 'STOP' || name === 'ERROR') && state !== proc.initialState)) continue;
+      written.add(name);
+      const transitions = proc.transitions.filter(t => t.fromState === state);
+      const head = `${clauses.length === 0 && proc.property ? 'property ' : ''}${name} = `;
+      if (transitions.length === 0) {
+        clauses.push(`${head}${state === 'ERROR' ? 'ERROR' : 'STOP'}`);
+      } else {
+        clauses.push(`${head}(${transitions.map(t => prefix(proc, t, names)).join('\n    |')})`);
+      }
+    }
+    const alphabet = proc.extraAlphabet && proc.extraAlphabet.length > 0 ? ` + ${fspLabelSet(proc.extraAlphabet)}` : '';
+    blocks.push(`${clauses.join(',\n')}${alphabet}.`);
+  }
+
+  const composition = composed.composition ?? (hidden.size > 0
+    ? { name: taken.has('SYSTEM') ? 'SYSTEM_' : 'SYSTEM', processes: processes.map(proc => proc.name) }
+    : undefined);
+  if (composition) {
+    if (!FSP_NAME.test(composition.name)) {
+      throw new Error(`Composition ${composition.name} cannot be written in FSP, where a name starts with an upper-case letter`);
+    }
+    const hide = hidden.size > 0 ? `\\${fspLabelSet(Array.from(hidden).sort())}` : '';
+    const { high, low } = composition.priority ?? {};
+    if (high && low) {
+      throw new Error(`Composition ${composition.name} has both high and low priority actions, but FSP allows one of them only`);
+    }
+    const priority = high ? ` << ${fspLabelSet(high)}` : low ? ` >> ${fspLabelSet(low)}` : '';
+    blocks.push(`||${composition.name} = (${composition.processes.join(' || ')})${hide}${priority}.`);
+  }
+
+  return blocks.join('\n\n') + '\n';
+}
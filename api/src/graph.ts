@@ -0,0 +1,407 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTS Graph Export
+// Renders the state machine of each process as a diagram description
+// ═══════════════════════════════════════════════════════════════════════════
+
+import {
+  LTSSpec,
+  ProcessDefinition,
+  analyzeActionUsage,
+  actionKind,
+  getAllStates,
+} from './transpiler';
+import { spawnSync } from 'child_process';
+import { normalizeSpec } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+const SHARED_EDGE_COLOR = '#1f6feb';
+const INTERNAL_EDGE_COLOR = '#8b949e';
+
+/**
+ * Colors of the states the system is in and the edges it just took, in
+ * the frames of an animated trace
+ */
+const ACTIVE_STATE_COLOR = '#ffd33d';
+const ACTIVE_EDGE_COLOR = '#d1242f';
+
+/**
+ * Graphviz command that lays out DOT, and where to get it
+ */
+const GRAPHVIZ_COMMAND = 'dot';
+const GRAPHVIZ_DOWNLOAD = 'https://graphviz.org/download/';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Outcome of running an external command
+ */
+export interface CommandResult {
+  /** Exit code, or null when the command could not be started or was killed */
+  status: number | null;
+  stdout: string;
+  stderr: string;
+  /** Set when the command could not be started, e.g. ENOENT when it is not installed */
+  error?: NodeJS.ErrnoException;
+}
+
+/**
+ * Run a command with `input` on its standard input and wait for it
+ */
+export type CommandRunner = (command: string, args: string[], input: string) => CommandResult;
+
+/**
+ * One line of a trace file written by generated code under `traceFile`
+ */
+export interface TraceRecord {
+  seq: number;
+  process: string;
+  from: string;
+  action: string;
+  to: string;
+  branch: number;
+}
+
+/**
+ * One step of a recorded run: an action, with the trace lines of every
+ * process that took part in it
+ */
+export interface RecordedStep {
+  action: string;
+  records: TraceRecord[];
+  /** State of every process once the step is done */
+  states: Record<string, string>;
+}
+
+/**
+ * What a frame of an animated trace highlights
+ */
+interface Highlight {
+  title: string;
+  states: Record<string, string>;
+  taken: TraceRecord[];
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Run a command through child_process
+ */
+const runCommand: CommandRunner = (command, args, input) => {
+  const result = spawnSync(command, args, { input, encoding: 'utf8' });
+  return { status: result.status, stdout: result.stdout ?? '', stderr: result.stderr ?? '', error: result.error };
+};
+
+/**
+ * Quote a string as a DOT identifier
+ */
+function dotId(value: string): string {
+  return `"${value.replace(/\\/g, '\\\\').replace(/"/g, '\\"')}"`;
+}
+
+/**
+ * Node name for a process state, matching the state names used in generated Go
+ */
+function nodeName(proc: ProcessDefinition, state: string): string {
+  return `${proc.name}_${state}`;
+}
+
+/**
+ * A state with no outgoing transitions (or STOP or ERROR) ends the process
+ */
+function isTerminalState(proc: ProcessDefinition, state: string): boolean {
+  return state === 'STOP' || state === 'ERROR' || !proc.transitions.some(t => t.fromState === state);
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// DOT Export
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Generate a Graphviz DOT description of every process in the spec.
+ * Each process is drawn as its own cluster; shared (synchronizing) actions
+ * are colored differently from internal ones and annotated as send/receive.
+ */
+export function generateDOT(source: LTSSpec): string {
+  return renderDOT(normalizeSpec(source));
+}
+
+/**
+ * DOT description of a normalized spec, optionally highlighting where the
+ * system is and the transitions it just took
+ */
+function renderDOT(spec: LTSSpec, highlight?: Highlight): string {
+  const actionUsage = analyzeActionUsage(spec);
+  const lines: string[] = [];
+
+  lines.push('digraph LTS {');
+  lines.push('\trankdir=LR;');
+  if (highlight) {
+    lines.push(`\tlabel=${dotId(highlight.title)};`);
+    lines.push('\tlabelloc=t;');
+  }
+  lines.push('\tnode [shape=circle, fontname="Helvetica"];');
+  lines.push('\tedge [fontname="Helvetica", fontsize=10];');
+
+  for (const proc of spec.processes) {
+    lines.push('');
+    lines.push(`\tsubgraph ${dotId(`cluster_${proc.name}`)} {`);
+    lines.push(`\t\tlabel=${dotId(proc.name)};`);
+
+    // Invisible entry point marking the initial state
+    const start = `__start_${proc.name}`;
+    lines.push(`\t\t${dotId(start)} [shape=point, label=""];`);
+
+    for (const state of Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort()) {
+      const shape = isTerminalState(proc, state) ? ', shape=doublecircle' : '';
+      const color = state === 'ERROR' ? ', color=red' : '';
+      const fill = highlight?.states[proc.name] === state ? `, style=filled, fillcolor=${dotId(ACTIVE_STATE_COLOR)}` : '';
+      lines.push(`\t\t${dotId(nodeName(proc, state))} [label=${dotId(nodeName(proc, state))}${shape}${color}${fill}];`);
+    }
+
+    lines.push(`\t\t${dotId(start)} -> ${dotId(nodeName(proc, proc.initialState))};`);
+
+    for (const t of proc.transitions) {
+      const kind = actionKind(actionUsage, proc.name, t.action);
+      const label = kind === 'internal' ? t.action : `${t.action} (${kind})`;
+      const taken = highlight?.taken.some(r =>
+        r.process === proc.name && r.from === t.fromState && r.action === t.action && r.to === t.toState);
+      const color = taken ? ACTIVE_EDGE_COLOR : kind === 'internal' ? INTERNAL_EDGE_COLOR : SHARED_EDGE_COLOR;
+      const style = (t.hidden ? ', style=dashed' : '') + (taken ? ', penwidth=3' : '');
+      lines.push(
+        `\t\t${dotId(nodeName(proc, t.fromState))} -> ${dotId(nodeName(proc, t.toState))} ` +
+        `[label=${dotId(label)}, color=${dotId(color)}, fontcolor=${dotId(color)}${style}];`
+      );
+    }
+
+    lines.push('\t}');
+  }
+
+  lines.push('}');
+  lines.push('');
+  return lines.join('\n');
+}
+
+/**
+ * Render the DOT description of every process as an SVG image, laid out by
+ * Graphviz's `dot` command
+ * @param source The specification to draw
+ * @param run Runs `dot`; defaults to starting it from the PATH
+ * @throws When Graphviz is not installed, fails, or does not return SVG
+ */
+export function generateSVG(source: LTSSpec, run: CommandRunner = runCommand): string {
+  const result = run(GRAPHVIZ_COMMAND, ['-Tsvg'], generateDOT(source));
+  if (result.error?.code === 'ENOENT') {
+    throw new Error(`SVG output needs Graphviz, but there is no '${GRAPHVIZ_COMMAND}' command on the PATH. ` +
+      `Install it from ${GRAPHVIZ_DOWNLOAD}, or use --format=dot and render the file elsewhere`);
+  }
+  if (result.error) {
+    throw new Error(`Could not run Graphviz: ${result.error.message}`);
+  }
+  if (result.status !== 0) {
+    throw new Error(`Graphviz failed${result.status === null ? '' : ` with exit code ${result.status}`}: ${result.stderr.trim() || 'no output'}`);
+  }
+  if (!result.stdout.includes('<svg')) {
+    throw new Error('Graphviz did not return an SVG image');
+  }
+  return result.stdout;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Animated Traces
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Read a trace file written under `traceFile`, one JSON object per line
+ */
+export function readTrace(content: string): TraceRecord[] {
+  return content.split('\n').flatMap((line, i) => {
+    if (line.trim() === '') return [];
+    let record: Partial<TraceRecord>;
+    try {
+      record = JSON.parse(line);
+    } catch {
+      throw new Error(`Trace line ${i + 1} is not JSON`);
+    }
+    if (typeof record !== 'object' || record === null ||
+      !(['process', 'from', 'action', 'to'] as const).every(key => typeof record[key] === 'string')) {
+      throw new Error(`Trace line ${i + 1} is not a trace entry; expected process, from, action and to`);
+    }
+    return [record as TraceRecord];
+  });
+}
+
+/**
+ * Group the lines of a trace into the steps of the system. Every process
+ * writes its own line, so a synchronization takes one line from each process
+ * with the action in its alphabet, which need not be adjacent; a local
+ * action is a step of its own. Steps come in the order of their first line.
+ * @throws When a line does not fit the spec: an unknown process, a
+ *   transition it does not have, or a state it is not in
+ */
+function recordedSteps(spec: LTSSpec, trace: TraceRecord[]): RecordedStep[] {
+  const actionUsage = analyzeActionUsage(spec);
+  const processes = new Map(spec.processes.map(proc => [proc.name, proc]));
+  const current = new Map(spec.processes.map(proc => [proc.name, proc.initialState]));
+  const steps: { action: string; records: TraceRecord[]; waiting: Set<string> }[] = [];
+
+  trace.forEach((record, i) => {
+    const proc = processes.get(record.process);
+    if (!proc) {
+      throw new Error(`Trace line ${i + 1}: the spec has no process ${record.process}`);
+    }
+    if (current.get(proc.name) !== record.from) {
+      throw new Error(`Trace line ${i + 1}: ${proc.name} is in ${current.get(proc.name)}, not ${record.from}`);
+    }
+    if (!proc.transitions.some(t => t.fromState === record.from && t.action === record.action && t.toState === record.to)) {
+      throw new Error(`Trace line ${i + 1}: ${proc.name} has no transition ${record.from} -${record.action}-> ${record.to}`);
+    }
+    current.set(proc.name, record.to);
+
+    let step = steps.find(s => s.action === record.action && s.waiting.has(proc.name));
+    if (!step) {
+      step = { action: record.action, records: [], waiting: new Set(actionUsage.get(record.action)?.processes ?? []) };
+      steps.push(step);
+    }
+    step.records.push(record);
+    step.waiting.delete(proc.name);
+  });
+
+  // A step leaves every process where its latest line up to then put it
+  const states = Object.fromEntries(spec.processes.map(proc => [proc.name, proc.initialState]));
+  const latest = new Map<string, number>();
+  return steps.map(({ action, records }) => {
+    for (const record of records) {
+      const line = trace.indexOf(record);
+      if (line > (latest.get(record.process) ?? -1)) {
+        latest.set(record.process, line);
+        states[record.process] = record.to;
+      }
+    }
+    return { action, records, states: { ...states } };
+  });
+}
+
+/**
+ * Generate one DOT description per step of a recorded run, for stitching
+ * into an animation. Each frame is the full diagram of `generateDOT`, with
+ * the state each process is in after the step filled and the transitions
+ * of the step drawn thick.
+ * @param source The specification the trace was recorded from
+ * @param trace The lines of its trace file, as `readTrace` returns them
+ */
+export function generateDOTFrames(source: LTSSpec, trace: TraceRecord[]): string[] {
+  const spec = normalizeSpec(source);
+  return recordedSteps(spec, trace).map((step, i) =>
+    renderDOT(spec, { title: `Step ${i + 1}: ${step.action}`, states: step.states, taken: step.records }));
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Mermaid Export
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Mermaid state ids may only contain word characters
+ */
+function mermaidId(proc: ProcessDefinition, state: string): string {
+  return nodeName(proc, state).replace(/[^a-zA-Z0-9_]/g, '_');
+}
+
+/**
+ * Generate Mermaid stateDiagram-v2 blocks, one fenced block per process,
+ * ready to paste into Markdown rendered by GitHub
+ */
+export function generateMermaid(source: LTSSpec): string {
+  const spec = normalizeSpec(source);
+  const blocks: string[] = [];
+
+  for (const proc of spec.processes) {
+    const lines: string[] = [];
+    lines.push('```mermaid');
+    lines.push('stateDiagram-v2');
+    lines.push(`    %% ${proc.name}`);
+    lines.push(`    [*] --> ${mermaidId(proc, proc.initialState)}`);
+
+    for (const t of proc.transitions) {
+      lines.push(`    ${mermaidId(proc, t.fromState)} --> ${mermaidId(proc, t.toState)} : ${t.action}`);
+    }
+
+    for (const state of Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort()) {
+      if (isTerminalState(proc, state)) {
+        lines.push(`    ${mermaidId(proc, state)} --> [*]`);
+      }
+    }
+
+    lines.push('```');
+    blocks.push(lines.join('\n'));
+  }
+
+  return blocks.join('\n\n') + '\n';
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// PlantUML Export
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * PlantUML state ids are identifiers; other names get an alias
+ */
+function plantumlId(state: string): string {
+  return state.replace(/[^a-zA-Z0-9_]/g, '_').replace(/^(\d)/, '_$1');
+}
+
+/**
+ * Generate PlantUML state diagrams, one `@startuml ... @enduml` block per
+ * process. As in the DOT export, shared actions are annotated as send or
+ * receive and drawn in their own color, and hidden actions are dashed.
+ */
+export function generatePlantUML(source: LTSSpec): string {
+  const spec = normalizeSpec(source);
+  const actionUsage = analyzeActionUsage(spec);
+  const blocks: string[] = [];
+
+  for (const proc of spec.processes) {
+    const lines: string[] = [];
+    const states = Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort();
+    lines.push(`@startuml ${plantumlId(proc.name)}`);
+    lines.push(`title ${proc.name}`);
+
+    for (const state of states) {
+      const color = state === 'ERROR' ? ' #red' : '';
+      if (plantumlId(state) !== state) {
+        lines.push(`state "${state}" as ${plantumlId(state)}${color}`);
+      } else if (color) {
+        lines.push(`state ${state}${color}`);
+      }
+    }
+
+    lines.push(`[*] --> ${plantumlId(proc.initialState)}`);
+    for (const t of proc.transitions) {
+      const kind = actionKind(actionUsage, proc.name, t.action);
+      const label = kind === 'internal' ? t.action : `${t.action} (${kind})`;
+      const styles = [
+        ...(kind === 'internal' ? [] : [SHARED_EDGE_COLOR]),
+        ...(t.hidden ? ['dashed'] : []),
+      ];
+      const arrow = styles.length > 0 ? `-[${styles.join(',')}]->` : '-->';
+      lines.push(`${plantumlId(t.fromState)} ${arrow} ${plantumlId(t.toState)} : ${label}`);
+    }
+
+    for (const state of states) {
+      if (isTerminalState(proc, state)) {
+        lines.push(`${plantumlId(state)} --> [*]`);
+      }
+    }
+
+    lines.push('@enduml');
+    blocks.push(lines.join('\n'));
+  }
+
+  return blocks.join('\n\n') + '\n';
+}
@@ -7,7 +7,8 @@ import { tmpdir } from 'os';
 import { randomUUID } from 'crypto';
 
 // Transpiler and Docker executor imports
-import { transpile, transpileFlat, LTSSpec, FlatTransition } from './transpiler';
+import { transpile, transpileFlat, flatToSpec, LTSSpec, FlatTransition, GeneratorOptions } from './transpiler';
+import { analyze, reachableStates, ExploreOptions } from './analysis';
 import { 
   executeGoCode, 
   isDockerAvailable, 
@@ -45,6 +46,7 @@ interface LTSResponse {
 // Transpiler request types
 interface TranspileRequest {
   spec: LTSSpec | FlatTransition[];
+  options?: GeneratorOptions;
 }
 
 interface TranspileAndRunRequest extends TranspileRequest {
@@ -137,6 +139,8 @@ app.get('/', (req: Request, res: Response) => {
       // Transpiler endpoints
       transpile: 'POST /transpile',
       transpileAndRun: 'POST /transpile-and-run',
+      analyze: 'POST /analyze',
+      states: 'POST /states',
       dockerStatus: 'GET /docker/status'
     }
   });
@@ -319,7 +323,7 @@ app.post('/docker/pull', asyncHandler(async (req: Request, res: Response) => {
 
 // Transpile LTS spec to Go code
 app.post('/transpile', asyncHandler(async (req: Request, res: Response) => {
-  const { spec } = req.body as TranspileRequest;
+  const { spec, options = {} } = req.body as TranspileRequest;
   
   if (!spec) {
     res.status(400).json({ error: 'spec is required' });
@@ -331,9 +335,9 @@ app.post('/transpile', asyncHandler(async (req: Request, res: Response) => {
     
     // Detect format: flat array or structured spec
     if (Array.isArray(spec)) {
-      goCode = transpileFlat(spec as FlatTransition[]);
+      goCode = transpileFlat(spec as FlatTransition[], options);
     } else if ((spec as LTSSpec).processes) {
-      goCode = transpile(spec as LTSSpec);
+      goCode = transpile(spec as LTSSpec, options);
     } else {
       res.status(400).json({ 
         error: 'Invalid spec format. Expected either an array of flat transitions or an object with "processes" property.' 
@@ -354,9 +358,74 @@ app.post('/transpile', asyncHandler(async (req: Request, res: Response) => {
   }
 }));
 
+// Analyze LTS spec for reachable deadlocks and ERROR states
+app.post('/analyze', asyncHandler(async (req: Request, res: Response) => {
+  const { spec, partialOrder, symmetry } = req.body as TranspileRequest & ExploreOptions;
+  
+  if (!spec) {
+    res.status(400).json({ error: 'spec is required' });
+    return;
+  }
+
+  if (!Array.isArray(spec) && !(spec as LTSSpec).processes) {
+    res.status(400).json({ 
+      error: 'Invalid spec format. Expected either an array of flat transitions or an object with "processes" property.' 
+    });
+    return;
+  }
+
+  try {
+    const ltsSpec = Array.isArray(spec) ? flatToSpec(spec as FlatTransition[]) : spec as LTSSpec;
+    const result = analyze(ltsSpec, { partialOrder, symmetry });
+
+    res.json({
+      success: result.deadlocks.length === 0 && result.errors.length === 0,
+      ...result
+    });
+  } catch (err) {
+    res.status(400).json({
+      success: false,
+      error: err instanceof Error ? err.message : 'Analysis failed'
+    });
+  }
+}));
+
+// Enumerate reachable global states of the composed system
+app.post('/states', asyncHandler(async (req: Request, res: Response) => {
+  const { spec, maxStates, partialOrder, symmetry } = req.body as TranspileRequest & ExploreOptions;
+
+  if (!spec) {
+    res.status(400).json({ error: 'spec is required' });
+    return;
+  }
+
+  if (!Array.isArray(spec) && !(spec as LTSSpec).processes) {
+    res.status(400).json({ 
+      error: 'Invalid spec format. Expected either an array of flat transitions or an object with "processes" property.' 
+    });
+    return;
+  }
+
+  try {
+    const ltsSpec = Array.isArray(spec) ? flatToSpec(spec as FlatTransition[]) : spec as LTSSpec;
+    const states = reachableStates(ltsSpec, { maxStates, partialOrder, symmetry });
+
+    res.json({
+      success: true,
+      count: states.length,
+      states
+    });
+  } catch (err) {
+    res.status(400).json({
+      success: false,
+      error: err instanceof Error ? err.message : 'Exploration failed'
+    });
+  }
+}));
+
 // Transpile and run in Docker
 app.post('/transpile-and-run', asyncHandler(async (req: Request, res: Response) => {
-  const { spec, timeoutMs, memoryLimit, cpuLimit } = req.body as TranspileAndRunRequest;
+  const { spec, options = {}, timeoutMs, memoryLimit, cpuLimit } = req.body as TranspileAndRunRequest;
   
   if (!spec) {
     res.status(400).json({ error: 'spec is required' });
@@ -391,9 +460,9 @@ app.post('/transpile-and-run', asyncHandler(async (req: Request, res: Response)
   let goCode: string;
   try {
     if (Array.isArray(spec)) {
-      goCode = transpileFlat(spec as FlatTransition[]);
+      goCode = transpileFlat(spec as FlatTransition[], options);
     } else if ((spec as LTSSpec).processes) {
-      goCode = transpile(spec as LTSSpec);
+      goCode = transpile(spec as LTSSpec, options);
     } else {
       res.status(400).json({ 
         success: false,
@@ -469,6 +538,8 @@ app.listen(PORT, () => {
 ║  Transpiler Endpoints:                                                    ║
 ║    POST /transpile       - Convert LTS spec to Go code                    ║
 ║    POST /transpile-and-run - Transpile & execute in Docker               ║
+║    POST /analyze         - Check LTS spec for reachable deadlocks         ║
+║    POST /states          - List reachable global states                   ║
 ║    GET  /docker/status   - Check Docker availability                      ║
 ║    POST /docker/pull     - Pull Go Docker image                           ║
 ╚═══════════════════════════════════════════════════════════════════════════╝
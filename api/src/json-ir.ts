@@ -0,0 +1,215 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// JSON Intermediate Representation
+// A stable, versioned serialization of a normalized LTS specification for
+// tools built on top of anvilts
+// ═══════════════════════════════════════════════════════════════════════════
+
+import {
+  LTSSpec,
+  ProcessDefinition,
+  ActionDeclaration,
+  ActionKind,
+  analyzeActionUsage,
+  actionKind,
+  getAllStates,
+  isSharedAction,
+} from './transpiler';
+import { normalizeSpec } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Current IR schema version, bumped on any incompatible change
+ */
+export const IR_VERSION = 1;
+
+/**
+ * A transition in the IR, annotated with how its process takes part in it
+ */
+export interface IRTransition {
+  from: string;
+  action: string;
+  to: string;
+  kind: ActionKind;
+  variable?: string;
+  hidden?: boolean;
+  guard?: string;
+  update?: Record<string, string>;
+  weight?: number;
+}
+
+/**
+ * A process in the IR with its full state set
+ */
+export interface IRProcess {
+  name: string;
+  initialState: string;
+  states: string[];
+  transitions: IRTransition[];
+  variables?: Record<string, number>;
+  extraAlphabet?: string[];
+  property?: boolean;
+}
+
+/**
+ * An action in the IR with its sharing classification
+ */
+export interface IRAction {
+  name: string;
+  shared: boolean;
+  processes: string[];
+  sender?: string;
+  payload?: string;
+  buffer?: number;
+  broadcast?: boolean;
+}
+
+/**
+ * The serialized model
+ */
+export interface LTSIR {
+  version: number;
+  composition?: { name: string; processes: string[] };
+  actions: IRAction[];
+  processes: IRProcess[];
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Conversion
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Convert a specification to the IR. The spec is normalized first, so the IR
+ * only contains concrete processes, states and actions.
+ */
+export function toIR(source: LTSSpec): LTSIR {
+  const spec = normalizeSpec(source);
+  const actionUsage = analyzeActionUsage(spec);
+
+  const actions: IRAction[] = Array.from(actionUsage.keys()).sort().map(name => {
+    const usage = actionUsage.get(name)!;
+    const shared = isSharedAction(usage);
+    const action: IRAction = { name, shared, processes: Array.from(usage.processes).sort() };
+    if (shared) action.sender = usage.sender;
+    const payload = spec.actions?.[name]?.payload;
+    if (payload) action.payload = payload;
+    const buffer = spec.actions?.[name]?.buffer;
+    if (buffer !== undefined) action.buffer = buffer;
+    if (spec.actions?.[name]?.broadcast) action.broadcast = true;
+    return action;
+  });
+
+  const processes: IRProcess[] = spec.processes.map(proc => ({
+    name: proc.name,
+    initialState: proc.initialState,
+    states: Array.from(new Set([proc.initialState, ...getAllStates(proc)])),
+    transitions: proc.transitions.map(t => {
+      const transition: IRTransition = {
+        from: t.fromState,
+        action: t.action,
+        to: t.toState,
+        kind: actionKind(actionUsage, proc.name, t.action),
+      };
+      if (t.variable) transition.variable = t.variable;
+      if (t.hidden) transition.hidden = true;
+      if (t.guard !== undefined) transition.guard = t.guard;
+      if (t.update) transition.update = t.update;
+      if (t.weight !== undefined) transition.weight = t.weight;
+      return transition;
+    }),
+    // Expansion has evaluated the initial values
+    ...(proc.variables ? { variables: proc.variables as Record<string, number> } : {}),
+    ...(proc.extraAlphabet ? { extraAlphabet: proc.extraAlphabet } : {}),
+    ...(proc.property ? { property: true } : {}),
+  }));
+
+  const ir: LTSIR = { version: IR_VERSION, actions, processes };
+  if (spec.composition) {
+    ir.composition = { name: spec.composition.name, processes: spec.composition.processes };
+  }
+  return ir;
+}
+
+/**
+ * Convert an IR document back to a specification
+ */
+export function fromIR(ir: LTSIR): LTSSpec {
+  if (!ir || typeof ir !== 'object') {
+    throw new Error('Invalid IR document');
+  }
+  if (ir.version !== IR_VERSION) {
+    throw new Error(`Unsupported IR version ${ir.version} (expected ${IR_VERSION})`);
+  }
+  if (!Array.isArray(ir.processes)) {
+    throw new Error('Invalid IR document: missing "processes"');
+  }
+
+  const processes: ProcessDefinition[] = ir.processes.map(proc => ({
+    name: proc.name,
+    initialState: proc.initialState,
+    transitions: proc.transitions.map(t => ({
+      fromState: t.from,
+      toState: t.to,
+      action: t.action,
+      ...(t.variable ? { variable: t.variable } : {}),
+      ...(t.hidden ? { hidden: true } : {}),
+      ...(t.guard !== undefined ? { guard: t.guard } : {}),
+      ...(t.update ? { update: t.update } : {}),
+      ...(t.weight !== undefined ? { weight: t.weight } : {}),
+    })),
+    ...(proc.variables ? { variables: proc.variables } : {}),
+    ...(proc.extraAlphabet ? { extraAlphabet: proc.extraAlphabet } : {}),
+    ...(proc.property ? { property: true } : {}),
+  }));
+
+  const spec: LTSSpec = { processes };
+  // Only senders that differ from the inferred ones were declared
+  const inferred = analyzeActionUsage(spec);
+
+  const actions: Record<string, ActionDeclaration> = {};
+  for (const action of ir.actions ?? []) {
+    const declaration: ActionDeclaration = {};
+    if (action.payload) declaration.payload = action.payload;
+    if (action.sender && action.sender !== inferred.get(action.name)?.sender) declaration.sender = action.sender;
+    if (action.buffer !== undefined) declaration.buffer = action.buffer;
+    if (action.broadcast) declaration.broadcast = true;
+    if (Object.keys(declaration).length > 0) actions[action.name] = declaration;
+  }
+  if (Object.keys(actions).length > 0) spec.actions = actions;
+  // A shared action of a single process only synchronizes when declared so,
+  // and declaring any means declaring every other shared action
+  const shared = (ir.actions ?? []).filter(action => action.shared);
+  if (shared.some(action => action.processes.length === 1)) spec.shared = shared.map(action => action.name);
+
+  if (ir.composition) {
+    spec.composition = { name: ir.composition.name, processes: ir.composition.processes };
+  }
+  return spec;
+}
+
+/**
+ * Whether parsed JSON is an IR document rather than a plain specification
+ */
+export function isIR(data: unknown): data is LTSIR {
+  return !!data && typeof data === 'object' && !Array.isArray(data) && 'version' in data;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Serialization
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Serialize a specification as IR JSON
+ */
+export function writeJSON(spec: LTSSpec): string {
+  return JSON.stringify(toIR(spec), null, 2) + '\n';
+}
+
+/**
+ * Parse IR JSON back into a specification
+ */
+export function readJSON(text: string): LTSSpec {
+  return fromIR(JSON.parse(text));
+}
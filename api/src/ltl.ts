@@ -0,0 +1,299 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTL Safety Properties
+// A small linear temporal logic over actions, checked by formula progression:
+// each action rewrites the formula into what must hold from then on, and a
+// formula that progresses to `false` has been violated by a finite trace
+// ═══════════════════════════════════════════════════════════════════════════
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * An LTL formula whose atoms are action names. An atom holds at a step when
+ * that step's action is the named one.
+ */
+export type LTLFormula =
+  | { kind: 'const'; value: boolean }
+  | { kind: 'atom'; action: string }
+  | { kind: 'not'; operand: LTLFormula }
+  | { kind: 'and'; operands: LTLFormula[] }
+  | { kind: 'or'; operands: LTLFormula[] }
+  | { kind: 'next'; operand: LTLFormula }
+  | { kind: 'globally'; operand: LTLFormula }
+  | { kind: 'until'; left: LTLFormula; right: LTLFormula; weak: boolean; bound?: number };
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Constructors
+// ─────────────────────────────────────────────────────────────────────────────
+
+const TRUE: LTLFormula = { kind: 'const', value: true };
+const FALSE: LTLFormula = { kind: 'const', value: false };
+
+/**
+ * Canonical text of a formula, used both for display and to detect
+ * monitor states that have been seen before
+ */
+export function formatLTL(f: LTLFormula): string {
+  switch (f.kind) {
+    case 'const': return String(f.value);
+    case 'atom': return f.action;
+    case 'not': return `!${formatLTL(f.operand)}`;
+    case 'and': return `(${f.operands.map(formatLTL).join(' && ')})`;
+    case 'or': return `(${f.operands.map(formatLTL).join(' || ')})`;
+    case 'next': return `X ${formatLTL(f.operand)}`;
+    case 'globally': return `G ${formatLTL(f.operand)}`;
+    case 'until': {
+      const op = `${f.weak ? 'W' : 'U'}${f.bound !== undefined ? `[${f.bound}]` : ''}`;
+      return `(${formatLTL(f.left)} ${op} ${formatLTL(f.right)})`;
+    }
+  }
+}
+
+/**
+ * Conjunction and disjunction are kept flat, deduplicated and sorted so
+ * that equivalent monitor states share one canonical form
+ */
+function junction(kind: 'and' | 'or', operands: LTLFormula[]): LTLFormula {
+  const unit = kind === 'and' ? true : false;
+  const flat = new Map<string, LTLFormula>();
+
+  for (const operand of operands) {
+    if (operand.kind === 'const') {
+      if (operand.value === unit) continue;
+      return operand;
+    }
+    for (const part of operand.kind === kind ? operand.operands : [operand]) {
+      flat.set(formatLTL(part), part);
+    }
+  }
+
+  const parts = Array.from(flat.keys()).sort().map(key => flat.get(key)!);
+  if (parts.length === 0) return unit ? TRUE : FALSE;
+  if (parts.length === 1) return parts[0];
+  return { kind, operands: parts };
+}
+
+function and(...operands: LTLFormula[]): LTLFormula {
+  return junction('and', operands);
+}
+
+function or(...operands: LTLFormula[]): LTLFormula {
+  return junction('or', operands);
+}
+
+function not(operand: LTLFormula): LTLFormula {
+  if (operand.kind === 'const') return operand.value ? FALSE : TRUE;
+  if (operand.kind === 'not') return operand.operand;
+  return { kind: 'not', operand };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Parser
+// ─────────────────────────────────────────────────────────────────────────────
+
+const TOKEN_PATTERN = /\s*([A-Za-z_][A-Za-z0-9_.]*|\d+|&&|\|\||->|[!()\[\]])/y;
+
+/**
+ * Temporal operators written as a single capital letter
+ */
+const UNARY_TEMPORAL = new Set(['G', 'X', 'F']);
+const BINARY_TEMPORAL = new Set(['U', 'W']);
+
+/**
+ * Parse a property such as `G(consume -> !put)` or `!consume W put`.
+ * Supported: `true`, `false`, action atoms, `!`, `&&`, `||`, `->`, and the
+ * temporal operators `G`, `X`, `U`, `W` (weak until) plus the bounded forms
+ * `U[k]` and `F[k]` (eventually within k steps). Unbounded `F` is a liveness
+ * operator and is rejected.
+ */
+export function parseLTL(source: string): LTLFormula {
+  const tokens: string[] = [];
+  TOKEN_PATTERN.lastIndex = 0;
+  while (TOKEN_PATTERN.lastIndex < source.length) {
+    if (/^\s*$/.test(source.slice(TOKEN_PATTERN.lastIndex))) break;
+    const at = TOKEN_PATTERN.lastIndex;
+    const match = TOKEN_PATTERN.exec(source);
+    if (!match) {
+      throw new Error(`Unexpected character '${source[at]}' in property "${source}"`);
+    }
+    tokens.push(match[1]);
+  }
+
+  let pos = 0;
+  const fail = (message: string): never => {
+    throw new Error(`${message} in property "${source}"`);
+  };
+  const expect = (token: string) => {
+    if (tokens[pos] !== token) fail(`Expected '${token}'`);
+    pos++;
+  };
+
+  // Optional `[k]` after a bounded operator
+  const parseBound = (): number | undefined => {
+    if (tokens[pos] !== '[') return undefined;
+    pos++;
+    const bound = tokens[pos++];
+    if (bound === undefined || !/^\d+$/.test(bound)) fail('Expected a step bound');
+    expect(']');
+    return Number(bound);
+  };
+
+  // implication := disjunction ('->' implication)?
+  const parseImplication = (): LTLFormula => {
+    const left = parseDisjunction();
+    if (tokens[pos] !== '->') return left;
+    pos++;
+    return or(not(left), parseImplication());
+  };
+
+  const parseDisjunction = (): LTLFormula => {
+    const operands = [parseConjunction()];
+    while (tokens[pos] === '||') {
+      pos++;
+      operands.push(parseConjunction());
+    }
+    return or(...operands);
+  };
+
+  const parseConjunction = (): LTLFormula => {
+    const operands = [parseUntil()];
+    while (tokens[pos] === '&&') {
+      pos++;
+      operands.push(parseUntil());
+    }
+    return and(...operands);
+  };
+
+  // until := unary (('U' | 'W') bound? until)?
+  const parseUntil = (): LTLFormula => {
+    const left = parseUnary();
+    if (!BINARY_TEMPORAL.has(tokens[pos])) return left;
+    const weak = tokens[pos++] === 'W';
+    const bound = parseBound();
+    return { kind: 'until', left, right: parseUntil(), weak, bound };
+  };
+
+  const parseUnary = (): LTLFormula => {
+    const token = tokens[pos];
+    if (token === '!') {
+      pos++;
+      return not(parseUnary());
+    }
+    if (UNARY_TEMPORAL.has(token)) {
+      pos++;
+      const bound = parseBound();
+      const operand = parseUnary();
+      if (token === 'G') return { kind: 'globally', operand };
+      if (token === 'X') return { kind: 'next', operand };
+      if (bound === undefined) {
+        return fail('Unbounded F is a liveness operator; use F[k] to bound it');
+      }
+      return { kind: 'until', left: TRUE, right: operand, weak: false, bound };
+    }
+    return parsePrimary();
+  };
+
+  const parsePrimary = (): LTLFormula => {
+    const token = tokens[pos++];
+    if (token === undefined) return fail('Unexpected end');
+    if (token === '(') {
+      const inner = parseImplication();
+      expect(')');
+      return inner;
+    }
+    if (token === 'true') return TRUE;
+    if (token === 'false') return FALSE;
+    if (/^[a-z_]/.test(token)) return { kind: 'atom', action: token };
+    return fail(`Unexpected '${token}'`);
+  };
+
+  const formula = parseImplication();
+  if (pos < tokens.length) fail(`Unexpected '${tokens[pos]}'`);
+  if (!isSafety(formula)) {
+    fail('Not a safety property (it requires something to eventually happen); use W, U[k] or F[k]');
+  }
+  return formula;
+}
+
+/**
+ * Whether every violation of a formula shows up in a finite trace. An
+ * unbounded strong until, or a negated `G` or `W`, promises that something
+ * eventually happens, which no finite trace can refute.
+ */
+function isSafety(f: LTLFormula, negated = false): boolean {
+  switch (f.kind) {
+    case 'const':
+    case 'atom':
+      return true;
+    case 'not':
+      return isSafety(f.operand, !negated);
+    case 'and':
+    case 'or':
+      return f.operands.every(o => isSafety(o, negated));
+    case 'next':
+      return isSafety(f.operand, negated);
+    case 'globally':
+      return !negated && isSafety(f.operand, negated);
+    case 'until':
+      if (f.bound === undefined && f.weak === negated) return false;
+      return isSafety(f.left, negated) && isSafety(f.right, negated);
+  }
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Progression
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Rewrite a formula into the obligation that remains after observing one
+ * action. The result is `false` exactly when the trace so far violates it.
+ */
+export function progress(f: LTLFormula, action: string): LTLFormula {
+  switch (f.kind) {
+    case 'const':
+      return f;
+    case 'atom':
+      return f.action === action ? TRUE : FALSE;
+    case 'not':
+      return negate(progress(f.operand, action));
+    case 'and':
+      return and(...f.operands.map(o => progress(o, action)));
+    case 'or':
+      return or(...f.operands.map(o => progress(o, action)));
+    case 'next':
+      return f.operand;
+    case 'globally':
+      return and(progress(f.operand, action), f);
+    case 'until': {
+      const now = progress(f.right, action);
+      if (f.bound === 0) return now;
+      const rest: LTLFormula = f.bound === undefined ? f : { ...f, bound: f.bound - 1 };
+      return or(now, and(progress(f.left, action), rest));
+    }
+  }
+}
+
+/**
+ * Negate a progressed formula, pushing the negation through the temporal
+ * operators that progression can produce
+ */
+function negate(f: LTLFormula): LTLFormula {
+  switch (f.kind) {
+    case 'and':
+      return or(...f.operands.map(negate));
+    case 'or':
+      return and(...f.operands.map(negate));
+    case 'next':
+      return { kind: 'next', operand: negate(f.operand) };
+    default:
+      return not(f);
+  }
+}
+
+/**
+ * Whether a formula has been violated
+ */
+export function isViolated(f: LTLFormula): boolean {
+  return f.kind === 'const' && !f.value;
+}
@@ -0,0 +1,221 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Promela Export
+// Translates an LTS specification into a Promela model for the SPIN
+// model checker, mirroring the structure of the generated Go program
+// ═══════════════════════════════════════════════════════════════════════════
+
+import {
+  LTSSpec,
+  ProcessDefinition,
+  Transition,
+  ActionUsage,
+  analyzeActionUsage,
+  actionKind,
+  getAllStates,
+  isSharedAction,
+} from './transpiler';
+import { normalizeSpec, unfoldVariables } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Go payload types with a direct Promela equivalent; anything else becomes `int`
+ */
+const PROMELA_TYPES: Record<string, string> = {
+  bool: 'bool',
+  byte: 'byte',
+  uint8: 'byte',
+  int16: 'short',
+  int: 'int',
+  int32: 'int',
+};
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Sanitize a name to be a valid Promela identifier
+ */
+function sanitizePromelaName(name: string): string {
+  return name
+    .replace(/[^a-zA-Z0-9_]/g, '_')
+    .replace(/^(\d)/, '_$1');
+}
+
+/**
+ * Promela channel for a shared action, named like its Go counterpart
+ */
+function channelName(action: string): string {
+  return `ch_${sanitizePromelaName(action)}`;
+}
+
+/**
+ * Symbolic constant for a process state
+ */
+function stateConstant(proc: ProcessDefinition, state: string): string {
+  return sanitizePromelaName(`${proc.name}_${state}`);
+}
+
+/**
+ * Promela type of an action's payload
+ */
+function payloadType(spec: LTSSpec, action: string): string | undefined {
+  const payload = spec.actions?.[action]?.payload;
+  if (!payload) return undefined;
+  return PROMELA_TYPES[payload] ?? 'int';
+}
+
+/**
+ * Local variable that carries a transition's payload, if it has one
+ */
+function payloadVariable(spec: LTSSpec, t: Transition): string | undefined {
+  if (!payloadType(spec, t.action)) return undefined;
+  return t.variable ?? `v_${sanitizePromelaName(t.action)}`;
+}
+
+/**
+ * Statements that fire a transition: the channel operation (if the action is
+ * shared), a trace line and the state change
+ */
+function transitionStatements(
+  spec: LTSSpec,
+  actionUsage: Map<string, ActionUsage>,
+  proc: ProcessDefinition,
+  t: Transition
+): string[] {
+  const kind = actionKind(actionUsage, proc.name, t.action);
+  const variable = payloadVariable(spec, t);
+  const statements: string[] = [];
+
+  if (kind === 'send') {
+    statements.push(`${channelName(t.action)}!${variable ?? '0'}`);
+  } else if (kind === 'receive') {
+    statements.push(`${channelName(t.action)}?${variable ?? '_'}`);
+  }
+
+  const label = t.hidden ? `tau: ${t.action}` : `action: ${t.action}`;
+  statements.push(`printf("[${proc.name}] ${label} (${t.fromState} -> ${t.toState})\\n")`);
+  statements.push(`state = ${stateConstant(proc, t.toState)}`);
+  return statements;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Model Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Generate one proctype. The process state lives in a local variable and a
+ * `do ... od` loop dispatches on it, like the switch in the Go program.
+ * Choices become an `if ... fi` that blocks until one option is executable.
+ */
+function generateProctype(spec: LTSSpec, actionUsage: Map<string, ActionUsage>, proc: ProcessDefinition): string {
+  const lines: string[] = [];
+  const states = Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort();
+
+  lines.push(`proctype ${sanitizePromelaName(proc.name)}() {`);
+  lines.push(`  int state = ${stateConstant(proc, proc.initialState)};`);
+
+  const variables = new Map<string, string>();
+  for (const t of proc.transitions) {
+    const variable = payloadVariable(spec, t);
+    if (variable) variables.set(variable, payloadType(spec, t.action)!);
+  }
+  for (const [variable, type] of Array.from(variables).sort()) {
+    lines.push(`  ${type} ${variable};`);
+  }
+
+  lines.push(``);
+  lines.push(`  do`);
+
+  for (const state of states) {
+    const outgoing = state === 'STOP' || state === 'ERROR' ? [] : proc.transitions.filter(t => t.fromState === state);
+    const guard = `state == ${stateConstant(proc, state)}`;
+
+    if (state === 'ERROR') {
+      // SPIN reports the failed assertion together with the trace reaching it
+      lines.push(`  :: ${guard} ->`);
+      lines.push(`       printf("[${proc.name}] Reached ERROR state\\n");`);
+      lines.push(`       assert(false)`);
+    } else if (outgoing.length === 0) {
+      lines.push(`  :: ${guard} ->`);
+      lines.push(`       printf("[${proc.name}] Reached terminal state: ${state}\\n");`);
+      lines.push(`       break`);
+    } else if (outgoing.length === 1) {
+      const statements = transitionStatements(spec, actionUsage, proc, outgoing[0]);
+      lines.push(`  :: ${guard} ->`);
+      lines.push(`       ${statements.join(';\n       ')}`);
+    } else {
+      lines.push(`  :: ${guard} ->`);
+      lines.push(`       if`);
+      for (const t of outgoing) {
+        const statements = transitionStatements(spec, actionUsage, proc, t);
+        // An internal action has no channel operation to guard on
+        const first = actionKind(actionUsage, proc.name, t.action) === 'internal' ? 'skip' : statements.shift()!;
+        lines.push(`       :: ${first} -> ${statements.join('; ')}`);
+      }
+      lines.push(`       fi`);
+    }
+  }
+
+  lines.push(`  od`);
+  lines.push(`}`);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate a Promela model of a specification: one synchronous (rendezvous)
+ * channel per shared action, one proctype per process and an `init` that
+ * runs the whole system
+ * @param source The LTS specification to translate
+ * @returns Promela source, ready for `spin -a`
+ */
+export function generatePromela(source: LTSSpec): string {
+  const normalized = normalizeSpec(source);
+  const actionUsage = analyzeActionUsage(normalized);
+  // Integer variables become explicit states, so guards need no translation
+  const spec = { ...normalized, processes: normalized.processes.map(p => unfoldVariables(p)) };
+  const parts: string[] = [];
+
+  parts.push(`/* Generated by AnvilTS from an LTS specification */`);
+
+  // State constants
+  const defines: string[] = [];
+  for (const proc of spec.processes) {
+    const states = Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort();
+    states.forEach((state, i) => {
+      defines.push(`#define ${stateConstant(proc, state)} ${i}`);
+    });
+  }
+  parts.push(defines.join('\n'));
+
+  // Rendezvous channels for shared actions
+  const channels: string[] = [];
+  for (const action of Array.from(actionUsage.keys()).sort()) {
+    if (isSharedAction(actionUsage.get(action)!)) {
+      channels.push(`chan ${channelName(action)} = [0] of { ${payloadType(spec, action) ?? 'bit'} }; /* shared action: ${action} */`);
+    }
+  }
+  if (channels.length > 0) {
+    parts.push(channels.join('\n'));
+  }
+
+  for (const proc of spec.processes) {
+    parts.push(generateProctype(spec, actionUsage, proc));
+  }
+
+  const init: string[] = [];
+  init.push(`init {`);
+  init.push(`  atomic {`);
+  for (const proc of spec.processes) {
+    init.push(`    run ${sanitizePromelaName(proc.name)}();`);
+  }
+  init.push(`  }`);
+  init.push(`}`);
+  parts.push(init.join('\n'));
+
+  return parts.join('\n\n') + '\n';
+}
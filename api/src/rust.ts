@@ -0,0 +1,467 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Rust Backend
+// Translates an LTS specification into a Rust program with the structure
+// of the generated Go one: a thread per process, a rendezvous channel per
+// shared action, and a state enum matched in a loop
+// ═══════════════════════════════════════════════════════════════════════════
+
+import {
+  LTSSpec,
+  ProcessDefinition,
+  Transition,
+  ActionUsage,
+  GeneratorOptions,
+  analyzeActionUsage,
+  actionKind,
+  getAllStates,
+} from './transpiler';
+import { normalizeSpec, unfoldVariables } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Generator options the Rust backend honours; the others act on Go
+ * constructs it does not have
+ */
+const RUST_OPTIONS: (keyof GeneratorOptions)[] = ['bufferSize'];
+
+/**
+ * Same banner as the Go program prints, so that runs of both read alike
+ */
+const BANNER = '═══════════════════════════════════════════════════════════════';
+
+/**
+ * Names that cannot be used as an enum variant
+ */
+const RUST_RESERVED_TYPES = ['Self'];
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Words of a name, split at everything that cannot be part of a Rust identifier
+ */
+function words(name: string): string[] {
+  return name.split(/[^a-zA-Z0-9]+/).filter(w => w.length > 0);
+}
+
+/**
+ * UpperCamelCase form of a name, for types and enum variants
+ */
+function camelName(name: string): string {
+  const camel = words(name).map(w => w[0].toUpperCase() + w.slice(1).toLowerCase()).join('');
+  if (camel === '') return 'X';
+  const named = /^\d/.test(camel) ? `S${camel}` : camel;
+  return RUST_RESERVED_TYPES.includes(named) ? `${named}_` : named;
+}
+
+/**
+ * snake_case form of a name, for functions and variables
+ */
+function snakeName(name: string): string {
+  const snake = words(name).join('_').toLowerCase();
+  return /^\d/.test(snake) || snake === '' ? `_${snake}` : snake;
+}
+
+/**
+ * Enum holding the states of a process
+ */
+function stateType(proc: ProcessDefinition): string {
+  return `${camelName(proc.name)}State`;
+}
+
+/**
+ * Enum variant for a state of a process
+ */
+function stateVariant(proc: ProcessDefinition, state: string): string {
+  return `${stateType(proc)}::${camelName(state)}`;
+}
+
+/**
+ * Function that runs a process
+ */
+function processFunction(proc: ProcessDefinition): string {
+  return `process_${snakeName(proc.name)}`;
+}
+
+/**
+ * Sending end of an action's channel
+ */
+function senderName(action: string): string {
+  return `${snakeName(action)}_tx`;
+}
+
+/**
+ * Receiving end of an action's channel
+ */
+function receiverName(action: string): string {
+  return `${snakeName(action)}_rx`;
+}
+
+/**
+ * The process on the other side of a two-party action
+ */
+function peerOf(usage: ActionUsage, process: string): string {
+  return Array.from(usage.processes).find(p => p !== process)!;
+}
+
+/**
+ * States of a process in the order their match arms are emitted, as the
+ * cases of the Go switch
+ */
+function statesOf(proc: ProcessDefinition): string[] {
+  return Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort();
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Validation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Fail when two distinct names would become the same Rust identifier
+ */
+function checkDistinct(names: [string, string][], what: string): void {
+  const seen = new Map<string, string>();
+  for (const [identifier, name] of names) {
+    const other = seen.get(identifier);
+    if (other !== undefined && other !== name) {
+      throw new Error(`${other} and ${name} would both use the Rust ${what} ${identifier}; rename one of them`);
+    }
+    seen.set(identifier, name);
+  }
+}
+
+/**
+ * Whether a process offers an action in a choice state
+ */
+function offersInChoice(proc: ProcessDefinition, action: string): boolean {
+  return proc.transitions.some(t => t.action === action &&
+    proc.transitions.filter(u => u.fromState === t.fromState).length > 1);
+}
+
+/**
+ * Make an action's sender the side that never offers it in a choice, unless
+ * the spec declares the sender. A choice polls, and can only wait for
+ * receives, so the side that chooses has to be the receiver.
+ */
+function assignSenders(spec: LTSSpec, actionUsage: Map<string, ActionUsage>): void {
+  for (const [action, usage] of actionUsage) {
+    if (usage.processes.size !== 2 || usage.declared) continue;
+    const sender = spec.processes.find(proc => proc.name === usage.sender)!;
+    if (offersInChoice(sender, action)) {
+      usage.sender = peerOf(usage, sender.name);
+    }
+  }
+}
+
+/**
+ * Reject what the Rust backend cannot express. std has no select, so a
+ * choice polls its channels: it can wait for a receive, but a send it
+ * offered could only meet a receiver that polls as well, and two polling
+ * sides never meet. A shared action synchronizes exactly two processes.
+ */
+function validateRustSpec(spec: LTSSpec, actionUsage: Map<string, ActionUsage>, options: GeneratorOptions): void {
+  for (const option of Object.keys(options) as (keyof GeneratorOptions)[]) {
+    if (options[option] !== undefined && !RUST_OPTIONS.includes(option)) {
+      throw new Error(`The rust backend does not support the ${option} option`);
+    }
+  }
+  if (spec.composition?.priority) {
+    throw new Error('The rust backend does not support priorities');
+  }
+  for (const [action, declaration] of Object.entries(spec.actions ?? {})) {
+    if (declaration.payload !== undefined) throw new Error(`Action ${action}: the rust backend does not support payloads`);
+    if (declaration.delay !== undefined) throw new Error(`Action ${action}: the rust backend does not support delays`);
+    if (declaration.broadcast) throw new Error(`Action ${action}: the rust backend does not support broadcast`);
+  }
+  for (const [action, usage] of actionUsage) {
+    if (usage.shared && usage.processes.size === 1) {
+      throw new Error(`Action ${action}: the rust backend needs a process at each end of a shared action, but only ${Array.from(usage.processes)[0]} uses it`);
+    }
+    if (usage.processes.size > 2) {
+      throw new Error(`Action ${action}: the rust backend only synchronizes two processes, not ${Array.from(usage.processes).sort().join(', ')}`);
+    }
+  }
+
+  for (const proc of spec.processes) {
+    for (const state of statesOf(proc)) {
+      const outgoing = proc.transitions.filter(t => t.fromState === state);
+      for (const t of outgoing) {
+        if (t.weight !== undefined) {
+          throw new Error(`Process ${proc.name}: the rust backend does not support weights (on ${t.action})`);
+        }
+        if (outgoing.length > 1 && actionKind(actionUsage, proc.name, t.action) === 'send') {
+          throw new Error(`Process ${proc.name}: the rust backend cannot offer the send of ${t.action} in a choice (state ${state}), which can only wait for receives`);
+        }
+      }
+    }
+    checkDistinct(statesOf(proc).map(state => [camelName(state), `State ${state} of ${proc.name}`]), 'variant');
+  }
+
+  checkDistinct(spec.processes.map(proc => [stateType(proc), `Process ${proc.name}`]), 'type');
+  checkDistinct(spec.processes.map(proc => [processFunction(proc), `Process ${proc.name}`]), 'function');
+  checkDistinct(Array.from(actionUsage.keys()).map(action => [snakeName(action), `Action ${action}`]), 'channel');
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Code Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Trace line of a transition, as the Go program prints it
+ */
+function transitionLog(proc: ProcessDefinition, t: Transition): string {
+  const label = t.hidden ? `tau: ${t.action}` : `action: ${t.action}`;
+  return `println!("[${proc.name}] ${label} (${t.fromState} -> ${t.toState})");`;
+}
+
+/**
+ * Report of a process giving up on an action whose peer has stopped
+ */
+function stoppedPeerLog(proc: ProcessDefinition, action: string, actionUsage: Map<string, ActionUsage>): string {
+  return `println!("[${proc.name}] ${action} can no longer happen: ${peerOf(actionUsage.get(action)!, proc.name)} has stopped");`;
+}
+
+/**
+ * Generate the enum of a process's states
+ */
+function generateStateEnum(proc: ProcessDefinition): string {
+  const lines: string[] = [];
+  const entered = new Set([proc.initialState, ...proc.transitions.map(t => t.toState)]);
+
+  lines.push(`/// States of the ${proc.name} process`);
+  // A state that only has outgoing transitions is never entered
+  if (statesOf(proc).some(state => !entered.has(state))) {
+    lines.push(`#[allow(dead_code)]`);
+  }
+  lines.push(`enum ${stateType(proc)} {`);
+  for (const state of statesOf(proc)) {
+    lines.push(`    ${camelName(state)},`);
+  }
+  lines.push(`}`);
+  return lines.join('\n');
+}
+
+/**
+ * Emit a state with a single transition: a blocking channel operation if
+ * the action is shared, then the trace line, evaluating to the next state
+ */
+function generateSingleTransition(lines: string[], proc: ProcessDefinition, t: Transition, actionUsage: Map<string, ActionUsage>): void {
+  const kind = actionKind(actionUsage, proc.name, t.action);
+  if (kind !== 'internal') {
+    const operation = kind === 'send' ? `${senderName(t.action)}.send(())` : `${receiverName(t.action)}.recv()`;
+    lines.push(`                if ${operation}.is_err() { // ${kind}: ${t.action}`);
+    lines.push(`                    ${stoppedPeerLog(proc, t.action, actionUsage)}`);
+    lines.push(`                    return;`);
+    lines.push(`                }`);
+  }
+  lines.push(`                ${transitionLog(proc, t)}`);
+  lines.push(`                ${stateVariant(proc, t.toState)}`);
+}
+
+/**
+ * Emit a choice state: a loop that offers the transitions in turn, from a
+ * random one on, until one of them fires. A local action always fires when
+ * offered; a receive fires when its sender is waiting.
+ */
+function generateChoice(lines: string[], proc: ProcessDefinition, transitions: Transition[], actionUsage: Map<string, ActionUsage>): void {
+  const n = transitions.length;
+  lines.push(`                let start = pick(${n});`);
+  lines.push(`                for i in 0..${n} {`);
+  lines.push(`                    match (start + i) % ${n} {`);
+  transitions.forEach((t, i) => {
+    const pattern = i === n - 1 ? '_' : `${i}`;
+    if (actionKind(actionUsage, proc.name, t.action) === 'internal') {
+      lines.push(`                        ${pattern} => {`);
+      lines.push(`                            ${transitionLog(proc, t)}`);
+      lines.push(`                            break 'choice ${stateVariant(proc, t.toState)};`);
+      lines.push(`                        }`);
+      return;
+    }
+    lines.push(`                        ${pattern} => match ${receiverName(t.action)}.try_recv() { // receive: ${t.action}`);
+    lines.push(`                            Ok(()) => {`);
+    lines.push(`                                ${transitionLog(proc, t)}`);
+    lines.push(`                                break 'choice ${stateVariant(proc, t.toState)};`);
+    lines.push(`                            }`);
+    lines.push(`                            Err(TryRecvError::Empty) => {}`);
+    lines.push(`                            Err(TryRecvError::Disconnected) => {`);
+    lines.push(`                                ${stoppedPeerLog(proc, t.action, actionUsage)}`);
+    lines.push(`                                return;`);
+    lines.push(`                            }`);
+    lines.push(`                        },`);
+  });
+  lines.push(`                    }`);
+  lines.push(`                }`);
+  lines.push(`                thread::sleep(POLL_INTERVAL);`);
+}
+
+/**
+ * Generate the function that runs a process. It takes the channel ends of
+ * its shared actions, and returns once it stops or a peer has stopped, which
+ * drops its ends so that its own peers notice in turn.
+ */
+function generateProcessFunction(proc: ProcessDefinition, actionUsage: Map<string, ActionUsage>): string {
+  const lines: string[] = [];
+  const performed = new Set(proc.transitions.map(t => t.action));
+
+  lines.push(`/// Runs the ${proc.name} process`);
+  lines.push(`fn ${processFunction(proc)}(${processParams(proc, actionUsage).map(([name, type, action]) =>
+    `${performed.has(action) ? '' : '_'}${name}: ${type}`).join(', ')}) {`);
+  lines.push(`    println!("[${proc.name}] Starting...");`);
+  lines.push(``);
+  lines.push(`    let mut state = ${stateVariant(proc, proc.initialState)};`);
+  lines.push(``);
+  lines.push(`    loop {`);
+  lines.push(`        state = match state {`);
+
+  for (const state of statesOf(proc)) {
+    const outgoing = state === 'STOP' || state === 'ERROR' ? [] : proc.transitions.filter(t => t.fromState === state);
+    const choice = outgoing.length > 1;
+    lines.push(`            ${stateVariant(proc, state)} => ${choice ? `'choice: loop {` : '{'}`);
+    if (state === 'ERROR') {
+      lines.push(`                println!("[${proc.name}] Reached ERROR state");`);
+      lines.push(`                panic!("LTS process ${proc.name} reached ERROR");`);
+    } else if (outgoing.length === 0) {
+      lines.push(`                println!("[${proc.name}] Reached terminal state: ${state}");`);
+      lines.push(`                return;`);
+    } else if (!choice) {
+      generateSingleTransition(lines, proc, outgoing[0], actionUsage);
+    } else {
+      generateChoice(lines, proc, outgoing, actionUsage);
+    }
+    lines.push(`            }${choice ? ',' : ''}`);
+  }
+
+  lines.push(`        };`);
+  lines.push(`    }`);
+  lines.push(`}`);
+  return lines.join('\n');
+}
+
+/**
+ * Channel ends a process takes, as (parameter, type, action), sorted by action
+ */
+function processParams(proc: ProcessDefinition, actionUsage: Map<string, ActionUsage>): [string, string, string][] {
+  return Array.from(actionUsage).filter(([, usage]) => usage.processes.size > 1 && usage.processes.has(proc.name))
+    .map(([action]) => action).sort()
+    .map(action => actionUsage.get(action)!.sender === proc.name
+      ? [senderName(action), 'SyncSender<()>', action]
+      : [receiverName(action), 'Receiver<()>', action]);
+}
+
+/**
+ * Generate `main`: it creates the channels, spawns a thread per process
+ * and waits for all of them, between the banners of the Go program
+ */
+function generateMain(spec: LTSSpec, actionUsage: Map<string, ActionUsage>, options: GeneratorOptions): string {
+  const lines: string[] = [];
+  const shared = Array.from(actionUsage.keys()).filter(action => actionUsage.get(action)!.processes.size > 1).sort();
+
+  lines.push(`fn main() {`);
+  lines.push(`    println!("${BANNER}");`);
+  lines.push(`    println!("  LTS Execution Started");`);
+  lines.push(`    println!("${BANNER}");`);
+  lines.push(`    println!();`);
+  lines.push(``);
+
+  if (spec.processes.some(proc => statesOf(proc).includes('ERROR'))) {
+    lines.push(`    // A process that reaches ERROR panics, which ends the whole program as in Go`);
+    lines.push(`    let report = std::panic::take_hook();`);
+    lines.push(`    std::panic::set_hook(Box::new(move |info| {`);
+    lines.push(`        report(info);`);
+    lines.push(`        std::process::exit(2);`);
+    lines.push(`    }));`);
+    lines.push(``);
+  }
+
+  if (shared.length > 0) {
+    lines.push(`    // Channels for action synchronization (shared actions only)`);
+    for (const action of shared) {
+      const capacity = spec.actions?.[action]?.buffer ?? options.bufferSize ?? 0;
+      lines.push(`    let (${senderName(action)}, ${receiverName(action)}) = mpsc::sync_channel(${capacity}); // shared action: ${action}`);
+    }
+    lines.push(``);
+  }
+
+  lines.push(`    // Launch process threads`);
+  lines.push(`    let handles = vec![`);
+  for (const proc of spec.processes) {
+    const args = processParams(proc, actionUsage).map(([name]) => name).join(', ');
+    lines.push(`        thread::spawn(move || ${processFunction(proc)}(${args})),`);
+  }
+  lines.push(`    ];`);
+  lines.push(``);
+  lines.push(`    // Wait for all processes to complete`);
+  lines.push(`    for handle in handles {`);
+  lines.push(`        handle.join().unwrap();`);
+  lines.push(`    }`);
+  lines.push(``);
+  lines.push(`    println!();`);
+  lines.push(`    println!("${BANNER}");`);
+  lines.push(`    println!("  LTS Execution Complete");`);
+  lines.push(`    println!("${BANNER}");`);
+  lines.push(`}`);
+  return lines.join('\n');
+}
+
+/**
+ * Generate a Rust program for a specification, using only std: a thread
+ * per process, a `sync_channel` per shared action (capacity 0, a
+ * rendezvous, unless buffered) and a state enum per process
+ * @param source The LTS specification to translate
+ * @param options Generator options; only `bufferSize` applies
+ * @returns Rust source for a single `main.rs`
+ */
+export function generateRust(source: LTSSpec, options: GeneratorOptions = {}): string {
+  const normalized = normalizeSpec(source);
+  // Integer variables become explicit states, so guards need no translation
+  const spec = { ...normalized, processes: normalized.processes.map(p => unfoldVariables(p)) };
+  const actionUsage = analyzeActionUsage(spec);
+  assignSenders(spec, actionUsage);
+  validateRustSpec(spec, actionUsage, options);
+
+  const choices = spec.processes.some(proc => statesOf(proc).some(state =>
+    state !== 'STOP' && state !== 'ERROR' && proc.transitions.filter(t => t.fromState === state).length > 1));
+  const shared = Array.from(actionUsage.values()).some(usage => usage.processes.size > 1);
+  const parts: string[] = [];
+
+  const imports: string[] = [];
+  if (choices) {
+    imports.push('use std::collections::hash_map::RandomState;');
+    imports.push('use std::hash::{BuildHasher, Hasher};');
+  }
+  if (shared) {
+    imports.push(choices ? 'use std::sync::mpsc::{self, Receiver, SyncSender, TryRecvError};' : 'use std::sync::mpsc::{self, Receiver, SyncSender};');
+  }
+  imports.push('use std::thread;');
+  if (choices) {
+    imports.push('use std::time::Duration;');
+  }
+  parts.push(imports.join('\n'));
+
+  if (choices) {
+    parts.push([
+      `/// How long a choice waits before offering its transitions again`,
+      `const POLL_INTERVAL: Duration = Duration::from_millis(1);`,
+      ``,
+      `/// A random index below n: the transition a choice offers first, so that`,
+      `/// local actions do not always win over receives`,
+      `fn pick(n: usize) -> usize {`,
+      `    (RandomState::new().build_hasher().finish() % n as u64) as usize`,
+      `}`,
+    ].join('\n'));
+  }
+
+  for (const proc of spec.processes) {
+    parts.push(generateStateEnum(proc));
+  }
+  for (const proc of spec.processes) {
+    parts.push(generateProcessFunction(proc, actionUsage));
+  }
+  parts.push(generateMain(spec, actionUsage, options));
+
+  return parts.join('\n\n') + '\n';
+}
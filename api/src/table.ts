@@ -0,0 +1,133 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Transition Table
+// A flat CSV listing of every transition, for auditing in spreadsheets and
+// for reproducible diffs, and a boxed text table per process for terminals
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ActionKind, analyzeActionUsage, actionKind } from './transpiler';
+import { normalizeSpec } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * One row of the table
+ */
+export interface TableRow {
+  process: string;
+  fromState: string;
+  action: string;
+  kind: ActionKind;
+  toState: string;
+}
+
+/**
+ * Column headers, in order
+ */
+const HEADER = ['process', 'from_state', 'action', 'kind', 'to_state'];
+
+/**
+ * Column headers of the text table, in order
+ */
+const TEXT_HEADER = ['From', 'Action', 'Kind', 'To'];
+
+/**
+ * Characters that take two terminal columns: CJK, Hangul, fullwidth forms and emoji
+ */
+const WIDE = /[\u1100-\u115F\u2E80-\uA4CF\uAC00-\uD7A3\uF900-\uFAFF\uFE30-\uFE4F\uFF00-\uFF60\uFFE0-\uFFE6\p{Emoji_Presentation}]/u;
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Table
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Natural ordering so that `2` sorts before `10`
+ */
+function compareNames(a: string, b: string): number {
+  return a.localeCompare(b, undefined, { numeric: true });
+}
+
+/**
+ * List every transition of the normalized specification, sorted by process,
+ * then from-state, then action. Transitions that tie keep their declaration
+ * order, so the same spec always gives the same table.
+ */
+export function transitionTable(source: LTSSpec): TableRow[] {
+  const spec = normalizeSpec(source);
+  const actionUsage = analyzeActionUsage(spec);
+
+  const rows = spec.processes.flatMap(proc => proc.transitions.map(t => ({
+    process: proc.name,
+    fromState: t.fromState,
+    action: t.action,
+    kind: actionKind(actionUsage, proc.name, t.action),
+    toState: t.toState,
+  })));
+
+  return rows.sort((a, b) =>
+    compareNames(a.process, b.process) ||
+    compareNames(a.fromState, b.fromState) ||
+    compareNames(a.action, b.action)
+  );
+}
+
+/**
+ * Quote a field when it contains a separator, quote or line break
+ */
+function csvField(value: string): string {
+  return /[",\r\n]/.test(value) ? `"${value.replace(/"/g, '""')}"` : value;
+}
+
+/**
+ * Write the transition table as CSV, with a header row and one line per
+ * transition: `process,from_state,action,kind,to_state`
+ */
+export function writeCSV(spec: LTSSpec): string {
+  const lines = [HEADER.join(',')];
+  for (const row of transitionTable(spec)) {
+    lines.push([row.process, row.fromState, row.action, row.kind, row.toState].map(csvField).join(','));
+  }
+  return lines.join('\n') + '\n';
+}
+
+/**
+ * Number of terminal columns a string takes up: combining marks take none
+ * and wide characters take two
+ */
+export function displayWidth(text: string): number {
+  let width = 0;
+  for (const char of text) {
+    if (/\p{M}/u.test(char)) continue;
+    width += WIDE.test(char) ? 2 : 1;
+  }
+  return width;
+}
+
+/**
+ * Draw rows under a header inside box-drawing borders, each column as wide
+ * as its widest cell
+ */
+function boxTable(header: string[], rows: string[][]): string {
+  const widths = header.map((h, i) => Math.max(displayWidth(h), ...rows.map(r => displayWidth(r[i]))));
+  const rule = (left: string, middle: string, right: string) =>
+    left + widths.map(w => '─'.repeat(w + 2)).join(middle) + right;
+  const line = (cells: string[]) =>
+    `│ ${cells.map((c, i) => c + ' '.repeat(widths[i] - displayWidth(c))).join(' │ ')} │`;
+
+  return [rule('┌', '┬', '┐'), line(header), rule('├', '┼', '┤'), ...rows.map(line), rule('└', '┴', '┘')].join('\n');
+}
+
+/**
+ * Write the transition table as aligned text for a terminal: one boxed
+ * table per process, under its name, with the columns From, Action, Kind
+ * and To. Rows are in the same order as in the CSV.
+ */
+export function writeTable(spec: LTSSpec): string {
+  const rows = transitionTable(spec);
+  const processes = Array.from(new Set(rows.map(r => r.process)));
+  return processes.map(process => {
+    const cells = rows.filter(r => r.process === process).map(r => [r.fromState, r.action, r.kind, r.toState]);
+    return `${process}\n${boxTable(TEXT_HEADER, cells)}`;
+  }).join('\n\n') + '\n';
+}
@@ -0,0 +1,193 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// TLA+ Export
+// Translates an LTS specification into a TLA+ module for the TLC model
+// checker: one record of process states, one action formula per action
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, getAllStates } from './transpiler';
+import { coversAction, normalizeSpec, unfoldVariables } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Configuration
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * TLA+ keywords, and the names the module defines itself
+ */
+const TLA_RESERVED = new Set([
+  'ASSUME', 'ASSUMPTION', 'AXIOM', 'BOOLEAN', 'CASE', 'CHOOSE', 'CONSTANT', 'CONSTANTS',
+  'DOMAIN', 'ELSE', 'ENABLED', 'EXCEPT', 'EXTENDS', 'FALSE', 'IF', 'IN', 'INSTANCE',
+  'LAMBDA', 'LET', 'LOCAL', 'MODULE', 'OTHER', 'STRING', 'SUBSET', 'THEN', 'THEOREM',
+  'TRUE', 'UNCHANGED', 'UNION', 'VARIABLE', 'VARIABLES', 'WITH',
+  'state', 'vars', 'TypeOK', 'NoError', 'Init', 'Next', 'Spec',
+]);
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Sanitize a name to be a valid TLA+ identifier that the module does not
+ * already use
+ */
+function sanitizeTLAName(name: string): string {
+  const sanitized = name.replace(/[^a-zA-Z0-9_]/g, '_');
+  const named = /[a-zA-Z]/.test(sanitized) ? sanitized : `A_${sanitized}`;
+  return TLA_RESERVED.has(named) || /^(WF|SF)_/.test(named) ? `${named}_` : named;
+}
+
+/**
+ * TLA+ string literal
+ */
+function tlaString(value: string): string {
+  return `"${value.replace(/\\/g, '\\\\').replace(/"/g, '\\"')}"`;
+}
+
+/**
+ * Field of the state record holding a process's state
+ */
+function stateField(proc: ProcessDefinition): string {
+  return `state.${sanitizeTLAName(proc.name)}`;
+}
+
+/**
+ * Fail when two distinct names would become the same TLA+ identifier
+ */
+function checkDistinct(names: string[], what: string): void {
+  const seen = new Map<string, string>();
+  for (const name of names) {
+    const identifier = sanitizeTLAName(name);
+    const other = seen.get(identifier);
+    if (other !== undefined && other !== name) {
+      throw new Error(`${what} ${other} and ${name} would both use the TLA+ name ${identifier}; rename one of them`);
+    }
+    seen.set(identifier, name);
+  }
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Module Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Generate the formula of one action. It is enabled when every process
+ * with the action in its alphabet is in a state offering it, and moves them
+ * all at once. A process with a single transition on the action has its
+ * state tested and set directly; one with several picks one of them with
+ * `\E`, so nondeterminism is kept.
+ */
+function generateAction(action: string, spec: LTSSpec): string {
+  const participants = spec.processes.filter(proc =>
+    proc.transitions.some(t => t.action === action) || (proc.extraAlphabet ?? []).includes(action));
+  const name = sanitizeTLAName(action);
+  const declared = spec.shared !== undefined && coversAction(action, spec.shared);
+  const kind = participants.length > 1 || declared ? 'shared' : 'local';
+  const lines = [`\\* ${kind} action: ${action} (${participants.map(p => p.name).sort().join(', ')})`];
+
+  // A process that only has the action in its alphabet blocks it for good
+  const blocker = participants.find(proc => !proc.transitions.some(t => t.action === action));
+  if (blocker) {
+    lines.push(`${name} == FALSE \\* ${blocker.name} never performs it`);
+    return lines.join('\n');
+  }
+  // A declared shared action has no partner to synchronize with
+  if (participants.length === 1 && declared) {
+    lines.push(`${name} == FALSE \\* declared shared, but only ${participants[0].name} performs it`);
+    return lines.join('\n');
+  }
+
+  const bounds: string[] = [];
+  const conditions: string[] = [];
+  const updates: string[] = [];
+  for (const proc of participants) {
+    const transitions: Transition[] = proc.transitions.filter(t => t.action === action);
+    const field = stateField(proc);
+    if (transitions.length === 1) {
+      conditions.push(`${field} = ${tlaString(transitions[0].fromState)}`);
+      updates.push(`!.${sanitizeTLAName(proc.name)} = ${tlaString(transitions[0].toState)}`);
+    } else {
+      const variable = `t_${sanitizeTLAName(proc.name)}`;
+      const pairs = transitions.map(t => `<<${tlaString(t.fromState)}, ${tlaString(t.toState)}>>`);
+      bounds.push(`${variable} \\in {${Array.from(new Set(pairs)).join(', ')}}`);
+      conditions.push(`${field} = ${variable}[1]`);
+      updates.push(`!.${sanitizeTLAName(proc.name)} = ${variable}[2]`);
+    }
+  }
+
+  const indent = bounds.length > 0 ? '        ' : '    ';
+  lines.push(`${name} ==`);
+  if (bounds.length > 0) {
+    lines.push(`    \\E ${bounds.join(', ')} :`);
+  }
+  for (const condition of conditions) {
+    lines.push(`${indent}/\\ ${condition}`);
+  }
+  lines.push(`${indent}/\\ state' = [state EXCEPT ${updates.join(', ')}]`);
+  return lines.join('\n');
+}
+
+/**
+ * Generate a TLA+ module for a specification. The variable `state` is a
+ * record with the current state of every process; `Init` sets each to its
+ * initial state, every action is an action formula with its enabling
+ * condition and next-state update, and `Next` is their disjunction.
+ * `TypeOK` and, when ERROR is reachable, `NoError` are ready to be checked
+ * as invariants.
+ * @param source The LTS specification to translate
+ * @returns TLA+ source; the module is named after the composition (or `LTS`),
+ *   so its file should be too
+ */
+export function generateTLA(source: LTSSpec): string {
+  const normalized = normalizeSpec(source);
+  // Integer variables become explicit states, so guards need no translation
+  const spec = { ...normalized, processes: normalized.processes.map(p => unfoldVariables(p)) };
+  const actions = Array.from(new Set(spec.processes.flatMap(proc => proc.transitions.map(t => t.action)))).sort();
+  checkDistinct(spec.processes.map(proc => proc.name), 'Processes');
+  checkDistinct(actions, 'Actions');
+
+  const moduleName = sanitizeTLAName(source.composition?.name ?? 'LTS');
+  const states = (proc: ProcessDefinition) => Array.from(new Set([proc.initialState, ...getAllStates(proc)])).sort();
+  const parts: string[] = [];
+
+  parts.push([
+    `${'-'.repeat(28)} MODULE ${moduleName} ${'-'.repeat(28)}`,
+    `(* Generated by AnvilTS from an LTS specification *)`,
+  ].join('\n'));
+
+  parts.push([`VARIABLE state`, ``, `vars == <<state>>`].join('\n'));
+
+  const typeOK = [`TypeOK ==`];
+  for (const proc of spec.processes) {
+    typeOK.push(`    /\\ ${stateField(proc)} \\in {${states(proc).map(tlaString).join(', ')}}`);
+  }
+  const erring = spec.processes.filter(proc => states(proc).includes('ERROR'));
+  if (erring.length > 0) {
+    typeOK.push(``, `NoError ==`);
+    for (const proc of erring) {
+      typeOK.push(`    /\\ ${stateField(proc)} # "ERROR"`);
+    }
+  }
+  parts.push(typeOK.join('\n'));
+
+  const fields = spec.processes.map(proc => `${sanitizeTLAName(proc.name)} |-> ${tlaString(proc.initialState)}`);
+  parts.push([`Init ==`, `    state = [${fields.join(', ')}]`].join('\n'));
+
+  for (const action of actions) {
+    parts.push(generateAction(action, spec));
+  }
+
+  const next = [`Next ==`];
+  if (actions.length === 0) {
+    next.push(`    FALSE`);
+  } else {
+    for (const action of actions) {
+      next.push(`    \\/ ${sanitizeTLAName(action)}`);
+    }
+  }
+  parts.push(next.join('\n'));
+
+  parts.push(`Spec == Init /\\ [][Next]_vars`);
+  parts.push('='.repeat(65 + moduleName.length));
+
+  return parts.join('\n\n') + '\n';
+}
@@ -0,0 +1,881 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTS Transforms
+// Passes that rewrite a specification into a simpler, concrete form
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, IndexRange, RangeDeclaration, ActionPriority, Composition } from './transpiler';
+import { Environment, Expr, evaluate, evaluateExpression, freeNames, parseExpression } from './expression';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Utility Functions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Enumerate the values of an index range, looking named ranges up in `ranges`
+ */
+function rangeValues(range: IndexRange, env: Environment, ranges: Record<string, RangeDeclaration>): number[] {
+  let bounds: RangeDeclaration;
+  if ('range' in range) {
+    if (!(range.range in ranges)) {
+      throw new Error(`Undefined range '${range.range}'`);
+    }
+    bounds = ranges[range.range];
+  } else {
+    bounds = range;
+  }
+  const from = evaluateExpression(bounds.from, env);
+  const to = evaluateExpression(bounds.to, env);
+  const values: number[] = [];
+  for (let v = from; v <= to; v++) {
+    values.push(v);
+  }
+  return values;
+}
+
+/**
+ * Replace every `[expr]` in a label with `.value`, the LTSA label convention
+ * (e.g. `put[i+1]` with i=0 becomes `put.1`)
+ */
+function substituteLabel(label: string, env: Environment): string {
+  return label.replace(/\[([^\[\]]+)\]/g, (_, expr: string) => `.${evaluateExpression(expr, env)}`);
+}
+
+/**
+ * Substitute the names bound in `env` into an expression, leaving process
+ * variables in place (e.g. `count < N` with N=2 becomes `count < 2`)
+ */
+function substituteExpression(source: string, env: Environment, variables: Set<string>): string {
+  const substituted = source.replace(/[A-Za-z_][A-Za-z0-9_]*/g, name => {
+    if (!(name in env)) return name;
+    return env[name] < 0 ? `(${env[name]})` : String(env[name]);
+  });
+  for (const name of freeNames(parseExpression(substituted))) {
+    if (!variables.has(name)) {
+      throw new Error(`Undefined name '${name}' in expression "${source}"`);
+    }
+  }
+  return substituted;
+}
+
+/**
+ * Resolve a guard as far as expansion can: a guard that reads no process
+ * variable is decided here, anything else is kept for run time
+ * @returns The remaining guard, or whether it always holds
+ */
+function resolveGuard(guard: string, env: Environment, variables: Set<string>): string | boolean {
+  const resolved = substituteExpression(guard, env, variables);
+  const expr = parseExpression(resolved);
+  return freeNames(expr).length === 0 ? evaluate(expr, {}) !== 0 : resolved;
+}
+
+/**
+ * Resolve the assignments of a transition, which may only target process variables
+ */
+function resolveUpdate(update: Record<string, string>, env: Environment, variables: Set<string>): Record<string, string> {
+  const resolved: Record<string, string> = {};
+  for (const [name, value] of Object.entries(update)) {
+    if (!variables.has(name)) {
+      throw new Error(`Assignment to undeclared variable '${name}'`);
+    }
+    resolved[name] = substituteExpression(value, env, variables);
+  }
+  return resolved;
+}
+
+/**
+ * Environment of a process whose variables shadow constants of the same name
+ */
+function processEnvironment(env: Environment, variables: Set<string>): Environment {
+  return Object.fromEntries(Object.entries(env).filter(([name]) => !variables.has(name)));
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Expansion
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Expand the transitions of a single process under an environment.
+ * Transitions whose guard can never hold are dropped.
+ */
+function expandTransitions(
+  transitions: Transition[],
+  env: Environment,
+  ranges: Record<string, RangeDeclaration>,
+  variables: Set<string>
+): Transition[] {
+  const expanded: Transition[] = [];
+
+  for (const t of transitions) {
+    const { index, guard, update, ...rest } = t;
+    // A later range may depend on the variables bound before it
+    let bindings = [env];
+    for (const range of index === undefined ? [] : Array.isArray(index) ? index : [index]) {
+      bindings = bindings.flatMap(scope =>
+        rangeValues(range, scope, ranges).map(v => ({ ...scope, [range.variable]: v }))
+      );
+    }
+
+    for (const scope of bindings) {
+      const resolved = guard === undefined ? true : resolveGuard(guard, scope, variables);
+      if (resolved === false) continue;
+      expanded.push({
+        ...rest,
+        fromState: substituteLabel(t.fromState, scope),
+        toState: substituteLabel(t.toState, scope),
+        action: substituteLabel(t.action, scope),
+        ...(typeof resolved === 'string' ? { guard: resolved } : {}),
+        ...(update ? { update: resolveUpdate(update, scope, variables) } : {}),
+      });
+    }
+  }
+
+  return expanded;
+}
+
+/**
+ * Evaluate the initial values of a process's variables
+ */
+function expandVariables(variables: Record<string, number | string>, env: Environment): Record<string, number> {
+  return Object.fromEntries(
+    Object.entries(variables).map(([name, value]) => [name, evaluateExpression(value, env)])
+  );
+}
+
+/**
+ * Replace a process by one identical copy per index value, named like the
+ * instances of a family, for the composition's `forall`
+ */
+function replicateProcess(
+  processes: ProcessDefinition[],
+  instances: Map<string, string[]>,
+  name: string,
+  values: number[],
+  composition: Composition
+): void {
+  if (!composition.processes.includes(name)) {
+    throw new Error(`Composition ${composition.name}: forall replicates ${name}, which it does not compose`);
+  }
+  if (instances.has(name)) {
+    throw new Error(`Composition ${composition.name}: forall cannot replicate the process family ${name}`);
+  }
+  const at = processes.findIndex(p => p.name === name);
+  if (at < 0) {
+    throw new Error(`Composition ${composition.name}: unknown process ${name}`);
+  }
+
+  const copies = values.map(v => ({ ...processes[at], name: `${name}_${v}` }));
+  for (const copy of copies) {
+    if (processes.some(p => p.name === copy.name)) {
+      throw new Error(`Composition ${composition.name}: replica ${copy.name} of ${name} clashes with the process of that name`);
+    }
+  }
+  processes.splice(at, 1, ...copies);
+  instances.set(name, copies.map(c => c.name));
+}
+
+/**
+ * Expand indexed process families and indexed transitions into concrete ones.
+ * `BUFFER` with index `i:0..2` becomes `BUFFER_0`, `BUFFER_1` and `BUFFER_2`;
+ * `[expr]` inside state and action names is evaluated with the index in scope.
+ * A process the composition replicates with `forall` is copied the same way,
+ * unchanged but for its name. Named ranges are evaluated here too, so
+ * overriding a constant also moves every range bounded by it.
+ * @param spec The specification to expand
+ * @param constants Constants that override (or add to) `spec.constants`
+ * @returns A new specification without any index declarations
+ */
+export function expandSpec(spec: LTSSpec, constants: Record<string, number> = {}): LTSSpec {
+  const env: Environment = { ...(spec.constants ?? {}), ...constants };
+  const ranges = spec.ranges ?? {};
+  const processes: ProcessDefinition[] = [];
+  const instances = new Map<string, string[]>();
+
+  for (const proc of spec.processes) {
+    const { index, ...rest } = proc;
+    const variables = new Set(Object.keys(proc.variables ?? {}));
+    const local = processEnvironment(env, variables);
+    try {
+      if (!index) {
+        processes.push({
+          ...rest,
+          initialState: substituteLabel(proc.initialState, local),
+          transitions: expandTransitions(proc.transitions, local, ranges, variables),
+          ...(proc.variables ? { variables: expandVariables(proc.variables, local) } : {}),
+          ...(proc.extraAlphabet ? { extraAlphabet: proc.extraAlphabet.map(a => substituteLabel(a, local)) } : {}),
+        });
+        continue;
+      }
+
+      instances.set(proc.name, []);
+      for (const v of rangeValues(index, local, ranges)) {
+        const scope = { ...local, [index.variable]: v };
+        instances.get(proc.name)!.push(`${proc.name}_${v}`);
+        processes.push({
+          ...rest,
+          name: `${proc.name}_${v}`,
+          initialState: substituteLabel(proc.initialState, scope),
+          transitions: expandTransitions(proc.transitions, scope, ranges, variables),
+          ...(proc.variables ? { variables: expandVariables(proc.variables, scope) } : {}),
+          ...(proc.extraAlphabet ? { extraAlphabet: proc.extraAlphabet.map(a => substituteLabel(a, scope)) } : {}),
+        });
+      }
+    } catch (err) {
+      throw new Error(`Process ${proc.name}: ${err instanceof Error ? err.message : err}`);
+    }
+  }
+
+  for (const [name, index] of Object.entries(spec.composition?.forall ?? {})) {
+    replicateProcess(processes, instances, name, rangeValues(index, env, ranges), spec.composition!);
+  }
+
+  const { constants: _, ranges: __, ...others } = spec;
+  const expanded: LTSSpec = { ...others, processes };
+
+  // A composed family or replicated process stands for all of its instances
+  if (spec.composition) {
+    const { forall: ___, ...composition } = spec.composition;
+    expanded.composition = {
+      ...composition,
+      processes: spec.composition.processes.flatMap(name => instances.get(name) ?? [name]),
+    };
+  }
+  return expanded;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Variables
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Replace the integer variables of an expanded process by explicit states,
+ * one per reachable combination of state and values, e.g. `READY(count=1)`.
+ * Guards are decided and updates applied along the way, so the result is a
+ * plain LTS for analysis to explore. STOP and ERROR keep their names.
+ * @param proc The process to unfold
+ * @param limit Give up once this many states have been produced
+ * @returns The process itself when it has no variables
+ */
+export function unfoldVariables(proc: ProcessDefinition, limit = 10000): ProcessDefinition {
+  const { variables, ...rest } = proc;
+  if (!variables || Object.keys(variables).length === 0) return proc;
+
+  const names = Object.keys(variables).sort();
+  const parsed = new Map<string, Expr>();
+  const valueOf = (source: string, env: Environment): number => {
+    if (!parsed.has(source)) parsed.set(source, parseExpression(source));
+    return evaluate(parsed.get(source)!, env);
+  };
+  const nameOf = (state: string, env: Environment): string => {
+    if (state === 'STOP' || state === 'ERROR') return state;
+    return `${state}(${names.map(n => `${n}=${env[n]}`).join(',')})`;
+  };
+
+  const initial = expandVariables(variables, {});
+  const queue: { state: string; env: Environment }[] = [{ state: proc.initialState, env: initial }];
+  const seen = new Set([nameOf(proc.initialState, initial)]);
+  const transitions: Transition[] = [];
+
+  for (let i = 0; i < queue.length; i++) {
+    const { state, env } = queue[i];
+    for (const t of proc.transitions) {
+      if (t.fromState !== state) continue;
+      if (t.guard !== undefined && valueOf(t.guard, env) === 0) continue;
+
+      const next = { ...env };
+      for (const [name, value] of Object.entries(t.update ?? {})) {
+        next[name] = valueOf(value, env);
+      }
+
+      const { guard: _, update: __, ...plain } = t;
+      const to = nameOf(t.toState, next);
+      transitions.push({ ...plain, fromState: nameOf(state, env), toState: to });
+      if (!seen.has(to)) {
+        if (seen.size >= limit) {
+          throw new Error(`Process ${proc.name}: variables reach more than ${limit} states; bound them with guards`);
+        }
+        seen.add(to);
+        queue.push({ state: t.toState, env: next });
+      }
+    }
+  }
+
+  return { ...rest, initialState: nameOf(proc.initialState, initial), transitions };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Completion
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Complete a process over an alphabet: in every state, each action of the
+ * alphabet that the state does not offer leads to ERROR, so unexpected
+ * actions become explicit. A guarded transition counts as offering its
+ * action; unfold variables first to decide guards. STOP and ERROR stay terminal.
+ * @param proc The process to complete
+ * @param alphabet Actions every state must define, in the order to add them
+ * @returns A new process; completing it again changes nothing
+ */
+export function completeProcess(proc: ProcessDefinition, alphabet: string[]): ProcessDefinition {
+  const states = new Set([proc.initialState, ...proc.transitions.flatMap(t => [t.fromState, t.toState])]);
+
+  const transitions = [...proc.transitions];
+  for (const state of states) {
+    if (state === 'STOP' || state === 'ERROR') continue;
+    const offered = new Set(proc.transitions.filter(t => t.fromState === state).map(t => t.action));
+    for (const action of alphabet) {
+      if (!offered.has(action)) transitions.push({ fromState: state, toState: 'ERROR', action });
+    }
+  }
+  return { ...proc, transitions };
+}
+
+/**
+ * Complete a safety property as FSP does: over the property's own alphabet
+ * (see `completeProcess`). Run in parallel with the system, the property
+ * then reaches ERROR exactly when the system performs an action it forbids.
+ * Variables are unfolded first so that guards are decided. Hidden and
+ * silent steps are never forbidden.
+ * @param proc A process marked `property`
+ * @param silent The spec's silent action
+ * @returns A new process; completing it again changes nothing
+ */
+export function completeProperty(proc: ProcessDefinition, silent = DEFAULT_SILENT_ACTION): ProcessDefinition {
+  const { extraAlphabet, ...plain } = unfoldVariables(proc);
+  const visible = plain.transitions.filter(t => !t.hidden && t.action !== silent);
+  const alphabet = Array.from(new Set([...visible.map(t => t.action), ...(extraAlphabet ?? [])])).sort();
+  return completeProcess(plain, alphabet);
+}
+
+/**
+ * Complete every property of a specification (see `completeProperty`)
+ */
+export function completeProperties(spec: LTSSpec): LTSSpec {
+  if (!spec.processes.some(p => p.property)) return spec;
+  return {
+    ...spec,
+    processes: spec.processes.map(p => p.property ? completeProperty(p, spec.silent) : p),
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Sequencing and Interrupts
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Renaming of the states of `second` to `<prefix><state>`, with STOP and
+ * ERROR left shared, checked not to clash with the states of `first`
+ */
+function renameApart(first: ProcessDefinition, second: ProcessDefinition, prefix: string): (state: string) => string {
+  const rename = (state: string) => state === 'STOP' || state === 'ERROR' ? state : `${prefix}${state}`;
+  const own = new Set([first.initialState, ...first.transitions.flatMap(t => [t.fromState, t.toState])]);
+  for (const t of second.transitions) {
+    for (const state of [rename(t.fromState), rename(t.toState)]) {
+      if (state !== 'STOP' && state !== 'ERROR' && own.has(state)) {
+        throw new Error(`Process ${first.name}: state ${state} of ${second.name} clashes with its own; choose another prefix`);
+      }
+    }
+  }
+  return rename;
+}
+
+/**
+ * The alphabet extensions of two processes together, when there are any
+ */
+function joinedAlphabet(first: ProcessDefinition, second: ProcessDefinition): Partial<ProcessDefinition> {
+  const extraAlphabet = Array.from(new Set([...first.extraAlphabet ?? [], ...second.extraAlphabet ?? []]));
+  return extraAlphabet.length > 0 ? { extraAlphabet } : {};
+}
+
+/**
+ * Sequential composition `first ; second`: behave as `first` until it stops,
+ * then as `second`. Every transition of `first` into STOP leads to the
+ * initial state of `second` instead, and the states of `second` are renamed
+ * apart as `<prefix><state>`; STOP and ERROR stay shared. When `first` never
+ * stops, the result is just `first`.
+ * @param first The process to run first; its name and flags are kept
+ * @param second The process to continue with
+ * @param prefix Prepended to the state names of `second`, e.g. `2.`
+ * @returns A new process; the inputs are left untouched
+ */
+export function sequenceProcesses(first: ProcessDefinition, second: ProcessDefinition, prefix: string): ProcessDefinition {
+  if (first.initialState !== 'STOP' && !first.transitions.some(t => t.toState === 'STOP')) {
+    return first;
+  }
+
+  const rename = renameApart(first, second, prefix);
+  const entry = rename(second.initialState);
+  return {
+    ...first,
+    initialState: first.initialState === 'STOP' ? entry : first.initialState,
+    transitions: [
+      ...first.transitions.map(t => t.toState === 'STOP' ? { ...t, toState: entry } : t),
+      ...second.transitions.map(t => ({ ...t, fromState: rename(t.fromState), toState: rename(t.toState) })),
+    ],
+    ...joinedAlphabet(first, second),
+  };
+}
+
+/**
+ * Interrupt `proc /\ handler`: behave as `proc`, but in any of its states
+ * the handler may take over. Every state of `proc` other than STOP and
+ * ERROR gets a copy of each transition leaving the initial state of
+ * `handler`, which continues in `handler`. Its states are renamed apart
+ * as `<prefix><state>`; STOP and ERROR stay shared.
+ * @param proc The process that can be interrupted; its name and flags are kept
+ * @param handler The process to continue with once interrupted
+ * @param prefix Prepended to the state names of `handler`, e.g. `2.`
+ * @returns A new process; the inputs are left untouched
+ */
+export function interruptProcess(proc: ProcessDefinition, handler: ProcessDefinition, prefix: string): ProcessDefinition {
+  const rename = renameApart(proc, handler, prefix);
+  const triggers = handler.transitions.filter(t => t.fromState === handler.initialState);
+  const states = Array.from(new Set([proc.initialState, ...proc.transitions.flatMap(t => [t.fromState, t.toState])]))
+    .filter(s => s !== 'STOP' && s !== 'ERROR');
+
+  const interrupts = states.flatMap(state => {
+    // A state inside an index range, such as `1[i]`, needs that range to expand
+    const leaving = proc.transitions.find(t => t.fromState === state);
+    const ranges = leaving?.index === undefined ? [] : Array.isArray(leaving.index) ? leaving.index : [leaving.index];
+    const scope = ranges.filter(r => state.includes(`[${r.variable}]`));
+    return triggers.map(t => {
+      const index = [...scope, ...t.index === undefined ? [] : Array.isArray(t.index) ? t.index : [t.index]];
+      return {
+        ...t,
+        fromState: state,
+        toState: rename(t.toState),
+        ...(index.length > 0 ? { index: index.length === 1 ? index[0] : index } : {}),
+      };
+    });
+  });
+
+  // The handler's initial state itself is only kept if the handler returns to it
+  const reached = new Set(interrupts.map(t => t.toState));
+  for (let grown = true; grown;) {
+    grown = false;
+    for (const t of handler.transitions) {
+      if (reached.has(rename(t.fromState)) && !reached.has(rename(t.toState))) {
+        reached.add(rename(t.toState));
+        grown = true;
+      }
+    }
+  }
+
+  return {
+    ...proc,
+    transitions: [
+      ...proc.transitions,
+      ...interrupts,
+      ...handler.transitions
+        .filter(t => reached.has(rename(t.fromState)))
+        .map(t => ({ ...t, fromState: rename(t.fromState), toState: rename(t.toState) })),
+    ],
+    ...joinedAlphabet(proc, handler),
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Relabelling
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Apply a relabelling to one action. As in LTSA, a mapping also renames
+ * actions the old label prefixes, so `out -> put` turns `out.1` into `put.1`.
+ */
+function relabelAction(action: string, mapping: Record<string, string>): string {
+  if (action in mapping) return mapping[action];
+
+  // Longest matching prefix wins
+  let best: string | undefined;
+  for (const old of Object.keys(mapping)) {
+    if (action.startsWith(`${old}.`) && (best === undefined || old.length > best.length)) {
+      best = old;
+    }
+  }
+  return best === undefined ? action : mapping[best] + action.slice(best.length);
+}
+
+/**
+ * Rename the actions of a process. Several old actions may map to the same
+ * new one, after which they synchronize as a single action.
+ * @param proc The process to relabel
+ * @param mapping Old action name -> new action name
+ * @returns A new process; the input is left untouched
+ */
+export function relabelProcess(proc: ProcessDefinition, mapping: Record<string, string>): ProcessDefinition {
+  return {
+    ...proc,
+    transitions: proc.transitions.map(t => ({ ...t, action: relabelAction(t.action, mapping) })),
+    ...(proc.extraAlphabet ? { extraAlphabet: proc.extraAlphabet.map(a => relabelAction(a, mapping)) } : {}),
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Hiding
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Whether an action is covered by a set of labels (exactly or as a label prefix)
+ */
+export function coversAction(action: string, labels: string[]): boolean {
+  return labels.some(l => action === l || action.startsWith(`${l}.`));
+}
+
+/**
+ * Mark actions of a process as hidden tau steps. Hidden actions keep
+ * synchronizing with the other processes of the system; they are only
+ * removed from its externally visible alphabet.
+ * @param proc The process to hide actions in
+ * @param actions Actions (or label prefixes) to hide
+ * @returns A new process; the input is left untouched
+ */
+export function hideProcess(proc: ProcessDefinition, actions: string[]): ProcessDefinition {
+  return {
+    ...proc,
+    transitions: proc.transitions.map(t =>
+      coversAction(t.action, actions) ? { ...t, hidden: true } : t
+    ),
+  };
+}
+
+/**
+ * Move the CSP-style direction markers off action names: `!put` becomes
+ * `put` with direction `output`, `?put` becomes `put` with direction `input`
+ * @param spec A specification whose transitions may carry markers
+ * @returns A new specification; the input is left untouched
+ */
+export function lowerDirections(spec: LTSSpec): LTSSpec {
+  const lower = (proc: ProcessDefinition, t: Transition): Transition => {
+    const marker = t.action[0];
+    if (marker !== '!' && marker !== '?') return t;
+    const direction = marker === '!' ? 'output' : 'input';
+    if (t.direction !== undefined && t.direction !== direction) {
+      throw new Error(`Process ${proc.name}: action ${t.action} is marked ${direction}, but its direction is ${t.direction}`);
+    }
+    return { ...t, action: t.action.slice(1), direction };
+  };
+  return { ...spec, processes: spec.processes.map(proc => ({ ...proc, transitions: proc.transitions.map(t => lower(proc, t)) })) };
+}
+
+/**
+ * Action name used for silent steps when the spec does not choose one
+ */
+export const DEFAULT_SILENT_ACTION = 'tau';
+
+/**
+ * Turn the transitions on the spec's silent action (`tau` by default) into
+ * hidden steps. Unlike a hidden action, a silent step never synchronizes:
+ * when several processes take one, each process's becomes its own
+ * `tau.<process>`, which the label `tau` still covers.
+ * @param spec A composed specification
+ * @returns A new specification; the input is left untouched
+ */
+export function silenceSpec(spec: LTSSpec): LTSSpec {
+  const silent = spec.silent ?? DEFAULT_SILENT_ACTION;
+  if (typeof silent !== 'string' || silent === '') {
+    throw new Error(`silent must be a non-empty action name, got ${JSON.stringify(silent)}`);
+  }
+  const users = spec.processes.filter(p => p.transitions.some(t => t.action === silent));
+  if (users.length === 0) return spec;
+
+  const rename = users.length > 1;
+  return {
+    ...spec,
+    processes: spec.processes.map(p => ({
+      ...p,
+      transitions: p.transitions.map(t => t.action !== silent ? t : {
+        ...t,
+        action: rename ? `${silent}.${p.name}` : silent,
+        hidden: true,
+      }),
+    })),
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Shared Actions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Apply the spec's `shared` declaration in place of the usual inference.
+ * The actions it lists (exactly or as a label prefix) synchronize, even
+ * when a single process uses one. Every other action stays with the
+ * process that takes it: when several take one, each process's becomes its
+ * own `<action>.<process>`, as silent steps do.
+ * @param spec A composed specification
+ * @returns A new specification, or the input itself when nothing is declared
+ */
+export function declareShared(spec: LTSSpec): LTSSpec {
+  const shared = spec.shared;
+  if (shared === undefined) return spec;
+  if (!Array.isArray(shared) || shared.some(action => typeof action !== 'string' || action === '')) {
+    throw new Error(`shared must be a list of action names, got ${JSON.stringify(shared)}`);
+  }
+
+  const users = new Map<string, Set<string>>();
+  for (const p of spec.processes) {
+    for (const action of [...p.transitions.map(t => t.action), ...(p.extraAlphabet ?? [])]) {
+      if (!users.has(action)) users.set(action, new Set());
+      users.get(action)!.add(p.name);
+    }
+  }
+  const rename = (action: string, proc: string) =>
+    !coversAction(action, shared) && users.get(action)!.size > 1 ? `${action}.${proc}` : action;
+
+  return {
+    ...spec,
+    processes: spec.processes.map(p => ({
+      ...p,
+      transitions: p.transitions.map(t => ({ ...t, action: rename(t.action, p.name) })),
+      ...(p.extraAlphabet ? { extraAlphabet: p.extraAlphabet.map(a => rename(a, p.name)) } : {}),
+    })),
+  };
+}
+
+/**
+ * An action several processes use without the spec declaring it shared,
+ * with the name autoNamespace gives it in each of them
+ */
+export interface NamespacedAction {
+  action: string;
+  /** New name of the action, by process */
+  names: Record<string, string>;
+}
+
+/**
+ * Find the actions that synchronize only because several processes happen
+ * to use the same name, and give each process its own, prefixed with the
+ * process name: `tick` becomes `P.tick` in P and `Q.tick` in Q. Actions the
+ * spec declares shared are left alone; without a declaration every action
+ * of several processes is a candidate. Declarations such as a payload are
+ * copied to each new name, except the sender and broadcast.
+ * @param source The specification to rename actions in
+ * @returns The normalized specification with the actions renamed, and what was renamed
+ */
+export function autoNamespace(source: LTSSpec): { spec: LTSSpec; renamed: NamespacedAction[] } {
+  const spec = normalizeSpec(source);
+  const users = new Map<string, string[]>();
+  for (const p of spec.processes) {
+    for (const action of new Set([...p.transitions.map(t => t.action), ...(p.extraAlphabet ?? [])])) {
+      if (!users.has(action)) users.set(action, []);
+      users.get(action)!.push(p.name);
+    }
+  }
+
+  const renamed: NamespacedAction[] = [];
+  for (const [action, procs] of Array.from(users).sort(([a], [b]) => a.localeCompare(b))) {
+    if (procs.length < 2 || (spec.shared !== undefined && coversAction(action, spec.shared))) continue;
+    const names: Record<string, string> = {};
+    for (const proc of procs) {
+      const name = `${proc}.${action}`;
+      if (users.has(name)) {
+        throw new Error(`Action ${action} of ${proc} would be renamed ${name}, which the spec already uses; rename one of them`);
+      }
+      names[proc] = name;
+    }
+    renamed.push({ action, names });
+  }
+  if (renamed.length === 0) return { spec, renamed };
+
+  const byAction = new Map(renamed.map(r => [r.action, r.names]));
+  const rename = (action: string, proc: string) => byAction.get(action)?.[proc] ?? action;
+  const actions = { ...spec.actions };
+  for (const { action, names } of renamed) {
+    const declaration = actions[action];
+    delete actions[action];
+    if (declaration === undefined) continue;
+    const rest = { ...declaration };
+    delete rest.sender;
+    delete rest.broadcast;
+    if (Object.keys(rest).length === 0) continue;
+    for (const name of Object.values(names)) actions[name] = { ...rest };
+  }
+
+  const { actions: _, ...plain } = spec;
+  return {
+    spec: {
+      ...plain,
+      ...(Object.keys(actions).length > 0 ? { actions } : {}),
+      processes: spec.processes.map(p => ({
+        ...p,
+        transitions: p.transitions.map(t => ({ ...t, action: rename(t.action, p.name) })),
+        ...(p.extraAlphabet ? { extraAlphabet: p.extraAlphabet.map(a => rename(a, p.name)) } : {}),
+      })),
+    },
+    renamed,
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Priority
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Rank of an action under a priority: 2 when high, 0 when low, 1 otherwise
+ */
+export function priorityRank(action: string, priority: ActionPriority | undefined): number {
+  if (priority?.high && coversAction(action, priority.high)) return 2;
+  if (priority?.low && coversAction(action, priority.low)) return 0;
+  return 1;
+}
+
+/**
+ * Filter moves that are enabled at the same time down to those the
+ * priority allows: only the highest-ranked ones remain
+ * @param moves Moves enabled together, e.g. the steps out of a global state
+ * @param priority The system's priority; without one every move remains
+ */
+export function applyPriority<T extends { action: string }>(moves: T[], priority: ActionPriority | undefined): T[] {
+  if (!priority || moves.length < 2) return moves;
+  const ranks = moves.map(m => priorityRank(m.action, priority));
+  const best = Math.max(...ranks);
+  return moves.filter((_, i) => ranks[i] === best);
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Composition
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Restrict a specification to the processes named in its composition,
+ * in composition order, and apply the composition's relabelling and hiding.
+ * Processes left out are helpers and are dropped.
+ * @param spec The specification to compose
+ * @returns The specification itself when it declares no composition
+ */
+export function composeSpec(spec: LTSSpec): LTSSpec {
+  const composition = spec.composition;
+  if (!composition) return spec;
+
+  const byName = new Map(spec.processes.map(p => [p.name, p]));
+  const processes: ProcessDefinition[] = [];
+  const seen = new Set<string>();
+
+  for (const name of composition.processes) {
+    const proc = byName.get(name);
+    if (!proc) {
+      throw new Error(`Composition ${composition.name}: unknown process ${name}`);
+    }
+    if (seen.has(name)) {
+      throw new Error(`Composition ${composition.name}: process ${name} is composed more than once`);
+    }
+    seen.add(name);
+    processes.push(proc);
+  }
+
+  if (processes.length === 0) {
+    throw new Error(`Composition ${composition.name} must contain at least one process`);
+  }
+
+  const { relabel, hide, ...declared } = composition;
+  let composed = processes;
+  if (relabel) {
+    composed = composed.map(p => relabelProcess(p, relabel));
+  }
+  if (hide) {
+    composed = composed.map(p => hideProcess(p, hide));
+  }
+
+  // Action declarations follow their action to its new name
+  let actions = spec.actions;
+  if (actions && relabel) {
+    actions = {};
+    for (const [name, declaration] of Object.entries(spec.actions!)) {
+      const renamed = relabelAction(name, relabel);
+      if (!(renamed in actions) || renamed === name) {
+        actions[renamed] = declaration;
+      }
+    }
+  }
+
+  return {
+    ...spec,
+    ...(actions ? { actions } : {}),
+    composition: declared,
+    processes: composed,
+  };
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Merging
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Merge named declarations from several specifications; a name declared
+ * twice must be declared the same way
+ */
+function mergeDeclarations<T>(
+  kind: string,
+  parts: (Record<string, T> | undefined)[],
+  sources: string[]
+): Record<string, T> | undefined {
+  const merged: Record<string, T> = {};
+  const origin: Record<string, string> = {};
+  parts.forEach((part, i) => {
+    for (const [name, value] of Object.entries(part ?? {})) {
+      if (name in merged && JSON.stringify(merged[name]) !== JSON.stringify(value)) {
+        throw new Error(`${kind} ${name} is declared differently in ${origin[name]} and ${sources[i]}`);
+      }
+      merged[name] = value;
+      origin[name] ??= sources[i];
+    }
+  });
+  return Object.keys(merged).length > 0 ? merged : undefined;
+}
+
+/**
+ * Merge specifications kept in separate files into one system. Processes
+ * keep the order of their files, so actions that processes in different
+ * files share synchronize as if they had been written together. Constants,
+ * ranges and action declarations are pooled; at most one file may declare
+ * the composition.
+ * @param specs The specifications to merge, before expansion
+ * @param sources Where each one came from, used in error messages
+ */
+export function mergeSpecs(specs: LTSSpec[], sources: string[] = specs.map((_, i) => `input ${i + 1}`)): LTSSpec {
+  const processes: ProcessDefinition[] = [];
+  const origin = new Map<string, string>();
+  specs.forEach((spec, i) => {
+    for (const proc of spec.processes ?? []) {
+      if (origin.has(proc.name)) {
+        throw new Error(`Process ${proc.name} is defined in both ${origin.get(proc.name)} and ${sources[i]}`);
+      }
+      origin.set(proc.name, sources[i]);
+      processes.push(proc);
+    }
+  });
+
+  const composed = specs.map((spec, i) => [spec.composition, sources[i]] as const).filter(([c]) => c !== undefined);
+  if (composed.length > 1) {
+    throw new Error(`Only one file may declare the composition, but ${composed.map(([, source]) => source).join(' and ')} both do`);
+  }
+  const silent = Array.from(new Set(specs.map(s => s.silent).filter((s): s is string => s !== undefined)));
+  if (silent.length > 1) {
+    throw new Error(`The inputs use different silent actions: ${silent.join(', ')}`);
+  }
+
+  const merged: LTSSpec = { processes };
+  const constants = mergeDeclarations('Constant', specs.map(s => s.constants), sources);
+  const ranges = mergeDeclarations('Range', specs.map(s => s.ranges), sources);
+  const actions = mergeDeclarations('Action', specs.map(s => s.actions), sources);
+  if (constants) merged.constants = constants;
+  if (ranges) merged.ranges = ranges;
+  if (actions) merged.actions = actions;
+  if (composed.length > 0) merged.composition = composed[0][0];
+  if (silent.length > 0) merged.silent = silent[0];
+  return merged;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Normalization
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Lower a specification to the concrete form consumed by the generator,
+ * analysis and exporters. Safe to call on an already-normalized spec.
+ */
+export function normalizeSpec(spec: LTSSpec): LTSSpec {
+  if (!spec.processes || spec.processes.length === 0) {
+    throw new Error('LTS specification must contain at least one process');
+  }
+  return declareShared(silenceSpec(composeSpec(completeProperties(expandSpec(lowerDirections(spec))))));
+}
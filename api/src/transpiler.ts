@@ -3,10 +3,33 @@
 // Converts Labelled Transition System specifications to idiomatic Go code
 // ═══════════════════════════════════════════════════════════════════════════
 
+import { availableParallelism } from 'os';
+import { Worker, isMainThread, parentPort, workerData } from 'worker_threads';
+import { coversAction, normalizeSpec, priorityRank } from './transforms';
+import { Environment, Expr, evaluateExpression, freeNames, parseExpression } from './expression';
+import { shortestCycle } from './analysis';
+
 // ─────────────────────────────────────────────────────────────────────────────
 // Type Definitions
 // ─────────────────────────────────────────────────────────────────────────────
 
+/**
+ * An integer range `from..to`. Bounds may be numbers or expressions over the
+ * spec constants.
+ */
+export interface RangeDeclaration {
+  from: number | string;
+  to: number | string;
+}
+
+/**
+ * An index variable ranging over integers, e.g. `i:0..N`, or over one of the
+ * spec's named ranges, e.g. `i:T`
+ */
+export type IndexRange =
+  | { variable: string; from: number | string; to: number | string }
+  | { variable: string; range: string };
+
 /**
  * A single transition in the LTS
  */
@@ -14,6 +37,43 @@ export interface Transition {
   fromState: string;
   toState: string;
   action: string;
+  /** Expand into one transition per index value (indexed states/actions), or per combination of several */
+  index?: IndexRange | IndexRange[];
+  /** Process variable that carries the payload of a value-passing action */
+  variable?: string;
+  /** Hidden (tau) step: still synchronizes, but is invisible outside the system */
+  hidden?: boolean;
+  /** Condition over constants, indices and process variables; the transition is only offered while it holds */
+  guard?: string;
+  /** Assignments to process variables made when the transition fires, e.g. `{ "count": "count + 1" }` */
+  update?: Record<string, string>;
+  /** Relative chance of taking the transition in a weighted choice; either every transition of a state has one or none does */
+  weight?: number;
+  /** Line of the input file that declares the transition, for diagnostics */
+  line?: number;
+  /** `!action` (output) or `?action` (input): which end of the action's channel the process holds */
+  direction?: ActionDirection;
+}
+
+/**
+ * Which end of an action's channel a process holds, as marked in the spec
+ */
+export type ActionDirection = 'input' | 'output';
+
+/**
+ * Declaration of an action's properties shared by every process using it
+ */
+export interface ActionDeclaration {
+  /** Go type of the value carried by the action, e.g. `int` (none = pure sync) */
+  payload?: string;
+  /** Process that sends on the action's channel (default: first alphabetically) */
+  sender?: string;
+  /** Capacity of the action's channel, overriding the `bufferSize` option */
+  buffer?: number;
+  /** Deliver to every receiver on its own schedule instead of synchronizing with all of them */
+  broadcast?: boolean;
+  /** Time that passes before the action fires, as a Go duration such as `100ms` */
+  delay?: string;
 }
 
 /**
@@ -23,6 +83,55 @@ export interface ProcessDefinition {
   name: string;
   initialState: string;
   transitions: Transition[];
+  /** Declare a family of processes, one instance per index value */
+  index?: IndexRange;
+  /** Integer variables local to the process, with their initial values */
+  variables?: Record<string, number | string>;
+  /**
+   * Alphabet extension, as FSP's `P + {a}`: actions the process takes part
+   * in without ever performing them, so that it blocks them for its peers
+   */
+  extraAlphabet?: string[];
+  /**
+   * A safety property, as FSP's `property`: it runs alongside the system and
+   * enters ERROR when the system performs an action of its alphabet that the
+   * property does not offer at that point
+   */
+  property?: boolean;
+}
+
+/**
+ * A parallel composition declaring which processes form the running system,
+ * e.g. `||SYS = (PRODUCER || CONSUMER || BUFFER)`
+ */
+export interface Composition {
+  name: string;
+  /** Names of the composed processes (or indexed process families) */
+  processes: string[];
+  /**
+   * Replicated processes, as FSP's `forall [i:1..N] WORKER`: each composed
+   * once per index value, as the identical instances `WORKER_1` to `WORKER_N`
+   */
+  forall?: Record<string, IndexRange>;
+  /** Relabelling `/{new/old}` as an old -> new map, applied to every composed process */
+  relabel?: Record<string, string>;
+  /** Hiding `\{a, b}`: actions that become internal tau steps of the system */
+  hide?: string[];
+  /** Priority `<< {a}` / `>> {b}` among actions, named as after relabelling */
+  priority?: ActionPriority;
+  /** Line of the input file that declares the composition, for diagnostics */
+  line?: number;
+}
+
+/**
+ * Priority among the actions of a composed system, as FSP's `<<` and `>>`.
+ * Labels also cover the actions they prefix, as in hiding.
+ */
+export interface ActionPriority {
+  /** While one of these is enabled, nothing else may happen */
+  high?: string[];
+  /** These only happen when nothing else is enabled */
+  low?: string[];
 }
 
 /**
@@ -30,6 +139,18 @@ export interface ProcessDefinition {
  */
 export interface LTSSpec {
   processes: ProcessDefinition[];
+  /** Named integer constants usable in index ranges and `[expr]` labels */
+  constants?: Record<string, number>;
+  /** Named ranges such as `T = 0..N`, usable as `{ "variable": "i", "range": "T" }` */
+  ranges?: Record<string, RangeDeclaration>;
+  /** Per-action declarations, keyed by action name */
+  actions?: Record<string, ActionDeclaration>;
+  /** The system to run; without one every process is launched */
+  composition?: Composition;
+  /** Action name that marks a silent internal step (default `tau`) */
+  silent?: string;
+  /** The actions (or label prefixes) that synchronize; when given, every other action is local */
+  shared?: string[];
 }
 
 /**
@@ -42,6 +163,88 @@ export interface FlatTransition {
   action: string;
 }
 
+/**
+ * Options controlling the shape of the generated Go code
+ */
+export interface GeneratorOptions {
+  /** Capacity of each shared action channel (0 = unbuffered rendezvous) */
+  bufferSize?: number;
+  /** Thread a context.Context through every process so the system can be cancelled */
+  context?: boolean;
+  /** Cancel the system's context after this Go duration, e.g. `2s`, so `main` returns on its own */
+  runFor?: string;
+  /** Cancel the system's context on SIGINT or SIGTERM, so Ctrl-C stops it cleanly */
+  signals?: boolean;
+  /** Stop each process after it has fired this many transitions */
+  shutdownAfterSteps?: number;
+  /** Give up on a blocking channel operation after this Go duration, e.g. `5s` or `10ms` */
+  actionTimeout?: string;
+  /** How runtime events are logged: `fmt` prints lines (default), `slog` emits structured records */
+  logger?: LoggerMode;
+  /** Name of the generated Go package (default `main`) */
+  package?: string;
+  /** Emit an exported `Run(ctx) error` instead of `func main`, for embedding in other programs */
+  noMain?: boolean;
+  /** Count how often each action fires and export an `ActionCounts()` snapshot */
+  counters?: boolean;
+  /** Make choice states try their actions in an order drawn from this seed, so runs repeat */
+  seed?: number;
+  /** Retry channel operations in short attempts, and give up when none makes progress */
+  nonblocking?: boolean;
+  /** Declare an exported `Observer` that is told about every transition */
+  hooks?: boolean;
+  /** Make choice states try the actions they have fired least often first */
+  fair?: boolean;
+  /** Keep each process's state in a typed integer constant instead of a string */
+  intStates?: boolean;
+  /** How processes communicate: a channel per shared action (default), an inbox per process, or one mutex over all their states */
+  backend?: Backend;
+  /** Recover a process that panics and run it again from its initial state */
+  supervise?: boolean;
+  /** How often a supervised process is restarted before it is given up on (default 3) */
+  maxRestarts?: number;
+  /** Publish action counts and process states under expvar, served over HTTP at this address, e.g. `localhost:8080` */
+  expvar?: string;
+  /** Serve per-action counters and per-process state gauges for Prometheus at `/metrics` on this address, e.g. `:9090` */
+  prometheus?: string;
+  /** Write every transition to this file as one JSON object per line, in the order they fire, so that a run can be reproduced */
+  traceFile?: string;
+  /** Follow a trace written under traceFile: every choice takes the recorded branch and transitions fire in the recorded order */
+  replay?: string;
+}
+
+/**
+ * Logging backends the generated code can use
+ */
+export type LoggerMode = 'fmt' | 'slog';
+
+const LOGGER_MODES: LoggerMode[] = ['fmt', 'slog'];
+
+/**
+ * Ways the generated processes communicate: `channels` synchronizes on a
+ * channel per shared action, `actor` sends tagged messages to the inbox of
+ * each process, and `mutex` keeps every state in one struct that a single
+ * driver loop steps under a lock
+ */
+export type Backend = 'channels' | 'actor' | 'mutex';
+
+export const BACKENDS: Backend[] = ['channels', 'actor', 'mutex'];
+
+/**
+ * Options that only make sense for channel operations, which the other
+ * backends do not have
+ */
+const CHANNEL_ONLY_OPTIONS: (keyof GeneratorOptions)[] = [
+  'context', 'runFor', 'signals', 'shutdownAfterSteps', 'actionTimeout', 'nonblocking', 'noMain', 'seed', 'fair',
+  'replay',
+];
+
+/**
+ * How a process takes part in an action: as the channel sender, as a
+ * receiver, or on its own without any channel operation
+ */
+export type ActionKind = 'send' | 'receive' | 'internal';
+
 /**
  * Internal representation of a state with its outgoing transitions
  */
@@ -52,9 +255,40 @@ interface StateInfo {
 /**
  * Action usage tracking for sender/receiver assignment
  */
-interface ActionUsage {
+export interface ActionUsage {
   processes: Set<string>;
   sender?: string;
+  /** The spec fixes the sender, with `actions.sender` or a `!` marker */
+  declared?: boolean;
+  /** Listed in `shared`, so it gets a channel even when one process uses it */
+  shared?: boolean;
+}
+
+/**
+ * Shared state threaded through the code generation functions
+ */
+interface GenContext {
+  actionUsage: Map<string, ActionUsage>;
+  actions: Record<string, ActionDeclaration>;
+  options: GeneratorOptions;
+  priority?: ActionPriority;
+  /** Shared actions whose participants tell each other when they stop */
+  closedOnStop: Set<string>;
+  /** Multiway actions whose coordinator tells the participants once one of them has stopped */
+  stoppedMultiway: Set<string>;
+  /** Some choice state picks its transitions by weight */
+  weighted: boolean;
+  /** Processes that pick one of several steps at random under the actor backend */
+  actorChoosers: Set<string>;
+}
+
+/**
+ * One case of a choice select: the communication and the transition it fires
+ */
+interface SelectCase {
+  comm: string;
+  comment: string;
+  t: Transition;
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -106,6 +340,19 @@ export function flatToSpec(transitions: FlatTransition[]): LTSSpec {
   return { processes };
 }
 
+/**
+ * Normalize either input format (structured or flat) to an LTSSpec
+ */
+export function toSpec(data: LTSSpec | FlatTransition[]): LTSSpec {
+  if (Array.isArray(data)) {
+    return flatToSpec(data);
+  }
+  if (data && Array.isArray(data.processes)) {
+    return data;
+  }
+  throw new Error('Invalid input format. Expected either an array of flat transitions or an object with "processes" property.');
+}
+
 /**
  * Sanitize a name to be a valid Go identifier
  */
@@ -122,6 +369,284 @@ function channelName(action: string): string {
   return `ch_${sanitizeGoName(action)}`;
 }
 
+/**
+ * Whether the processes synchronize over channels, the default backend
+ */
+function usesChannels(gen: GenContext): boolean {
+  return (gen.options.backend ?? 'channels') === 'channels';
+}
+
+/**
+ * Whether a shared action synchronizes three or more processes at once
+ */
+function isMultiway(action: string, gen: GenContext): boolean {
+  if (!usesChannels(gen)) return false;
+  return gen.actionUsage.get(action)!.processes.size > 2 && !gen.actions[action]?.broadcast;
+}
+
+/**
+ * Whether a shared action is broadcast: its sender never waits for the
+ * receivers, each of which takes the action from a queue of its own
+ */
+function isBroadcast(action: string, gen: GenContext): boolean {
+  if (!usesChannels(gen)) return false;
+  return isSharedAction(gen.actionUsage.get(action)!) && gen.actions[action]?.broadcast === true;
+}
+
+/**
+ * Broadcast actions of the system, sorted
+ */
+function broadcastActions(gen: GenContext): string[] {
+  return Array.from(gen.actionUsage.keys()).filter(action => isBroadcast(action, gen)).sort();
+}
+
+/**
+ * Processes that receive a shared action, sorted
+ */
+function receiversOf(action: string, gen: GenContext): string[] {
+  const usage = gen.actionUsage.get(action)!;
+  return Array.from(usage.processes).filter(p => p !== usage.sender).sort();
+}
+
+/**
+ * Channel on which a receiver of a broadcast action takes it
+ */
+function deliveryChannelName(action: string, receiver: string): string {
+  return `${channelName(action)}_${sanitizeGoName(receiver)}`;
+}
+
+/**
+ * Channel closed once everything broadcast to a receiver has been delivered
+ * and the sender has returned, used by shutdown mode
+ */
+function drainedChannelName(action: string, receiver: string): string {
+  return `drained_${sanitizeGoName(action)}_${sanitizeGoName(receiver)}`;
+}
+
+/**
+ * Channel a process uses for a transition's action
+ */
+function transitionChannel(proc: ProcessDefinition, t: Transition, gen: GenContext): string {
+  if (isBroadcast(t.action, gen) && actionKind(gen.actionUsage, proc.name, t.action) === 'receive') {
+    return deliveryChannelName(t.action, proc.name);
+  }
+  return channelName(t.action);
+}
+
+/**
+ * Multiway actions of the system, sorted
+ */
+function multiwayActions(gen: GenContext): string[] {
+  return Array.from(gen.actionUsage.keys()).filter(action => isMultiway(action, gen)).sort();
+}
+
+/**
+ * Processes taking part in a multiway action, sorted
+ */
+function participantsOf(action: string, gen: GenContext): string[] {
+  return Array.from(gen.actionUsage.get(action)!.processes).sort();
+}
+
+/**
+ * Whether a process takes part in some multiway action
+ */
+function joinsMultiway(proc: ProcessDefinition, gen: GenContext): boolean {
+  return proc.transitions.some(t => isMultiway(t.action, gen));
+}
+
+/**
+ * Channel on which the coordinator locks a participant into a round of a multiway action
+ */
+function lockChannelName(action: string, process: string): string {
+  return `${channelName(action)}_lock_${sanitizeGoName(process)}`;
+}
+
+/**
+ * Channel on which the coordinator tells a locked participant whether the round fires
+ */
+function releaseChannelName(action: string, process: string): string {
+  return `${channelName(action)}_release_${sanitizeGoName(process)}`;
+}
+
+/**
+ * Every channel a shared action needs, with the expression that creates it
+ */
+function actionChannels(action: string, gen: GenContext): [string, string][] {
+  const channels: [string, string][] = [[channelName(action), makeChannel(action, gen)]];
+  if (isMultiway(action, gen)) {
+    for (const process of participantsOf(action, gen)) {
+      channels.push([lockChannelName(action, process), 'make(chan struct{})']);
+      channels.push([releaseChannelName(action, process), 'make(chan bool)']);
+    }
+  }
+  if (isBroadcast(action, gen)) {
+    for (const receiver of receiversOf(action, gen)) {
+      channels.push([deliveryChannelName(action, receiver), `make(${channelType(action, gen)})`]);
+    }
+  }
+  return channels;
+}
+
+/**
+ * Go variable that holds the payload of a transition's action, if it has one
+ */
+function payloadVariable(t: Transition, gen: GenContext): string | undefined {
+  if (!gen.actions[t.action]?.payload) return undefined;
+  return t.variable ?? `v_${sanitizeGoName(t.action)}`;
+}
+
+/**
+ * Name of the guard that lets a stopping sender close an action's channel only once
+ */
+function closeOnceName(action: string): string {
+  return `closeOnce_${sanitizeGoName(action)}`;
+}
+
+/**
+ * Name of the channel closed once a receiver of an action has stopped
+ */
+function stoppedChannelName(action: string): string {
+  return `stopped_${sanitizeGoName(action)}`;
+}
+
+/**
+ * Name of the guard that lets receivers close an action's stopped channel only once
+ */
+function stopOnceName(action: string): string {
+  return `stopOnce_${sanitizeGoName(action)}`;
+}
+
+/**
+ * Whether receiving a transition's action must tell a real handshake from a
+ * channel its sender has closed
+ */
+function receivesClosable(proc: ProcessDefinition, t: Transition, gen: GenContext): boolean {
+  return gen.closedOnStop.has(t.action) && actionKind(gen.actionUsage, proc.name, t.action) === 'receive';
+}
+
+/**
+ * The Go expression of an action's delay, e.g. `100 * time.Millisecond`
+ * @returns undefined when the action is not delayed
+ */
+function actionDelay(action: string, gen: GenContext): string | undefined {
+  const delay = gen.actions[action]?.delay;
+  return delay === undefined ? undefined : goDuration(delay);
+}
+
+/**
+ * Length of an action's delay in nanoseconds, 0 when it has none
+ */
+function delayNanos(action: string, gen: GenContext): number {
+  const delay = gen.actions[action]?.delay;
+  return delay === undefined ? 0 : durationNanos(delay);
+}
+
+/**
+ * Whether some delayed action is taken by the given process or, without
+ * one, by any process
+ */
+function usesDelays(gen: GenContext, proc?: ProcessDefinition): boolean {
+  return Array.from(gen.actionUsage).some(([action, usage]) =>
+    gen.actions[action]?.delay !== undefined && (proc === undefined || usage.processes.has(proc.name))
+  );
+}
+
+/**
+ * Channel send statement for a transition
+ */
+function sendOp(t: Transition, gen: GenContext, channel = channelName(t.action)): string {
+  return `${channel} <- ${payloadVariable(t, gen) ?? 'struct{}{}'}`;
+}
+
+/**
+ * Channel receive expression/statement for a transition
+ */
+function receiveOp(t: Transition, gen: GenContext, channel = channelName(t.action)): string {
+  const variable = payloadVariable(t, gen);
+  if (gen.closedOnStop.has(t.action)) {
+    return `${variable ?? '_'}, ok = <-${channel}`;
+  }
+  return variable ? `${variable} = <-${channel}` : `<-${channel}`;
+}
+
+/**
+ * Render a spec expression as Go. The spec language treats numbers and
+ * conditions alike, as C does; Go does not, so a number used as a condition
+ * is compared with zero, and a condition used as a number is an error.
+ */
+function goExpression(expr: Expr): { code: string; condition: boolean } {
+  switch (expr.kind) {
+    case 'number':
+      return { code: String(expr.value), condition: false };
+    case 'name':
+      return { code: expr.name, condition: false };
+    case 'unary':
+      return expr.op === '-'
+        ? { code: `-${goOperand(expr.operand, false, true)}`, condition: false }
+        : { code: `!${goOperand(expr.operand, true, true)}`, condition: true };
+    case 'binary': {
+      if (expr.op === '&&' || expr.op === '||') {
+        return { code: `${goOperand(expr.left, true)} ${expr.op} ${goOperand(expr.right, true)}`, condition: true };
+      }
+      const comparison = ['==', '!=', '<', '<=', '>', '>='].includes(expr.op);
+      // Two conditions may be compared for equality as they are
+      const conditions = (expr.op === '==' || expr.op === '!=') &&
+        goExpression(expr.left).condition && goExpression(expr.right).condition;
+      return {
+        code: `${goOperand(expr.left, conditions)} ${expr.op} ${goOperand(expr.right, conditions)}`,
+        condition: comparison,
+      };
+    }
+  }
+}
+
+/**
+ * A subexpression rendered as Go, parenthesized when it is compound
+ */
+function goOperand(expr: Expr, condition: boolean, unary = false): string {
+  const rendered = goExpression(expr);
+  const code = expr.kind === 'binary' || (unary && expr.kind === 'unary') ? `(${rendered.code})` : rendered.code;
+  if (condition && !rendered.condition) return `(${code} != 0)`;
+  if (!condition && rendered.condition) {
+    throw new Error(`Condition ${rendered.code} cannot be used as a number in Go`);
+  }
+  return code;
+}
+
+/**
+ * Go condition for a transition guard
+ */
+function goCondition(guard: string): string {
+  const rendered = goExpression(parseExpression(guard));
+  return rendered.condition ? rendered.code : `${rendered.code} != 0`;
+}
+
+/**
+ * Go integer expression for the value assigned to a variable
+ */
+function goValue(source: string): string {
+  const rendered = goExpression(parseExpression(source));
+  if (rendered.condition) {
+    throw new Error(`Condition ${source} cannot be assigned to an integer variable`);
+  }
+  return rendered.code;
+}
+
+/**
+ * Variables of a process that Go code ever reads. Assignments to any other
+ * variable are dead stores and left out, as Go rejects unused variables.
+ */
+function readVariables(proc: ProcessDefinition): Set<string> {
+  const read = new Set<string>();
+  for (const t of proc.transitions) {
+    const sources = [...(t.guard !== undefined ? [t.guard] : []), ...Object.values(t.update ?? {})];
+    for (const source of sources) {
+      for (const name of freeNames(parseExpression(source))) read.add(name);
+    }
+  }
+  return read;
+}
+
 /**
  * Generate a valid Go function name from a process name
  */
@@ -130,10 +655,18 @@ function funcName(process: string): string {
 }
 
 /**
- * Generate a valid Go state constant from a state name
+ * Generate a valid Go state constant from a state name: a string literal,
+ * or the name of an integer constant with `intStates`
+ */
+function stateName(process: string, state: string, gen: GenContext): string {
+  return gen.options.intStates ? sanitizeGoName(`${process}_${state}`) : `"${process}_${state}"`;
+}
+
+/**
+ * Go type of a process's integer states
  */
-function stateName(process: string, state: string): string {
-  return `"${process}_${state}"`;
+function stateType(process: string): string {
+  return `state_${sanitizeGoName(process)}`;
 }
 
 // ─────────────────────────────────────────────────────────────────────────────
@@ -156,7 +689,7 @@ function extractActions(spec: LTSSpec): Set<string> {
 /**
  * Analyze action usage across processes for sender/receiver assignment
  */
-function analyzeActionUsage(spec: LTSSpec): Map<string, ActionUsage> {
+export function analyzeActionUsage(spec: LTSSpec): Map<string, ActionUsage> {
   const usage = new Map<string, ActionUsage>();
 
   for (const proc of spec.processes) {
@@ -168,15 +701,80 @@ function analyzeActionUsage(spec: LTSSpec): Map<string, ActionUsage> {
     }
   }
 
-  // Assign senders: first process (alphabetically) that uses the action is the sender
+  // Assign senders: the declared sender or the process that outputs the action,
+  // else the first process (alphabetically) that uses it without marking it input
   for (const [action, info] of usage) {
+    const declared = spec.actions?.[action]?.sender;
+    if (declared !== undefined && !info.processes.has(declared)) {
+      throw new Error(`Action ${action}: declared sender ${declared} does not use it`);
+    }
+    const { outputs, inputs } = actionDirections(spec, action);
+    const output = outputs.length > 0 ? outputs[0] : undefined;
+    if (declared !== undefined && output !== undefined && declared !== output) {
+      throw new Error(`Action ${action}: declared sender ${declared}, but ${output} outputs it (!${action})`);
+    }
     const procs = Array.from(info.processes).sort();
-    info.sender = procs[0];
+    if ((output !== undefined || inputs.length > 0) && procs.length === 1) {
+      throw new Error(`Action ${action}: ${procs[0]} ${output !== undefined ? 'outputs' : 'inputs'} it, but no other process ${output !== undefined ? 'reads' : 'writes'} it`);
+    }
+    const writers = procs.filter(name => !inputs.includes(name));
+    if (writers.length === 0) {
+      throw new Error(`Action ${action}: every process inputs it (?${action}), so none writes it`);
+    }
+    info.sender = declared ?? output ?? writers[0];
+    info.declared = declared !== undefined || output !== undefined;
+    info.shared = spec.shared !== undefined && coversAction(action, spec.shared);
+  }
+
+  // An extended alphabet joins an action without sending it: the process
+  // never takes its side of the handshake, so the action cannot complete
+  for (const proc of spec.processes) {
+    for (const action of proc.extraAlphabet ?? []) {
+      usage.get(action)?.processes.add(proc.name);
+    }
   }
 
   return usage;
 }
 
+/**
+ * The processes that mark an action output (`!`) and input (`?`), sorted.
+ * A process may mark it one way or the other, and only one may output it.
+ */
+function actionDirections(spec: LTSSpec, action: string): { outputs: string[]; inputs: string[] } {
+  const outputs: string[] = [];
+  const inputs: string[] = [];
+  for (const proc of spec.processes) {
+    const marked = new Set(proc.transitions.filter(t => t.action === action && t.direction).map(t => t.direction!));
+    if (marked.size > 1) {
+      throw new Error(`Process ${proc.name}: action ${action} is marked both output (!${action}) and input (?${action})`);
+    }
+    if (marked.has('output')) outputs.push(proc.name);
+    if (marked.has('input')) inputs.push(proc.name);
+  }
+  if (outputs.length > 1) {
+    throw new Error(`Action ${action} is output (!${action}) by ${outputs.sort().join(' and ')}, but only one process may write it`);
+  }
+  return { outputs, inputs: inputs.sort() };
+}
+
+/**
+ * Whether an action synchronizes, and so needs a channel: when several
+ * processes use it, or the spec declares it shared
+ */
+export function isSharedAction(usage: ActionUsage): boolean {
+  return usage.processes.size > 1 || usage.shared === true;
+}
+
+/**
+ * Classify how a process takes part in an action
+ */
+export function actionKind(actionUsage: Map<string, ActionUsage>, process: string, action: string): ActionKind {
+  const usage = actionUsage.get(action)!;
+  if (!isSharedAction(usage)) return 'internal';
+  return usage.sender === process ? 'send' : 'receive';
+}
+
 /**
  * Build a state map for a process: state -> outgoing transitions
  */
@@ -196,7 +794,7 @@ function buildStateMap(proc: ProcessDefinition): Map<string, StateInfo> {
 /**
  * Get all unique states in a process
  */
-function getAllStates(proc: ProcessDefinition): Set<string> {
+export function getAllStates(proc: ProcessDefinition): Set<string> {
   const states = new Set<string>();
   for (const t of proc.transitions) {
     states.add(t.fromState);
@@ -212,334 +810,3851 @@ function getAllStates(proc: ProcessDefinition): Set<string> {
 /**
  * Generate the Go package header and imports
  */
-function generateHeader(hasNonSharedActions: boolean): string {
-  const imports = ['"fmt"', '"sync"'];
-  if (hasNonSharedActions) {
-    imports.push('"context"');
-  }
-  
-  return `package main
-
+function generateHeader(gen: GenContext, imports: string[]): string {
+  const sorted = Array.from(new Set(imports)).sort();
+  const block = sorted.length > 0 ? `
 import (
-\t${imports.join('\n\t')}
+\t${sorted.join('\n\t')}
 )
+` : '';
 
+  return `package ${gen.options.package ?? 'main'}
+${block}
 `;
 }
 
 /**
- * Generate channel declarations for shared actions only
+ * Packages used by the package-level declarations
  */
-function generateChannelDeclarations(
-  actions: Set<string>,
-  actionUsage: Map<string, ActionUsage>
-): string {
-  // Only create channels for shared actions (used by multiple processes)
-  const sharedActions = Array.from(actions)
-    .filter(action => actionUsage.get(action)!.processes.size > 1)
-    .sort();
-
-  if (sharedActions.length === 0) return '';
+function declarationImports(gen: GenContext): string[] {
+  const imports: string[] = [];
+  if (usesSlog(gen)) {
+    imports.push('"log/slog"');
+  } else if (gen.options.supervise) {
+    imports.push('"fmt"');
+  }
+  if (gen.options.actionTimeout !== undefined || gen.options.nonblocking || gen.options.runFor !== undefined) {
+    imports.push('"time"');
+  }
+  if (gen.options.counters) {
+    imports.push('"sync/atomic"');
+  }
+  if (gen.options.expvar !== undefined) {
+    imports.push('"expvar"');
+  }
+  if (gen.options.prometheus !== undefined) {
+    imports.push('"github.com/prometheus/client_golang/prometheus"', '"github.com/prometheus/client_golang/prometheus/promauto"');
+  }
+  if (gen.options.traceFile !== undefined) {
+    imports.push('"encoding/json"', '"os"', '"sync"');
+  }
+  if (gen.options.replay !== undefined) {
+    imports.push('"encoding/json"', '"fmt"', '"io"', '"os"', '"sync"');
+  }
+  if (gen.options.seed !== undefined || gen.weighted) {
+    imports.push('"hash/fnv"', '"math/rand"');
+  }
+  if (gen.options.seed === undefined && gen.weighted) {
+    imports.push('"time"');
+  }
+  if (gen.options.fair) {
+    imports.push('"sort"');
+  }
+  // anyDone, for the multiway actions, waits on sync.Once
+  if (gen.closedOnStop.size > 0 || multiwayActions(gen).length > 0) {
+    imports.push('"sync"');
+  }
+  return imports;
+}
 
-  const lines = ['// Channels for action synchronization (shared actions only)'];
-  lines.push('var (');
-  
-  for (const action of sharedActions) {
-    lines.push(`\t${channelName(action)} = make(chan struct{}) // shared action: ${action}`);
+/**
+ * Packages used by the process functions, or by just one of them
+ */
+function processImports(gen: GenContext, proc?: ProcessDefinition): string[] {
+  const imports = ['"sync"'];
+  if (!usesSlog(gen)) {
+    imports.push('"fmt"');
   }
-  
-  lines.push(')');
-  lines.push('');
-  return lines.join('\n');
+  if (gen.options.context) {
+    imports.push('"context"');
+  }
+  if (gen.options.actionTimeout !== undefined || gen.options.nonblocking || usesDelays(gen, proc)) {
+    imports.push('"time"');
+  }
+  if (gen.options.intStates) {
+    imports.push('"strconv"');
+  }
+  if (proc ? gen.actorChoosers.has(proc.name) : gen.actorChoosers.size > 0) {
+    imports.push('"math/rand"');
+  }
+  return imports;
 }
 
 /**
- * Generate a single case block for a state
+ * Packages used by `main` or, in library mode, `Run`
  */
-function generateStateCase(
-  proc: ProcessDefinition,
-  state: string,
-  stateInfo: StateInfo | undefined,
-  actionUsage: Map<string, ActionUsage>,
-  allStates: Set<string>
-): string {
-  const lines: string[] = [];
-  const caseLabel = stateName(proc.name, state);
-  
-  lines.push(`\t\tcase ${caseLabel}:`);
-
-  // Check if this is a terminal state (STOP or no outgoing transitions)
-  if (!stateInfo || stateInfo.transitions.length === 0 || state === 'STOP') {
-    lines.push(`\t\t\tfmt.Printf("[${proc.name}] Reached terminal state: ${state}\\n")`);
-    lines.push(`\t\t\treturn`);
-    return lines.join('\n');
+function entryImports(gen: GenContext): string[] {
+  if (gen.options.noMain) {
+    return ['"context"', '"sync"'];
+  }
+  const imports = ['"sync"'];
+  if (!usesSlog(gen)) {
+    imports.push('"fmt"');
+  }
+  if (gen.options.context) {
+    imports.push('"context"');
   }
+  if (gen.options.signals) {
+    imports.push('"os"', '"os/signal"', '"syscall"');
+  }
+  if (gen.options.expvar !== undefined) {
+    imports.push('"net/http"');
+  }
+  if (gen.options.prometheus !== undefined) {
+    imports.push('"net/http"', '"github.com/prometheus/client_golang/prometheus/promhttp"');
+  }
+  return imports;
+}
 
-  const transitions = stateInfo.transitions;
+/**
+ * Shared actions of a set, which need a channel
+ */
+function sharedActionsOf(actions: Set<string>, gen: GenContext): string[] {
+  return Array.from(actions)
+    .filter(action => isSharedAction(gen.actionUsage.get(action)!))
+    .sort();
+}
 
-  if (transitions.length === 1) {
-    // Single transition: direct channel operation
-    const t = transitions[0];
-    const usage = actionUsage.get(t.action)!;
-    const isSender = usage.sender === proc.name;
-    const isShared = usage.processes.size > 1;
-    const chName = channelName(t.action);
-
-    if (isShared) {
-      // Shared action: synchronous handshake between processes
-      if (isSender) {
-        lines.push(`\t\t\t${chName} <- struct{}{} // send: ${t.action}`);
-      } else {
-        lines.push(`\t\t\t<-${chName} // receive: ${t.action}`);
-      }
-    }
-    // Non-shared actions don't need channel operations - just log
-    
-    lines.push(`\t\t\tfmt.Printf("[${proc.name}] action: ${t.action} (${state} -> ${t.toState})\\n")`);
-    lines.push(`\t\t\tstate = ${stateName(proc.name, t.toState)}`);
-  } else {
-    // Multiple transitions: check if any are shared
-    const hasSharedTransition = transitions.some(t => {
-      const usage = actionUsage.get(t.action)!;
-      return usage.processes.size > 1;
-    });
+/**
+ * Capacity of a shared action's channel: its declared buffer, else the global size
+ */
+function bufferOf(action: string, gen: GenContext): number {
+  return gen.actions[action]?.buffer ?? gen.options.bufferSize ?? 0;
+}
+
+/**
+ * Go type of the channel for a shared action
+ */
+function channelType(action: string, gen: GenContext): string {
+  return `chan ${gen.actions[action]?.payload ?? 'struct{}'}`;
+}
 
-    if (hasSharedTransition) {
-      // Use select for choice with shared actions
-      lines.push(`\t\t\tselect {`);
+/**
+ * Go expression creating the channel for a shared action
+ */
+function makeChannel(action: string, gen: GenContext): string {
+  const bufferSize = bufferOf(action, gen);
+  const chanType = channelType(action, gen);
+  return `make(${bufferSize > 0 ? `${chanType}, ${bufferSize}` : chanType})`;
+}
 
-      for (const t of transitions) {
-        const usage = actionUsage.get(t.action)!;
-        const isSender = usage.sender === proc.name;
-        const isShared = usage.processes.size > 1;
-        const chName = channelName(t.action);
-
-        if (isShared) {
-          if (isSender) {
-            lines.push(`\t\t\tcase ${chName} <- struct{}{}: // send: ${t.action}`);
-          } else {
-            lines.push(`\t\t\tcase <-${chName}: // receive: ${t.action}`);
-          }
-        } else {
-          // Non-shared action in a select - use a default-like pattern
-          // We'll handle this by just allowing it as an option
-          lines.push(`\t\t\tdefault: // non-shared action: ${t.action}`);
-        }
-        
-        lines.push(`\t\t\t\tfmt.Printf("[${proc.name}] action: ${t.action} (${state} -> ${t.toState})\\n")`);
-        lines.push(`\t\t\t\tstate = ${stateName(proc.name, t.toState)}`);
-      }
+/**
+ * Generate channel declarations for shared actions only. In library mode the
+ * channels are only declared here; `Run` creates fresh ones on every call.
+ */
+function generateChannelDeclarations(actions: Set<string>, gen: GenContext): string {
+  // Only create channels for shared actions (used by multiple processes)
+  const sharedActions = sharedActionsOf(actions, gen);
 
-      lines.push(`\t\t\t}`);
-    } else {
-      // All transitions are non-shared - just pick the first one deterministically
-      // (In a real LTS, non-deterministic choice would need special handling)
-      const t = transitions[0];
-      lines.push(`\t\t\t// Non-deterministic choice (picking first option): ${transitions.map(tr => tr.action).join(' | ')}`);
-      lines.push(`\t\t\tfmt.Printf("[${proc.name}] action: ${t.action} (${state} -> ${t.toState})\\n")`);
-      lines.push(`\t\t\tstate = ${stateName(proc.name, t.toState)}`);
+  if (sharedActions.length === 0) return '';
+
+  const lines = ['// Channels for action synchronization (shared actions only)'];
+  lines.push('var (');
+
+  for (const action of sharedActions) {
+    const declaration = gen.options.noMain ? channelType(action, gen) : `= ${makeChannel(action, gen)}`;
+    lines.push(`\t${channelName(action)} ${declaration} // shared action: ${action}`);
+    if (isMultiway(action, gen)) {
+      const lock = gen.options.noMain ? 'chan struct{}' : '= make(chan struct{})';
+      const release = gen.options.noMain ? 'chan bool' : '= make(chan bool)';
+      for (const process of participantsOf(action, gen)) {
+        lines.push(`\t${lockChannelName(action, process)} ${lock} // locks ${process} into a round of ${action}`);
+        lines.push(`\t${releaseChannelName(action, process)} ${release} // fires ${action} for ${process}, or sends it back`);
+      }
+      if (gen.stoppedMultiway.has(action)) {
+        const stopped = gen.options.noMain ? 'chan struct{}' : '= make(chan struct{})';
+        lines.push(`\t${stoppedChannelName(action)} ${stopped} // closed once a participant of ${action} stops`);
+      }
+    }
+    if (isBroadcast(action, gen)) {
+      const delivery = gen.options.noMain ? channelType(action, gen) : `= make(${channelType(action, gen)})`;
+      for (const receiver of receiversOf(action, gen)) {
+        lines.push(`\t${deliveryChannelName(action, receiver)} ${delivery} // delivers ${action} to ${receiver}`);
+      }
+    }
+    if (gen.closedOnStop.has(action)) {
+      const stopped = gen.options.noMain ? 'chan struct{}' : '= make(chan struct{})';
+      lines.push(`\t${closeOnceName(action)} sync.Once // closes ${channelName(action)} when ${gen.actionUsage.get(action)!.sender} stops`);
+      lines.push(`\t${stoppedChannelName(action)} ${stopped} // closed once a receiver of ${action} stops`);
+      lines.push(`\t${stopOnceName(action)} sync.Once`);
     }
   }
 
+  lines.push(')');
+  lines.push('');
   return lines.join('\n');
 }
 
 /**
- * Generate a Go function for a single process
+ * Generate the coordinator of the multiway actions. Go channels join two
+ * goroutines, so the participants of a larger rendezvous cannot meet on one;
+ * instead each offers its multiway actions to the coordinator, which locks
+ * them into a round once all of them offer the same one.
  */
-function generateProcessFunction(
-  proc: ProcessDefinition,
-  actionUsage: Map<string, ActionUsage>
-): string {
+function generateMultiwayDeclarations(gen: GenContext): string {
   const lines: string[] = [];
-  const fName = funcName(proc.name);
-  const stateMap = buildStateMap(proc);
-  const allStates = getAllStates(proc);
-
-  lines.push(`// ${fName} implements the ${proc.name} process`);
-  lines.push(`func ${fName}(wg *sync.WaitGroup) {`);
-  lines.push(`\tdefer wg.Done()`);
-  lines.push(`\tfmt.Printf("[${proc.name}] Starting...\\n")`);
+  lines.push(`// multiwayOffer tells the coordinator which multiway actions a process offers`);
+  lines.push(`// from its current state: none once it has moved on, and none for good once`);
+  lines.push(`// it has returned`);
+  lines.push(`type multiwayOffer struct {`);
+  lines.push(`\tprocess string`);
+  lines.push(`\tactions map[string]bool`);
+  lines.push(`\tdone    bool`);
+  lines.push(`}`);
   lines.push(``);
-  lines.push(`\tstate := ${stateName(proc.name, proc.initialState)}`);
+  lines.push(`// multiwayOffers carries the offers of every process to the coordinator`);
+  lines.push(`var multiwayOffers = make(chan multiwayOffer)`);
   lines.push(``);
-  lines.push(`\tfor {`);
-  lines.push(`\t\tswitch state {`);
-
-  // Generate case for each state
-  for (const state of Array.from(allStates).sort()) {
-    const stateInfo = stateMap.get(state);
-    lines.push(generateStateCase(proc, state, stateInfo, actionUsage, allStates));
+  lines.push(`// multiwayRound is a multiway action with the channels on which the`);
+  lines.push(`// coordinator locks each participant into a round and then releases it`);
+  lines.push(`type multiwayRound struct {`);
+  lines.push(`\taction       string`);
+  lines.push(`\tparticipants []string`);
+  lines.push(`\tlock         []chan struct{}`);
+  lines.push(`\trelease      []chan bool`);
+  lines.push(`\tstopped      chan struct{} // closed once a participant has returned, if set`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// coordinateMultiway fires each multiway action whenever all of its`);
+  lines.push(`// participants offer it, until stop is closed`);
+  lines.push(`func coordinateMultiway(stop <-chan struct{}) {`);
+  lines.push(`\trounds := []*multiwayRound{`);
+  for (const action of multiwayActions(gen)) {
+    const participants = participantsOf(action, gen);
+    const locks = participants.map(p => lockChannelName(action, p)).join(', ');
+    const releases = participants.map(p => releaseChannelName(action, p)).join(', ');
+    const stopped = gen.stoppedMultiway.has(action) ? stoppedChannelName(action) : 'nil';
+    lines.push(`\t\t{"${action}", []string{${participants.map(p => `"${p}"`).join(', ')}}, []chan struct{}{${locks}}, []chan bool{${releases}}, ${stopped}},`);
   }
-
-  // Add default case for unknown states
-  lines.push(`\t\tdefault:`);
-  lines.push(`\t\t\tfmt.Printf("[${proc.name}] Unknown state: %s\\n", state)`);
+  lines.push(`\t}`);
+  lines.push(`\toffered := map[string]map[string]bool{}`);
+  lines.push(`\ttake := func(o multiwayOffer) {`);
+  lines.push(`\t\toffered[o.process] = o.actions`);
+  lines.push(`\t\tif !o.done {`);
   lines.push(`\t\t\treturn`);
-
+  lines.push(`\t\t}`);
+  lines.push(`\t\tfor _, r := range rounds {`);
+  lines.push(`\t\t\tfor _, p := range r.participants {`);
+  lines.push(`\t\t\t\tif p == o.process && r.stopped != nil {`);
+  lines.push(`\t\t\t\t\tclose(r.stopped)`);
+  lines.push(`\t\t\t\t\tr.stopped = nil`);
+  lines.push(`\t\t\t\t}`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tfor {`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase o := <-multiwayOffers:`);
+  lines.push(`\t\t\ttake(o)`);
+  lines.push(`\t\tcase <-stop:`);
+  lines.push(`\t\t\treturn`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tfor _, r := range rounds {`);
+  lines.push(`\t\t\tr.fire(offered, take)`);
   lines.push(`\t\t}`);
   lines.push(`\t}`);
   lines.push(`}`);
   lines.push(``);
-
+  lines.push(`// fire runs a round of r if every participant offers it. The participants`);
+  lines.push(`// are locked one at a time while new offers keep coming in. One that withdraws`);
+  lines.push(`// before it is locked ends the round, and the ones already locked go back to`);
+  lines.push(`// offering. Only once all of them are locked are they released together, so`);
+  lines.push(`// none moves on while another could still back out.`);
+  lines.push(`func (r *multiwayRound) fire(offered map[string]map[string]bool, take func(multiwayOffer)) {`);
+  lines.push(`\toffering := func(from int) bool {`);
+  lines.push(`\t\tfor _, p := range r.participants[from:] {`);
+  lines.push(`\t\t\tif !offered[p][r.action] {`);
+  lines.push(`\t\t\t\treturn false`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\treturn true`);
+  lines.push(`\t}`);
+  lines.push(`\tif !offering(0) {`);
+  lines.push(`\t\treturn`);
+  lines.push(`\t}`);
+  lines.push(`\tfor locked := 0; locked < len(r.participants); {`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase r.lock[locked] <- struct{}{}:`);
+  lines.push(`\t\t\t// A locked participant offers again after the round`);
+  lines.push(`\t\t\toffered[r.participants[locked]] = nil`);
+  lines.push(`\t\t\tlocked++`);
+  lines.push(`\t\tcase o := <-multiwayOffers:`);
+  lines.push(`\t\t\ttake(o)`);
+  lines.push(`\t\t\tif !offering(locked) {`);
+  lines.push(`\t\t\t\tfor _, release := range r.release[:locked] {`);
+  lines.push(`\t\t\t\t\trelease <- false`);
+  lines.push(`\t\t\t\t}`);
+  lines.push(`\t\t\t\treturn`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tfor _, release := range r.release {`);
+  lines.push(`\t\trelease <- true`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
   return lines.join('\n');
 }
 
-
 /**
- * Generate the main() function
+ * Generate the dispatchers that fan broadcast actions out to their receivers
  */
-function generateMain(spec: LTSSpec): string {
+function generateBroadcastDeclarations(gen: GenContext): string {
   const lines: string[] = [];
 
-  lines.push(`func main() {`);
-  lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
-  lines.push(`\tfmt.Println("  LTS Execution Started")`);
-  lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
-  lines.push(`\tfmt.Println()`);
-  lines.push(``);
-  lines.push(`\tvar wg sync.WaitGroup`);
+  lines.push(`// broadcast delivers every value sent on in to each of outs until in is`);
+  lines.push(`// closed. Each receiver has a queue of its own, so one that is slow or not`);
+  lines.push(`// listening yet never holds up the sender. drained, if given, holds a`);
+  lines.push(`// channel per receiver that is closed once its queue has run dry after in`);
+  lines.push(`// was closed.`);
+  lines.push(`func broadcast[T any](in <-chan T, outs []chan T, drained []chan struct{}) {`);
+  lines.push(`\tqueues := make([]chan T, len(outs))`);
+  lines.push(`\tfor i, out := range outs {`);
+  lines.push(`\t\tvar done chan struct{}`);
+  lines.push(`\t\tif drained != nil {`);
+  lines.push(`\t\t\tdone = drained[i]`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tqueues[i] = make(chan T)`);
+  lines.push(`\t\tgo relay(queues[i], out, done)`);
+  lines.push(`\t}`);
+  lines.push(`\tfor v := range in {`);
+  lines.push(`\t\tfor _, q := range queues {`);
+  lines.push(`\t\t\tq <- v`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tfor _, q := range queues {`);
+  lines.push(`\t\tclose(q)`);
+  lines.push(`\t}`);
+  lines.push(`}`);
   lines.push(``);
-  lines.push(`\twg.Add(${spec.processes.length})`);
+  lines.push(`// relay forwards the values from in to out in order, queueing them while out`);
+  lines.push(`// is not ready. It always accepts from in. Once in is closed it delivers what`);
+  lines.push(`// is left, closes drained (unless nil) and returns.`);
+  lines.push(`func relay[T any](in <-chan T, out chan<- T, drained chan struct{}) {`);
+  lines.push(`\tvar queue []T`);
+  lines.push(`\tfor in != nil || len(queue) > 0 {`);
+  lines.push(`\t\tvar next chan<- T`);
+  lines.push(`\t\tvar head T`);
+  lines.push(`\t\tif len(queue) > 0 {`);
+  lines.push(`\t\t\tnext, head = out, queue[0]`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase v, ok := <-in:`);
+  lines.push(`\t\t\tif !ok {`);
+  lines.push(`\t\t\t\tin = nil`);
+  lines.push(`\t\t\t\tcontinue`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t\tqueue = append(queue, v)`);
+  lines.push(`\t\tcase next <- head:`);
+  lines.push(`\t\t\tqueue = queue[1:]`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tif drained != nil {`);
+  lines.push(`\t\tclose(drained)`);
+  lines.push(`\t}`);
+  lines.push(`}`);
   lines.push(``);
-
-  // Launch process goroutines
-  lines.push(`\t// Launch process goroutines`);
-  for (const proc of spec.processes) {
-    lines.push(`\tgo ${funcName(proc.name)}(&wg)`);
+  lines.push(`// startBroadcasts starts the dispatcher of every broadcast action. Each one`);
+  lines.push(`// runs until the action's sender returns and closes its channel.`);
+  lines.push(`func startBroadcasts() {`);
+  for (const action of broadcastActions(gen)) {
+    const receivers = receiversOf(action, gen);
+    const outs = `[]${channelType(action, gen)}{${receivers.map(r => deliveryChannelName(action, r)).join(', ')}}`;
+    const drained = gen.options.shutdownAfterSteps !== undefined
+      ? `[]chan struct{}{${receivers.map(r => drainedChannelName(action, r)).join(', ')}}`
+      : 'nil';
+    lines.push(`\tgo broadcast(${channelName(action)}, ${outs}, ${drained})`);
   }
-
-  lines.push(``);
-  lines.push(`\t// Wait for all processes to complete`);
-  lines.push(`\twg.Wait()`);
-  lines.push(``);
-  lines.push(`\tfmt.Println()`);
-  lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
-  lines.push(`\tfmt.Println("  LTS Execution Complete")`);
-  lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
   lines.push(`}`);
+  lines.push(``);
 
   return lines.join('\n');
 }
 
-// ─────────────────────────────────────────────────────────────────────────────
-// Main Transpiler Function
-// ─────────────────────────────────────────────────────────────────────────────
+/**
+ * Whether runtime events go through log/slog instead of fmt
+ */
+function usesSlog(gen: GenContext): boolean {
+  return gen.options.logger === 'slog';
+}
 
 /**
- * Transpile an LTS specification to Go source code
- * @param spec The LTS specification to transpile
- * @returns A string containing valid, executable Go source code
+ * A runtime event of a process, described for both logging backends
  */
-export function transpile(spec: LTSSpec): string {
-  // Validate input
-  if (!spec.processes || spec.processes.length === 0) {
-    throw new Error('LTS specification must contain at least one process');
+interface LogEvent {
+  /** fmt mode: Printf format following the `[PROCESS] ` prefix */
+  text: string;
+  /** fmt mode: Printf arguments */
+  args?: string[];
+  /** slog mode: record message */
+  message: string;
+  /** slog mode: key/value pairs following the process, values as Go expressions */
+  attrs?: [string, string][];
+  level?: 'Info' | 'Warn' | 'Error';
+}
+
+/**
+ * Go statement logging an event of a process
+ */
+function logStatement(proc: ProcessDefinition, event: LogEvent, gen: GenContext): string {
+  if (usesSlog(gen)) {
+    const pairs = [['process', `"${proc.name}"`], ...(event.attrs ?? [])]
+      .map(([key, value]) => `"${key}", ${value}`);
+    return `logger.${event.level ?? 'Info'}("${event.message}", ${pairs.join(', ')})`;
   }
+  const args = (event.args ?? []).map(arg => `, ${arg}`).join('');
+  return `fmt.Printf("[${proc.name}] ${event.text}\\n"${args})`;
+}
 
-  // Analyze the specification
-  const actions = extractActions(spec);
-  const actionUsage = analyzeActionUsage(spec);
+/**
+ * Generate the package-level logger used in slog mode
+ */
+function generateLoggerDeclaration(): string {
+  return `// logger receives every runtime event; replace it to redirect or silence output
+var logger = slog.Default()
+`;
+}
 
-  // Generate code sections
-  const parts: string[] = [];
+/**
+ * Whether some state of a process offers a choice that includes a local
+ * action, so that its select needs an always-ready case
+ */
+function offersLocalChoice(proc: ProcessDefinition, gen: GenContext): boolean {
+  // Only the channel backend selects
+  if (!usesChannels(gen)) return false;
+  return Array.from(buildStateMap(proc).values()).some(({ transitions }) => {
+    const kinds = transitions.map(t => actionKind(gen.actionUsage, proc.name, t.action));
+    // Guarded states always select, and so does every choice, even one between local actions
+    if (transitions.length < 2 && transitions.every(t => t.guard === undefined)) return false;
+    return kinds.includes('internal');
+  });
+}
 
-  // We no longer need context since we removed the action sink
-  parts.push(generateHeader(false));
-  parts.push(generateChannelDeclarations(actions, actionUsage));
+/**
+ * Generate the closed channel that lets a select offer local actions
+ */
+function generateAlwaysDeclaration(): string {
+  return `// always is closed, so receiving from it never blocks: a select offers a
+// local action as a case on it, and Go picks among ready cases at random
+var always = func() chan struct{} {
+\tch := make(chan struct{})
+\tclose(ch)
+\treturn ch
+}()
+`;
+}
 
-  // Generate process functions
-  for (const proc of spec.processes) {
-    parts.push(generateProcessFunction(proc, actionUsage));
-  }
+/**
+ * Whether choice states try their actions in an order of the generated
+ * code's making (seeded or fair) rather than leaving the pick to select
+ */
+function ordersChoices(gen: GenContext): boolean {
+  return gen.options.seed !== undefined || gen.options.fair === true;
+}
 
-  // Generate main function
-  parts.push(generateMain(spec));
+/**
+ * Whether a choice state picks among its transitions by weight
+ */
+function isWeighted(transitions: Transition[]): boolean {
+  return transitions.length > 1 && transitions.some(t => t.weight !== undefined);
+}
 
-  return parts.join('\n');
+/**
+ * Whether a choice state tries its actions in an order of the generated
+ * code's making, for the whole system or by its own weights
+ */
+function ordersState(transitions: Transition[], gen: GenContext): boolean {
+  return (ordersChoices(gen) && transitions.length > 1) || isWeighted(transitions);
 }
 
 /**
- * Transpile from flat transition format
- * @param transitions Array of flat transitions
- * @returns A string containing valid, executable Go source code
+ * Generate the helper that orders the cases of a choice under fair scheduling
  */
-export function transpileFlat(transitions: FlatTransition[]): string {
-  const spec = flatToSpec(transitions);
-  return transpile(spec);
+function generateFairDeclaration(): string {
+  return `// leastTaken orders the cases of a choice by how often each has fired, least
+// first, so that no enabled case is starved; cases that tie keep their order
+func leastTaken(taken []int, cases []int) []int {
+\tsort.SliceStable(cases, func(a, b int) bool { return taken[cases[a]] < taken[cases[b]] })
+\treturn cases
+}
+`;
 }
 
-// ─────────────────────────────────────────────────────────────────────────────
-// CLI Entry Point
-// ─────────────────────────────────────────────────────────────────────────────
+/**
+ * Counter array of a choice state under fair scheduling
+ */
+function takenName(state: string): string {
+  return sanitizeGoName(`taken_${state}`);
+}
 
-if (require.main === module) {
-  const fs = require('fs');
+/**
+ * States of a process that choose between several transitions
+ */
+function choiceStates(proc: ProcessDefinition): [string, StateInfo][] {
+  return Array.from(buildStateMap(proc)).filter(([state, info]) =>
+    state !== 'STOP' && state !== 'ERROR' && info.transitions.length > 1
+  );
+}
+
+/**
+ * Generate the seed and the per-process generators of seeded scheduling.
+ * Weighted choices draw from the same generators; without a seed of its
+ * own, a run takes one from the clock.
+ */
+function generateSeedDeclarations(gen: GenContext): string {
+  const seed = gen.options.seed !== undefined
+    ? `// seed fixes the order in which choice states try their actions; runs with
+// the same seed make the same choices
+var seed int64 = ${gen.options.seed}
+`
+    : `// seed drives the draws of weighted choices; set it before a run to repeat one
+var seed = time.Now().UnixNano()
+`;
+  const shuffled = `
+// shuffled returns case numbers in an order drawn from rng
+func shuffled(rng *rand.Rand, cases ...int) []int {
+\trng.Shuffle(len(cases), func(i, j int) { cases[i], cases[j] = cases[j], cases[i] })
+\treturn cases
+}
+`;
+  const weighted = `
+// weightedOrder returns case numbers in an order drawn from rng by weight:
+// each next case is picked from those left with a chance proportional to its
+// weight, by a draw against their cumulative weights
+func weightedOrder(rng *rand.Rand, weights []float64, cases ...int) []int {
+\torder := make([]int, 0, len(cases))
+\tfor len(cases) > 0 {
+\t\ttotal := 0.0
+\t\tfor _, c := range cases {
+\t\t\ttotal += weights[c]
+\t\t}
+\t\tdraw := rng.Float64() * total
+\t\tpick := len(cases) - 1
+\t\tfor i, c := range cases {
+\t\t\tdraw -= weights[c]
+\t\t\tif draw < 0 {
+\t\t\t\tpick = i
+\t\t\t\tbreak
+\t\t\t}
+\t\t}
+\t\torder = append(order, cases[pick])
+\t\tcases = append(cases[:pick], cases[pick+1:]...)
+\t}
+\treturn order
+}
+`;
+  return `${seed}
+// rngFor gives each process its own generator, derived from seed and the
+// process name, so its choices do not depend on how goroutines interleave
+func rngFor(process string) *rand.Rand {
+\th := fnv.New64a()
+\th.Write([]byte(process))
+\treturn rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+${gen.options.seed !== undefined ? shuffled : ''}${gen.weighted ? weighted : ''}`;
+}
 
-  const args = process.argv.slice(2);
+/**
+ * Generate the hook called when a process enters ERROR
+ */
+function generateErrorHook(): string {
+  return `// onError is called when a process enters its ERROR state. It panics by
+// default; replace it to report the error some other way.
+var onError = func(process string) {
+\tpanic("LTS process " + process + " reached ERROR")
+}
+`;
+}
 
-  if (args.length < 1) {
-    console.log(`
-LTS-to-Go Transpiler
+/**
+ * Default number of restarts of a supervised process
+ */
+const DEFAULT_MAX_RESTARTS = 3;
 
-Usage: npx tsx src/transpiler.ts <input.json> [output.go]
+/**
+ * Generate the supervisor that recovers a panicking process and runs it
+ * again from its initial state
+ */
+function generateSupervisorDeclarations(gen: GenContext): string {
+  const log = (level: string, message: string, text: string, pairs: [string, string][]) => usesSlog(gen)
+    ? `logger.${level}("${message}", "process", process${pairs.map(([key, value]) => `, "${key}", ${value}`).join('')})`
+    : `fmt.Printf("[%s] ${text}\\n", process${pairs.map(([, value]) => `, ${value}`).join('')})`;
 
-Arguments:
-  input.json   JSON file containing the LTS specification
-  output.go    Output Go file (optional, defaults to stdout)
+  return `// maxRestarts is how often a process that panics is run again before it
+// is given up on
+const maxRestarts = ${gen.options.maxRestarts ?? DEFAULT_MAX_RESTARTS}
 
-Input Format (Structured):
-{
-  "processes": [
-    {
-      "name": "P",
-      "initialState": "0",
-      "transitions": [
-        { "fromState": "0", "toState": "1", "action": "a" },
-        { "fromState": "1", "toState": "0", "action": "b" }
-      ]
-    }
-  ]
+// supervise runs a process, and runs it again from its initial state each
+// time it panics, until it returns or has been restarted maxRestarts times
+func supervise(process string, run func()) {
+\tfor restarts := 0; ; restarts++ {
+\t\tif !panics(process, run) {
+\t\t\treturn
+\t\t}
+\t\tif restarts == maxRestarts {
+\t\t\t${log('Error', 'giving up', 'Giving up after %d restarts', [['restarts', 'maxRestarts']])}
+\t\t\treturn
+\t\t}
+\t\t${log('Warn', 'restarting', 'Restarting from the initial state (%d of %d)', [['restart', 'restarts + 1'], ['max', 'maxRestarts']])}
+\t}
+}
+
+// panics runs a process once and reports whether it panicked
+func panics(process string, run func()) (panicked bool) {
+\tdefer func() {
+\t\tif r := recover(); r != nil {
+\t\t\t${log('Error', 'panic', 'Panic: %v', [['panic', 'r']])}
+\t\t\tpanicked = true
+\t\t}
+\t}()
+\trun()
+\treturn false
+}
+`;
 }
 
-Input Format (Flat):
-[
-  { "process": "P", "fromState": "0", "toState": "1", "action": "a" },
-  { "process": "P", "fromState": "1", "toState": "0", "action": "b" }
-]
+/**
+ * Names expvar itself publishes, which a system cannot take
+ */
+const EXPVAR_RESERVED = ['cmdline', 'memstats'];
+
+/**
+ * Published state of a process under expvar
+ */
+function metricStateName(process: string): string {
+  return `metricState_${sanitizeGoName(process)}`;
+}
 
-Example:
-  npx tsx src/transpiler.ts spec.json output.go
-`);
-    process.exit(1);
+/**
+ * Generate the expvar map of the system: the count of each action under
+ * `actions` and the current state of each process under `states`
+ */
+function generateExpvarDeclarations(spec: LTSSpec, actions: Set<string>): string {
+  const system = spec.composition?.name ?? 'System';
+  if (EXPVAR_RESERVED.includes(system)) {
+    throw new Error(`expvar already publishes ${system}; rename the composition`);
   }
+  const lines: string[] = [];
 
-  const inputFile = args[0];
-  const outputFile = args[1];
+  lines.push(`// metrics is published under expvar as ${system}, at /debug/vars, with how`);
+  lines.push(`// often each action has fired and the state each process is in`);
+  const vars: [string, string][] = [
+    ['metrics', `expvar.NewMap("${system}")`],
+    ['metricActions', 'new(expvar.Map)'],
+    ['metricStates', 'new(expvar.Map)'],
+    ...spec.processes.map((proc): [string, string] => [metricStateName(proc.name), 'new(expvar.String)']),
+  ];
+  const width = Math.max(...vars.map(([name]) => name.length));
+  lines.push(`var (`);
+  for (const [name, value] of vars) {
+    lines.push(`\t${name.padEnd(width)} = ${value}`);
+  }
+  lines.push(`)`);
+  lines.push(``);
+  lines.push(`func init() {`);
+  // Every action shows up from the start, so a scrape never misses one
+  for (const action of Array.from(actions).sort()) {
+    lines.push(`\tmetricActions.Add("${action}", 0)`);
+  }
+  for (const proc of spec.processes) {
+    lines.push(`\tmetricStates.Set("${proc.name}", ${metricStateName(proc.name)})`);
+  }
+  lines.push(`\tmetrics.Set("actions", metricActions)`);
+  lines.push(`\tmetrics.Set("states", metricStates)`);
+  lines.push(`}`);
+  lines.push(``);
 
-  try {
-    const jsonContent = fs.readFileSync(inputFile, 'utf-8');
-    const data = JSON.parse(jsonContent);
+  return lines.join('\n');
+}
 
-    let goCode: string;
+/**
+ * Emit the goroutine serving expvar's /debug/vars from `main`
+ */
+function generateExpvarServer(lines: string[], gen: GenContext): void {
+  lines.push(`\t// Serve the metrics at http://${gen.options.expvar}/debug/vars while the system runs`);
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\tif err := http.ListenAndServe("${gen.options.expvar}", nil); err != nil {`);
+  lines.push(usesSlog(gen)
+    ? `\t\t\tlogger.Error("expvar server failed", "err", err)`
+    : `\t\t\tfmt.Printf("expvar server failed: %v\\n", err)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}()`);
+  lines.push(``);
+}
 
-    // Detect format: flat array or structured spec
-    if (Array.isArray(data)) {
-      goCode = transpileFlat(data as FlatTransition[]);
-    } else if (data.processes) {
-      goCode = transpile(data as LTSSpec);
-    } else {
-      throw new Error('Invalid input format. Expected either an array of flat transitions or an object with "processes" property.');
-    }
+/**
+ * Generate the Prometheus metrics of the system: a counter of the actions
+ * each process takes part in, and a gauge per process and state that is 1
+ * while the process is in it. Both go in the default registry.
+ */
+function generatePrometheusDeclarations(spec: LTSSpec): string {
+  const lines: string[] = [];
 
-    if (outputFile) {
-      fs.writeFileSync(outputFile, goCode, 'utf-8');
-      console.log(`✓ Generated Go code written to: ${outputFile}`);
-    } else {
-      console.log(goCode);
+  lines.push(`// promActions counts the actions each process has taken part in, and`);
+  lines.push(`// promStates is 1 for the state each process is in and 0 for the others;`);
+  lines.push(`// both are served for Prometheus at /metrics`);
+  lines.push(`var (`);
+  lines.push(`\tpromActions = promauto.NewCounterVec(prometheus.CounterOpts{`);
+  lines.push(`\t\tName: "anvilts_action_total",`);
+  lines.push(`\t\tHelp: "Number of times each process has taken part in each action.",`);
+  lines.push(`\t}, []string{"process", "action"})`);
+  lines.push(`\tpromStates = promauto.NewGaugeVec(prometheus.GaugeOpts{`);
+  lines.push(`\t\tName: "anvilts_process_state",`);
+  lines.push(`\t\tHelp: "1 for the state each process is in, 0 for its other states.",`);
+  lines.push(`\t}, []string{"process", "state"})`);
+  lines.push(`)`);
+  lines.push(``);
+  lines.push(`// promStateNames lists the states of each process`);
+  lines.push(`var promStateNames = map[string][]string{`);
+  for (const proc of spec.processes) {
+    const states = Array.from(new Set([proc.initialState, ...getAllStates(proc)]));
+    lines.push(`\t"${proc.name}": {${states.map(state => `"${state}"`).join(', ')}},`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`func init() {`);
+  // Every series shows up from the start, so a scrape never misses one
+  for (const proc of spec.processes) {
+    for (const action of Array.from(new Set(proc.transitions.map(t => t.action))).sort()) {
+      lines.push(`\tpromActions.WithLabelValues("${proc.name}", "${action}")`);
     }
-  } catch (err) {
-    console.error(`Error: ${err}`);
-    process.exit(1);
   }
+  lines.push(`\tfor process, states := range promStateNames {`);
+  lines.push(`\t\tfor _, state := range states {`);
+  lines.push(`\t\t\tpromStates.WithLabelValues(process, state)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// promStart marks a process as being in its initial state, clearing the`);
+  lines.push(`// state it was in before a restart`);
+  lines.push(`func promStart(process, state string) {`);
+  lines.push(`\tfor _, other := range promStateNames[process] {`);
+  lines.push(`\t\tpromStates.WithLabelValues(process, other).Set(0)`);
+  lines.push(`\t}`);
+  lines.push(`\tpromStates.WithLabelValues(process, state).Set(1)`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Emit the Prometheus bookkeeping of one process's transition
+ * @param from Go expression of the state it leaves
+ * @param to Go expression of the state it enters
+ */
+function emitPrometheusTransition(lines: string[], indent: string, process: string, action: string, from: string, to: string): void {
+  lines.push(`${indent}promActions.WithLabelValues("${process}", "${action}").Inc()`);
+  if (from === to) return;
+  lines.push(`${indent}promStates.WithLabelValues("${process}", ${from}).Set(0)`);
+  lines.push(`${indent}promStates.WithLabelValues("${process}", ${to}).Set(1)`);
+}
+
+/**
+ * Emit the goroutine serving Prometheus's /metrics from `main`
+ */
+function generatePrometheusServer(lines: string[], gen: GenContext): void {
+  lines.push(`\t// Serve the Prometheus metrics at ${gen.options.prometheus}/metrics while the system runs`);
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\tmux := http.NewServeMux()`);
+  lines.push(`\t\tmux.Handle("/metrics", promhttp.Handler())`);
+  lines.push(`\t\tif err := http.ListenAndServe("${gen.options.prometheus}", mux); err != nil {`);
+  lines.push(usesSlog(gen)
+    ? `\t\t\tlogger.Error("prometheus server failed", "err", err)`
+    : `\t\t\tfmt.Printf("prometheus server failed: %v\\n", err)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}()`);
+  lines.push(``);
+}
+
+/**
+ * Generate the trace file writer: a JSON object per transition with the
+ * process, its states before and after, and the position of the transition
+ * among those leaving its source state, which tells the branches of a
+ * choice apart
+ */
+function generateTraceDeclarations(gen: GenContext): string {
+  return `// tracePath receives one line per transition, in the order they fire
+const tracePath = ${JSON.stringify(gen.options.traceFile)}
+
+var (
+\ttraceMu  sync.Mutex
+\ttraceOut *os.File
+\ttraceSeq int
+)
+
+// openTrace creates the trace file, emptying it if it exists
+func openTrace() error {
+\tf, err := os.OpenFile(tracePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, 0o644)
+\tif err != nil {
+\t\treturn err
+\t}
+\ttraceMu.Lock()
+\tdefer traceMu.Unlock()
+\ttraceOut, traceSeq = f, 0
+\treturn nil
+}
+
+// recordTrace appends a transition to the trace file. The caller holds
+// traceMu from before it logs the transition, so that the log and the
+// trace list transitions in the same order.
+func recordTrace(process, from, action, to string, branch int) {
+\ttraceSeq++
+\tif err := json.NewEncoder(traceOut).Encode(traceEntry{traceSeq, process, from, action, to, branch}); err != nil {
+\t\tos.Stderr.WriteString("trace: " + err.Error() + "\\n")
+\t}
+}
+`;
+}
+
+/**
+ * Generate the type of a trace file line, which recording writes and replay
+ * reads
+ */
+function generateTraceEntryType(): string {
+  return `// traceEntry is one line of the trace file. Branch is the position of the
+// transition among those leaving From, in the order the spec lists them.
+type traceEntry struct {
+\tSeq     int    \`json:"seq"\`
+\tProcess string \`json:"process"\`
+\tFrom    string \`json:"from"\`
+\tAction  string \`json:"action"\`
+\tTo      string \`json:"to"\`
+\tBranch  int    \`json:"branch"\`
+}
+`;
+}
+
+/**
+ * Generate the replay of a trace file. Choice states ask replayBranch which
+ * branch the trace took next, and every transition waits in waitTurn until
+ * it is the next line of the trace, so the run fires and prints exactly
+ * what the recorded one did. A run that cannot follow its trace, because it
+ * ran out or a process is somewhere the trace does not have it, stops with
+ * exit status 3.
+ */
+function generateReplayDeclarations(gen: GenContext): string {
+  return `// replayPath is the trace this run follows
+const replayPath = ${JSON.stringify(gen.options.replay)}
+
+var (
+\treplayMu      sync.Mutex
+\treplayCond    = sync.NewCond(&replayMu)
+\treplayEntries []traceEntry
+\treplayPos     int
+)
+
+// loadReplay reads the trace the run follows
+func loadReplay() error {
+\tf, err := os.Open(replayPath)
+\tif err != nil {
+\t\treturn err
+\t}
+\tdefer f.Close()
+\tvar entries []traceEntry
+\tdec := json.NewDecoder(f)
+\tfor {
+\t\tvar e traceEntry
+\t\terr := dec.Decode(&e)
+\t\tif err == io.EOF {
+\t\t\tbreak
+\t\t}
+\t\tif err != nil {
+\t\t\treturn fmt.Errorf("%s, after %d transitions: %w", replayPath, len(entries), err)
+\t\t}
+\t\tentries = append(entries, e)
+\t}
+\treplayMu.Lock()
+\tdefer replayMu.Unlock()
+\treplayEntries, replayPos = entries, 0
+\treturn nil
+}
+
+// String formats an entry as the transition it records
+func (e traceEntry) String() string {
+\treturn fmt.Sprintf("%s: %s -%s-> %s", e.Process, e.From, e.Action, e.To)
+}
+
+// replayFail stops a run that can no longer follow its trace
+func replayFail(format string, args ...any) {
+\tfmt.Fprintf(os.Stderr, "replay: "+format+"\\n", args...)
+\tos.Exit(3)
+}
+
+// replayBranch returns the branch the trace has process take when it next
+// leaves from
+func replayBranch(process, from string) int {
+\treplayMu.Lock()
+\tdefer replayMu.Unlock()
+\tfor _, e := range replayEntries[replayPos:] {
+\t\tif e.Process != process {
+\t\t\tcontinue
+\t\t}
+\t\tif e.From != from {
+\t\t\treplayFail("diverged at transition %d: the trace has %v, but %s is in %s", e.Seq, e, process, from)
+\t\t}
+\t\treturn e.Branch
+\t}
+\treplayFail("trace exhausted after %d transitions, with %s still in %s", len(replayEntries), process, from)
+\treturn -1
+}
+
+// waitTurn blocks until a transition is the next one in the trace, and
+// holds the trace until doneTurn so that nothing else fires meanwhile
+func waitTurn(process, from, action, to string) {
+\treplayMu.Lock()
+\tfor replayPos < len(replayEntries) && replayEntries[replayPos].Process != process {
+\t\treplayCond.Wait()
+\t}
+\tif replayPos == len(replayEntries) {
+\t\treplayFail("trace exhausted after %d transitions, but %s fired %s -%s-> %s", len(replayEntries), process, from, action, to)
+\t}
+\tif e := replayEntries[replayPos]; e.From != from || e.Action != action || e.To != to {
+\t\treplayFail("diverged at transition %d: the trace has %v, but %s fired %s -%s-> %s", e.Seq, e, process, from, action, to)
+\t}
+}
+
+// doneTurn passes the trace on to its next transition
+func doneTurn() {
+\treplayPos++
+\treplayCond.Broadcast()
+\treplayMu.Unlock()
+}
+`;
+}
+
+/**
+ * Emit the loading of the replayed trace at the start of `main` or `Run`
+ */
+function generateReplayLoad(lines: string[], gen: GenContext): void {
+  lines.push(`\t// Follow the run recorded in ${gen.options.replay}`);
+  lines.push(`\tif err := loadReplay(); err != nil {`);
+  if (gen.options.noMain) {
+    lines.push(`\t\treturn err`);
+  } else {
+    lines.push(usesSlog(gen)
+      ? `\t\tlogger.Error("cannot read replayed trace", "err", err)`
+      : `\t\tfmt.Printf("Cannot read replayed trace: %v\\n", err)`);
+    lines.push(`\t\treturn`);
+  }
+  lines.push(`\t}`);
+  lines.push(``);
+}
+
+/**
+ * Emit the opening of the trace file at the start of `main` or `Run`
+ */
+function generateTraceOpen(lines: string[], gen: GenContext): void {
+  lines.push(`\t// Record every transition in ${gen.options.traceFile}`);
+  lines.push(`\tif err := openTrace(); err != nil {`);
+  if (gen.options.noMain) {
+    lines.push(`\t\treturn err`);
+  } else {
+    lines.push(usesSlog(gen)
+      ? `\t\tlogger.Error("cannot open trace file", "err", err)`
+      : `\t\tfmt.Printf("Cannot open trace file: %v\\n", err)`);
+    lines.push(`\t\treturn`);
+  }
+  lines.push(`\t}`);
+  lines.push(`\tdefer traceOut.Close()`);
+  lines.push(``);
+}
+
+/**
+ * Position of a transition among those leaving its source state
+ */
+function branchIndex(proc: ProcessDefinition, t: Transition): number {
+  return proc.transitions.filter(u => u.fromState === t.fromState).indexOf(t);
+}
+
+/**
+ * Generate the observer that instrumentation can hook into
+ */
+function generateObserverDeclaration(): string {
+  return `// Observer, if set before the processes start, is told about every
+// transition as it happens. Calls come from the process goroutines
+// concurrently, so an implementation must be safe for concurrent use.
+var Observer interface {
+\tOnTransition(process, from, action, to string)
+}
+`;
+}
+
+/**
+ * Generate the per-action counters and their snapshot accessor
+ */
+function generateCounterDeclarations(actions: Set<string>): string {
+  const lines: string[] = [];
+
+  lines.push(`// actionCounts records how often each action has fired`);
+  lines.push(`var actionCounts = map[string]*atomic.Int64{`);
+  for (const action of Array.from(actions).sort()) {
+    lines.push(`\t"${action}": new(atomic.Int64),`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// ActionCounts returns a snapshot of how often each action has fired so far`);
+  lines.push(`func ActionCounts() map[string]int64 {`);
+  lines.push(`\tcounts := make(map[string]int64, len(actionCounts))`);
+  lines.push(`\tfor action, n := range actionCounts {`);
+  lines.push(`\t\tcounts[action] = n.Load()`);
+  lines.push(`\t}`);
+  lines.push(`\treturn counts`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Go units accepted in duration options
+ */
+const DURATION_UNITS: Record<string, string> = {
+  ns: 'time.Nanosecond',
+  us: 'time.Microsecond',
+  ms: 'time.Millisecond',
+  s: 'time.Second',
+  m: 'time.Minute',
+  h: 'time.Hour',
+};
+
+/**
+ * Translate a duration such as `10ms` into a Go expression (`10 * time.Millisecond`)
+ */
+function goDuration(duration: string): string | undefined {
+  const match = /^(\d+)(ns|us|ms|s|m|h)$/.exec(duration);
+  if (!match) return undefined;
+  return `${match[1]} * ${DURATION_UNITS[match[2]]}`;
+}
+
+/**
+ * Length of a duration accepted by goDuration, in nanoseconds
+ */
+function durationNanos(duration: string): number {
+  const match = /^(\d+)(ns|us|ms|s|m|h)$/.exec(duration)!;
+  const scale: Record<string, number> = { ns: 1, us: 1e3, ms: 1e6, s: 1e9, m: 60e9, h: 3600e9 };
+  return Number(match[1]) * scale[match[2]];
+}
+
+/**
+ * Generate the tunable timeout for blocking channel operations
+ */
+function generateTimeoutDeclaration(gen: GenContext): string {
+  return `// actionTimeout bounds how long a process waits on a channel operation
+var actionTimeout = ${goDuration(gen.options.actionTimeout!)}
+`;
+}
+
+/**
+ * Generate the tunable run time of the system
+ */
+function generateRunForDeclaration(gen: GenContext): string {
+  return `// runFor is how long main lets the system run before cancelling it
+var runFor = ${goDuration(gen.options.runFor!)}
+`;
+}
+
+/**
+ * Generate the tunables of nonblocking mode
+ */
+function generateNonblockingDeclarations(): string {
+  return `// deadlockThreshold is how many consecutive attempts a process makes without
+// progress before it reports a possible deadlock and returns
+var deadlockThreshold = 1000
+
+// idleBackoff is how long each attempt waits for a channel operation
+var idleBackoff = time.Millisecond
+`;
+}
+
+/**
+ * Name of the channel a process closes when it returns (shutdown mode)
+ */
+function doneChannelName(process: string): string {
+  return `done_${sanitizeGoName(process)}`;
+}
+
+/**
+ * Processes other than `proc` that take part in any of the given actions
+ */
+function peersOf(proc: ProcessDefinition, actions: string[], gen: GenContext): string[] {
+  const peers = new Set<string>();
+  for (const action of actions) {
+    for (const p of gen.actionUsage.get(action)!.processes) {
+      if (p !== proc.name) peers.add(p);
+    }
+  }
+  return Array.from(peers).sort();
+}
+
+/**
+ * Channels closed once an action can no longer fire, each with the peers it
+ * watches. A two-way action dies with its peer; a multiway one as soon as
+ * any of its other participants has returned.
+ */
+function deadSignals(proc: ProcessDefinition, actions: string[], gen: GenContext): Map<string, string[]> {
+  const signals = new Map<string, string[]>();
+  for (const action of actions) {
+    // A broadcast's dispatcher always takes it, and a receiver waits until its queue runs dry
+    if (isBroadcast(action, gen)) {
+      if (actionKind(gen.actionUsage, proc.name, action) === 'receive') {
+        signals.set(drainedChannelName(action, proc.name), [gen.actionUsage.get(action)!.sender!]);
+      }
+      continue;
+    }
+    const peers = peersOf(proc, [action], gen);
+    if (peers.length === 0) continue;
+    const name = peers.length === 1 ? doneChannelName(peers[0]) : `anyDone_${peers.map(sanitizeGoName).join('_')}`;
+    signals.set(name, peers);
+  }
+  return signals;
+}
+
+/**
+ * Go expression for a channel that is closed once none of the given actions
+ * can fire any more
+ */
+function peersDoneExpr(proc: ProcessDefinition, actions: string[], gen: GenContext): string | undefined {
+  const signals = Array.from(deadSignals(proc, actions, gen).keys()).sort();
+  if (signals.length <= 1) return signals[0];
+  return `peersDone_${signals.map(s => s.replace(/^done_/, '')).join('_')}`;
+}
+
+/**
+ * Under shutdown, the exits of a guarded choice state whose peers depend on
+ * which guards hold: for each combination of enabled guarded transitions,
+ * most first, the actions the state then waits on. Undefined when the state
+ * unwinds on the same channel whatever holds.
+ */
+function guardedExits(proc: ProcessDefinition, transitions: Transition[], gen: GenContext): { offers: number[]; actions: string[] }[] | undefined {
+  if (gen.options.shutdownAfterSteps === undefined) return undefined;
+  const guarded = transitions.map((t, i) => i).filter(i => transitions[i].guard !== undefined);
+  const always = transitions.filter(t => t.guard === undefined).map(t => t.action);
+
+  const exits: { offers: number[]; actions: string[] }[] = [];
+  for (let mask = 1; mask < 1 << guarded.length; mask++) {
+    const offers = guarded.filter((_, bit) => mask & (1 << bit));
+    exits.push({ offers, actions: [...always, ...offers.map(i => transitions[i].action)] });
+  }
+  exits.sort((a, b) => b.offers.length - a.offers.length);
+
+  const unwinds = new Set([...exits, { actions: always }].map(exit => peersDoneExpr(proc, exit.actions, gen)));
+  return unwinds.size > 1 ? exits : undefined;
+}
+
+/**
+ * Generate the step budget and per-process done channels used by shutdown mode
+ */
+function generateShutdownDeclarations(spec: LTSSpec, gen: GenContext): string {
+  const lines: string[] = [];
+
+  lines.push(`// Number of transitions each process fires before shutting down`);
+  lines.push(`const maxSteps = ${gen.options.shutdownAfterSteps}`);
+  lines.push(``);
+  lines.push(`// Each process closes its done channel on return so blocked peers can unwind`);
+  lines.push(`var (`);
+  for (const proc of spec.processes) {
+    const declaration = gen.options.noMain ? 'chan struct{}' : '= make(chan struct{})';
+    lines.push(`\t${doneChannelName(proc.name)} ${declaration}`);
+  }
+  for (const action of broadcastActions(gen)) {
+    const declaration = gen.options.noMain ? 'chan struct{}' : '= make(chan struct{})';
+    for (const receiver of receiversOf(action, gen)) {
+      lines.push(`\t${drainedChannelName(action, receiver)} ${declaration}`);
+    }
+  }
+  lines.push(`)`);
+  lines.push(``);
+  lines.push(`// allDone returns a channel that is closed once every given channel is closed`);
+  lines.push(`func allDone(chs ...chan struct{}) <-chan struct{} {`);
+  lines.push(`\tout := make(chan struct{})`);
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\tfor _, ch := range chs {`);
+  lines.push(`\t\t\t<-ch`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tclose(out)`);
+  lines.push(`\t}()`);
+  lines.push(`\treturn out`);
+  lines.push(`}`);
+  lines.push(``);
+
+  if (Array.from(gen.actionUsage.keys()).some(action => isMultiway(action, gen))) {
+    lines.push(`// anyDone returns a channel that is closed once any given channel is closed`);
+    lines.push(`func anyDone(chs ...chan struct{}) chan struct{} {`);
+    lines.push(`\tout := make(chan struct{})`);
+    lines.push(`\tvar once sync.Once`);
+    lines.push(`\tfor _, ch := range chs {`);
+    lines.push(`\t\tgo func(ch chan struct{}) {`);
+    lines.push(`\t\t\t<-ch`);
+    lines.push(`\t\t\tonce.Do(func() { close(out) })`);
+    lines.push(`\t\t}(ch)`);
+    lines.push(`\t}`);
+    lines.push(`\treturn out`);
+    lines.push(`}`);
+    lines.push(``);
+  }
+
+  return lines.join('\n');
+}
+
+/**
+ * Extra select cases that let a process blocked on a channel bail out
+ */
+function exitSelectCases(
+  proc: ProcessDefinition,
+  actions: string[],
+  gen: GenContext,
+  retry = true,
+  unwind = peersDoneExpr(proc, actions, gen)
+): string[] {
+  const cases: string[] = [];
+  if (gen.options.context) {
+    cases.push(`case <-ctx.Done():`, `\treturn`);
+  }
+  // A receiver that has stopped will never take the action
+  for (const action of Array.from(new Set(actions)).sort()) {
+    if (gen.closedOnStop.has(action) && actionKind(gen.actionUsage, proc.name, action) === 'send') {
+      cases.push(`case <-${stoppedChannelName(action)}:`, `\t${logStatement(proc, {
+        text: `${action} can no longer happen: a receiver has stopped`,
+        message: 'peer stopped',
+        attrs: [['action', `"${action}"`]],
+      }, gen)}`, `\treturn`);
+    }
+    if (gen.stoppedMultiway.has(action)) {
+      cases.push(`case <-${stoppedChannelName(action)}:`, `\t${logStatement(proc, {
+        text: `${action} can no longer happen: a participant has stopped`,
+        message: 'peer stopped',
+        attrs: [['action', `"${action}"`]],
+      }, gen)}`, `\treturn`);
+    }
+  }
+  if (gen.options.shutdownAfterSteps !== undefined) {
+    // Nobody left to synchronize with: unwind instead of blocking forever
+    if (unwind !== undefined) {
+      cases.push(`case <-${unwind}:`, `\treturn`);
+    }
+  }
+  if (gen.options.actionTimeout !== undefined) {
+    const waiting = actions.join(' | ');
+    cases.push(
+      `case <-time.After(actionTimeout):`,
+      `\t${logStatement(proc, {
+        text: `Timed out after %v waiting for ${waiting}`,
+        args: ['actionTimeout'],
+        message: 'timeout',
+        attrs: [['waiting', `"${waiting}"`], ['after', 'actionTimeout']],
+        level: 'Warn',
+      }, gen)}`,
+      `\treturn`
+    );
+  }
+  if (gen.options.nonblocking && retry) {
+    // Each attempt waits briefly rather than taking a plain default: two
+    // processes that only polled would never meet on an unbuffered channel
+    const waiting = actions.join(' | ');
+    cases.push(
+      `case <-time.After(idleBackoff):`,
+      `\tidle++`,
+      `\tif idle >= deadlockThreshold {`,
+      `\t\t${logStatement(proc, {
+        text: `Possible deadlock: no progress on ${waiting} after %d attempts`,
+        args: ['idle'],
+        message: 'possible deadlock',
+        attrs: [['waiting', `"${waiting}"`], ['attempts', 'idle']],
+        level: 'Warn',
+      }, gen)}`,
+      `\t\treturn`,
+      `\t}`,
+      `\tcontinue`
+    );
+  }
+  return cases;
+}
+
+/**
+ * Emit a blocking channel operation, wrapped in a select when the process
+ * needs a way out while it waits (or, in nonblocking mode, must not wait)
+ */
+function emitChannelOp(
+  lines: string[],
+  indent: string,
+  op: string,
+  comment: string,
+  proc: ProcessDefinition,
+  action: string,
+  gen: GenContext,
+  retry = true
+): void {
+  const exitCases = exitSelectCases(proc, [action], gen, retry);
+  if (exitCases.length === 0) {
+    lines.push(`${indent}${op} // ${comment}`);
+    return;
+  }
+
+  lines.push(`${indent}select {`);
+  lines.push(`${indent}case ${op}: // ${comment}`);
+  for (const line of exitCases) {
+    lines.push(`${indent}${line}`);
+  }
+  lines.push(`${indent}}`);
+}
+
+/**
+ * The multiway transitions a state offers
+ */
+function multiwayTransitions(proc: ProcessDefinition, transitions: Transition[], gen: GenContext): Transition[] {
+  return transitions.filter(t => actionKind(gen.actionUsage, proc.name, t.action) !== 'internal' && isMultiway(t.action, gen));
+}
+
+/**
+ * Whether a state of a process offers some multiway action, and so tells
+ * the coordinator what it offers before it waits
+ */
+function offersMultiway(proc: ProcessDefinition, state: string, gen: GenContext): boolean {
+  return multiwayTransitions(proc, proc.transitions.filter(t => t.fromState === state), gen).length > 0;
+}
+
+/**
+ * Tell the coordinator which multiway actions a state offers, each enabled
+ * when one of its transitions is unguarded or has a guard that holds
+ */
+function emitMultiwayOffer(lines: string[], indent: string, proc: ProcessDefinition, transitions: Transition[], gen: GenContext): void {
+  const offered = new Map<string, string[]>();
+  for (const t of multiwayTransitions(proc, transitions, gen)) {
+    if (!offered.has(t.action)) offered.set(t.action, []);
+    offered.get(t.action)!.push(t.guard === undefined ? 'true' : goCondition(t.guard));
+  }
+  if (offered.size === 0) return;
+  const entries = Array.from(offered).sort(([a], [b]) => a.localeCompare(b)).map(([action, conditions]) => {
+    const condition = conditions.includes('true') ? 'true' : conditions.length === 1 ? conditions[0] : conditions.map(c => `(${c})`).join(' || ');
+    return `"${action}": ${condition}`;
+  });
+  lines.push(`${indent}multiwayOffers <- multiwayOffer{process: "${proc.name}", actions: map[string]bool{${entries.join(', ')}}} // offer: ${Array.from(offered.keys()).sort().join(', ')}`);
+}
+
+/**
+ * Finish a multiway transition once the coordinator has locked the process
+ * into a round. The coordinator then either fires the round, once every
+ * participant is locked, or sends the process back to offer again, when one
+ * withdrew first. The sender of a payload hands it to every other participant.
+ */
+function emitMultiwayRelease(
+  lines: string[],
+  indent: string,
+  proc: ProcessDefinition,
+  t: Transition,
+  gen: GenContext
+): void {
+  lines.push(`${indent}if !<-${releaseChannelName(t.action, proc.name)} { // released: ${t.action}`);
+  lines.push(`${indent}\tcontinue // another participant withdrew: offer again`);
+  lines.push(`${indent}}`);
+  const variable = payloadVariable(t, gen);
+  if (!variable) return;
+  if (actionKind(gen.actionUsage, proc.name, t.action) === 'receive') {
+    lines.push(`${indent}${variable} = <-${channelName(t.action)} // payload: ${t.action}`);
+    return;
+  }
+  const others = gen.actionUsage.get(t.action)!.processes.size - 1;
+  for (let i = 0; i < others; i++) {
+    lines.push(`${indent}${channelName(t.action)} <- ${variable} // payload: ${t.action}`);
+  }
+}
+
+/**
+ * Emit the bookkeeping for a fired transition: log it and move to the target state
+ */
+function emitTransition(
+  lines: string[],
+  indent: string,
+  proc: ProcessDefinition,
+  t: Transition,
+  gen: GenContext
+): void {
+  if (isMultiway(t.action, gen) && actionKind(gen.actionUsage, proc.name, t.action) !== 'internal') {
+    emitMultiwayRelease(lines, indent, proc, t, gen);
+  } else if (offersMultiway(proc, t.fromState, gen)) {
+    // The state's multiway actions are no longer on offer
+    lines.push(`${indent}multiwayOffers <- multiwayOffer{process: "${proc.name}"} // withdraw`);
+  }
+  if (receivesClosable(proc, t, gen)) {
+    // A closed channel means the sender has stopped, so the action is gone for good
+    lines.push(`${indent}if !ok {`);
+    lines.push(`${indent}\t${logStatement(proc, {
+      text: `${t.action} can no longer happen: ${gen.actionUsage.get(t.action)!.sender} has stopped`,
+      message: 'peer stopped',
+      attrs: [['action', `"${t.action}"`], ['peer', `"${gen.actionUsage.get(t.action)!.sender}"`]],
+    }, gen)}`);
+    lines.push(`${indent}\treturn`);
+    lines.push(`${indent}}`);
+  }
+  const variable = payloadVariable(t, gen);
+  const label = t.hidden ? `tau: ${t.action}` : `action: ${t.action}`;
+  const attrs: [string, string][] = [
+    ['action', `"${t.action}"`],
+    ['from', `"${t.fromState}"`],
+    ['to', `"${t.toState}"`],
+  ];
+  if (variable) attrs.push(['value', variable]);
+  if (t.hidden) attrs.push(['hidden', 'true']);
+  if (gen.options.replay !== undefined) {
+    lines.push(`${indent}waitTurn("${proc.name}", "${t.fromState}", "${t.action}", "${t.toState}")`);
+  }
+  if (gen.options.traceFile !== undefined) {
+    lines.push(`${indent}traceMu.Lock()`);
+  }
+  lines.push(`${indent}${logStatement(proc, {
+    text: variable ? `${label}(%v) (${t.fromState} -> ${t.toState})` : `${label} (${t.fromState} -> ${t.toState})`,
+    args: variable ? [variable] : [],
+    message: 'action',
+    attrs,
+  }, gen)}`);
+  if (gen.options.traceFile !== undefined) {
+    lines.push(`${indent}recordTrace("${proc.name}", "${t.fromState}", "${t.action}", "${t.toState}", ${branchIndex(proc, t)})`);
+    lines.push(`${indent}traceMu.Unlock()`);
+  }
+  if (gen.options.replay !== undefined) {
+    lines.push(`${indent}doneTurn()`);
+  }
+  // A synchronization fires once, so only its sender counts it
+  if (gen.options.counters && actionKind(gen.actionUsage, proc.name, t.action) !== 'receive') {
+    lines.push(`${indent}actionCounts["${t.action}"].Add(1)`);
+  }
+  if (gen.options.expvar !== undefined) {
+    if (actionKind(gen.actionUsage, proc.name, t.action) !== 'receive') {
+      lines.push(`${indent}metricActions.Add("${t.action}", 1)`);
+    }
+    lines.push(`${indent}${metricStateName(proc.name)}.Set("${t.toState}")`);
+  }
+  if (gen.options.prometheus !== undefined) {
+    emitPrometheusTransition(lines, indent, proc.name, t.action, `"${t.fromState}"`, `"${t.toState}"`);
+  }
+  if (gen.options.hooks) {
+    lines.push(`${indent}if Observer != nil {`);
+    lines.push(`${indent}\tObserver.OnTransition("${proc.name}", "${t.fromState}", "${t.action}", "${t.toState}")`);
+    lines.push(`${indent}}`);
+  }
+  // Every assignment reads the values from before the transition
+  const read = readVariables(proc);
+  const assignments = Object.entries(t.update ?? {}).filter(([name]) => read.has(name)).sort();
+  if (assignments.length > 0) {
+    const targets = assignments.map(([name]) => name).join(', ');
+    lines.push(`${indent}${targets} = ${assignments.map(([, value]) => goValue(value)).join(', ')}`);
+  }
+  if (gen.options.nonblocking && mayWait(proc, gen)) {
+    lines.push(`${indent}idle = 0`);
+  }
+  lines.push(`${indent}state = ${stateName(proc.name, t.toState, gen)}`);
+
+  if (gen.options.shutdownAfterSteps !== undefined) {
+    lines.push(`${indent}steps++`);
+    lines.push(`${indent}if steps >= maxSteps {`);
+    lines.push(`${indent}\t${logStatement(proc, {
+      text: 'Step limit reached (%d), shutting down',
+      args: ['maxSteps'],
+      message: 'step limit reached',
+      attrs: [['steps', 'maxSteps']],
+    }, gen)}`);
+    lines.push(`${indent}\treturn`);
+    lines.push(`${indent}}`);
+  }
+}
+
+/**
+ * Emit a state whose transitions carry guards. Each guard is an `if` that
+ * enables its channel; a disabled transition offers a nil channel, which a
+ * select never picks. Guards only read the process's own variables, which
+ * cannot change while it waits, so when none holds the process blocks just
+ * as it would on an action no peer accepts. Under shutdown the state unwinds
+ * once the peers of the enabled transitions are done, so it picks that
+ * channel from the offers that are not nil.
+ */
+function generateGuardedChoice(
+  lines: string[],
+  proc: ProcessDefinition,
+  transitions: Transition[],
+  gen: GenContext
+): void {
+  emitChoiceDelay(lines, '\t\t\t', proc, transitions, gen);
+  const offers = transitions.map((t, i) => {
+    const local = actionKind(gen.actionUsage, proc.name, t.action) === 'internal';
+    const multiway = isMultiway(t.action, gen);
+    const delay = local ? actionDelay(t.action, gen) : undefined;
+    const channel = delay ? `time.After(${delay})` : local ? 'always'
+      : multiway ? lockChannelName(t.action, proc.name) : transitionChannel(proc, t, gen);
+    if (t.guard === undefined) return channel;
+
+    const offer = `offer${i}`;
+    const type = delay ? '<-chan time.Time' : local || multiway ? 'chan struct{}' : channelType(t.action, gen);
+    lines.push(`\t\t\tvar ${offer} ${type}`);
+    lines.push(`\t\t\tif ${goCondition(t.guard)} {`);
+    lines.push(`\t\t\t\t${offer} = ${channel}`);
+    lines.push(`\t\t\t}`);
+    return offer;
+  });
+
+  const exits = guardedExits(proc, transitions, gen);
+  let unwind: string | undefined;
+  if (exits) {
+    unwind = 'unwind';
+    lines.push(`\t\t\tvar unwind <-chan struct{}`);
+    lines.push(`\t\t\tswitch {`);
+    // Only the combination that holds matches first: the larger ones need a nil offer enabled
+    for (const exit of exits) {
+      const expr = peersDoneExpr(proc, exit.actions, gen);
+      if (expr === undefined) continue;
+      lines.push(`\t\t\tcase ${exit.offers.map(i => `${offers[i]} != nil`).join(' && ')}:`);
+      lines.push(`\t\t\t\tunwind = ${expr}`);
+    }
+    const fallback = peersDoneExpr(proc, transitions.filter(t => t.guard === undefined).map(t => t.action), gen);
+    if (fallback !== undefined) {
+      lines.push(`\t\t\tdefault:`);
+      lines.push(`\t\t\t\tunwind = ${fallback}`);
+    }
+    lines.push(`\t\t\t}`);
+  }
+
+  emitMultiwayOffer(lines, '\t\t\t', proc, transitions, gen);
+  emitChoiceSelect(lines, '\t\t\t', proc, transitions.map((t, i) => selectCase(proc, t, gen, offers[i])), gen, unwind);
+}
+
+/**
+ * Wait out the delays of the shared actions a choice state offers. A select
+ * cannot hold back one of its channel operations, so the state waits for
+ * the longest of them before offering any action; delayed local actions
+ * instead become ready in the select once their own delay has passed.
+ */
+function emitChoiceDelay(lines: string[], indent: string, proc: ProcessDefinition, transitions: Transition[], gen: GenContext): void {
+  const shared = transitions.filter(t =>
+    actionKind(gen.actionUsage, proc.name, t.action) !== 'internal' && actionDelay(t.action, gen) !== undefined
+  );
+  if (shared.length === 0) return;
+  const longest = shared.reduce((a, b) => delayNanos(b.action, gen) > delayNanos(a.action, gen) ? b : a);
+  const actions = Array.from(new Set(shared.map(t => t.action)));
+  lines.push(`${indent}<-time.After(${actionDelay(longest.action, gen)}) // delay: ${actions.join(', ')}`);
+}
+
+/**
+ * The select case offering a transition, on its own channel or on `channel`
+ */
+function selectCase(proc: ProcessDefinition, t: Transition, gen: GenContext, channel?: string): SelectCase {
+  if (isMultiway(t.action, gen)) {
+    return { comm: `<-${channel ?? lockChannelName(t.action, proc.name)}`, comment: `lock: ${t.action}`, t };
+  }
+  switch (actionKind(gen.actionUsage, proc.name, t.action)) {
+    case 'send':
+      return { comm: sendOp(t, gen, channel), comment: `send: ${t.action}`, t };
+    case 'receive':
+      return { comm: receiveOp(t, gen, channel ?? transitionChannel(proc, t, gen)), comment: `receive: ${t.action}`, t };
+    case 'internal': {
+      // Local action offered alongside the channel operations: always ready,
+      // or ready once its delay has passed
+      const delay = actionDelay(t.action, gen);
+      const ready = channel ?? (delay ? `time.After(${delay})` : 'always');
+      return { comm: `<-${ready}`, comment: `local: ${t.action}${delay ? ` after ${gen.actions[t.action].delay}` : ''}`, t };
+    }
+  }
+}
+
+/**
+ * The exit cases of a choice select; `unwind` overrides the channel closed
+ * once its peers are done
+ */
+function exitCases(proc: ProcessDefinition, cases: SelectCase[], gen: GenContext, unwind?: string): string[] {
+  const actions = cases.map(c => c.t.action);
+  return exitSelectCases(proc, actions, gen, true, unwind ?? peersDoneExpr(proc, actions, gen));
+}
+
+/**
+ * Emit a select over the transitions of a choice state, with the exit cases
+ */
+function emitSelect(
+  lines: string[],
+  indent: string,
+  proc: ProcessDefinition,
+  cases: SelectCase[],
+  gen: GenContext,
+  unwind?: string
+): void {
+  lines.push(`${indent}select {`);
+  for (const c of cases) {
+    lines.push(`${indent}case ${c.comm}: // ${c.comment}`);
+    emitTransition(lines, `${indent}\t`, proc, c.t, gen);
+  }
+  for (const line of exitCases(proc, cases, gen, unwind)) {
+    lines.push(`${indent}${line}`);
+  }
+  lines.push(`${indent}}`);
+}
+
+/**
+ * Emit a choice state under seeded or fair scheduling. Go's select picks at
+ * random among ready cases, so instead the cases are tried one at a time
+ * without blocking, each group in turn (preferred cases first). Within a
+ * group the process's generator shuffles them under a seed, and under
+ * fairness the ones fired least often so far come first. Only when none is
+ * ready does the process wait for whichever comes first.
+ */
+function emitOrderedSelect(
+  lines: string[],
+  indent: string,
+  proc: ProcessDefinition,
+  cases: SelectCase[],
+  groups: number[][],
+  gen: GenContext,
+  unwind?: string
+): void {
+  const taken = takenName(cases[0].t.fromState);
+  const weights = `[]float64{${cases.map(c => c.t.weight).join(', ')}}`;
+  const [first, ...others] = groups.map(group => {
+    const order = isWeighted(cases.map(c => c.t))
+      ? `weightedOrder(rng, ${weights}, ${group.join(', ')})`
+      : gen.options.seed !== undefined ? `shuffled(rng, ${group.join(', ')})` : `[]int{${group.join(', ')}}`;
+    return gen.options.fair ? `leastTaken(${taken}[:], ${order})` : order;
+  });
+  const order = others.length > 0 ? `append(${first}, ${others.map(o => `${o}...`).join(', ')})` : first;
+
+  lines.push(`${indent}fired := -1`);
+  lines.push(`${indent}for _, i := range ${order} {`);
+  lines.push(`${indent}\tswitch i {`);
+  cases.forEach((c, i) => {
+    lines.push(`${indent}\tcase ${i}:`);
+    lines.push(`${indent}\t\tselect {`);
+    lines.push(`${indent}\t\tcase ${c.comm}: // ${c.comment}`);
+    lines.push(`${indent}\t\t\tfired = ${i}`);
+    lines.push(`${indent}\t\tdefault:`);
+    lines.push(`${indent}\t\t}`);
+  });
+  lines.push(`${indent}\t}`);
+  lines.push(`${indent}\tif fired >= 0 {`);
+  lines.push(`${indent}\t\tbreak`);
+  lines.push(`${indent}\t}`);
+  lines.push(`${indent}}`);
+
+  lines.push(`${indent}if fired < 0 {`);
+  lines.push(`${indent}\tselect {`);
+  cases.forEach((c, i) => {
+    lines.push(`${indent}\tcase ${c.comm}: // ${c.comment}`);
+    lines.push(`${indent}\t\tfired = ${i}`);
+  });
+  for (const line of exitCases(proc, cases, gen, unwind)) {
+    lines.push(`${indent}\t${line}`);
+  }
+  lines.push(`${indent}\t}`);
+  lines.push(`${indent}}`);
+
+  if (gen.options.fair) {
+    lines.push(`${indent}${taken}[fired]++`);
+  }
+  lines.push(`${indent}switch fired {`);
+  cases.forEach((c, i) => {
+    lines.push(`${indent}case ${i}:`);
+    emitTransition(lines, `${indent}\t`, proc, c.t, gen);
+  });
+  lines.push(`${indent}}`);
+}
+
+/**
+ * Emit the select of a choice state. Under a priority the preferred cases
+ * are tried first without blocking, and only when none of them is ready
+ * does the process wait for any of its actions.
+ */
+function emitChoiceSelect(
+  lines: string[],
+  indent: string,
+  proc: ProcessDefinition,
+  cases: SelectCase[],
+  gen: GenContext,
+  unwind?: string
+): void {
+  const ranks = cases.map(c => priorityRank(c.t.action, gen.priority));
+  const best = Math.max(...ranks);
+  const preferred = cases.filter((_, i) => ranks[i] === best);
+  if (ordersState(cases.map(c => c.t), gen)) {
+    const first = cases.map((_, i) => i).filter(i => ranks[i] === best);
+    const rest = cases.map((_, i) => i).filter(i => ranks[i] !== best);
+    emitOrderedSelect(lines, indent, proc, cases, rest.length > 0 ? [first, rest] : [first], gen, unwind);
+    return;
+  }
+  if (preferred.length === cases.length) {
+    emitSelect(lines, indent, proc, cases, gen, unwind);
+    return;
+  }
+
+  lines.push(`${indent}select {`);
+  for (const c of preferred) {
+    lines.push(`${indent}case ${c.comm}: // ${c.comment} (priority)`);
+    emitTransition(lines, `${indent}\t`, proc, c.t, gen);
+  }
+  lines.push(`${indent}default:`);
+  emitSelect(lines, `${indent}\t`, proc, cases, gen, unwind);
+  lines.push(`${indent}}`);
+}
+
+/**
+ * Emit a state's only transition: a direct channel operation when the action
+ * is shared, then its bookkeeping
+ */
+function emitDirectTransition(lines: string[], indent: string, proc: ProcessDefinition, t: Transition, gen: GenContext): void {
+  const usage = gen.actionUsage.get(t.action)!;
+  const isSender = usage.sender === proc.name;
+  const isShared = isSharedAction(usage);
+
+  const delay = actionDelay(t.action, gen);
+  if (delay) {
+    lines.push(`${indent}<-time.After(${delay}) // delay: ${t.action}`);
+  }
+  if (isShared && isMultiway(t.action, gen)) {
+    // Multiway action: wait until the coordinator locks the process into a round
+    emitMultiwayOffer(lines, indent, proc, [t], gen);
+    emitChannelOp(lines, indent, `<-${lockChannelName(t.action, proc.name)}`, `lock: ${t.action}`, proc, t.action, gen);
+  } else if (isShared) {
+    // Shared action: synchronous handshake between processes
+    if (isSender) {
+      emitChannelOp(lines, indent, sendOp(t, gen), `send: ${t.action}`, proc, t.action, gen);
+    } else {
+      emitChannelOp(lines, indent, receiveOp(t, gen, transitionChannel(proc, t, gen)), `receive: ${t.action}`, proc, t.action, gen);
+    }
+  }
+  // Non-shared actions don't need channel operations - just log
+
+  emitTransition(lines, indent, proc, t, gen);
+}
+
+/**
+ * Emit a choice state under replay. The trace says which branch the process
+ * took, so instead of a select the state performs that one transition as if
+ * it were the only one; a branch the state does not have, or one whose guard
+ * does not hold, means the run has left the trace.
+ */
+function generateReplayedChoice(
+  lines: string[],
+  proc: ProcessDefinition,
+  state: string,
+  transitions: Transition[],
+  gen: GenContext
+): void {
+  lines.push(`\t\t\tswitch branch := replayBranch("${proc.name}", "${state}"); branch {`);
+  for (const t of transitions) {
+    lines.push(`\t\t\tcase ${branchIndex(proc, t)}: // ${t.action} -> ${t.toState}`);
+    if (t.guard !== undefined) {
+      lines.push(`\t\t\t\tif !(${goCondition(t.guard)}) {`);
+      lines.push(`\t\t\t\t\treplayFail("diverged: the trace has ${proc.name} take ${state} -${t.action}-> ${t.toState}, whose guard does not hold")`);
+      lines.push(`\t\t\t\t}`);
+    }
+    emitDirectTransition(lines, '\t\t\t\t', proc, t, gen);
+  }
+  lines.push(`\t\t\tdefault:`);
+  lines.push(`\t\t\t\treplayFail("diverged: the trace has ${proc.name} take branch %d from ${state}, which has ${transitions.length}", branch)`);
+  lines.push(`\t\t\t}`);
+}
+
+/**
+ * Generate a single case block for a state
+ */
+function generateStateCase(
+  proc: ProcessDefinition,
+  state: string,
+  stateInfo: StateInfo | undefined,
+  gen: GenContext
+): string {
+  const lines: string[] = [];
+  const caseLabel = stateName(proc.name, state, gen);
+  
+  lines.push(`\t\tcase ${caseLabel}:`);
+
+  // ERROR marks a bad state: hand it to the error hook instead of stopping quietly
+  if (state === 'ERROR') {
+    lines.push(`\t\t\t${logStatement(proc, {
+      text: 'Reached ERROR state',
+      message: 'error state',
+      level: 'Error',
+    }, gen)}`);
+    lines.push(`\t\t\tonError("${proc.name}")`);
+    lines.push(`\t\t\treturn`);
+    return lines.join('\n');
+  }
+
+  // Check if this is a terminal state (STOP or no outgoing transitions)
+  if (!stateInfo || stateInfo.transitions.length === 0 || state === 'STOP') {
+    lines.push(`\t\t\t${logStatement(proc, {
+      text: `Reached terminal state: ${state}`,
+      message: 'terminal state',
+      attrs: [['state', `"${state}"`]],
+    }, gen)}`);
+    lines.push(`\t\t\treturn`);
+    return lines.join('\n');
+  }
+
+  const transitions = stateInfo.transitions;
+
+  if (gen.options.backend === 'actor') {
+    generateActorState(lines, proc, transitions, gen);
+  } else if (gen.options.replay !== undefined && transitions.length > 1) {
+    generateReplayedChoice(lines, proc, state, transitions, gen);
+  } else if (transitions.some(t => t.guard !== undefined)) {
+    generateGuardedChoice(lines, proc, transitions, gen);
+  } else if (transitions.length === 1) {
+    emitDirectTransition(lines, '\t\t\t', proc, transitions[0], gen);
+  } else {
+    // Choice: a select with one case per offered action, sends and receives
+    // alike, and local actions as cases on the closed always channel
+    emitChoiceDelay(lines, '\t\t\t', proc, transitions, gen);
+    emitMultiwayOffer(lines, '\t\t\t', proc, transitions, gen);
+    emitChoiceSelect(lines, '\t\t\t', proc, transitions.map(t => selectCase(proc, t, gen)), gen);
+  }
+
+  return lines.join('\n');
+}
+
+/**
+ * Parameter list shared by every generated process function
+ */
+function processParams(gen: GenContext): string {
+  const params = ['wg *sync.WaitGroup'];
+  if (gen.options.context) {
+    params.unshift('ctx context.Context');
+  }
+  return params.join(', ');
+}
+
+/**
+ * Argument list used when launching a process goroutine from main
+ */
+/**
+ * Parameters of the function running a supervised process's state machine:
+ * those of the process function, less the WaitGroup that only it signals
+ */
+function runParams(gen: GenContext): string {
+  return gen.options.context ? 'ctx context.Context' : '';
+}
+
+/**
+ * Function running the state machine of a supervised process
+ */
+function runName(process: string): string {
+  return `run_${sanitizeGoName(process)}`;
+}
+
+function processArgs(gen: GenContext): string {
+  const args = ['&wg'];
+  if (gen.options.context) {
+    args.unshift('ctx');
+  }
+  return args.join(', ');
+}
+
+/**
+ * Locals of a generated process function that spec variables must not shadow
+ */
+const RESERVED_LOCALS = new Set(['state', 'steps', 'wg', 'ctx', 'always', 'logger', 'rng', 'fired', 'seed', 'idle', 'leastTaken', 'weightedOrder', 'ok', 'msg', 'branch', 'unwind']);
+
+/**
+ * Whether some state of a process waits in a channel operation or a select,
+ * rather than only firing local actions
+ */
+function mayWait(proc: ProcessDefinition, gen: GenContext): boolean {
+  return Array.from(buildStateMap(proc)).some(([state, info]) =>
+    state !== 'STOP' && state !== 'ERROR' && (
+      info.transitions.some(t => t.guard !== undefined || isSharedAction(gen.actionUsage.get(t.action)!)) ||
+      info.transitions.length > 1
+    )
+  );
+}
+
+/**
+ * Whether some state of a process chooses between several transitions
+ */
+function offersChoice(proc: ProcessDefinition): boolean {
+  return choiceStates(proc).length > 0;
+}
+
+/**
+ * Declare the states of a process as typed integer constants, numbered in
+ * the order of its switch, with a table that maps them back to their names
+ * for logging
+ */
+function generateStateDeclarations(proc: ProcessDefinition, states: string[], gen: GenContext): string {
+  const type = stateType(proc.name);
+  const names = `stateNames_${sanitizeGoName(proc.name)}`;
+  const lines: string[] = [];
+
+  lines.push(`// ${type} is a state of the ${proc.name} process`);
+  lines.push(`type ${type} int`);
+  lines.push(``);
+  lines.push(`const (`);
+  states.forEach((state, i) => {
+    lines.push(`\t${stateName(proc.name, state, gen)}${i === 0 ? ` ${type} = iota` : ''}`);
+  });
+  lines.push(`)`);
+  lines.push(``);
+  lines.push(`var ${names} = [...]string{`);
+  for (const state of states) {
+    lines.push(`\t"${state}",`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`func (s ${type}) String() string {`);
+  lines.push(`\tif s >= 0 && int(s) < len(${names}) {`);
+  lines.push(`\t\treturn ${names}[s]`);
+  lines.push(`\t}`);
+  lines.push(`\treturn "${type}(" + strconv.Itoa(int(s)) + ")"`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate a Go function for a single process
+ */
+function generateProcessFunction(proc: ProcessDefinition, gen: GenContext): string {
+  const lines: string[] = [];
+  const fName = funcName(proc.name);
+  const stateMap = buildStateMap(proc);
+  // A process that starts in STOP has no transitions but still needs its state
+  const allStates = new Set([proc.initialState, ...getAllStates(proc)]);
+
+  if (gen.options.intStates) {
+    lines.push(generateStateDeclarations(proc, Array.from(allStates).sort(), gen));
+  }
+  lines.push(`// ${fName} implements the ${proc.name} process`);
+  lines.push(`func ${fName}(${processParams(gen)}) {`);
+  lines.push(`\tdefer wg.Done()`);
+  if (gen.options.shutdownAfterSteps !== undefined) {
+    lines.push(`\tdefer close(${doneChannelName(proc.name)})`);
+  }
+  // However it returns, peers still waiting on its actions must find out
+  for (const action of Array.from(gen.closedOnStop).sort()) {
+    if (!gen.actionUsage.get(action)!.processes.has(proc.name)) continue;
+    const kind = actionKind(gen.actionUsage, proc.name, action);
+    if (kind === 'send') {
+      lines.push(`\tdefer ${closeOnceName(action)}.Do(func() { close(${channelName(action)}) })`);
+    } else if (kind === 'receive') {
+      lines.push(`\tdefer ${stopOnceName(action)}.Do(func() { close(${stoppedChannelName(action)}) })`);
+    }
+  }
+  if (joinsMultiway(proc, gen)) {
+    // Withdraw for good, so that the coordinator stops waiting for this process
+    lines.push(`\tdefer func() { multiwayOffers <- multiwayOffer{process: "${proc.name}", done: true} }()`);
+  }
+  // Closing a broadcast channel lets its dispatcher finish delivering and stop
+  for (const action of broadcastActions(gen)) {
+    if (gen.actionUsage.get(action)!.sender === proc.name) {
+      lines.push(`\tdefer close(${channelName(action)})`);
+    }
+  }
+  lines.push(`\t${logStatement(proc, { text: 'Starting...', message: 'starting' }, gen)}`);
+  if (gen.options.supervise) {
+    // The state machine runs on its own, so a restart redeclares every local
+    // while the cleanup above waits for the process to return for good
+    lines.push(`\tsupervise("${proc.name}", func() { ${runName(proc.name)}(${gen.options.context ? 'ctx' : ''}) })`);
+    lines.push(`}`);
+    lines.push(``);
+    lines.push(`// ${runName(proc.name)} runs the state machine of ${proc.name} from its initial state`);
+    lines.push(`func ${runName(proc.name)}(${runParams(gen)}) {`);
+  }
+  lines.push(``);
+  lines.push(`\tstate := ${stateName(proc.name, proc.initialState, gen)}`);
+  if (gen.options.expvar !== undefined) {
+    lines.push(`\t${metricStateName(proc.name)}.Set("${proc.initialState}")`);
+  }
+  if (gen.options.prometheus !== undefined) {
+    lines.push(`\tpromStart("${proc.name}", "${proc.initialState}")`);
+  }
+
+  // Variables carrying action payloads, declared once per process
+  const variables = new Map<string, string>();
+  for (const t of proc.transitions) {
+    const variable = payloadVariable(t, gen);
+    if (!variable) continue;
+    const type = gen.actions[t.action].payload!;
+    if (variables.has(variable) && variables.get(variable) !== type) {
+      throw new Error(`Process ${proc.name}: variable ${variable} used with both ${variables.get(variable)} and ${type} payloads`);
+    }
+    variables.set(variable, type);
+  }
+  for (const [variable, type] of Array.from(variables).sort()) {
+    lines.push(`\tvar ${variable} ${type}`);
+  }
+
+  if ((gen.options.seed !== undefined && offersChoice(proc)) ||
+      choiceStates(proc).some(([, info]) => isWeighted(info.transitions))) {
+    lines.push(`\trng := rngFor("${proc.name}")`);
+  }
+  if (gen.options.fair) {
+    // How often each case of each choice state has fired
+    for (const [state, info] of choiceStates(proc)) {
+      lines.push(`\tvar ${takenName(state)} [${info.transitions.length}]int`);
+    }
+  }
+
+  // Integer variables read by guards and updates
+  const read = readVariables(proc);
+  for (const [name, value] of Object.entries(proc.variables ?? {}).sort()) {
+    if (!read.has(name)) continue;
+    if (RESERVED_LOCALS.has(name) || variables.has(name)) {
+      throw new Error(`Process ${proc.name}: variable ${name} clashes with a name used by the generated code`);
+    }
+    lines.push(`\t${name} := ${value}`);
+  }
+
+  if (gen.options.nonblocking && mayWait(proc, gen)) {
+    // Consecutive attempts in which no transition was ready
+    lines.push(`\tidle := 0`);
+  }
+
+  if (proc.transitions.some(t => receivesClosable(proc, t, gen))) {
+    // Whether the last receive was a handshake rather than a closed channel
+    lines.push(`\tvar ok bool`);
+  }
+
+  if (gen.options.shutdownAfterSteps !== undefined) {
+    lines.push(`\tsteps := 0`);
+
+    // Choice states may wait on several actions; only unwind once all of them
+    // are dead. Under replay a choice state performs one transition, so it
+    // only ever waits on that action.
+    const anySets = new Map<string, string[]>();
+    const allSets = new Map<string, string[]>();
+    for (const info of stateMap.values()) {
+      const actions = info.transitions.map(t => t.action);
+      const signals = deadSignals(proc, actions, gen);
+      for (const [name, peers] of signals) {
+        if (peers.length > 1) anySets.set(name, peers);
+      }
+      // A guarded state waits on the actions its guards enable
+      const exits = info.transitions.some(t => t.guard !== undefined) ? guardedExits(proc, info.transitions, gen) : undefined;
+      const waits = exits
+        ? [...exits.map(exit => exit.actions), info.transitions.filter(t => t.guard === undefined).map(t => t.action)]
+        : [actions];
+      for (const waited of gen.options.replay === undefined ? waits : []) {
+        const dead = deadSignals(proc, waited, gen);
+        if (dead.size > 1) allSets.set(peersDoneExpr(proc, waited, gen)!, Array.from(dead.keys()).sort());
+      }
+    }
+    for (const [name, peers] of Array.from(anySets).sort()) {
+      lines.push(`\t${name} := anyDone(${peers.map(doneChannelName).join(', ')})`);
+    }
+    for (const [name, signals] of Array.from(allSets).sort()) {
+      lines.push(`\t${name} := allDone(${signals.join(', ')})`);
+    }
+  }
+  lines.push(``);
+  lines.push(`\tfor {`);
+
+  if (gen.options.context) {
+    // Local-only steps never block, so check for cancellation every iteration
+    lines.push(`\t\tselect {`);
+    lines.push(`\t\tcase <-ctx.Done():`);
+    lines.push(`\t\t\treturn`);
+    lines.push(`\t\tdefault:`);
+    lines.push(`\t\t}`);
+    lines.push(``);
+  }
+
+  lines.push(`\t\tswitch state {`);
+
+  // Generate case for each state
+  for (const state of Array.from(allStates).sort()) {
+    const stateInfo = stateMap.get(state);
+    lines.push(generateStateCase(proc, state, stateInfo, gen));
+  }
+
+  // Add default case for unknown states
+  lines.push(`\t\tdefault:`);
+  lines.push(`\t\t\t${logStatement(proc, {
+    text: 'Unknown state: %s',
+    args: ['state'],
+    message: 'unknown state',
+    attrs: [['state', 'state']],
+    level: 'Error',
+  }, gen)}`);
+  lines.push(`\t\t\treturn`);
+
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+
+/**
+ * Add every process to the WaitGroup and launch its goroutine
+ */
+function generateLaunch(lines: string[], spec: LTSSpec, gen: GenContext): void {
+  if (broadcastActions(gen).length > 0) {
+    lines.push(`\tstartBroadcasts()`);
+  }
+  if (multiwayActions(gen).length > 0) {
+    lines.push(`\tstopMultiway := make(chan struct{})`);
+    lines.push(`\tgo coordinateMultiway(stopMultiway)`);
+  }
+  lines.push(`\twg.Add(${spec.processes.length})`);
+  lines.push(``);
+
+  // Launch process goroutines
+  lines.push(spec.composition
+    ? `\t// Launch process goroutines (||${spec.composition.name})`
+    : `\t// Launch process goroutines`);
+  for (const proc of spec.processes) {
+    lines.push(`\tgo ${funcName(proc.name)}(${processArgs(gen)})`);
+  }
+}
+
+/**
+ * Stop the coordinator of the multiway actions once every process has returned
+ */
+function generateMultiwayStop(lines: string[], indent: string, gen: GenContext): void {
+  if (multiwayActions(gen).length > 0) {
+    lines.push(`${indent}close(stopMultiway)`);
+  }
+}
+
+/**
+ * Generate the exported Run function used in library mode
+ */
+function generateRun(spec: LTSSpec, actions: Set<string>, gen: GenContext): string {
+  const lines: string[] = [];
+
+  lines.push(`// Run starts every process and blocks until they have all returned or ctx is done.`);
+  lines.push(`// It returns ctx.Err() if the context ended first. Calls must not overlap.`);
+  lines.push(`func Run(ctx context.Context) error {`);
+  if (gen.options.replay !== undefined) {
+    generateReplayLoad(lines, gen);
+  }
+  if (gen.options.traceFile !== undefined) {
+    generateTraceOpen(lines, gen);
+  }
+  for (const action of sharedActionsOf(actions, gen)) {
+    for (const [channel, make] of actionChannels(action, gen)) {
+      lines.push(`\t${channel} = ${make}`);
+    }
+    if (gen.closedOnStop.has(action)) {
+      lines.push(`\t${closeOnceName(action)} = sync.Once{}`);
+      lines.push(`\t${stoppedChannelName(action)} = make(chan struct{})`);
+      lines.push(`\t${stopOnceName(action)} = sync.Once{}`);
+    }
+    if (gen.stoppedMultiway.has(action)) {
+      lines.push(`\t${stoppedChannelName(action)} = make(chan struct{})`);
+    }
+  }
+  if (gen.options.shutdownAfterSteps !== undefined) {
+    for (const proc of spec.processes) {
+      lines.push(`\t${doneChannelName(proc.name)} = make(chan struct{})`);
+    }
+    for (const action of broadcastActions(gen)) {
+      for (const receiver of receiversOf(action, gen)) {
+        lines.push(`\t${drainedChannelName(action, receiver)} = make(chan struct{})`);
+      }
+    }
+  }
+  lines.push(``);
+  lines.push(`\tvar wg sync.WaitGroup`);
+  lines.push(``);
+  generateLaunch(lines, spec, gen);
+  lines.push(``);
+
+  if (gen.options.context) {
+    // Processes watch ctx themselves, so wait for them to unwind
+    lines.push(`\twg.Wait()`);
+    generateMultiwayStop(lines, '\t', gen);
+    lines.push(`\treturn ctx.Err()`);
+  } else {
+    lines.push(`\tdone := make(chan struct{})`);
+    lines.push(`\tgo func() {`);
+    lines.push(`\t\twg.Wait()`);
+    generateMultiwayStop(lines, '\t\t', gen);
+    lines.push(`\t\tclose(done)`);
+    lines.push(`\t}()`);
+    lines.push(``);
+    lines.push(`\tselect {`);
+    lines.push(`\tcase <-done:`);
+    lines.push(`\t\treturn nil`);
+    lines.push(`\tcase <-ctx.Done():`);
+    lines.push(`\t\treturn ctx.Err()`);
+    lines.push(`\t}`);
+  }
+  lines.push(`}`);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate the handler that cancels the system's context on SIGINT or
+ * SIGTERM. The processes see the cancellation at their next channel
+ * operation or step, so none of them is cut off in the middle of a handshake.
+ */
+function generateSignalHandler(lines: string[], gen: GenContext): void {
+  lines.push(`\t// Ctrl-C or SIGTERM cancels the context, so every process returns cleanly`);
+  lines.push(`\tsignals := make(chan os.Signal, 1)`);
+  lines.push(`\tsignal.Notify(signals, os.Interrupt, syscall.SIGTERM)`);
+  lines.push(`\tdefer signal.Stop(signals)`);
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase sig := <-signals:`);
+  if (usesSlog(gen)) {
+    lines.push(`\t\t\tlogger.Info("LTS shutting down", "signal", sig.String())`);
+  } else {
+    lines.push(`\t\t\tfmt.Println()`);
+    lines.push(`\t\t\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\t\t\tfmt.Printf("  Received %v, shutting down\\n", sig)`);
+    lines.push(`\t\t\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+  }
+  lines.push(`\t\t\tcancel()`);
+  lines.push(`\t\tcase <-ctx.Done():`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}()`);
+  lines.push(``);
+}
+
+/**
+ * Generate the main() function
+ */
+function generateMain(spec: LTSSpec, gen: GenContext): string {
+  const lines: string[] = [];
+
+  lines.push(`func main() {`);
+  if (usesSlog(gen)) {
+    lines.push(`\tlogger.Info("LTS execution started")`);
+  } else {
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println("  LTS Execution Started")`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println()`);
+  }
+  lines.push(``);
+
+  if (gen.options.runFor !== undefined) {
+    lines.push(`\t// Every process returns once the run time is up`);
+    lines.push(`\tctx, cancel := context.WithTimeout(context.Background(), runFor)`);
+    lines.push(`\tdefer cancel()`);
+    lines.push(``);
+  } else if (gen.options.context) {
+    lines.push(`\tctx, cancel := context.WithCancel(context.Background())`);
+    lines.push(`\tdefer cancel()`);
+    lines.push(``);
+  }
+  if (gen.options.signals) {
+    generateSignalHandler(lines, gen);
+  }
+  if (gen.options.expvar !== undefined) {
+    generateExpvarServer(lines, gen);
+  }
+  if (gen.options.prometheus !== undefined) {
+    generatePrometheusServer(lines, gen);
+  }
+  if (gen.options.replay !== undefined) {
+    generateReplayLoad(lines, gen);
+  }
+  if (gen.options.traceFile !== undefined) {
+    generateTraceOpen(lines, gen);
+  }
+
+  lines.push(`\tvar wg sync.WaitGroup`);
+  lines.push(``);
+  generateLaunch(lines, spec, gen);
+
+  lines.push(``);
+  lines.push(`\t// Wait for all processes to complete`);
+  lines.push(`\twg.Wait()`);
+  generateMultiwayStop(lines, '\t', gen);
+  if (gen.options.runFor !== undefined || gen.options.context) {
+    lines.push(`\t// The processes have all returned, so nothing needs the context any more`);
+    lines.push(`\tcancel()`);
+  }
+  lines.push(``);
+  if (usesSlog(gen)) {
+    lines.push(`\tlogger.Info("LTS execution complete")`);
+  } else {
+    lines.push(`\tfmt.Println()`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println("  LTS Execution Complete")`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+  }
+  lines.push(`}`);
+
+  return lines.join('\n');
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Actor Backend
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Capacity of each inbox when no buffer size is given
+ */
+const DEFAULT_INBOX_SIZE = 16;
+
+/**
+ * Package-level inbox of a process under the actor backend
+ */
+function actorName(process: string): string {
+  return `actor_${sanitizeGoName(process)}`;
+}
+
+/**
+ * Processes that take part in some shared action, and so need an inbox, in spec order
+ */
+function actorsOf(spec: LTSSpec, gen: GenContext): string[] {
+  const participants = new Set(Array.from(gen.actionUsage.values())
+    .filter(usage => isSharedAction(usage))
+    .flatMap(usage => Array.from(usage.processes)));
+  return spec.processes.map(proc => proc.name).filter(name => participants.has(name));
+}
+
+/**
+ * Whether the sender of an action moves on without waiting for its
+ * receivers to acknowledge it: for broadcast and buffered actions
+ */
+function isAsyncMessage(action: string, gen: GenContext): boolean {
+  return gen.actions[action]?.broadcast === true || (gen.actions[action]?.buffer ?? 0) > 0;
+}
+
+/**
+ * Reject what the actor and mutex backends cannot express: neither a message
+ * nor a step of the driver has a way to be held back by a guard, a delay or
+ * a priority, nor to be drawn by weight. The mutex backend keeps no process
+ * variables either, so it has nothing for updates or payloads to act on.
+ */
+function validateBackendSpec(spec: LTSSpec, backend: Backend): void {
+  for (const proc of spec.processes) {
+    for (const t of proc.transitions) {
+      if (t.guard !== undefined) {
+        throw new Error(`Process ${proc.name}: the ${backend} backend does not support guards (on ${t.action})`);
+      }
+      if (t.weight !== undefined) {
+        throw new Error(`Process ${proc.name}: the ${backend} backend does not support weights (on ${t.action})`);
+      }
+      if (backend === 'mutex' && t.update !== undefined) {
+        throw new Error(`Process ${proc.name}: the mutex backend does not support updates (on ${t.action})`);
+      }
+    }
+  }
+  for (const [action, declaration] of Object.entries(spec.actions ?? {})) {
+    if (declaration.delay !== undefined) {
+      throw new Error(`Action ${action}: the ${backend} backend does not support delays`);
+    }
+    if (backend === 'mutex' && declaration.payload !== undefined) {
+      throw new Error(`Action ${action}: the mutex backend does not support payloads`);
+    }
+  }
+  if (spec.composition?.priority) {
+    throw new Error(`The ${backend} backend does not support priorities`);
+  }
+}
+
+/**
+ * Generate the message type, the inbox type with its receive operations,
+ * and one inbox per receiving process
+ */
+function generateActorDeclarations(spec: LTSSpec, gen: GenContext): string {
+  const actors = actorsOf(spec, gen);
+  if (actors.length === 0) return '';
+
+  const lines: string[] = [];
+  lines.push(`// Message is one action delivered to the inbox of a process, with the`);
+  lines.push(`// process that performed it and the value it carries, if any. A receiver`);
+  lines.push(`// answers with an Ack unless the sender does not wait for one.`);
+  lines.push(`type Message struct {`);
+  lines.push(`\tAction string`);
+  lines.push(`\tFrom   string`);
+  lines.push(`\tValue  any`);
+  lines.push(`\tAck    bool`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// Actor is the inbox of a process, together with the messages that arrived`);
+  lines.push(`// before the process was ready for them`);
+  lines.push(`type Actor struct {`);
+  lines.push(`\tinbox   chan Message`);
+  lines.push(`\tpending []Message`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// wants reports whether a message performs one of actions`);
+  lines.push(`func wants(m Message, actions []string) bool {`);
+  lines.push(`\tif m.Ack {`);
+  lines.push(`\t\treturn false`);
+  lines.push(`\t}`);
+  lines.push(`\tfor _, action := range actions {`);
+  lines.push(`\t\tif m.Action == action {`);
+  lines.push(`\t\t\treturn true`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\treturn false`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// receive returns the oldest message for one of actions, waiting for one`);
+  lines.push(`// if need be; messages for other actions are kept for later states`);
+  lines.push(`func (a *Actor) receive(actions ...string) Message {`);
+  lines.push(`\tif m, ok := a.poll(actions...); ok {`);
+  lines.push(`\t\treturn m`);
+  lines.push(`\t}`);
+  lines.push(`\tfor {`);
+  lines.push(`\t\tm := <-a.inbox`);
+  lines.push(`\t\tif wants(m, actions) {`);
+  lines.push(`\t\t\treturn m`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\ta.pending = append(a.pending, m)`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// poll is receive without the waiting: ok is false when no message for`);
+  lines.push(`// one of actions has arrived yet`);
+  lines.push(`func (a *Actor) poll(actions ...string) (Message, bool) {`);
+  lines.push(`\tfor i, m := range a.pending {`);
+  lines.push(`\t\tif wants(m, actions) {`);
+  lines.push(`\t\t\ta.pending = append(a.pending[:i], a.pending[i+1:]...)`);
+  lines.push(`\t\t\treturn m, true`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tfor {`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase m := <-a.inbox:`);
+  lines.push(`\t\t\tif wants(m, actions) {`);
+  lines.push(`\t\t\t\treturn m, true`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t\ta.pending = append(a.pending, m)`);
+  lines.push(`\t\tdefault:`);
+  lines.push(`\t\t\treturn Message{}, false`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// awaitAcks waits until n receivers have acknowledged action, keeping other`);
+  lines.push(`// messages for later states`);
+  lines.push(`func (a *Actor) awaitAcks(action string, n int) {`);
+  lines.push(`\tfor n > 0 {`);
+  lines.push(`\t\tm := <-a.inbox`);
+  lines.push(`\t\tif m.Ack && m.Action == action {`);
+  lines.push(`\t\t\tn--`);
+  lines.push(`\t\t} else {`);
+  lines.push(`\t\t\ta.pending = append(a.pending, m)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// Inboxes of the processes that take part in shared actions`);
+  lines.push(`var (`);
+  const size = gen.options.bufferSize ?? DEFAULT_INBOX_SIZE;
+  for (const actor of actors) {
+    lines.push(`\t${actorName(actor)} = &Actor{inbox: make(chan Message, ${size})} // inbox of ${actor}`);
+  }
+  lines.push(`)`);
+  lines.push(``);
+  return lines.join('\n');
+}
+
+/**
+ * Emit a step a process takes on its own under the actor backend: a send
+ * puts a message in the inbox of every other participant, then waits for
+ * all of them to acknowledge it unless the action is broadcast or buffered
+ */
+function emitActorStep(lines: string[], indent: string, proc: ProcessDefinition, t: Transition, gen: GenContext): void {
+  if (actionKind(gen.actionUsage, proc.name, t.action) === 'send') {
+    const variable = payloadVariable(t, gen);
+    const value = variable ? `, Value: ${variable}` : '';
+    const receivers = receiversOf(t.action, gen);
+    for (const receiver of receivers) {
+      lines.push(`${indent}${actorName(receiver)}.inbox <- Message{Action: "${t.action}", From: "${proc.name}"${value}} // send: ${t.action} to ${receiver}`);
+    }
+    if (!isAsyncMessage(t.action, gen)) {
+      lines.push(`${indent}${actorName(proc.name)}.awaitAcks("${t.action}", ${receivers.length})`);
+    }
+  }
+  emitTransition(lines, indent, proc, t, gen);
+}
+
+/**
+ * Emit the transition a received message fires: take its value, and answer
+ * the sender when it waits for an acknowledgement
+ */
+function emitActorDelivery(lines: string[], indent: string, proc: ProcessDefinition, t: Transition, gen: GenContext): void {
+  const variable = payloadVariable(t, gen);
+  if (variable) {
+    lines.push(`${indent}${variable} = msg.Value.(${gen.actions[t.action].payload})`);
+  }
+  if (!isAsyncMessage(t.action, gen)) {
+    const sender = gen.actionUsage.get(t.action)!.sender;
+    lines.push(`${indent}${actorName(sender)}.inbox <- Message{Action: "${t.action}", From: "${proc.name}", Ack: true} // acknowledge: ${t.action}`);
+  }
+  emitTransition(lines, indent, proc, t, gen);
+}
+
+/**
+ * Emit the steps a state can take on its own under the actor backend, picking
+ * one of several at random
+ */
+function emitActorSteps(lines: string[], indent: string, proc: ProcessDefinition, steps: Transition[], gen: GenContext): void {
+  if (steps.length === 1) {
+    emitActorStep(lines, indent, proc, steps[0], gen);
+    return;
+  }
+  lines.push(`${indent}switch rand.Intn(${steps.length}) { // choice: ${steps.map(t => t.action).join(' | ')}`);
+  steps.forEach((t, i) => {
+    lines.push(`${indent}case ${i}:`);
+    emitActorStep(lines, `${indent}\t`, proc, t, gen);
+  });
+  lines.push(`${indent}}`);
+}
+
+/**
+ * Whether some state of a process picks among several steps of its own under
+ * the actor backend
+ */
+function actorChooses(proc: ProcessDefinition, actionUsage: Map<string, ActionUsage>): boolean {
+  return choiceStates(proc).some(([, info]) =>
+    info.transitions.filter(t => actionKind(actionUsage, proc.name, t.action) !== 'receive').length > 1
+  );
+}
+
+/**
+ * Emit a state under the actor backend. Receiving takes the oldest message
+ * for one of the state's actions from the process's inbox. A state that can
+ * also send or act locally takes a message if one is waiting, and otherwise
+ * takes one of its other steps at random, as nothing else would wake it.
+ */
+function generateActorState(lines: string[], proc: ProcessDefinition, transitions: Transition[], gen: GenContext): void {
+  const indent = '\t\t\t';
+  // A switch case cannot repeat, so of several receives of one action the first wins
+  const receives = transitions
+    .filter(t => actionKind(gen.actionUsage, proc.name, t.action) === 'receive')
+    .filter((t, i, all) => all.findIndex(u => u.action === t.action) === i);
+  const steps = transitions.filter(t => actionKind(gen.actionUsage, proc.name, t.action) !== 'receive');
+
+  if (receives.length === 0) {
+    emitActorSteps(lines, indent, proc, steps, gen);
+    return;
+  }
+
+  const actions = receives.map(t => `"${t.action}"`).join(', ');
+  const needsMessage = receives.length > 1 || receives.some(t => payloadVariable(t, gen) !== undefined);
+  const dispatch = (inner: string) => {
+    if (receives.length === 1) {
+      emitActorDelivery(lines, inner, proc, receives[0], gen);
+      return;
+    }
+    lines.push(`${inner}switch msg.Action {`);
+    for (const t of receives) {
+      lines.push(`${inner}case "${t.action}": // receive: ${t.action}`);
+      emitActorDelivery(lines, `${inner}\t`, proc, t, gen);
+    }
+    lines.push(`${inner}}`);
+  };
+
+  if (steps.length === 0) {
+    const comment = receives.length === 1 ? ` // receive: ${receives[0].action}` : '';
+    lines.push(`${indent}${needsMessage ? 'msg := ' : ''}${actorName(proc.name)}.receive(${actions})${comment}`);
+    dispatch(indent);
+    return;
+  }
+
+  lines.push(`${indent}if ${needsMessage ? 'msg' : '_'}, ok := ${actorName(proc.name)}.poll(${actions}); ok {`);
+  dispatch(`${indent}\t`);
+  lines.push(`${indent}} else {`);
+  emitActorSteps(lines, `${indent}\t`, proc, steps, gen);
+  lines.push(`${indent}}`);
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Mutex Backend
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Method of System that performs an action under the mutex backend
+ */
+function actionMethodName(action: string): string {
+  return `act_${sanitizeGoName(action)}`;
+}
+
+/**
+ * States a process cannot leave: STOP, and any other without transitions
+ */
+function terminalStatesOf(proc: ProcessDefinition): Set<string> {
+  const states = buildStateMap(proc);
+  return new Set(Array.from(new Set([proc.initialState, ...getAllStates(proc)]))
+    .filter(state => state !== 'ERROR' && (state === 'STOP' || !states.get(state)?.transitions.length)));
+}
+
+/**
+ * Emit the report of a process entering STOP, ERROR or another state it
+ * cannot leave, as the process functions of the channel backend log it
+ */
+function emitSystemArrival(lines: string[], proc: ProcessDefinition, targets: string[], gen: GenContext): void {
+  const field = `s.${sanitizeGoName(proc.name)}`;
+  const terminal = terminalStatesOf(proc);
+  const reported = targets.filter(state => state === 'ERROR' || terminal.has(state));
+  const report = (state: string, indent: string) => {
+    if (state === 'ERROR') {
+      lines.push(`${indent}${logStatement(proc, { text: 'Reached ERROR state', message: 'error state', level: 'Error' }, gen)}`);
+      lines.push(`${indent}onError("${proc.name}")`);
+    } else {
+      lines.push(`${indent}${logStatement(proc, {
+        text: `Reached terminal state: ${state}`,
+        message: 'terminal state',
+        attrs: [['state', `"${state}"`]],
+      }, gen)}`);
+    }
+  };
+
+  if (reported.length === 1) {
+    lines.push(`\tif ${field} == "${reported[0]}" {`);
+    report(reported[0], '\t\t');
+    lines.push(`\t}`);
+  } else if (reported.length > 1) {
+    lines.push(`\tswitch ${field} {`);
+    for (const state of reported) {
+      lines.push(`\tcase "${state}":`);
+      report(state, '\t\t');
+    }
+    lines.push(`\t}`);
+  }
+}
+
+/**
+ * Generate the method performing one action: it checks that every process
+ * taking part can perform it from its current state, and if so moves all of
+ * them on before releasing the lock
+ */
+function generateActionMethod(action: string, processes: ProcessDefinition[], gen: GenContext): string {
+  const lines: string[] = [];
+  const method = actionMethodName(action);
+  const participants = processes.filter(proc => gen.actionUsage.get(action)!.processes.has(proc.name));
+
+  lines.push(`// ${method} performs ${action} if every process taking part can, and reports whether it did`);
+  lines.push(`func (s *System) ${method}() bool {`);
+  const blocking = participants.find(proc => !proc.transitions.some(t => t.action === action));
+  const unmatched = participants.length === 1 && gen.actionUsage.get(action)!.shared;
+  if (blocking || unmatched) {
+    // An alphabet extension takes part in the action without ever performing it,
+    // and a shared action of a single process has no one to synchronize with
+    lines.push(blocking
+      ? `\t// ${blocking.name} never performs ${action}, so it can never happen`
+      : `\t// ${action} is declared shared, but only ${participants[0].name} takes part, so it can never happen`);
+    lines.push(`\treturn false`);
+    lines.push(`}`);
+    lines.push(``);
+    return lines.join('\n');
+  }
+
+  lines.push(`\ts.mu.Lock()`);
+  lines.push(`\tdefer s.mu.Unlock()`);
+  lines.push(``);
+  lines.push(`\tvar ${participants.map(proc => `next_${sanitizeGoName(proc.name)}`).join(', ')} string`);
+  if (gen.options.traceFile !== undefined) {
+    lines.push(`\tvar ${participants.map(proc => `branch_${sanitizeGoName(proc.name)}`).join(', ')} int`);
+  }
+  const targets = new Map<string, string[]>();
+  for (const proc of participants) {
+    const field = sanitizeGoName(proc.name);
+    // A switch case cannot repeat, so of several transitions from one state the first wins
+    const transitions = proc.transitions
+      .filter(t => t.action === action)
+      .filter((t, i, all) => all.findIndex(u => u.fromState === t.fromState) === i);
+    targets.set(proc.name, Array.from(new Set(transitions.map(t => t.toState))));
+    lines.push(`\tswitch s.${field} {`);
+    for (const t of transitions) {
+      lines.push(`\tcase "${t.fromState}":`);
+      lines.push(`\t\tnext_${field} = "${t.toState}"`);
+      if (gen.options.traceFile !== undefined) {
+        lines.push(`\t\tbranch_${field} = ${branchIndex(proc, t)}`);
+      }
+    }
+    lines.push(`\tdefault:`);
+    lines.push(`\t\treturn false`);
+    lines.push(`\t}`);
+  }
+  lines.push(``);
+
+  for (const proc of participants) {
+    const field = sanitizeGoName(proc.name);
+    const hidden = proc.transitions.some(t => t.action === action && t.hidden);
+    const attrs: [string, string][] = [['action', `"${action}"`], ['from', `s.${field}`], ['to', `next_${field}`]];
+    if (hidden) attrs.push(['hidden', 'true']);
+    if (gen.options.traceFile !== undefined) {
+      lines.push(`\ttraceMu.Lock()`);
+    }
+    lines.push(`\t${logStatement(proc, {
+      text: `${hidden ? 'tau' : 'action'}: ${action} (%s -> %s)`,
+      args: [`s.${field}`, `next_${field}`],
+      message: 'action',
+      attrs,
+    }, gen)}`);
+    if (gen.options.traceFile !== undefined) {
+      lines.push(`\trecordTrace("${proc.name}", s.${field}, "${action}", next_${field}, branch_${field})`);
+      lines.push(`\ttraceMu.Unlock()`);
+    }
+    if (gen.options.hooks) {
+      lines.push(`\tif Observer != nil {`);
+      lines.push(`\t\tObserver.OnTransition("${proc.name}", s.${field}, "${action}", next_${field})`);
+      lines.push(`\t}`);
+    }
+  }
+  if (gen.options.counters) {
+    lines.push(`\tactionCounts["${action}"].Add(1)`);
+  }
+  if (gen.options.expvar !== undefined) {
+    lines.push(`\tmetricActions.Add("${action}", 1)`);
+    for (const proc of participants) {
+      lines.push(`\t${metricStateName(proc.name)}.Set(next_${sanitizeGoName(proc.name)})`);
+    }
+  }
+  if (gen.options.prometheus !== undefined) {
+    for (const proc of participants) {
+      const field = sanitizeGoName(proc.name);
+      emitPrometheusTransition(lines, '\t', proc.name, action, `s.${field}`, `next_${field}`);
+    }
+  }
+  const fields = participants.map(proc => sanitizeGoName(proc.name));
+  lines.push(`\t${fields.map(field => `s.${field}`).join(', ')} = ${fields.map(field => `next_${field}`).join(', ')}`);
+  for (const proc of participants) {
+    emitSystemArrival(lines, proc, targets.get(proc.name)!, gen);
+  }
+  lines.push(`\treturn true`);
+  lines.push(`}`);
+  lines.push(``);
+  return lines.join('\n');
+}
+
+/**
+ * Generate the System struct holding the state of every process, its
+ * constructor, and one method per action
+ */
+function generateSystemDeclarations(spec: LTSSpec, actions: Set<string>, gen: GenContext): string {
+  // Sanitizing can map distinct names to one Go identifier
+  const fields = new Map<string, string>([['mu', 'the mutex']]);
+  for (const proc of spec.processes) {
+    const field = sanitizeGoName(proc.name);
+    if (fields.has(field)) {
+      throw new Error(`Process ${proc.name} and ${fields.get(field)} would both use the System field ${field}; rename one of them`);
+    }
+    fields.set(field, `process ${proc.name}`);
+  }
+  const methods = new Map<string, string>();
+  for (const action of Array.from(actions).sort()) {
+    const method = actionMethodName(action);
+    if (methods.has(method)) {
+      throw new Error(`Actions ${methods.get(method)} and ${action} would both use the System method ${method}; rename one of them`);
+    }
+    methods.set(method, action);
+  }
+
+  const lines: string[] = [];
+  const width = Math.max(2, ...spec.processes.map(proc => sanitizeGoName(proc.name).length));
+  lines.push(`// System holds the state of every process. Each action is a method that`);
+  lines.push(`// checks, with mu held, whether every process taking part can perform it,`);
+  lines.push(`// and if so moves all of them on in one atomic step.`);
+  lines.push(`type System struct {`);
+  lines.push(`\t${'mu'.padEnd(width)} sync.Mutex`);
+  for (const proc of spec.processes) {
+    lines.push(`\t${sanitizeGoName(proc.name).padEnd(width)} string`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// newSystem returns a system with every process in its initial state`);
+  lines.push(`func newSystem() *System {`);
+  lines.push(`\treturn &System{`);
+  for (const proc of spec.processes) {
+    lines.push(`\t\t${(sanitizeGoName(proc.name) + ':').padEnd(width + 1)} "${proc.initialState}",`);
+  }
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+  for (const action of Array.from(actions).sort()) {
+    lines.push(generateActionMethod(action, spec.processes, gen));
+  }
+  return lines.join('\n');
+}
+
+/**
+ * Generate `main` for the mutex backend: a driver loop that fires one
+ * enabled action at a time, trying them in turn from the one after the last
+ * that fired, until none is enabled
+ */
+function generateDriver(spec: LTSSpec, actions: Set<string>, gen: GenContext): string {
+  const lines: string[] = [];
+
+  lines.push(`func main() {`);
+  if (usesSlog(gen)) {
+    lines.push(`\tlogger.Info("LTS execution started")`);
+  } else {
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println("  LTS Execution Started")`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println()`);
+  }
+  lines.push(``);
+  if (gen.options.expvar !== undefined) {
+    generateExpvarServer(lines, gen);
+  }
+  if (gen.options.prometheus !== undefined) {
+    generatePrometheusServer(lines, gen);
+  }
+  if (gen.options.traceFile !== undefined) {
+    generateTraceOpen(lines, gen);
+  }
+  lines.push(`\ts := newSystem()`);
+  if (gen.options.expvar !== undefined) {
+    for (const proc of spec.processes) {
+      lines.push(`\t${metricStateName(proc.name)}.Set(s.${sanitizeGoName(proc.name)})`);
+    }
+  }
+  if (gen.options.prometheus !== undefined) {
+    for (const proc of spec.processes) {
+      lines.push(`\tpromStart("${proc.name}", s.${sanitizeGoName(proc.name)})`);
+    }
+  }
+  lines.push(`\tactions := []func() bool{`);
+  for (const action of Array.from(actions).sort()) {
+    lines.push(`\t\ts.${actionMethodName(action)},`);
+  }
+  lines.push(`\t}`);
+  lines.push(``);
+  lines.push(`\t// Try the actions in turn, starting after the last one that fired`);
+  lines.push(`\tfor next := 0; ; {`);
+  lines.push(`\t\tfired := false`);
+  lines.push(`\t\tfor i := range actions {`);
+  lines.push(`\t\t\tj := (next + i) % len(actions)`);
+  lines.push(`\t\t\tif actions[j]() {`);
+  lines.push(`\t\t\t\tnext, fired = j+1, true`);
+  lines.push(`\t\t\t\tbreak`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tif !fired {`);
+  lines.push(`\t\t\tbreak`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(``);
+  if (usesSlog(gen)) {
+    lines.push(`\tlogger.Info("no action is enabled")`);
+    lines.push(`\tlogger.Info("LTS execution complete")`);
+  } else {
+    lines.push(`\tfmt.Println()`);
+    lines.push(`\tfmt.Println("No action is enabled")`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+    lines.push(`\tfmt.Println("  LTS Execution Complete")`);
+    lines.push(`\tfmt.Println("═══════════════════════════════════════════════════════════════")`);
+  }
+  lines.push(`}`);
+
+  return lines.join('\n');
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Main Transpiler Function
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Validate generator options before any code is emitted
+ */
+function validateOptions(options: GeneratorOptions): void {
+  if (options.bufferSize !== undefined &&
+      (!Number.isInteger(options.bufferSize) || options.bufferSize < 0)) {
+    throw new Error(`bufferSize must be a non-negative integer, got ${options.bufferSize}`);
+  }
+  if (options.shutdownAfterSteps !== undefined &&
+      (!Number.isInteger(options.shutdownAfterSteps) || options.shutdownAfterSteps < 1)) {
+    throw new Error(`shutdownAfterSteps must be a positive integer, got ${options.shutdownAfterSteps}`);
+  }
+  if (options.actionTimeout !== undefined && goDuration(options.actionTimeout) === undefined) {
+    throw new Error(`actionTimeout must be a duration such as 5s or 10ms, got ${options.actionTimeout}`);
+  }
+  if (options.logger !== undefined && !LOGGER_MODES.includes(options.logger)) {
+    throw new Error(`logger must be one of ${LOGGER_MODES.join(', ')}, got ${options.logger}`);
+  }
+  if (options.package !== undefined && !/^[A-Za-z_][A-Za-z0-9_]*$/.test(options.package)) {
+    throw new Error(`package must be a Go identifier, got ${options.package}`);
+  }
+  if (options.noMain && (options.package ?? 'main') === 'main') {
+    throw new Error('noMain needs a package other than main, which must declare func main');
+  }
+  if (options.seed !== undefined && !Number.isSafeInteger(options.seed)) {
+    throw new Error(`seed must be an integer, got ${options.seed}`);
+  }
+  if (options.runFor !== undefined) {
+    if (goDuration(options.runFor) === undefined) {
+      throw new Error(`runFor must be a duration such as 2s or 50ms, got ${options.runFor}`);
+    }
+    if (!options.context) {
+      throw new Error('runFor stops the system through its context, so it needs context');
+    }
+    if (options.noMain) {
+      throw new Error('runFor bounds the generated main; with noMain the caller times Run through its context');
+    }
+  }
+  if (options.signals) {
+    if (!options.context) {
+      throw new Error('signals stops the system through its context, so it needs context');
+    }
+    if (options.noMain) {
+      throw new Error('signals installs its handler in the generated main; with noMain the caller handles signals');
+    }
+  }
+  if (options.nonblocking && options.actionTimeout !== undefined) {
+    throw new Error('nonblocking and actionTimeout both bound how long a process waits; use only one');
+  }
+  if (options.backend !== undefined && !BACKENDS.includes(options.backend)) {
+    throw new Error(`backend must be one of ${BACKENDS.join(', ')}, got ${options.backend}`);
+  }
+  if (options.backend !== undefined && options.backend !== 'channels') {
+    const unsupported = CHANNEL_ONLY_OPTIONS.filter(option => options[option] !== undefined && options[option] !== false);
+    if (unsupported.length > 0) {
+      throw new Error(`The ${options.backend} backend does not support ${unsupported.join(', ')}; only the channels backend does`);
+    }
+  }
+  if (options.backend === 'mutex' && options.intStates) {
+    throw new Error('The mutex backend keeps every state as a string field of System; drop intStates');
+  }
+  if (options.maxRestarts !== undefined) {
+    if (!Number.isInteger(options.maxRestarts) || options.maxRestarts < 0) {
+      throw new Error(`maxRestarts must be a non-negative integer, got ${options.maxRestarts}`);
+    }
+    if (!options.supervise) {
+      throw new Error('maxRestarts bounds how often a supervised process restarts, so it needs supervise');
+    }
+  }
+  if (options.traceFile !== undefined && options.traceFile === '') {
+    throw new Error('traceFile must be a file path');
+  }
+  if (options.replay !== undefined) {
+    if (options.replay === '') {
+      throw new Error('replay must be the path of a trace file');
+    }
+    if (options.seed !== undefined || options.fair) {
+      throw new Error(`replay takes every choice from the trace, so ${options.seed !== undefined ? 'seed' : 'fair'} has nothing to decide; drop it`);
+    }
+    if (options.runFor !== undefined) {
+      throw new Error('replay ends where its trace does, so runFor would only cut it short; drop it');
+    }
+  }
+  if (options.expvar !== undefined && options.noMain) {
+    throw new Error('expvar serves its metrics from the generated main; with noMain the caller serves /debug/vars');
+  }
+  if (options.prometheus !== undefined && options.noMain) {
+    throw new Error('prometheus serves its metrics from the generated main; with noMain the caller serves /metrics');
+  }
+  if (options.supervise && options.backend === 'mutex') {
+    throw new Error('The mutex backend runs no process goroutines to supervise');
+  }
+}
+
+/**
+ * Validate the action declarations of a specification
+ */
+function validateActions(actions: Record<string, ActionDeclaration>): void {
+  for (const [name, declaration] of Object.entries(actions)) {
+    if (declaration.buffer !== undefined &&
+        (!Number.isInteger(declaration.buffer) || declaration.buffer < 0)) {
+      throw new Error(`Action ${name}: buffer must be a non-negative integer, got ${declaration.buffer}`);
+    }
+    if (declaration.broadcast !== undefined && typeof declaration.broadcast !== 'boolean') {
+      throw new Error(`Action ${name}: broadcast must be true or false, got ${declaration.broadcast}`);
+    }
+    if (declaration.delay !== undefined &&
+        (typeof declaration.delay !== 'string' || goDuration(declaration.delay) === undefined)) {
+      throw new Error(`Action ${name}: delay must be a duration such as 100ms, got ${JSON.stringify(declaration.delay)}`);
+    }
+  }
+}
+
+/**
+ * Validate the weights of weighted choices: positive numbers, given on all
+ * transitions leaving a state or on none of them
+ */
+function validateWeights(spec: LTSSpec): void {
+  for (const proc of spec.processes) {
+    for (const [state, { transitions }] of buildStateMap(proc)) {
+      for (const t of transitions) {
+        if (t.weight !== undefined && (typeof t.weight !== 'number' || !Number.isFinite(t.weight) || t.weight <= 0)) {
+          throw new Error(`Process ${proc.name}: weight of ${state} -${t.action}-> ${t.toState} must be a positive number, got ${t.weight}`);
+        }
+      }
+      if (transitions.some(t => t.weight !== undefined) && transitions.some(t => t.weight === undefined)) {
+        throw new Error(`Process ${proc.name}: state ${state} gives weights to only some of its transitions`);
+      }
+    }
+  }
+}
+
+/**
+ * Generated code of a specification, section by section
+ */
+interface GeneratedSections {
+  gen: GenContext;
+  /** Package-level channels, shutdown state, timeout and logger */
+  declarations: string[];
+  processes: { proc: ProcessDefinition; code: string }[];
+  /** `main`, or `Run` in library mode */
+  entry: string;
+}
+
+/**
+ * Every section but the process functions, with the normalized spec they
+ * are generated from
+ */
+interface SharedSections extends Omit<GeneratedSections, 'processes'> {
+  spec: LTSSpec;
+}
+
+/**
+ * Shared actions that must outlive a stopped participant. Once some process
+ * can stop, a peer waiting on it would block forever, and a peer that gives
+ * up waiting may leave others blocked in turn; so every participant that
+ * returns closes the action's channel if it sends it, or its stopped channel
+ * if it receives it. The coordinator of a multiway action closes its stopped
+ * channel once any participant has returned instead, and broadcast senders
+ * close their channel on return already.
+ * ERROR only counts when the process is supervised, as otherwise onError
+ * takes the whole program down.
+ */
+function closedOnStop(spec: LTSSpec, actions: Set<string>, actionUsage: Map<string, ActionUsage>, supervised: boolean): Set<string> {
+  const stops = spec.processes.some(proc => Array.from(new Set([proc.initialState, ...getAllStates(proc)])).some(state =>
+    state === 'STOP' || (supervised && state === 'ERROR') ||
+    (state !== 'ERROR' && !proc.transitions.some(t => t.fromState === state))));
+  if (!stops) return new Set();
+  return new Set(Array.from(actions).filter(action =>
+    isSharedAction(actionUsage.get(action)!) && !spec.actions?.[action]?.broadcast));
+}
+
+/**
+ * Validate, analyze and generate the sections of the Go code for a
+ * specification that are shared between its processes
+ */
+function generateSharedSections(source: LTSSpec, options: GeneratorOptions): SharedSections {
+  // Validate input and lower indexed declarations to concrete processes
+  const spec = normalizeSpec(source);
+  validateOptions(options);
+  validateActions(spec.actions ?? {});
+  validateWeights(spec);
+  if (options.backend !== undefined && options.backend !== 'channels') {
+    validateBackendSpec(spec, options.backend);
+  }
+
+  // Analyze the specification
+  const actions = extractActions(spec);
+  const actionUsage = analyzeActionUsage(spec);
+  const stopping = (options.backend ?? 'channels') === 'channels' ? closedOnStop(spec, actions, actionUsage, options.supervise === true) : new Set<string>();
+  const multiway = (action: string) => actionUsage.get(action)!.processes.size > 2;
+  const gen: GenContext = {
+    actionUsage,
+    actions: spec.actions ?? {},
+    options,
+    priority: spec.composition?.priority,
+    closedOnStop: new Set(Array.from(stopping).filter(action => !multiway(action))),
+    stoppedMultiway: new Set(Array.from(stopping).filter(multiway)),
+    weighted: spec.processes.some(proc => choiceStates(proc).some(([, info]) => isWeighted(info.transitions))),
+    actorChoosers: new Set(options.backend === 'actor'
+      ? spec.processes.filter(proc => actorChooses(proc, actionUsage)).map(proc => proc.name)
+      : []),
+  };
+
+  // Sanitizing can map distinct actions (`lib1.put`, `lib1_put`) to one identifier
+  const channels = new Map<string, string>();
+  for (const action of sharedActionsOf(actions, gen)) {
+    const channel = channelName(action);
+    if (channels.has(channel)) {
+      throw new Error(`Actions ${channels.get(channel)} and ${action} would both use the Go channel ${channel}; rename one of them`);
+    }
+    channels.set(channel, action);
+  }
+
+  // Likewise `A.1` and `A_1`, or process `P_Q` state `R` and process `P` state `Q_R`
+  if (options.intStates) {
+    const constants = new Map<string, string>();
+    for (const proc of spec.processes) {
+      for (const state of new Set([proc.initialState, ...getAllStates(proc)])) {
+        const constant = stateName(proc.name, state, gen);
+        if (constants.has(constant)) {
+          throw new Error(`${constants.get(constant)} and state ${state} of ${proc.name} would both use the Go constant ${constant}; rename one of them`);
+        }
+        constants.set(constant, `State ${state} of ${proc.name}`);
+      }
+    }
+  }
+
+  const declarations: string[] = [];
+  if (options.backend === 'actor') {
+    declarations.push(generateActorDeclarations(spec, gen));
+  } else if (options.backend === 'mutex') {
+    declarations.push(generateSystemDeclarations(spec, actions, gen));
+  } else {
+    declarations.push(generateChannelDeclarations(actions, gen));
+  }
+  if (usesSlog(gen)) {
+    declarations.push(generateLoggerDeclaration());
+  }
+  if (options.shutdownAfterSteps !== undefined) {
+    declarations.push(generateShutdownDeclarations(spec, gen));
+  }
+  if (options.actionTimeout !== undefined) {
+    declarations.push(generateTimeoutDeclaration(gen));
+  }
+  if (options.runFor !== undefined) {
+    declarations.push(generateRunForDeclaration(gen));
+  }
+  if (options.nonblocking) {
+    declarations.push(generateNonblockingDeclarations());
+  }
+  if (options.counters) {
+    declarations.push(generateCounterDeclarations(actions));
+  }
+  if (options.expvar !== undefined) {
+    declarations.push(generateExpvarDeclarations(spec, actions));
+  }
+  if (options.prometheus !== undefined) {
+    declarations.push(generatePrometheusDeclarations(spec));
+  }
+  if (options.hooks) {
+    declarations.push(generateObserverDeclaration());
+  }
+  if (options.traceFile !== undefined || options.replay !== undefined) {
+    declarations.push(generateTraceEntryType());
+  }
+  if (options.traceFile !== undefined) {
+    declarations.push(generateTraceDeclarations(gen));
+  }
+  if (options.replay !== undefined) {
+    declarations.push(generateReplayDeclarations(gen));
+  }
+  if (broadcastActions(gen).length > 0) {
+    declarations.push(generateBroadcastDeclarations(gen));
+  }
+  if (multiwayActions(gen).length > 0) {
+    declarations.push(generateMultiwayDeclarations(gen));
+  }
+  if (gen.options.seed !== undefined || gen.weighted) {
+    declarations.push(generateSeedDeclarations(gen));
+  }
+  if (gen.options.fair) {
+    declarations.push(generateFairDeclaration());
+  }
+  if (spec.processes.some(proc => proc.initialState === 'ERROR' || getAllStates(proc).has('ERROR'))) {
+    declarations.push(generateErrorHook());
+  }
+  if (options.supervise) {
+    declarations.push(generateSupervisorDeclarations(gen));
+  }
+  if (spec.processes.some(proc => offersLocalChoice(proc, gen))) {
+    declarations.push(generateAlwaysDeclaration());
+  }
+
+  return {
+    spec,
+    gen,
+    declarations,
+    entry: options.noMain ? generateRun(spec, actions, gen)
+      : options.backend === 'mutex' ? generateDriver(spec, actions, gen)
+      : generateMain(spec, gen),
+  };
+}
+
+/**
+ * Processes that get a function of their own: all of them, except under the
+ * mutex backend, whose driver steps every process itself
+ */
+function functionProcesses(spec: LTSSpec, gen: GenContext): ProcessDefinition[] {
+  return gen.options.backend === 'mutex' ? [] : spec.processes;
+}
+
+/**
+ * Validate, analyze and generate every section of the Go code for a specification
+ */
+function generateSections(source: LTSSpec, options: GeneratorOptions): GeneratedSections {
+  const { spec, ...shared } = generateSharedSections(source, options);
+  return { ...shared, processes: functionProcesses(spec, shared.gen).map(proc => ({ proc, code: generateProcessFunction(proc, shared.gen) })) };
+}
+
+/**
+ * Join the sections of the Go code into a single file
+ */
+function assembleFile({ gen, declarations, processes, entry }: GeneratedSections): string {
+  const imports = [...declarationImports(gen), ...processImports(gen), ...entryImports(gen)];
+
+  return [
+    generateHeader(gen, imports),
+    ...declarations,
+    ...processes.map(p => p.code),
+    entry,
+  ].join('\n') + '\n';
+}
+
+/**
+ * Transpile an LTS specification to Go source code
+ * @param spec The LTS specification to transpile
+ * @param options Generator options (defaults produce unbuffered channels)
+ * @returns A string containing valid, executable Go source code
+ */
+export function transpile(source: LTSSpec, options: GeneratorOptions = {}): string {
+  return assembleFile(generateSections(source, options));
+}
+
+/**
+ * Split the sections of the Go code into one file per process, plus the
+ * shared declarations and the entry point
+ */
+function assembleFiles({ gen, declarations, processes, entry }: GeneratedSections): Map<string, string> {
+  if (gen.options.backend === 'mutex') {
+    throw new Error('The mutex backend generates no process functions to split into files');
+  }
+  const files = new Map<string, string>();
+  const owners = new Map<string, string>();
+
+  const addFile = (name: string, owner: string, imports: string[], parts: string[]) => {
+    if (owners.has(name)) {
+      throw new Error(`${owner} and ${owners.get(name)} would both be written to ${name}`);
+    }
+    owners.set(name, owner);
+    files.set(name, generateHeader(gen, imports) + parts.join('\n'));
+  };
+
+  const nonEmpty = declarations.filter(d => d.length > 0);
+  if (nonEmpty.length > 0) {
+    addFile('channels.go', 'the shared declarations', declarationImports(gen), nonEmpty);
+  }
+  addFile(gen.options.noMain ? 'run.go' : 'main.go', 'the entry point', entryImports(gen), [entry + '\n']);
+  for (const { proc, code } of processes) {
+    addFile(`${sanitizeGoName(proc.name).toLowerCase()}.go`, `Process ${proc.name}`, processImports(gen, proc), [code]);
+  }
+
+  return files;
+}
+
+/**
+ * Transpile an LTS specification to one Go file per process. Package-level
+ * declarations, including every `ch_*` channel, go to `channels.go`, and the
+ * entry point to `main.go` (`run.go` in library mode).
+ * @param spec The LTS specification to transpile
+ * @param options Generator options
+ * @returns File contents keyed by file name: shared files first, then one per process
+ */
+export function transpileFiles(source: LTSSpec, options: GeneratorOptions = {}): Map<string, string> {
+  return assembleFiles(generateSections(source, options));
+}
+
+/**
+ * Transpile from flat transition format
+ * @param transitions Array of flat transitions
+ * @param options Generator options
+ * @returns A string containing valid, executable Go source code
+ */
+export function transpileFlat(transitions: FlatTransition[], options: GeneratorOptions = {}): string {
+  const spec = flatToSpec(transitions);
+  return transpile(spec, options);
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Parallel Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Marks a worker thread started to generate process functions
+ */
+const GENERATOR_WORKER = 'anvilts-generator';
+
+/**
+ * A process function generated by a worker, or the error it raised
+ */
+interface WorkerReply {
+  index: number;
+  code?: string;
+  error?: string;
+}
+
+/**
+ * Generate the function of every process on a pool of worker threads. Each
+ * worker is handed the next process as soon as it is done with the last one.
+ * @returns The functions in the order of the processes
+ */
+function generateInWorkers(processes: ProcessDefinition[], gen: GenContext, workers: number): Promise<string[]> {
+  const codes: string[] = new Array(processes.length);
+  let next = 0;
+  let idle = 0;
+
+  return new Promise((resolve, reject) => {
+    const pool = Array.from({ length: workers }, () =>
+      new Worker(__filename, { workerData: { role: GENERATOR_WORKER, gen } }));
+    const fail = (err: Error) => {
+      for (const worker of pool) worker.terminate();
+      reject(err);
+    };
+    const feed = (worker: Worker) => {
+      if (next < processes.length) {
+        worker.postMessage({ index: next, proc: processes[next] });
+        next++;
+        return;
+      }
+      worker.terminate();
+      if (++idle === pool.length) resolve(codes);
+    };
+
+    for (const worker of pool) {
+      worker.on('message', (reply: WorkerReply) => {
+        if (reply.error !== undefined) {
+          fail(new Error(reply.error));
+          return;
+        }
+        codes[reply.index] = reply.code!;
+        feed(worker);
+      });
+      worker.on('error', fail);
+      feed(worker);
+    }
+  });
+}
+
+/**
+ * Generate every section of the Go code, with the process functions spread
+ * over up to `workers` threads. One worker, or a single process, generates
+ * on the calling thread instead.
+ */
+async function generateSectionsParallel(source: LTSSpec, options: GeneratorOptions, workers: number): Promise<GeneratedSections> {
+  if (!Number.isInteger(workers) || workers < 1) {
+    throw new Error(`workers must be a positive integer, got ${workers}`);
+  }
+  const { spec, ...shared } = generateSharedSections(source, options);
+  const processes = functionProcesses(spec, shared.gen);
+  const pool = Math.min(workers, processes.length);
+  const codes = pool > 1
+    ? await generateInWorkers(processes, shared.gen, pool)
+    : processes.map(proc => generateProcessFunction(proc, shared.gen));
+  return { ...shared, processes: processes.map((proc, i) => ({ proc, code: codes[i] })) };
+}
+
+/**
+ * Transpile an LTS specification to Go source code, generating the process
+ * functions concurrently. The output is byte for byte that of `transpile`,
+ * whatever the number of workers.
+ * @param spec The LTS specification to transpile
+ * @param options Generator options
+ * @param workers Size of the worker pool (default: the available parallelism)
+ */
+export async function transpileParallel(
+  source: LTSSpec,
+  options: GeneratorOptions = {},
+  workers = availableParallelism()
+): Promise<string> {
+  return assembleFile(await generateSectionsParallel(source, options, workers));
+}
+
+/**
+ * Transpile an LTS specification to one Go file per process, generating the
+ * process functions concurrently. The files are those of `transpileFiles`.
+ */
+export async function transpileFilesParallel(
+  source: LTSSpec,
+  options: GeneratorOptions = {},
+  workers = availableParallelism()
+): Promise<Map<string, string>> {
+  return assembleFiles(await generateSectionsParallel(source, options, workers));
+}
+
+// A worker generates the functions of the processes it is sent, one at a time
+if (!isMainThread && workerData?.role === GENERATOR_WORKER) {
+  const gen: GenContext = workerData.gen;
+  parentPort!.on('message', ({ index, proc }: { index: number; proc: ProcessDefinition }) => {
+    try {
+      parentPort!.postMessage({ index, code: generateProcessFunction(proc, gen) });
+    } catch (err) {
+      parentPort!.postMessage({ index, error: err instanceof Error ? err.message : String(err) });
+    }
+  });
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Test Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * How often a test lets a cyclic process come back to the same state
+ */
+const TEST_ITERATIONS = 3;
+
+/**
+ * Follow a process through the run it makes when a test is its only peer
+ * and offers it one action at a time. Where the process offers a choice of
+ * channel operations the test takes the first transition, as it can offer
+ * that one alone; a choice that involves a local action (or a send into a
+ * buffer) is the process's own, so the run stops there. A cyclic process is
+ * followed until it is about to enter some state for the
+ * `TEST_ITERATIONS + 1`th time.
+ * @returns The transitions the process is expected to fire, in order
+ */
+function expectedRun(proc: ProcessDefinition, gen: GenContext): Transition[] {
+  const stateMap = buildStateMap(proc);
+  const maxSteps = gen.options.shutdownAfterSteps;
+  const env: Environment = {};
+  for (const [name, value] of Object.entries(proc.variables ?? {})) {
+    env[name] = evaluateExpression(value, {});
+  }
+
+  // A send into a buffered channel is ready without the test, like a local action
+  const waits = (t: Transition) => {
+    const kind = actionKind(gen.actionUsage, proc.name, t.action);
+    return kind === 'receive' || (kind === 'send' && (bufferOf(t.action, gen) === 0 || isMultiway(t.action, gen)));
+  };
+
+  const steps: Transition[] = [];
+  const visits = new Map<string, number>();
+  let state = proc.initialState;
+
+  while (maxSteps === undefined || steps.length < maxSteps) {
+    const transitions = stateMap.get(state)?.transitions ?? [];
+    if (state === 'STOP' || state === 'ERROR') break;
+
+    const key = `${state}|${JSON.stringify(env)}`;
+    const count = (visits.get(key) ?? 0) + 1;
+    if (count > TEST_ITERATIONS) break;
+    visits.set(key, count);
+
+    const enabled = transitions.filter(t => t.guard === undefined || evaluateExpression(t.guard, env) !== 0);
+    if (enabled.length === 0) break;
+    if (enabled.length > 1 && !enabled.every(waits)) break;
+
+    const next = enabled[0];
+    const updated = { ...env };
+    for (const [name, value] of Object.entries(next.update ?? {})) {
+      updated[name] = evaluateExpression(value, env);
+    }
+    Object.assign(env, updated);
+    steps.push(next);
+    state = next.toState;
+  }
+
+  return steps;
+}
+
+/**
+ * Go statements the test runs to play the peers' side of a transition
+ */
+function peerOp(proc: ProcessDefinition, t: Transition, gen: GenContext): string[] {
+  // Stand in for a broadcast's dispatcher: take what the sender broadcasts, deliver to the receiver
+  const channel = transitionChannel(proc, t, gen);
+  const sends = actionKind(gen.actionUsage, proc.name, t.action) === 'send';
+  const payload = gen.actions[t.action]?.payload;
+  if (isMultiway(t.action, gen)) {
+    // Play the coordinator: take the offer, lock the process in and fire the round
+    const ops = ['<-multiwayOffers', `${lockChannelName(t.action, proc.name)} <- struct{}{}`, `${releaseChannelName(t.action, proc.name)} <- true`];
+    if (payload) {
+      const others = gen.actionUsage.get(t.action)!.processes.size - 1;
+      ops.push(...(sends ? Array(others).fill(`<-${channel}`) : [`${channel} <- *new(${payload})`]));
+    }
+    return ops;
+  }
+  const ops = actionKind(gen.actionUsage, proc.name, t.action) === 'internal' ? []
+    : [sends ? `<-${channel}` : `${channel} <- ${payload ? `*new(${payload})` : 'struct{}{}'}`];
+  // Take the offer of the state's multiway actions, and its withdrawal
+  return offersMultiway(proc, t.fromState, gen) ? ['<-multiwayOffers', ...ops, '<-multiwayOffers'] : ops;
+}
+
+/**
+ * Generate the helpers every process test uses
+ */
+function generateTestHelpers(spec: LTSSpec, actions: Set<string>, gen: GenContext): string {
+  const lines: string[] = [];
+  // slog.Default() goes through the log package, which prefixes a timestamp
+  const pattern = usesSlog(gen)
+    ? String.raw` INFO action process=(\S+) action=(\S+) from=(\S+) to=(\S+)`
+    : String.raw`^\[([^\]]+)\] (?:action|tau): ([^ (]+)(?:\(.*\))? \((\S+) -> (\S+)\)$`;
+
+  lines.push(`// eventPattern matches the line a process logs when it fires a transition`);
+  lines.push(`var eventPattern = regexp.MustCompile(\`${pattern}\`)`);
+  lines.push(``);
+  lines.push(`// childEnv is set in the copy of the test binary that hosts a process`);
+  lines.push(`const childEnv = "LTS_TEST_PROCESS"`);
+  lines.push(``);
+  lines.push(`// runProcess starts a process, plays its peers' side of every synchronization`);
+  lines.push(`// through drive, and returns the first n transitions the process logs, each`);
+  lines.push(`// as "action FROM->TO". The process runs in a fresh copy of the test binary:`);
+  lines.push(`// left blocked in this one, it would wait on the same channels as every`);
+  lines.push(`// later test.`);
+  lines.push(`func runProcess(t *testing.T, process string, start func(*sync.WaitGroup), drive func(), n int) []string {`);
+  lines.push(`\tt.Helper()`);
+  lines.push(`\tif os.Getenv(childEnv) != "" {`);
+  if (gen.options.noMain) {
+    for (const action of sharedActionsOf(actions, gen)) {
+      for (const [channel, make] of actionChannels(action, gen)) {
+        lines.push(`\t\t${channel} = ${make}`);
+      }
+    }
+    if (gen.options.shutdownAfterSteps !== undefined) {
+      for (const proc of spec.processes) {
+        lines.push(`\t\t${doneChannelName(proc.name)} = make(chan struct{})`);
+      }
+      for (const action of broadcastActions(gen)) {
+        for (const receiver of receiversOf(action, gen)) {
+          lines.push(`\t\t${drainedChannelName(action, receiver)} = make(chan struct{})`);
+        }
+      }
+    }
+  }
+  if (spec.processes.some(proc => proc.initialState === 'ERROR' || getAllStates(proc).has('ERROR'))) {
+    // Entering ERROR is an expected step here, not a failure
+    lines.push(`\t\tonError = func(string) {}`);
+  }
+  lines.push(`\t\tvar wg sync.WaitGroup`);
+  lines.push(`\t\twg.Add(1)`);
+  lines.push(`\t\tstart(&wg)`);
+  lines.push(`\t\tdrive()`);
+  lines.push(`\t\twg.Wait()`);
+  lines.push(`\t\tos.Exit(0)`);
+  lines.push(`\t}`);
+  lines.push(``);
+  lines.push(`\tr, w, err := os.Pipe()`);
+  lines.push(`\tif err != nil {`);
+  lines.push(`\t\tt.Fatal(err)`);
+  lines.push(`\t}`);
+  lines.push(`\tdefer r.Close()`);
+  lines.push(`\tcmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")`);
+  lines.push(`\tcmd.Env = append(os.Environ(), childEnv+"=1")`);
+  lines.push(`\tcmd.Stdout = w`);
+  lines.push(`\tcmd.Stderr = w`);
+  lines.push(`\terr = cmd.Start()`);
+  lines.push(`\tw.Close()`);
+  lines.push(`\tif err != nil {`);
+  lines.push(`\t\tt.Fatal(err)`);
+  lines.push(`\t}`);
+  lines.push(`\tdefer func() {`);
+  lines.push(`\t\tcmd.Process.Kill()`);
+  lines.push(`\t\tcmd.Wait()`);
+  lines.push(`\t}()`);
+  lines.push(``);
+  lines.push(`\tevents := make(chan string)`);
+  lines.push(`\tdone := make(chan struct{})`);
+  lines.push(`\tdefer close(done)`);
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\tdefer close(events)`);
+  lines.push(`\t\tscanner := bufio.NewScanner(r)`);
+  lines.push(`\t\tfor scanner.Scan() {`);
+  lines.push(`\t\t\tm := eventPattern.FindStringSubmatch(scanner.Text())`);
+  lines.push(`\t\t\tif m == nil || m[1] != process {`);
+  lines.push(`\t\t\t\tcontinue`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t\tselect {`);
+  lines.push(`\t\t\tcase events <- m[2] + " " + m[3] + "->" + m[4]:`);
+  lines.push(`\t\t\tcase <-done:`);
+  lines.push(`\t\t\t\treturn`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}()`);
+  lines.push(``);
+  lines.push(`\tvar got []string`);
+  lines.push(`\ttimeout := time.After(5 * time.Second)`);
+  lines.push(`\tfor len(got) < n {`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase event, ok := <-events:`);
+  lines.push(`\t\t\tif !ok {`);
+  lines.push(`\t\t\t\tt.Fatalf("%s stopped after %d of %d expected transitions: %v", process, len(got), n, got)`);
+  lines.push(`\t\t\t}`);
+  lines.push(`\t\t\tgot = append(got, event)`);
+  lines.push(`\t\tcase <-timeout:`);
+  lines.push(`\t\t\tt.Fatalf("%s timed out after %d of %d expected transitions: %v", process, len(got), n, got)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\treturn got`);
+  lines.push(`}`);
+  lines.push(``);
+  lines.push(`// assertEvents fails the test at the first transition that differs from want`);
+  lines.push(`func assertEvents(t *testing.T, got, want []string) {`);
+  lines.push(`\tt.Helper()`);
+  lines.push(`\tfor i := range want {`);
+  lines.push(`\t\tif got[i] != want[i] {`);
+  lines.push(`\t\t\tt.Fatalf("transition %d: got %q, want %q\\ngot:  %v\\nwant: %v", i+1, got[i], want[i], got, want)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate the test of one process: the test stands in for all of its peers,
+ * drives it along its expected run and checks the transitions it logs
+ */
+function generateProcessTest(proc: ProcessDefinition, gen: GenContext): string {
+  const lines: string[] = [];
+  const fName = funcName(proc.name);
+  const steps = expectedRun(proc, gen);
+
+  lines.push(`// Test${fName} drives ${proc.name} through ${steps.length} transition(s)`);
+  lines.push(`func Test${fName}(t *testing.T) {`);
+  const args = gen.options.context ? 'context.Background(), wg' : 'wg';
+  lines.push(`\tgot := runProcess(t, "${proc.name}", func(wg *sync.WaitGroup) {`);
+  lines.push(`\t\tgo ${fName}(${args})`);
+  const ops = steps.flatMap(t => peerOp(proc, t, gen));
+  if (ops.length === 0) {
+    lines.push(`\t}, func() {}, ${steps.length})`);
+  } else {
+    lines.push(`\t}, func() {`);
+    for (const op of ops) {
+      lines.push(`\t\t${op}`);
+    }
+    lines.push(`\t}, ${steps.length})`);
+  }
+
+  if (steps.length === 0) {
+    lines.push(`\tassertEvents(t, got, nil)`);
+  } else {
+    lines.push(`\tassertEvents(t, got, []string{`);
+    for (const t of steps) {
+      lines.push(`\t\t"${t.action} ${t.fromState}->${t.toState}",`);
+    }
+    lines.push(`\t})`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate a Go test file for the code `transpile` emits with the same
+ * options. Each process gets a test that runs it alone, with the test
+ * playing its peers' side of every channel, and checks that it logs its
+ * transitions in the expected order.
+ * @param spec The LTS specification the code was generated from
+ * @param options The generator options the code was generated with
+ * @returns The contents of a `_test.go` file in the generated package
+ */
+export function transpileTests(source: LTSSpec, options: GeneratorOptions = {}): string {
+  if (options.backend !== undefined && options.backend !== 'channels') {
+    throw new Error(`The tests drive processes through their channels, which the ${options.backend} backend does not have`);
+  }
+  const { gen } = generateSections(source, options);
+  const spec = normalizeSpec(source);
+  const actions = extractActions(spec);
+
+  const imports = ['"bufio"', '"os"', '"os/exec"', '"regexp"', '"sync"', '"testing"', '"time"'];
+  if (gen.options.context) imports.push('"context"');
+
+  return generateHeader(gen, imports) + [
+    generateTestHelpers(spec, actions, gen),
+    ...spec.processes.map(proc => generateProcessTest(proc, gen)),
+  ].join('\n');
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Benchmark Generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Wrap text into Go line comments
+ */
+function wrapComment(text: string, width = 76): string[] {
+  const lines: string[] = [];
+  let line = '';
+  for (const word of text.split(' ')) {
+    if (line && line.length + word.length + 1 > width) {
+      lines.push(`// ${line}`);
+      line = word;
+    } else {
+      line = line ? `${line} ${word}` : word;
+    }
+  }
+  if (line) lines.push(`// ${line}`);
+  return lines;
+}
+
+/**
+ * Generate the helpers the system benchmark uses between runs
+ */
+function generateBenchHelpers(actions: Set<string>, gen: GenContext): string {
+  const lines: string[] = [];
+
+  lines.push(`// quietBench discards the processes' output for the rest of the benchmark`);
+  lines.push(`func quietBench(b *testing.B) {`);
+  if (usesSlog(gen)) {
+    lines.push(`\tprevious := logger`);
+    lines.push(`\tlogger = slog.New(slog.NewTextHandler(io.Discard, nil))`);
+    lines.push(`\tb.Cleanup(func() { logger = previous })`);
+  } else {
+    lines.push(`\tdevNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)`);
+    lines.push(`\tif err != nil {`);
+    lines.push(`\t\tb.Fatal(err)`);
+    lines.push(`\t}`);
+    lines.push(`\tstdout := os.Stdout`);
+    lines.push(`\tos.Stdout = devNull`);
+    lines.push(`\tb.Cleanup(func() {`);
+    lines.push(`\t\tos.Stdout = stdout`);
+    lines.push(`\t\tdevNull.Close()`);
+    lines.push(`\t})`);
+  }
+  lines.push(`}`);
+  lines.push(``);
+  // The comment only describes what this spec's reset does
+  const shared = sharedActionsOf(actions, gen);
+  const comment = ['resetBench readies the system for a fresh run.'];
+  if (shared.some(action => bufferOf(action, gen) > 0 && !isBroadcast(action, gen) && !gen.closedOnStop.has(action))) {
+    comment.push('The channels of the last run are reused: every process has returned, so only buffered items are left in them, and those are drained.');
+  } else {
+    comment.push('Every process has returned, so the channels of the last run are empty and reused as they are.');
+  }
+  if (shared.some(action => isBroadcast(action, gen))) {
+    comment.push('Broadcast channels were closed by their senders, so they are made afresh with new dispatchers.');
+  }
+  if (shared.some(action => (gen.closedOnStop.has(action) && !isBroadcast(action, gen)) || gen.stoppedMultiway.has(action))) {
+    comment.push('The channels that processes close when they stop are made afresh.');
+  }
+  comment.push('The action counts start again from zero.');
+  lines.push(...wrapComment(comment.join(' ')));
+  lines.push(`func resetBench() {`);
+  for (const action of shared) {
+    const channel = channelName(action);
+    if (isBroadcast(action, gen)) {
+      for (const [name, make] of actionChannels(action, gen)) {
+        lines.push(`\t${name} = ${make}`);
+      }
+      continue;
+    }
+    if (gen.closedOnStop.has(action)) {
+      for (const [name, make] of actionChannels(action, gen)) {
+        lines.push(`\t${name} = ${make}`);
+      }
+      lines.push(`\t${closeOnceName(action)} = sync.Once{}`);
+      lines.push(`\t${stoppedChannelName(action)} = make(chan struct{})`);
+      lines.push(`\t${stopOnceName(action)} = sync.Once{}`);
+      continue;
+    }
+    if (gen.stoppedMultiway.has(action)) {
+      lines.push(`\t${stoppedChannelName(action)} = make(chan struct{})`);
+    }
+    if (gen.options.noMain) {
+      for (const [name, make] of actionChannels(action, gen)) {
+        lines.push(`\tif ${name} == nil {`);
+        lines.push(`\t\t${name} = ${make}`);
+        lines.push(`\t}`);
+      }
+    }
+    if (bufferOf(action, gen) > 0) {
+      lines.push(`\tfor len(${channel}) > 0 {`);
+      lines.push(`\t\t<-${channel}`);
+      lines.push(`\t}`);
+    }
+  }
+  if (broadcastActions(gen).length > 0) {
+    lines.push(`\tstartBroadcasts()`);
+  }
+  lines.push(`\tfor _, n := range actionCounts {`);
+  lines.push(`\t\tn.Store(0)`);
+  lines.push(`\t}`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return lines.join('\n');
+}
+
+/**
+ * Generate a Go benchmark for the code `transpile` emits with the same
+ * options. `Benchmark<System>` runs the composed system for `b.N` full
+ * cycles, a cycle being a shortest run that returns every process to its
+ * initial state. Cycles are counted through the action counters, by an
+ * action that every cycle fires (the one it fires the fewest times), and
+ * the system is stopped through its context. The processes are started once per run, so
+ * the measurement covers synchronization and logging rather than goroutine
+ * startup.
+ * @param spec The LTS specification the code was generated from
+ * @param options The generator options the code was generated with; the
+ *                benchmark needs `context` and `counters`
+ * @returns The contents of a `_test.go` file in the generated package
+ */
+export function transpileBench(source: LTSSpec, options: GeneratorOptions = {}): string {
+  if (!options.context || !options.counters) {
+    throw new Error('The benchmark needs code generated with context and counters');
+  }
+  if (options.shutdownAfterSteps !== undefined) {
+    throw new Error('The benchmark cannot run code that shuts down after a fixed number of steps');
+  }
+
+  const { gen } = generateSections(source, options);
+  const spec = normalizeSpec(source);
+  const actions = extractActions(spec);
+  const system = sanitizeGoName(spec.composition?.name ?? 'System');
+
+  const imports = ['"context"', '"sync"', '"testing"', '"time"'];
+  imports.push(...(usesSlog(gen) ? ['"io"', '"log/slog"'] : ['"os"']));
+
+  const lines: string[] = [];
+  const cycle = shortestCycle(spec);
+  if (cycle === null) {
+    lines.push(`// Benchmark${system} would run ${system} through full cycles, but it never`);
+    lines.push(`// returns to its initial state`);
+    lines.push(`func Benchmark${system}(b *testing.B) {`);
+    lines.push(`\tb.Skip("${system} never returns to its initial state")`);
+    lines.push(`}`);
+    lines.push(``);
+    return generateHeader(gen, ['"testing"']) + lines.join('\n');
+  }
+
+  // Count cycles by an action every cycle fires, the one it fires least often
+  const firings = new Map<string, number>();
+  for (const action of cycle.trace) firings.set(action, (firings.get(action) ?? 0) + 1);
+  const candidates = cycle.unavoidable.length > 0 ? cycle.unavoidable : Array.from(firings.keys());
+  const [marker] = candidates.sort((a, b) => firings.get(a)! - firings.get(b)! || a.localeCompare(b));
+  const perCycle = firings.get(marker)!;
+  const count = `actionCounts["${marker}"].Load()`;
+  const cycles = (n: string) => perCycle === 1 ? n : `${n}/${perCycle}`;
+
+  lines.push(`// Benchmark${system} runs ${system} through b.N full cycles. A cycle takes`);
+  lines.push(`// ${cycle.trace.length} step(s) back to the initial state and fires ${marker} ${perCycle} time(s), so`);
+  lines.push(`// cycles are counted by counting ${marker}.`);
+  lines.push(`func Benchmark${system}(b *testing.B) {`);
+  lines.push(`\tquietBench(b)`);
+  lines.push(`\tresetBench()`);
+  lines.push(``);
+  lines.push(`\tctx, cancel := context.WithCancel(context.Background())`);
+  lines.push(`\tvar wg sync.WaitGroup`);
+  lines.push(`\tfinished := make(chan struct{})`);
+  lines.push(`\tdefer func() {`);
+  lines.push(`\t\tcancel()`);
+  lines.push(`\t\t<-finished`);
+  lines.push(`\t}()`);
+  lines.push(`\ttarget := int64(b.N)${perCycle === 1 ? '' : ` * ${perCycle}`}`);
+  lines.push(``);
+  lines.push(`\tb.ResetTimer()`);
+  lines.push(`\twg.Add(${spec.processes.length})`);
+  for (const proc of spec.processes) {
+    lines.push(`\tgo ${funcName(proc.name)}(${processArgs(gen)})`);
+  }
+  if (multiwayActions(gen).length > 0) {
+    lines.push(`\tstopMultiway := make(chan struct{})`);
+    lines.push(`\tgo coordinateMultiway(stopMultiway)`);
+  }
+  lines.push(`\tgo func() {`);
+  lines.push(`\t\twg.Wait()`);
+  generateMultiwayStop(lines, '\t\t', gen);
+  lines.push(`\t\tclose(finished)`);
+  lines.push(`\t}()`);
+  lines.push(``);
+  lines.push(`\t// A system that can deadlock may stop making progress before the target`);
+  lines.push(`\tticker := time.NewTicker(10 * time.Microsecond)`);
+  lines.push(`\tdefer ticker.Stop()`);
+  lines.push(`\tlast, stalled := int64(-1), time.Now()`);
+  lines.push(`\tfor n := ${count}; n < target; n = ${count} {`);
+  lines.push(`\t\tif n != last {`);
+  lines.push(`\t\t\tlast, stalled = n, time.Now()`);
+  lines.push(`\t\t} else if time.Since(stalled) > time.Second {`);
+  lines.push(`\t\t\tb.Fatalf("${system} made no progress for a second after %d of %d cycles", ${cycles('n')}, b.N)`);
+  lines.push(`\t\t}`);
+  lines.push(`\t\tselect {`);
+  lines.push(`\t\tcase <-finished:`);
+  lines.push(`\t\t\tb.Fatalf("${system} stopped after %d of %d cycles", ${cycles(count)}, b.N)`);
+  lines.push(`\t\tcase <-ticker.C:`);
+  lines.push(`\t\t}`);
+  lines.push(`\t}`);
+  lines.push(`\tb.StopTimer()`);
+  lines.push(`}`);
+  lines.push(``);
+
+  return generateHeader(gen, imports) + [generateBenchHelpers(actions, gen), lines.join('\n')].join('\n');
 }
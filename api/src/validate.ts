@@ -0,0 +1,313 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// LTS Validation
+// Static checks over individual processes that point out likely mistakes
+// in a specification without rejecting it
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, getAllStates } from './transpiler';
+import { coversAction, normalizeSpec } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A problem found in a specification
+ */
+export interface Diagnostic {
+  severity: 'warning' | 'error';
+  process?: string;
+  message: string;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Checks
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Find the states of a process that cannot be entered from its initial state
+ * @returns Unreachable state names, sorted
+ */
+export function unreachableStates(proc: ProcessDefinition): string[] {
+  const reached = new Set<string>([proc.initialState]);
+  const queue = [proc.initialState];
+
+  for (let i = 0; i < queue.length; i++) {
+    for (const t of proc.transitions) {
+      if (t.fromState === queue[i] && !reached.has(t.toState)) {
+        reached.add(t.toState);
+        queue.push(t.toState);
+      }
+    }
+  }
+
+  return Array.from(getAllStates(proc)).filter(s => !reached.has(s)).sort();
+}
+
+/**
+ * Find nondeterministic transitions: two or more transitions that leave the
+ * same state on the same action for different targets. Guarded transitions
+ * are left out, as their guards may well exclude each other.
+ * @returns Every transition of each such (state, action) group, in declaration order
+ */
+export function nondeterministicTransitions(proc: ProcessDefinition): Transition[] {
+  const groups = new Map<string, Transition[]>();
+  for (const t of proc.transitions) {
+    if (t.guard !== undefined) continue;
+    const key = JSON.stringify([t.fromState, t.action]);
+    if (!groups.has(key)) groups.set(key, []);
+    groups.get(key)!.push(t);
+  }
+
+  const found = new Set<Transition>();
+  for (const group of groups.values()) {
+    if (new Set(group.map(t => t.toState)).size > 1) {
+      for (const t of group) found.add(t);
+    }
+  }
+  return proc.transitions.filter(t => found.has(t));
+}
+
+/**
+ * Find duplicate transitions: two or more that agree on source, action and
+ * target, and on everything else they declare
+ * @returns Each group of identical transitions, in declaration order
+ */
+export function duplicateTransitions(proc: ProcessDefinition): Transition[][] {
+  const groups = new Map<string, Transition[]>();
+  for (const t of proc.transitions) {
+    const key = JSON.stringify([t.fromState, t.action, t.toState, t.guard, t.update, t.variable, t.hidden ?? false]);
+    if (!groups.has(key)) groups.set(key, []);
+    groups.get(key)!.push(t);
+  }
+  return Array.from(groups.values()).filter(group => group.length > 1);
+}
+
+/**
+ * Where a group of transitions was declared, when the input recorded it
+ */
+function declaredAt(transitions: Transition[]): string {
+  const lines = Array.from(new Set(transitions.flatMap(t => t.line === undefined ? [] : [t.line]))).sort((a, b) => a - b);
+  if (lines.length === 0) return '';
+  return lines.length === 1 ? ` (line ${lines[0]})` : ` (lines ${lines.join(', ')})`;
+}
+
+/**
+ * Terminal states that end a process wherever they appear
+ */
+const TERMINAL_STATES = ['STOP', 'ERROR'];
+
+/**
+ * Symbol table of a specification: the states each process defines, that
+ * is those with outgoing transitions plus the terminal STOP and ERROR
+ */
+export function definedStates(spec: LTSSpec): Map<string, Set<string>> {
+  return new Map(spec.processes.map(proc =>
+    [proc.name, new Set([...TERMINAL_STATES, ...proc.transitions.map(t => t.fromState)])]));
+}
+
+/**
+ * Find the transitions of a process that lead to a state it never defines,
+ * usually a misspelt name that would otherwise end the process silently
+ * @returns The transitions grouped by target, in declaration order
+ */
+export function undefinedTargets(proc: ProcessDefinition, defined: Set<string>): Map<string, Transition[]> {
+  const targets = new Map<string, Transition[]>();
+  for (const t of proc.transitions) {
+    if (defined.has(t.toState)) continue;
+    if (!targets.has(t.toState)) targets.set(t.toState, []);
+    targets.get(t.toState)!.push(t);
+  }
+  return targets;
+}
+
+/**
+ * Number of single-character edits that turn one name into the other
+ */
+function editDistance(a: string, b: string): number {
+  let row = Array.from({ length: b.length + 1 }, (_, j) => j);
+  for (let i = 1; i <= a.length; i++) {
+    const next = [i];
+    for (let j = 1; j <= b.length; j++) {
+      next.push(Math.min(row[j] + 1, next[j - 1] + 1, row[j - 1] + (a[i - 1] === b[j - 1] ? 0 : 1)));
+    }
+    row = next;
+  }
+  return row[b.length];
+}
+
+/**
+ * The defined name closest to an undefined one, when it is close enough to
+ * be what was meant
+ */
+function suggestion(name: string, candidates: Iterable<string>): string {
+  let best: string | undefined;
+  let distance = Math.max(1, Math.floor(name.length / 4)) + 1;
+  for (const candidate of candidates) {
+    const d = editDistance(name, candidate);
+    if (d < distance) {
+      best = candidate;
+      distance = d;
+    }
+  }
+  return best === undefined ? '' : `; did you mean ${best}?`;
+}
+
+/**
+ * Find the processes a composition names that the specification does not
+ * define, which must be caught before the composition is applied
+ */
+function undefinedProcesses(spec: LTSSpec): Diagnostic[] {
+  const defined = new Set(spec.processes.map(proc => proc.name));
+  const composition = spec.composition;
+  if (!composition) return [];
+  const names = [...composition.processes, ...Object.keys(composition.forall ?? {})];
+  const at = composition.line === undefined ? '' : ` (line ${composition.line})`;
+  return Array.from(new Set(names)).filter(name => !defined.has(name)).map(name => ({
+    severity: 'error',
+    message: `composition ${composition.name} refers to undefined process ${name}${at}${suggestion(name, defined)}`,
+  }));
+}
+
+/**
+ * The specification with its composition cut down to the processes it
+ * defines, so that the rest can still be checked; with none of them left,
+ * every process runs as if there were no composition
+ */
+function withoutUndefinedProcesses(spec: LTSSpec): LTSSpec {
+  const composition = spec.composition;
+  if (!composition) return spec;
+  const defined = new Set(spec.processes.map(proc => proc.name));
+  const processes = composition.processes.filter(name => defined.has(name));
+  if (processes.length === 0) {
+    const { composition: _, ...rest } = spec;
+    return rest;
+  }
+  const trimmed = { ...composition, processes };
+  delete trimmed.forall;
+  const forall = Object.entries(composition.forall ?? {}).filter(([name]) => defined.has(name));
+  if (forall.length > 0) trimmed.forall = Object.fromEntries(forall);
+  return { ...spec, composition: trimmed };
+}
+
+/**
+ * Find the actions a specification declares shared that only one process
+ * uses: with no partner to synchronize with, they never happen
+ * @returns The using process of each such action, by action
+ */
+export function unmatchedSharedActions(spec: LTSSpec): Map<string, string> {
+  const users = new Map<string, Set<string>>();
+  for (const proc of spec.processes) {
+    for (const action of [...proc.transitions.map(t => t.action), ...(proc.extraAlphabet ?? [])]) {
+      if (!users.has(action)) users.set(action, new Set());
+      users.get(action)!.add(proc.name);
+    }
+  }
+  const unmatched = new Map<string, string>();
+  for (const [action, procs] of users) {
+    if (procs.size === 1 && spec.shared !== undefined && coversAction(action, spec.shared)) {
+      unmatched.set(action, Array.from(procs)[0]);
+    }
+  }
+  return unmatched;
+}
+
+/**
+ * Transitions leaving a terminal state, which can never fire
+ */
+function terminalTransitions(proc: ProcessDefinition, state: string): number {
+  return proc.transitions.filter(t => t.fromState === state).length;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Validation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Run every check over the normalized form of a specification
+ * @param source The specification to validate
+ * @returns Diagnostics in process order; empty when nothing looks wrong
+ */
+export function validateSpec(source: LTSSpec): Diagnostic[] {
+  const diagnostics = undefinedProcesses(source);
+  const spec = normalizeSpec(diagnostics.length > 0 ? withoutUndefinedProcesses(source) : source);
+  const symbols = definedStates(spec);
+  const unmatched = unmatchedSharedActions(spec);
+
+  for (const proc of spec.processes) {
+    const defined = symbols.get(proc.name)!;
+    if (!defined.has(proc.initialState) && proc.transitions.length > 0) {
+      diagnostics.push({
+        severity: 'error',
+        process: proc.name,
+        message: `initial state ${proc.initialState} is never defined${suggestion(proc.initialState, defined)}`,
+      });
+    }
+    for (const [state, transitions] of undefinedTargets(proc, defined)) {
+      const t = transitions[0];
+      diagnostics.push({
+        severity: 'error',
+        process: proc.name,
+        message: `state ${state} is never defined, but ${t.fromState} -${t.action}-> leads to it${declaredAt(transitions)}${suggestion(state, defined)}`,
+      });
+    }
+    for (const state of unreachableStates(proc)) {
+      diagnostics.push({
+        severity: 'warning',
+        process: proc.name,
+        message: `state ${state} is unreachable from initial state ${proc.initialState}`,
+      });
+    }
+    const reported = new Set<string>();
+    for (const t of nondeterministicTransitions(proc)) {
+      const key = JSON.stringify([t.fromState, t.action]);
+      if (reported.has(key)) continue;
+      reported.add(key);
+      const targets = proc.transitions
+        .filter(u => u.guard === undefined && u.fromState === t.fromState && u.action === t.action)
+        .map(u => u.toState);
+      diagnostics.push({
+        severity: 'warning',
+        process: proc.name,
+        message: `state ${t.fromState} is nondeterministic on ${t.action}, which can lead to ${Array.from(new Set(targets)).join(' or ')}`,
+      });
+    }
+    for (const group of duplicateTransitions(proc)) {
+      const t = group[0];
+      diagnostics.push({
+        severity: 'warning',
+        process: proc.name,
+        message: `transition ${t.fromState} -${t.action}-> ${t.toState} is defined ${group.length} times${declaredAt(group)}`,
+      });
+    }
+    for (const [action, user] of unmatched) {
+      if (user !== proc.name) continue;
+      diagnostics.push({
+        severity: 'warning',
+        process: proc.name,
+        message: `action ${action} is declared shared, but no other process uses it, so it can never happen`,
+      });
+    }
+    for (const terminal of TERMINAL_STATES) {
+      const count = terminalTransitions(proc, terminal);
+      if (count > 0) {
+        diagnostics.push({
+          severity: 'error',
+          process: proc.name,
+          message: `${terminal} is terminal but has ${count} outgoing transition(s)`,
+        });
+      }
+    }
+  }
+
+  return diagnostics;
+}
+
+/**
+ * Format a diagnostic as a single line
+ */
+export function formatDiagnostic(diagnostic: Diagnostic): string {
+  const label = diagnostic.severity === 'error' ? 'Error' : 'Warning';
+  const where = diagnostic.process ? `Process ${diagnostic.process}: ` : '';
+  return `${label}: ${where}${diagnostic.message}`;
+}
@@ -0,0 +1,57 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Spec Visitor
+// A fixed-order walk over the processes, states and transitions of a
+// specification, for passes that should not depend on the IR's layout
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { LTSSpec, ProcessDefinition, Transition, getAllStates } from './transpiler';
+import { normalizeSpec } from './transforms';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Callbacks of a pass over a specification. Every method is optional, so a
+ * pass implements only what it looks at.
+ */
+export interface LTSVisitor {
+  /** Called before the states of a process; returning false skips them */
+  visitProcess?(proc: ProcessDefinition): boolean | void;
+  /** Called once per state, before the transitions that leave it */
+  visitState?(proc: ProcessDefinition, state: string): void;
+  /** Called once per transition, after the state it leaves */
+  visitTransition?(proc: ProcessDefinition, transition: Transition): void;
+  /** Called after the states and transitions of a process that was not skipped */
+  leaveProcess?(proc: ProcessDefinition): void;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Walk
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * States of a process in visiting order: the initial state, then the others
+ * as the transitions first mention them
+ */
+export function stateOrder(proc: ProcessDefinition): string[] {
+  return Array.from(new Set([proc.initialState, ...getAllStates(proc)]));
+}
+
+/**
+ * Walk the normalized form of a specification. Processes come in
+ * declaration order; within each, states come in stateOrder and each state
+ * is followed by the transitions leaving it, in declaration order.
+ */
+export function walk(source: LTSSpec, visitor: LTSVisitor): void {
+  for (const proc of normalizeSpec(source).processes) {
+    if (visitor.visitProcess?.(proc) === false) continue;
+    for (const state of stateOrder(proc)) {
+      visitor.visitState?.(proc, state);
+      for (const t of proc.transitions) {
+        if (t.fromState === state) visitor.visitTransition?.(proc, t);
+      }
+    }
+    visitor.leaveProcess?.(proc);
+  }
+}
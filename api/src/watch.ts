@@ -0,0 +1,55 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Watch Mode
+// Re-runs a build whenever an input file changes on disk
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { Stats, unwatchFile, watchFile } from 'fs';
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Type Definitions
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Options controlling how often a watched file is checked
+ */
+export interface WatchOptions {
+  /** Polling interval in milliseconds (default 250) */
+  intervalMs?: number;
+  /** Wait this long after the last change before firing (default 100) */
+  debounceMs?: number;
+}
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Watching
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Call `onChange` whenever a file changes. The file is polled rather than
+ * watched through file system events, so editors that save by replacing the
+ * file are still followed. A burst of writes fires `onChange` only once.
+ * @param file The file to watch
+ * @param onChange Called after the file has settled
+ * @returns A function that stops watching
+ */
+export function watchInput(file: string, onChange: () => void, options: WatchOptions = {}): () => void {
+  let timer: ReturnType<typeof setTimeout> | undefined;
+
+  const listener = (current: Stats, previous: Stats) => {
+    if (current.mtimeMs === previous.mtimeMs && current.size === previous.size) return;
+    clearTimeout(timer);
+    timer = setTimeout(onChange, options.debounceMs ?? 100);
+  };
+
+  watchFile(file, { interval: options.intervalMs ?? 250 }, listener);
+  return () => {
+    clearTimeout(timer);
+    unwatchFile(file, listener);
+  };
+}
+
+/**
+ * Local wall-clock time as `HH:MM:SS` for log lines
+ */
+export function timestamp(date = new Date()): string {
+  return date.toTimeString().slice(0, 8);
+}
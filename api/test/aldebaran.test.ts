@@ -0,0 +1,40 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { readAut, writeAut } from '../src/aldebaran';
+import { analyze } from '../src/analysis';
+import { loadExample } from './helpers';
+
+const SMALL = `des (0, 4, 3)
+(0, "put!", 1)
+(1, "i", 2)
+(2, "get?", 0)
+(1, "log", 1)
+`;
+
+test('an .aut file reads into one process with the transitions its header counts', () => {
+  const spec = readAut(SMALL, 'P');
+  assert.equal(spec.processes.length, 1);
+  const [proc] = spec.processes;
+  assert.equal(proc.initialState, '0');
+  assert.equal(proc.transitions.length, 4);
+  assert.deepEqual(proc.transitions.map(t => `${t.fromState} ${t.action} ${t.toState}${t.hidden ? ' hidden' : ''}`), [
+    '0 put 1',
+    '1 i 2 hidden',
+    '2 get 0',
+    '1 log 1',
+  ]);
+  // put! makes P the sender of put; get? leaves get to be sent by a peer
+  assert.deepEqual(spec.actions, { put: { sender: 'P' } });
+  assert.throws(() => readAut('des (0, 5, 3)\n(0, "a", 1)\n'), /header declares 5 transitions but the file contains 1/);
+});
+
+test('writing composes the system, and reading it back keeps every transition', () => {
+  const spec = loadExample('producer_consumer.json');
+  const aut = writeAut(spec);
+  const { stateCount, transitionCount } = analyze(spec);
+  assert.equal(aut.split('\n')[0], `des (0, ${transitionCount}, ${stateCount})`);
+  const edges = (text: string) => text.split('\n').slice(1).filter(line => line.length > 0).sort();
+  const [flat] = readAut(aut).processes;
+  assert.equal(flat.transitions.length, transitionCount);
+  assert.deepEqual(edges(writeAut(readAut(aut))), edges(aut));
+});
@@ -0,0 +1,173 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { StateLimitError, analyze, checkDivergence, checkLTL, checkProgress, flattenSpec, formatTrace, randomTrace, reachableStates, specStats } from '../src/analysis';
+import { fsp, loadExample } from './helpers';
+
+test('producer/consumer reaches all eight combinations of its local states', () => {
+  const states = reachableStates(loadExample('producer_consumer.json'));
+  const key = (s: Record<string, string>) => `${s.PRODUCER} ${s.CONSUMER} ${s.BUFFER}`;
+  assert.deepEqual(states[0], { PRODUCER: 'READY', CONSUMER: 'WAITING', BUFFER: 'EMPTY' });
+  assert.deepEqual(states.map(key).sort(), [
+    'PRODUCING CONSUMING EMPTY',
+    'PRODUCING CONSUMING FULL',
+    'PRODUCING WAITING EMPTY',
+    'PRODUCING WAITING FULL',
+    'READY CONSUMING EMPTY',
+    'READY CONSUMING FULL',
+    'READY WAITING EMPTY',
+    'READY WAITING FULL',
+  ]);
+  assert.throws(() => reachableStates(loadExample('producer_consumer.json'), { maxStates: 3 }), StateLimitError);
+});
+
+test('checkLTL passes a property producer/consumer keeps and traces one it breaks', () => {
+  const spec = loadExample('producer_consumer.json');
+  assert.equal(checkLTL(spec, '!consume W put'), null);
+  const violation = checkLTL(spec, 'G(put -> X(get))');
+  assert.ok(violation);
+  assert.equal(violation.property, 'G(put -> X(get))');
+  assert.deepEqual(violation.trace, ['start_produce', 'put', 'start_produce']);
+  assert.deepEqual(violation.state, { PRODUCER: 'PRODUCING', CONSUMER: 'WAITING', BUFFER: 'FULL' });
+});
+
+test('partial-order reduction finds the same deadlock in fewer states', () => {
+  // Two pairs that never interact, each of which can block itself
+  const spec = fsp([
+    'X = (x1 -> x2 -> s -> X)+{t}.',
+    'Y = (y1 -> s -> Y | y2 -> t -> Y).',
+    'U = (u1 -> u2 -> v -> U)+{z}.',
+    'V = (w1 -> v -> V | w2 -> z -> V).',
+  ].join('\n'));
+  const full = analyze(spec);
+  const reduced = analyze(spec, { partialOrder: true });
+  assert.ok(reduced.stateCount < full.stateCount, `${reduced.stateCount} states with reduction, ${full.stateCount} without`);
+  assert.deepEqual(reduced.deadlocks.map(d => d.state), full.deadlocks.map(d => d.state));
+  assert.deepEqual(full.deadlocks.map(d => d.state), [{ X: '2', Y: '2', U: '2', V: '2' }]);
+});
+
+test('symmetry reduction merges permutations of identical workers and keeps the deadlock verdict', () => {
+  // A worker picks BUSY or IDLE on every job, so the copies drift apart and block once they disagree
+  const spec = fsp([
+    'const N = 3',
+    'WORKER = (job -> BUSY | job -> IDLE),',
+    'BUSY = (job -> WORKER | fail -> STOP),',
+    'IDLE = (rest -> WORKER).',
+    '||FARM = (forall [i:1..N] WORKER).',
+  ].join('\n'));
+  const full = analyze(spec);
+  const reduced = analyze(spec, { symmetry: true });
+  assert.ok(reduced.stateCount < full.stateCount, `${reduced.stateCount} states with reduction, ${full.stateCount} without`);
+  const locals = (state: Record<string, string>) => Object.values(state).sort().join(' ');
+  assert.equal(full.deadlocks.length, 6);
+  assert.deepEqual(reduced.deadlocks.map(d => locals(d.state)).sort(), ['BUSY BUSY IDLE', 'BUSY IDLE IDLE']);
+  assert.deepEqual(Array.from(new Set(full.deadlocks.map(d => locals(d.state)))).sort(), ['BUSY BUSY IDLE', 'BUSY IDLE IDLE']);
+});
+
+test('a reachable deadlock comes with its global state and shortest trace', () => {
+  const { deadlocks } = analyze(loadExample('choice_example.json'));
+  assert.deepEqual(deadlocks.map(({ state, trace }) => ({ state, trace })), [
+    { state: { VENDING_MACHINE: 'IDLE', CUSTOMER: 'WAITING' }, trace: ['insert_coin', 'refund'] },
+  ]);
+  assert.deepEqual(analyze(loadExample('producer_consumer.json')).deadlocks, []);
+});
+
+test('every producer/consumer action makes progress, and a sink cycle starves consume', () => {
+  assert.deepEqual(checkProgress(loadExample('producer_consumer.json')), []);
+  const spec = fsp(`PRODUCER = (start_produce -> put -> PRODUCER).
+CONSUMER = (get -> CONSUMING), CONSUMING = (consume -> CONSUMER | idle -> SINK), SINK = (idle -> SINK).
+BUFFER = (put -> get -> BUFFER).
+||SYS = (PRODUCER || CONSUMER || BUFFER).`);
+  assert.deepEqual(checkProgress(spec, ['consume']), ['consume']);
+  // Once the consumer idles forever the buffer fills and the producer stops too
+  assert.deepEqual(checkProgress(spec), ['consume', 'get', 'put', 'start_produce']);
+});
+
+test('STOP is a clean end, but a peer left waiting on a stopped process is deadlocked', () => {
+  assert.deepEqual(analyze(fsp('P = (a -> STOP).')).deadlocks, []);
+  const deadlock = analyze(fsp('P = (a -> STOP).\nQ = (a -> a -> STOP).\n||S = (P || Q).')).deadlocks;
+  assert.deepEqual(deadlock.map(d => [d.state, d.trace]), [[{ P: 'STOP', Q: '1' }, ['a']]]);
+});
+
+test('a second request before the ack drives the server into ERROR along its trace', () => {
+  const spec = fsp(`SERVER = (req -> BUSY), BUSY = (ack -> SERVER | req -> ERROR).
+CLIENT = (req -> CLIENT | ack -> CLIENT).
+||S = (SERVER || CLIENT).`);
+  const { errors } = analyze(spec);
+  assert.equal(errors.length, 1);
+  assert.equal(errors[0].process, 'SERVER');
+  assert.deepEqual(errors[0].trace, ['req', 'req']);
+  assert.deepEqual(errors[0].state, { SERVER: 'ERROR', CLIENT: 'CLIENT' });
+});
+
+test('a prioritized action is always taken while it is enabled', () => {
+  const moves = (priority: string) => flattenSpec(fsp(`P = (urgent -> P | routine -> P).
+Q = (urgent -> STOP).
+||SYS = (P || Q)${priority}.`)).transitions.map(t => [t.fromState, t.action, t.toState]);
+  assert.deepEqual(moves(''), [['0', 'routine', '0'], ['0', 'urgent', '1'], ['1', 'routine', '1']]);
+  // routine waits for urgent, and is only taken once Q has stopped
+  assert.deepEqual(moves(' << {urgent}'), [['0', 'urgent', '1'], ['1', 'routine', '1']]);
+  assert.deepEqual(moves(' >> {urgent}'), [['0', 'routine', '0']]);
+});
+
+test('a hidden self-loop is a divergence and producer/consumer has none', () => {
+  assert.deepEqual(checkDivergence(loadExample('producer_consumer.json')), []);
+  const divergences = checkDivergence(fsp('P = (a -> Q), Q = (spin -> Q | b -> P).\n||S = (P)\\{spin}.'));
+  assert.deepEqual(divergences.map(d => ({ state: d.state, trace: d.trace, cycle: d.cycle })), [
+    { state: { P: 'Q' }, trace: ['a'], cycle: ['spin'] },
+  ]);
+});
+
+test('every random trace replays step by step against the product', () => {
+  for (const name of ['producer_consumer.json', 'choice_example.json']) {
+    const spec = loadExample(name);
+    const product = flattenSpec(spec);
+    for (let run = 0; run < 50; run++) {
+      const trace = randomTrace(spec, 30);
+      let states = new Set([product.initialState]);
+      for (const action of trace) {
+        states = new Set(product.transitions.filter(t => states.has(t.fromState) && t.action === action).map(t => t.toState));
+        assert.ok(states.size > 0, `${name}: ${trace.join(' -> ')} cannot take ${action}`);
+      }
+      // A trace only ends early in a state with nothing left to do
+      if (trace.length < 30) {
+        assert.ok(product.transitions.every(t => !states.has(t.fromState)), `${name}: ${trace.join(' -> ')} stopped early`);
+      }
+    }
+  }
+});
+
+test('the deadlock of opposite lock orders comes with its steps', () => {
+  const spec = fsp('P = (x -> y -> a -> b -> P).\nQ = (x -> y -> b -> a -> Q).\n||S = (P || Q).');
+  const [deadlock] = analyze(spec).deadlocks;
+  assert.deepEqual(deadlock.steps, [
+    { action: 'x', state: { P: '1', Q: '1' } },
+    { action: 'y', state: { P: '2', Q: '2' } },
+  ]);
+  assert.equal(formatTrace(deadlock.steps), '  1. x -> (P=1, Q=1)\n  2. y -> (P=2, Q=2)');
+  assert.equal(formatTrace([]), '  <initial state>');
+});
+
+test('the mutual exclusion property is broken without a lock and kept with one', () => {
+  const unlocked = loadExample('mutex_property.lts');
+  assert.equal(unlocked.processes.find(p => p.name === 'MUTEX')!.property, true);
+  const { errors } = analyze(unlocked);
+  assert.deepEqual(errors.map(({ process, property, state, trace }) => ({ process, property, state, trace })), [{
+    process: 'MUTEX',
+    property: true,
+    state: { P1: '1', P2: '1', MUTEX: 'ERROR' },
+    trace: ['p1.enter', 'p2.enter'],
+  }]);
+  const locked = fsp(`P1 = (p1.get -> p1.enter -> p1.exit -> p1.put -> P1).
+P2 = (p2.get -> p2.enter -> p2.exit -> p2.put -> P2).
+LOCK = (p1.get -> p1.put -> LOCK | p2.get -> p2.put -> LOCK).
+property MUTEX = (p1.enter -> p1.exit -> MUTEX | p2.enter -> p2.exit -> MUTEX).
+||SYS = (P1 || P2 || LOCK || MUTEX).`);
+  assert.deepEqual(analyze(locked).errors, []);
+});
+
+test('producer/consumer stats count three two-state processes and eight global states', () => {
+  const spec = loadExample('producer_consumer.json');
+  const processes = ['PRODUCER', 'CONSUMER', 'BUFFER'].map(name => ({ name, states: 2, transitions: 2 }));
+  assert.deepEqual(specStats(spec), { processes, sharedActions: ['get', 'put'], reachableStates: 8, capped: false });
+  assert.deepEqual(specStats(spec, { maxStates: 3 }), { processes, sharedActions: ['get', 'put'], reachableStates: 3, capped: true });
+});
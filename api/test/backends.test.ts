@@ -0,0 +1,34 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { writeFileSync } from 'fs';
+import { join, resolve } from 'path';
+import { findBackend, listBackends, registerBackend } from '../src/backends';
+import { loadExample, runCLI, withTempDir } from './helpers';
+
+test('a registered backend is found by its name', () => {
+  const fake = { name: 'fake', description: 'Counts the processes', generate: () => 'three processes\n' };
+  registerBackend(fake);
+  assert.equal(findBackend('fake'), fake);
+  assert.deepEqual(listBackends().map(b => b.name), ['channels', 'actor', 'mutex', 'rust', 'fake']);
+  assert.equal(findBackend('fake').generate(loadExample('producer_consumer.json'), {}), 'three processes\n');
+  assert.throws(() => registerBackend(fake), /Backend fake is already registered/);
+  assert.throws(() => findBackend('missing'), /Unknown backend "missing". Available: channels, actor, mutex, rust, fake/);
+});
+
+test('a plugin backend is listed and selectable from the command line', () => {
+  withTempDir(dir => {
+    const plugin = join(dir, 'outline.ts');
+    writeFileSync(plugin, `import { registerBackend } from ${JSON.stringify(resolve('src/backends.ts'))};
+
+registerBackend({
+  name: 'outline',
+  description: 'Lists the processes of a spec',
+  generate: spec => spec.processes.map(p => \`\${p.name} starts in \${p.initialState}\`).join('\\n') + '\\n',
+});
+`);
+    assert.match(runCLI(['--plugin', plugin, '--list-backends']).stdout, /\noutline +Lists the processes of a spec\n$/);
+    const result = runCLI(['--no-cache', '--plugin', plugin, '--backend', 'outline', '../examples/producer_consumer.json']);
+    assert.equal(result.status, 0, result.stderr);
+    assert.equal(result.stdout, 'PRODUCER starts in READY\nCONSUMER starts in WAITING\nBUFFER starts in EMPTY\n');
+  });
+});
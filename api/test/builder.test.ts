@@ -0,0 +1,32 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { newProcess, newSpec } from '../src/builder';
+import { transpile } from '../src/transpiler';
+import { loadExample, readExample } from './helpers';
+
+test('a producer/consumer built in code generates the parsed program', () => {
+  const spec = newSpec()
+    .addProcess(newProcess('PRODUCER')
+      .withInitial('READY')
+      .addTransition('READY', 'start_produce', 'PRODUCING', 'internal')
+      .addTransition('PRODUCING', 'put', 'READY', 'receive'))
+    .addProcess(newProcess('CONSUMER')
+      .withInitial('WAITING')
+      .addTransition('WAITING', 'get', 'CONSUMING', 'receive')
+      .addTransition('CONSUMING', 'consume', 'WAITING', 'internal'))
+    .addProcess(newProcess('BUFFER')
+      .withInitial('EMPTY')
+      .addTransition('EMPTY', 'put', 'FULL', 'send')
+      .addTransition('FULL', 'get', 'EMPTY', 'send'))
+    .build();
+  assert.deepEqual(spec.processes, loadExample('producer_consumer.json').processes);
+  assert.equal(transpile(spec), readExample('producer_consumer.go'));
+});
+
+test('the builder rejects a transition out of an undeclared state', () => {
+  assert.throws(
+    () => newProcess('P').withInitial('A').addTransition('B', 'a', 'A'),
+    /Process P: transition B -a-> A leaves undeclared state B; declare it with withInitial or addState first/,
+  );
+  assert.throws(() => newSpec().compose('SYS', 'P'), /Composition SYS refers to process P, which has not been added/);
+});
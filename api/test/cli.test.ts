@@ -0,0 +1,218 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { existsSync, readFileSync, writeFileSync } from 'fs';
+import { spawnSync } from 'child_process';
+import { join } from 'path';
+import { analyze, counterexamples } from '../src/analysis';
+import type { Counterexample } from '../src/analysis';
+import { HAS_RUST, loadExample, readExample, readGolden, runCLI, withTempDir } from './helpers';
+
+test('a spec piped through stdin generates the golden program', () => {
+  const result = runCLI(['--no-cache', '-'], readExample('producer_consumer.json'));
+  assert.equal(result.status, 0, result.stderr);
+  assert.equal(result.stdout, readGolden('producer_consumer.go'));
+});
+
+test('empty stdin is an error', () => {
+  const result = runCLI(['--no-cache', '-'], '');
+  assert.equal(result.status, 1);
+  assert.match(result.stderr, /Standard input contains no specification/);
+});
+
+test('check prints a deadlock counterexample in the documented JSON schema', () => {
+  const result = runCLI(['check', '--output=json', '../examples/choice_example.json']);
+  assert.equal(result.status, 1);
+  const found: Counterexample[] = JSON.parse(result.stdout);
+  assert.deepEqual(found, [{
+    kind: 'deadlock',
+    trace: [
+      { action: 'insert_coin', states: { VENDING_MACHINE: 'COIN_INSERTED', CUSTOMER: 'WAITING' } },
+      { action: 'refund', states: { VENDING_MACHINE: 'IDLE', CUSTOMER: 'WAITING' } },
+    ],
+  }]);
+  const { deadlocks } = analyze(loadExample('choice_example.json'));
+  assert.deepEqual(JSON.parse(JSON.stringify(counterexamples({ deadlocks }))), found);
+});
+
+test('check counts problems and states in the singular and plural', () => {
+  const deadlock = runCLI(['check', '../examples/choice_example.json']);
+  assert.match(deadlock.stderr, /Error: 1 problem found/);
+  withTempDir(dir => {
+    const file = join(dir, 'loop.lts');
+    writeFileSync(file, 'P = (a -> P).\n');
+    assert.match(runCLI(['check', file]).stdout, /problem in 1 state\n/);
+    writeFileSync(file, 'P = (a -> b -> P).\n');
+    assert.match(runCLI(['check', file]).stdout, /problem in 2 states\n/);
+  });
+});
+
+test('generate counts what it found in the singular and plural', () => {
+  const verified = runCLI(['--no-cache', '--verify', '-o', '/dev/null', '../examples/choice_example.json']);
+  assert.match(verified.stderr, /Error: 1 deadlock and 0 ERROR states found, no code generated/);
+  const spec = { ...loadExample('producer_consumer.json'), composition: { name: 'SYS', processes: ['PRODUCR', 'CONSUMR'] } };
+  const invalid = runCLI(['--no-cache', '-o', '/dev/null', '-'], JSON.stringify(spec));
+  assert.match(invalid.stderr, /Error: 2 problems found, no code generated/);
+  spec.composition.processes = ['PRODUCER', 'CONSUMR', 'BUFFER'];
+  assert.match(runCLI(['--no-cache', '-o', '/dev/null', '-'], JSON.stringify(spec)).stderr, /Error: 1 problem found, no code generated/);
+});
+
+test('generate -o writes the same bytes as stdout, with one final newline', () => {
+  withTempDir(dir => {
+    const file = join(dir, 'out.go');
+    const written = runCLI(['--no-cache', '-o', file, '../examples/producer_consumer.json']);
+    assert.equal(written.status, 0, written.stderr);
+    const printed = runCLI(['--no-cache', '../examples/producer_consumer.json']);
+    assert.equal(readFileSync(file, 'utf-8'), readExample('producer_consumer.go'));
+    assert.equal(printed.stdout, readExample('producer_consumer.go'));
+  });
+  for (const backend of ['channels', 'actor', 'mutex', 'rust']) {
+    const { stdout } = runCLI(['--no-cache', '--backend', backend, '../examples/producer_consumer.json']);
+    assert.match(stdout, /[^\n]\n$/, `${backend} output does not end in exactly one newline`);
+  }
+});
+
+test('table writes the golden CSV for producer/consumer', () => {
+  const result = runCLI(['table', '../examples/producer_consumer.json']);
+  assert.equal(result.status, 0, result.stderr);
+  assert.equal(result.stdout, readExample('producer_consumer.csv'));
+});
+
+test('the rust backend writes the golden program, which compiles', { skip: !HAS_RUST }, () => {
+  const result = runCLI(['--no-cache', '--backend', 'rust', '../examples/producer_consumer.json']);
+  assert.equal(result.status, 0, result.stderr);
+  assert.equal(result.stdout, readExample('producer_consumer.rs'));
+  withTempDir(dir => {
+    const file = join(dir, 'main.rs');
+    writeFileSync(file, result.stdout);
+    const check = spawnSync('rustc', ['--edition', '2021', '--emit=metadata', '--out-dir', dir, file], { encoding: 'utf-8' });
+    assert.equal(check.status, 0, check.stderr);
+  });
+});
+
+test('an unchanged build is served from the cache, and a changed spec is built again', () => {
+  withTempDir(dir => {
+    const spec = join(dir, 'spec.json');
+    const output = join(dir, 'out.go');
+    const build = () => runCLI(['--cache-dir', join(dir, 'cache'), '-o', output, spec]);
+    writeFileSync(spec, readExample('producer_consumer.json'));
+
+    const first = build();
+    assert.equal(first.status, 0, first.stderr);
+    assert.match(first.stdout, /✓ Generated Go code written to/);
+    const second = build();
+    assert.equal(second.status, 0, second.stderr);
+    assert.match(second.stdout, /✓ Unchanged, cached output written to/);
+    assert.equal(readFileSync(output, 'utf-8'), readExample('producer_consumer.go'));
+
+    writeFileSync(spec, readExample('producer_consumer.json').replace(/"consume"/g, '"eat"'));
+    const changed = build();
+    assert.equal(changed.status, 0, changed.stderr);
+    assert.match(changed.stdout, /✓ Generated Go code written to/);
+    assert.match(readFileSync(output, 'utf-8'), /action: eat/);
+  });
+});
+
+test('--check-deadlock stops generation at a reachable deadlock', () => {
+  withTempDir(dir => {
+    const output = join(dir, 'out.go');
+    const blocked = runCLI(['--no-cache', '--check-deadlock', '-o', output, '../examples/choice_example.json']);
+    assert.equal(blocked.status, 1);
+    assert.match(blocked.stderr, /Deadlock reachable in state \(VENDING_MACHINE=IDLE, CUSTOMER=WAITING\)\n {2}trace: insert_coin -> refund\n/);
+    assert.equal(existsSync(output), false);
+    assert.equal(runCLI(['--no-cache', '--check-deadlock', '-o', output, '../examples/producer_consumer.json']).status, 0);
+  });
+});
+
+test('export --format promela writes the golden model', () => {
+  const result = runCLI(['export', '--format', 'promela', '../examples/producer_consumer.json']);
+  assert.equal(result.status, 0, result.stderr);
+  assert.equal(result.stdout, readGolden('producer_consumer.pml'));
+});
+
+test('--no-main --package=pc generates a library with Run and no main', () => {
+  const result = runCLI(['--no-cache', '--no-main', '--package=pc', '../examples/producer_consumer.json']);
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /^package pc\n/);
+  assert.doesNotMatch(result.stdout, /func main\(/);
+  assert.match(result.stdout, /\nfunc Run\(ctx context\.Context\) error \{/);
+});
+
+test('a scripted simulation steps into the vending machine deadlock', () => {
+  const result = runCLI(['simulate', '../examples/choice_example.json'], '1\nx\n3\n');
+  assert.equal(result.status, 0, result.stderr);
+  assert.equal(result.stdout, `State: (VENDING_MACHINE=IDLE, CUSTOMER=WANT_DRINK)
+Enabled actions:
+  1. insert_coin
+Pick an action by number, or q to quit
+insert_coin:
+  VENDING_MACHINE: IDLE -> COIN_INSERTED
+  CUSTOMER: WANT_DRINK -> WAITING
+Enabled actions:
+  1. dispense_coffee
+  2. dispense_tea
+  3. refund
+Pick a number from 1 to 3
+refund:
+  VENDING_MACHINE: COIN_INSERTED -> IDLE
+  CUSTOMER: WAITING
+✗ Deadlock: no action is enabled in state (VENDING_MACHINE=IDLE, CUSTOMER=WAITING)
+`);
+  withTempDir(dir => {
+    const file = join(dir, 'stop.lts');
+    writeFileSync(file, 'P = (a -> STOP).\n');
+    // Steps left over once every process has stopped are ignored
+    const stopped = runCLI(['simulate', file], '1\n1\n').stdout;
+    assert.ok(stopped.endsWith('  P: P -> STOP\n✓ Every process has stopped\n'), stopped);
+  });
+});
+
+test('the producer/consumer split over three files generates the single-file program', () => {
+  withTempDir(dir => {
+    const files = loadExample('producer_consumer.json').processes.map(proc => {
+      const file = join(dir, `${proc.name.toLowerCase()}.json`);
+      writeFileSync(file, JSON.stringify({ processes: [proc] }));
+      return file;
+    });
+    const output = join(dir, 'sys.go');
+    const result = runCLI(['--no-cache', '-o', output, ...files]);
+    assert.equal(result.status, 0, result.stderr);
+    assert.equal(readFileSync(output, 'utf-8'), readExample('producer_consumer.go'));
+    const duplicate = runCLI(['--no-cache', '-o', output, files[0], files[0]]);
+    assert.match(duplicate.stderr, /Error: Process PRODUCER is defined in both .*producer\.json and .*producer\.json/);
+  });
+});
+
+test('stats prints the producer/consumer sizes and caps the state count', () => {
+  const sizes = `Processes: 3
+  PRODUCER  2 states, 2 transitions
+  CONSUMER  2 states, 2 transitions
+  BUFFER    2 states, 2 transitions
+Shared actions: 2 (get, put)
+`;
+  assert.equal(runCLI(['stats', '../examples/producer_consumer.json']).stdout, `${sizes}Reachable states: 8\n`);
+  assert.equal(runCLI(['stats', '--max-states', '3', '../examples/producer_consumer.json']).stdout, `${sizes}Reachable states: >= 3\n`);
+});
+
+test('generate --verify refuses a deadlock with its trace and passes producer/consumer', () => {
+  withTempDir(dir => {
+    const output = join(dir, 'out.go');
+    const blocked = runCLI(['--no-cache', '--verify', '-o', output, '../examples/choice_example.json']);
+    assert.equal(blocked.status, 1);
+    assert.equal(blocked.stderr, `Deadlock reachable in state (VENDING_MACHINE=IDLE, CUSTOMER=WAITING)
+  trace: insert_coin -> refund
+Error: 1 deadlock and 0 ERROR states found, no code generated
+`);
+    assert.equal(existsSync(output), false);
+
+    const warned = runCLI(['--no-cache', '--verify=warn', '-o', output, '../examples/choice_example.json']);
+    assert.equal(warned.status, 0, warned.stderr);
+    assert.match(warned.stderr, /Warning: 1 deadlock and 0 ERROR states found\n/);
+    assert.equal(existsSync(output), true);
+
+    const property = runCLI(['--no-cache', '--verify', '-o', output, '../examples/mutex_property.lts']);
+    assert.equal(property.status, 1);
+    assert.match(property.stderr, /Property MUTEX is violated in state \(P1=1, P2=1, MUTEX=ERROR\)\n {2}trace: p1\.enter -> p2\.enter\n/);
+
+    assert.equal(runCLI(['--no-cache', '--verify', '-o', output, '../examples/producer_consumer.json']).status, 0);
+  });
+});
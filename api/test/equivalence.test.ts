@@ -0,0 +1,80 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { writeFileSync } from 'fs';
+import { join } from 'path';
+import { determinize, divergentStates, minimize, minimizeWeakSpec, traceEquivalent } from '../src/equivalence';
+import type { LTSSpec } from '../src/transpiler';
+import { fsp, loadExample, runCLI, withTempDir } from './helpers';
+
+test('strong minimization merges the states of a repeated cycle', () => {
+  const proc = fsp('P = (a -> b -> a -> b -> P).').processes[0];
+  const minimized = minimize(proc);
+  assert.equal(minimized.initialState, '2+P');
+  assert.deepEqual(minimized.transitions.map(({ fromState, action, toState }) => ({ fromState, action, toState })), [
+    { fromState: '2+P', action: 'a', toState: '1+3' },
+    { fromState: '1+3', action: 'b', toState: '2+P' },
+  ]);
+  withTempDir(dir => {
+    const file = join(dir, 'cycle.lts');
+    writeFileSync(file, 'P = (a -> b -> a -> b -> P).\n');
+    const result = runCLI(['--no-cache', '--minimize', file]);
+    assert.equal(result.status, 0, result.stderr);
+    assert.deepEqual(result.stdout.match(/case "P_[^"]*"/g), ['case "P_1+3"', 'case "P_2+P"']);
+  });
+});
+
+test('weak minimization drops a hidden handshake and flags a hidden loop', () => {
+  const abstracted = minimizeWeakSpec(fsp('P = (a -> b -> b -> c -> P).\n||S = (P)\\{b}.'));
+  assert.deepEqual(abstracted.processes.map(p => p.transitions.map(({ fromState, action, toState, hidden }) => ({ fromState, action, toState, hidden }))), [[
+    { fromState: 'P', action: 'a', toState: '1+2+3', hidden: undefined },
+    { fromState: '1+2+3', action: 'c', toState: 'P', hidden: undefined },
+  ]]);
+
+  const divergent = minimizeWeakSpec(fsp('P = (a -> Q), Q = (b -> Q | c -> P).\n||S = (P)\\{b}.')).processes[0];
+  assert.deepEqual(divergentStates(divergent), ['Q']);
+  assert.ok(divergent.transitions.some(t => t.hidden && t.fromState === 'Q' && t.toState === 'Q'), 'the tau loop on Q is gone');
+});
+
+test('producer/consumer keeps its traces when refactored and loses them when broken', () => {
+  const spec = loadExample('producer_consumer.json');
+  const [producer, consumer, buffer] = spec.processes;
+  const t = (fromState: string, action: string, toState: string) => ({ fromState, action, toState });
+  const refactored: LTSSpec = {
+    processes: [
+      { name: 'MAKER', initialState: 'IDLE', transitions: [t('IDLE', 'start_produce', 'BUSY'), t('BUSY', 'put', 'IDLE')] },
+      consumer,
+      { name: 'SLOT', initialState: 'E0', transitions: [t('E0', 'put', 'F0'), t('F0', 'get', 'E1'), t('E1', 'put', 'F1'), t('F1', 'get', 'E0')] },
+    ],
+  };
+  assert.deepEqual(traceEquivalent(spec, refactored), { equivalent: true });
+
+  // A buffer that accepts a second put while full
+  const broken: LTSSpec = {
+    processes: [producer, consumer, { ...buffer, transitions: [...buffer.transitions, t('FULL', 'put', 'FULL')] }],
+  };
+  assert.deepEqual(traceEquivalent(spec, broken), {
+    equivalent: false,
+    trace: ['start_produce', 'put', 'start_produce', 'put'],
+    possibleIn: 'second',
+  });
+  assert.deepEqual(traceEquivalent(spec, broken, { maxDepth: 3 }), { equivalent: true });
+});
+
+test('trace comparison looks through an explicit tau', () => {
+  const silent = fsp('P = (a -> tau -> b -> STOP).');
+  assert.deepEqual(traceEquivalent(silent, fsp('P = (a -> b -> STOP).')), { equivalent: true });
+  assert.deepEqual(traceEquivalent(silent, fsp('P = (a -> STOP).')), { equivalent: false, trace: ['a', 'b'], possibleIn: 'first' });
+});
+
+test('determinizing a nondeterministic toss merges its targets into one set state', () => {
+  const coin = fsp('COIN = (toss -> HEADS | toss -> TAILS), HEADS = (heads -> COIN), TAILS = (tails -> COIN).').processes[0];
+  const deterministic = determinize(coin);
+  assert.equal(deterministic.initialState, 'COIN');
+  assert.deepEqual(deterministic.transitions.map(({ fromState, action, toState }) => ({ fromState, action, toState })), [
+    { fromState: 'COIN', action: 'toss', toState: 'HEADS+TAILS' },
+    { fromState: 'HEADS+TAILS', action: 'heads', toState: 'COIN' },
+    { fromState: 'HEADS+TAILS', action: 'tails', toState: 'COIN' },
+  ]);
+  const pairs = deterministic.transitions.map(t => `${t.fromState} ${t.action}`);
+  assert.equal(new Set(pairs).size, pairs.length);
+});
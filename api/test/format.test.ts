@@ -0,0 +1,52 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { writeFileSync } from 'fs';
+import { join } from 'path';
+import { formatFSP } from '../src/format';
+import type { LTSSpec } from '../src/transpiler';
+import { fsp, runCLI, withTempDir } from './helpers';
+
+const MESSY = `// Producer/consumer, written in a hurry
+PRODUCER=(start_produce->put->PRODUCER).
+CONSUMER   =   ( get -> consume ->CONSUMER ).   // eats what it gets
+BUFFER = (put ->
+get -> BUFFER).
+||SYS=(PRODUCER||CONSUMER||BUFFER).
+`;
+
+/**
+ * A spec without the source lines of its transitions and composition, which layout changes
+ */
+function withoutLines(spec: LTSSpec): LTSSpec {
+  const stripped = { ...spec, processes: spec.processes.map(p => ({ ...p, transitions: p.transitions.map(({ line: _, ...t }) => t) })) };
+  if (spec.composition) {
+    const { line: _, ...composition } = spec.composition;
+    stripped.composition = composition;
+  }
+  return stripped;
+}
+
+test('formatting is idempotent, keeps comments and keeps the meaning', () => {
+  const first = formatFSP(MESSY);
+  assert.equal(first, [
+    '// Producer/consumer, written in a hurry',
+    'PRODUCER = (start_produce -> put -> PRODUCER).',
+    'CONSUMER = (get -> consume -> CONSUMER).  // eats what it gets',
+    'BUFFER = (put ->',
+    '    get -> BUFFER).',
+    '||SYS = (PRODUCER || CONSUMER || BUFFER).',
+    '',
+  ].join('\n'));
+  assert.equal(formatFSP(first), first);
+  assert.deepEqual(withoutLines(fsp(first)), withoutLines(fsp(MESSY)));
+});
+
+test('fmt --check fails on a messy file and passes on a formatted one', () => {
+  withTempDir(dir => {
+    const file = join(dir, 'spec.lts');
+    writeFileSync(file, MESSY);
+    assert.equal(runCLI(['fmt', '--check', file]).status, 1);
+    writeFileSync(file, formatFSP(MESSY));
+    assert.equal(runCLI(['fmt', '--check', file]).status, 0);
+  });
+});
@@ -0,0 +1,146 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { getAllStates, transpile } from '../src/transpiler';
+import { flattenSpec } from '../src/analysis';
+import { minimize, traceEquivalent } from '../src/equivalence';
+import { FSPParseError, writeFSP } from '../src/fsp';
+import { fsp, loadExample, readExample, runCLI } from './helpers';
+
+test('local definitions become states of their owning process', () => {
+  const spec = fsp('BUFF = (put -> FULL), FULL = (get -> BUFF).');
+  assert.equal(spec.processes.length, 1);
+  const [buff] = spec.processes;
+  assert.equal(buff.initialState, 'BUFF');
+  assert.deepEqual(Array.from(getAllStates(buff)).sort(), ['BUFF', 'FULL']);
+  assert.deepEqual(buff.transitions.map(t => [t.fromState, t.action, t.toState]), [
+    ['BUFF', 'put', 'FULL'],
+    ['FULL', 'get', 'BUFF'],
+  ]);
+
+  const go = transpile(spec);
+  assert.match(go, /case "BUFF_BUFF":/);
+  assert.match(go, /case "BUFF_FULL":/);
+});
+
+test('the initial state is named after its process', () => {
+  const [p] = fsp('P = (a -> b -> P).').processes;
+  assert.equal(p.initialState, 'P');
+  assert.deepEqual(p.transitions.map(t => [t.fromState, t.toState]), [['P', '1'], ['1', 'P']]);
+});
+
+test('@buffer sets the capacity of one action channel only', () => {
+  const spec = fsp(['PRODUCER = (@buffer(2) put -> PRODUCER).', 'CONSUMER = (put -> get -> CONSUMER).', 'SINK = (get -> SINK).'].join('\n'));
+  assert.deepEqual(spec.actions, { put: { buffer: 2 } });
+
+  const go = transpile(spec);
+  assert.match(go, /\tch_put = make\(chan struct\{\}, 2\) \/\/ shared action: put\n/);
+  assert.match(go, /\tch_get = make\(chan struct\{\}\) \/\/ shared action: get\n/);
+});
+
+test('the classic LTSA buffer imports as a two-state process', () => {
+  const [buff] = fsp('BUFF = (in->out->BUFF).').processes;
+  assert.equal(buff.name, 'BUFF');
+  assert.equal(buff.initialState, 'BUFF');
+  assert.deepEqual(buff.transitions.map(t => [t.fromState, t.action, t.toState]), [
+    ['BUFF', 'in', '1'],
+    ['1', 'out', 'BUFF'],
+  ]);
+  const result = runCLI(['--no-cache', '--dialect', 'fsp', '-'], 'BUFF = (in->out->BUFF).\n');
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /\[BUFF\] action: in \(BUFF -> 1\)/);
+});
+
+test('choice and STOP lower to branching transitions and a terminal state', () => {
+  const [p] = fsp('P = (a -> P | b -> STOP).').processes;
+  assert.deepEqual(p.transitions.map(t => [t.fromState, t.action, t.toState]), [
+    ['P', 'a', 'P'],
+    ['P', 'b', 'STOP'],
+  ]);
+});
+
+test('const N bounds the indexed buffer, and a new N changes how many cells run', () => {
+  const source = readExample('indexed_buffer.lts');
+  const spec = fsp(source);
+  assert.deepEqual(spec.constants, { N: 2 });
+  assert.deepEqual(spec.ranges, { T: { from: '0', to: 'N-1' } });
+  const launched = (go: string) => go.match(/go Process_CELL_\d+/g);
+  assert.deepEqual(launched(transpile(spec)), ['go Process_CELL_0', 'go Process_CELL_1']);
+  const four = fsp(source.replace('const N = 2', 'const N = 4'));
+  assert.deepEqual(launched(transpile(four)), ['go Process_CELL_0', 'go Process_CELL_1', 'go Process_CELL_2', 'go Process_CELL_3']);
+  assert.throws(() => fsp('range T = 0..M\nP = (a -> P).'), /Line 1, column 14: Undefined constant M/);
+});
+
+test('put in two namespaces only shares a channel once relabelled', () => {
+  const apart = fsp('namespace lib1 { P = (put -> P). }\nnamespace lib2 { Q = (put -> Q). }\n||S = (P || Q).');
+  assert.deepEqual(apart.processes.map(p => p.transitions.map(t => t.action)), [['lib1.put'], ['lib2.put']]);
+  assert.doesNotMatch(transpile(apart), /ch_\w+ = make/);
+  const joined = fsp('namespace lib1 { P = (put -> P). }\nnamespace lib2 { Q = (put -> Q). }\n||S = (P || Q)/{put/lib1.put, put/lib2.put}.');
+  assert.deepEqual(transpile(joined).match(/ch_\w+ = make.*/g), ['ch_put = make(chan struct{}) // shared action: put']);
+  const together = fsp('namespace lib1 { P = (put -> P). Q = (put -> Q). }\n||S = (P || Q).');
+  assert.deepEqual(transpile(together).match(/ch_\w+ = make.*/g), ['ch_lib1_put = make(chan struct{}) // shared action: lib1.put']);
+});
+
+test('extending P with reset makes P block the reset Q offers', () => {
+  const plain = fsp('P = (work -> P).\nQ = (work -> Q | reset -> Q).\n||S = (P || Q).');
+  const extended = fsp('P = (work -> P) + {reset}.\nQ = (work -> Q | reset -> Q).\n||S = (P || Q).');
+  assert.deepEqual(extended.processes[0].extraAlphabet, ['reset']);
+  assert.deepEqual(flattenSpec(plain).transitions.map(t => t.action), ['reset', 'work']);
+  assert.deepEqual(flattenSpec(extended).transitions.map(t => t.action), ['work']);
+  // reset now needs P as a peer, which never offers it
+  assert.doesNotMatch(transpile(plain), /ch_reset/);
+  assert.match(transpile(extended), /case ch_reset <- struct\{\}\{\}: \/\/ send: reset/);
+});
+
+test('(a -> STOP) ; (b -> STOP) does a, then b, then stops', () => {
+  const [p] = fsp('P = (a -> STOP) ; (b -> STOP).').processes;
+  assert.deepEqual(p.transitions.map(t => [t.fromState, t.action, t.toState]), [
+    ['P', 'a', '2.0'],
+    ['2.0', 'b', 'STOP'],
+  ]);
+  // A first part that never stops leaves nothing for the second to follow
+  const looping = fsp('LOOP = (x -> LOOP).\nP = LOOP ; (b -> STOP).\n||S = (P).').processes.find(proc => proc.name === 'P')!;
+  assert.deepEqual(looping.transitions.map(t => [t.fromState, t.action, t.toState]), [['P', 'x', 'P']]);
+});
+
+test('every typo is reported with its line and a caret under the bad token', () => {
+  assert.throws(() => fsp('P = (a -> b -> P).\nQ = (a -> * Q).\nR = (c -> R | ).\n'), (err: unknown) => {
+    assert.ok(err instanceof FSPParseError);
+    assert.deepEqual(err.errors.map(e => e.pos), [{ line: 2, column: 11 }, { line: 3, column: 15 }]);
+    assert.equal(err.message, [
+      "Line 2, column 11: Expected STOP, ERROR, a process name or a parenthesized choice but found '*'",
+      'Q = (a -> * Q).',
+      '          ^',
+      "Line 3, column 15: Expected an action label but found ')'",
+      'R = (c -> R | ).',
+      '              ^',
+    ].join('\n'));
+    return true;
+  });
+});
+
+test('!put and ?put pick the direction of the put channel', () => {
+  const body = (go: string, name: string) => go.slice(go.indexOf(`func Process_${name}(`)).split('\n}\n')[0];
+  // Unmarked, the first process would send
+  const go = transpile(fsp('P = (?put -> P).\nQ = (!put -> Q).\n||S = (P || Q).'));
+  assert.match(body(go, 'P'), /\t<-ch_put \/\/ receive: put\n/);
+  assert.match(body(go, 'Q'), /\tch_put <- struct\{\}\{\} \/\/ send: put\n/);
+  assert.throws(() => transpile(fsp('P = (!put -> P).\nQ = (!put -> Q).\n||S = (P || Q).')), /Action put is output \(!put\) by P and Q, but only one process may write it/);
+  assert.throws(() => transpile(fsp('P = (!put -> ?put -> P).\nQ = (put -> Q).\n||S = (P || Q).')), /Process P: action put is marked both output \(!put\) and input \(\?put\)/);
+});
+
+test('a written spec parses back to the same behaviour, and a minimized one is smaller', () => {
+  const spec = loadExample('producer_consumer.json');
+  const text = writeFSP(spec);
+  const parsed = fsp(text);
+  assert.equal(writeFSP(parsed), text);
+  assert.deepEqual(traceEquivalent(parsed, spec), { equivalent: true });
+
+  const cycle = fsp('P = (a -> b -> a -> b -> P).');
+  const minimized = { processes: [minimize(cycle.processes[0])] };
+  const written = writeFSP(minimized);
+  assert.equal(written, 'P = (a -> Q1),\nQ1 = (b -> P).\n');
+  const [p] = fsp(written).processes;
+  assert.equal(getAllStates(p).size, 2);
+  assert.equal(getAllStates(cycle.processes[0]).size, 4);
+  assert.deepEqual(traceEquivalent(fsp(written), cycle), { equivalent: true });
+});
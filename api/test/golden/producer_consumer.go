@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+
+// Channels for action synchronization (shared actions only)
+var (
+	ch_get = make(chan struct{}) // shared action: get
+	ch_put = make(chan struct{}) // shared action: put
+)
+
+// Process_PRODUCER implements the PRODUCER process
+func Process_PRODUCER(wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Printf("[PRODUCER] Starting...\n")
+
+	state := "PRODUCER_READY"
+
+	for {
+		switch state {
+		case "PRODUCER_PRODUCING":
+			<-ch_put // receive: put
+			fmt.Printf("[PRODUCER] action: put (PRODUCING -> READY)\n")
+			state = "PRODUCER_READY"
+		case "PRODUCER_READY":
+			fmt.Printf("[PRODUCER] action: start_produce (READY -> PRODUCING)\n")
+			state = "PRODUCER_PRODUCING"
+		default:
+			fmt.Printf("[PRODUCER] Unknown state: %s\n", state)
+			return
+		}
+	}
+}
+
+// Process_CONSUMER implements the CONSUMER process
+func Process_CONSUMER(wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Printf("[CONSUMER] Starting...\n")
+
+	state := "CONSUMER_WAITING"
+
+	for {
+		switch state {
+		case "CONSUMER_CONSUMING":
+			fmt.Printf("[CONSUMER] action: consume (CONSUMING -> WAITING)\n")
+			state = "CONSUMER_WAITING"
+		case "CONSUMER_WAITING":
+			<-ch_get // receive: get
+			fmt.Printf("[CONSUMER] action: get (WAITING -> CONSUMING)\n")
+			state = "CONSUMER_CONSUMING"
+		default:
+			fmt.Printf("[CONSUMER] Unknown state: %s\n", state)
+			return
+		}
+	}
+}
+
+// Process_BUFFER implements the BUFFER process
+func Process_BUFFER(wg *sync.WaitGroup) {
+	defer wg.Done()
+	fmt.Printf("[BUFFER] Starting...\n")
+
+	state := "BUFFER_EMPTY"
+
+	for {
+		switch state {
+		case "BUFFER_EMPTY":
+			ch_put <- struct{}{} // send: put
+			fmt.Printf("[BUFFER] action: put (EMPTY -> FULL)\n")
+			state = "BUFFER_FULL"
+		case "BUFFER_FULL":
+			ch_get <- struct{}{} // send: get
+			fmt.Printf("[BUFFER] action: get (FULL -> EMPTY)\n")
+			state = "BUFFER_EMPTY"
+		default:
+			fmt.Printf("[BUFFER] Unknown state: %s\n", state)
+			return
+		}
+	}
+}
+
+func main() {
+	fmt.Println("═══════════════════════════════════════════════════════════════")
+	fmt.Println("  LTS Execution Started")
+	fmt.Println("═══════════════════════════════════════════════════════════════")
+	fmt.Println()
+
+	var wg sync.WaitGroup
+
+	wg.Add(3)
+
+	// Launch process goroutines
+	go Process_PRODUCER(&wg)
+	go Process_CONSUMER(&wg)
+	go Process_BUFFER(&wg)
+
+	// Wait for all processes to complete
+	wg.Wait()
+
+	fmt.Println()
+	fmt.Println("═══════════════════════════════════════════════════════════════")
+	fmt.Println("  LTS Execution Complete")
+	fmt.Println("═══════════════════════════════════════════════════════════════")
+}
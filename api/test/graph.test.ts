@@ -0,0 +1,100 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { generateDOT, generateMermaid, generatePlantUML, generateSVG } from '../src/graph';
+import { readFileSync, readdirSync, writeFileSync } from 'fs';
+import { join } from 'path';
+import { loadExample, readGolden, runCLI, withTempDir } from './helpers';
+
+test('DOT has the start_produce edge from PRODUCER_READY to PRODUCER_PRODUCING', () => {
+  const dot = generateDOT(loadExample('producer_consumer.json'));
+  assert.ok(dot.startsWith('digraph'));
+  assert.match(dot, /"PRODUCER_READY" -> "PRODUCER_PRODUCING" \[label="start_produce"/);
+});
+
+test('DOT colors shared actions apart from local ones', () => {
+  const dot = generateDOT(loadExample('producer_consumer.json'));
+  const local = dot.split('\n').find(line => line.includes('label="start_produce"'))!;
+  const shared = dot.split('\n').find(line => line.includes('label="put (receive)"'))!;
+  assert.notEqual(local.match(/color="([^"]+)"/)![1], shared.match(/color="([^"]+)"/)![1]);
+});
+
+test('Mermaid blocks parse back into the transitions of every process', () => {
+  const spec = loadExample('producer_consumer.json');
+  const blocks = generateMermaid(spec).split('\n\n');
+  assert.equal(blocks.length, spec.processes.length);
+  spec.processes.forEach((proc, i) => {
+    const lines = blocks[i].trimEnd().split('\n');
+    assert.deepEqual([lines[0], lines[1], lines[lines.length - 1]], ['```mermaid', 'stateDiagram-v2', '```']);
+    const transitions: string[] = [];
+    let initial: string | undefined;
+    for (const line of lines.slice(2, -1)) {
+      // Every line is a comment, the start marker or a labelled transition between plain ids
+      const start = /^ {4}\[\*\] --> (\w+)$/.exec(line);
+      const edge = /^ {4}(\w+) --> (\w+) : (\S+)$/.exec(line);
+      assert.ok(/^ {4}%% /.test(line) || start || edge, `not a stateDiagram-v2 line: ${line}`);
+      if (start) initial = start[1];
+      if (edge) transitions.push(`${edge[1]} ${edge[3]} ${edge[2]}`);
+    }
+    assert.equal(initial, `${proc.name}_${proc.initialState}`);
+    assert.deepEqual(transitions, proc.transitions.map(t => `${proc.name}_${t.fromState} ${t.action} ${proc.name}_${t.toState}`));
+  });
+});
+
+test('SVG is rendered by Graphviz from the DOT description', () => {
+  const spec = loadExample('producer_consumer.json');
+  const calls: { command: string; args: string[]; input: string }[] = [];
+  const svg = generateSVG(spec, (command, args, input) => {
+    calls.push({ command, args, input });
+    return { status: 0, stdout: '<svg xmlns="http://www.w3.org/2000/svg"></svg>', stderr: '' };
+  });
+  assert.equal(svg, '<svg xmlns="http://www.w3.org/2000/svg"></svg>');
+  assert.deepEqual(calls, [{ command: 'dot', args: ['-Tsvg'], input: generateDOT(spec) }]);
+});
+
+test('SVG without Graphviz is an actionable error', () => {
+  const missing = Object.assign(new Error('spawnSync dot ENOENT'), { code: 'ENOENT' });
+  assert.throws(
+    () => generateSVG(loadExample('producer_consumer.json'), () => ({ status: null, stdout: '', stderr: '', error: missing })),
+    /needs Graphviz, but there is no 'dot' command on the PATH.*--format=dot/
+  );
+  assert.throws(
+    () => generateSVG(loadExample('producer_consumer.json'), () => ({ status: 0, stdout: 'garbage', stderr: '' })),
+    /did not return an SVG image/
+  );
+});
+
+test('graph help lists every diagram format', () => {
+  assert.match(runCLI(['--help']).stdout, /Diagram format: dot, svg, mermaid, plantuml/);
+});
+
+test('an animated trace writes one frame per step with the current state filled', () => {
+  withTempDir(dir => {
+    const trace = [
+      { process: 'P', from: 'P', action: 'a', to: '1' },
+      { process: 'P', from: '1', action: 'b', to: '2' },
+      { process: 'P', from: '2', action: 'c', to: 'P' },
+    ];
+    writeFileSync(join(dir, 'p.lts'), 'P = (a -> b -> c -> P).\n');
+    writeFileSync(join(dir, 'trace.jsonl'), trace.map(record => JSON.stringify(record)).join('\n') + '\n');
+    const out = join(dir, 'frames');
+    const result = runCLI(['graph', '--animate', '--trace', join(dir, 'trace.jsonl'), join(dir, 'p.lts'), out]);
+    assert.equal(result.status, 0, result.stderr);
+    assert.match(result.stdout, /3 frames written/);
+
+    const frames = readdirSync(out).sort();
+    assert.deepEqual(frames, ['step-001.dot', 'step-002.dot', 'step-003.dot']);
+    frames.forEach((name, i) => {
+      const dot = readFileSync(join(out, name), 'utf-8');
+      assert.ok(dot.includes(`label="Step ${i + 1}: ${trace[i].action}"`), name);
+      const filled = dot.split('\n').filter(line => line.includes('style=filled'));
+      assert.equal(filled.length, 1, name);
+      assert.match(filled[0], new RegExp(`^\\t+"P_${trace[i].to}" \\[.*fillcolor="#ffd33d"`), name);
+    });
+  });
+});
+
+test('PlantUML for producer/consumer matches the golden diagram', () => {
+  const golden = readGolden('producer_consumer.puml');
+  assert.equal(runCLI(['graph', '--format=plantuml', '../examples/producer_consumer.json']).stdout, golden);
+  assert.equal(generatePlantUML(loadExample('producer_consumer.json')), golden);
+});
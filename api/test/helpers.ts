@@ -0,0 +1,158 @@
+// ═══════════════════════════════════════════════════════════════════════════
+// Test Helpers
+// Loading the example specs, and building and running generated Go
+// ═══════════════════════════════════════════════════════════════════════════
+
+import { mkdtempSync, readFileSync, rmSync, writeFileSync } from 'fs';
+import { tmpdir } from 'os';
+import { join } from 'path';
+import { spawnSync } from 'child_process';
+import { toSpec } from '../src/transpiler';
+import { parseFSP } from '../src/fsp';
+import type { LTSSpec } from '../src/transpiler';
+
+// Loaders that run the tests as ES modules leave __dirname undefined; npm runs
+// them from the package directory
+const HERE = typeof __dirname === 'string' ? __dirname : join(process.cwd(), 'test');
+
+/**
+ * Directory of the example specifications
+ */
+export const EXAMPLES = join(HERE, '..', '..', 'examples');
+
+/**
+ * Directory of the expected outputs
+ */
+const GOLDEN = join(HERE, 'golden');
+
+/**
+ * The command line entry point
+ */
+const CLI = join(HERE, '..', 'src', 'cli.ts');
+
+/**
+ * Whether a Go toolchain is on the PATH; tests that build Go skip without one
+ */
+export const HAS_GO = spawnSync('go', ['version']).status === 0;
+
+/**
+ * Whether a Rust compiler is on the PATH; tests that compile Rust skip without one
+ */
+export const HAS_RUST = spawnSync('rustc', ['--version']).status === 0;
+
+/**
+ * Outcome of running a command
+ */
+export interface RunResult {
+  status: number | null;
+  stdout: string;
+  stderr: string;
+}
+
+/**
+ * Read an example file
+ */
+export function readExample(name: string): string {
+  return readFileSync(join(EXAMPLES, name), 'utf-8');
+}
+
+/**
+ * Read an expected output
+ */
+export function readGolden(name: string): string {
+  return readFileSync(join(GOLDEN, name), 'utf-8');
+}
+
+/**
+ * Load an example spec, JSON or FSP by its extension
+ */
+export function loadExample(name: string): LTSSpec {
+  const content = readExample(name);
+  return name.endsWith('.json') ? toSpec(JSON.parse(content)) : parseFSP(content);
+}
+
+/**
+ * Parse FSP source
+ */
+export function fsp(source: string): LTSSpec {
+  return parseFSP(source);
+}
+
+/**
+ * Run the CLI with the same Node and loader as the test itself
+ */
+export function runCLI(args: string[], input?: string): RunResult {
+  const result = spawnSync(process.execPath, [...process.execArgv, CLI, ...args], {
+    input,
+    encoding: 'utf-8',
+    cwd: join(HERE, '..'),
+  });
+  return { status: result.status, stdout: result.stdout, stderr: result.stderr };
+}
+
+/**
+ * Make a temporary directory, pass it to `body`, and remove it afterwards
+ */
+export function withTempDir<T>(body: (dir: string) => T): T {
+  const dir = mkdtempSync(join(tmpdir(), 'anvilts-test-'));
+  try {
+    return body(dir);
+  } finally {
+    rmSync(dir, { recursive: true, force: true });
+  }
+}
+
+/**
+ * Write Go files into dir as a module of their own
+ * @param files File name to contents; a string is written as main.go
+ */
+function writeModule(dir: string, files: string | Record<string, string>): void {
+  const sources = typeof files === 'string' ? { 'main.go': files } : files;
+  writeFileSync(join(dir, 'go.mod'), 'module anvilts_test\n\ngo 1.21\n');
+  for (const [name, content] of Object.entries(sources)) {
+    writeFileSync(join(dir, name), content);
+  }
+}
+
+/**
+ * Write Go files into a fresh module and run a go command on it
+ * @param files File name to contents; a string is written as main.go
+ * @param args The go command, e.g. `['run', '.']` or `['vet', '.']`
+ */
+export function goCommand(files: string | Record<string, string>, args: string[], timeout = 60000): RunResult {
+  return withTempDir(dir => {
+    writeModule(dir, files);
+    const result = spawnSync('go', args, { cwd: dir, encoding: 'utf-8', timeout, env: { ...process.env, GOFLAGS: '-mod=mod' } });
+    return { status: result.status, stdout: result.stdout ?? '', stderr: result.stderr ?? '' };
+  });
+}
+
+/**
+ * Run a generated Go program and return what it printed
+ */
+export function runGo(files: string | Record<string, string>, timeout = 60000): RunResult {
+  return goCommand(files, ['run', '.'], timeout);
+}
+
+/**
+ * Build a generated Go program that never stops by itself, run it for a
+ * while and return what it printed until it was killed
+ */
+export function runGoFor(files: string | Record<string, string>, ms: number): RunResult {
+  return withTempDir(dir => {
+    writeModule(dir, files);
+    const build = spawnSync('go', ['build', '-o', 'program', '.'], { cwd: dir, encoding: 'utf-8', env: { ...process.env, GOFLAGS: '-mod=mod' } });
+    if (build.status !== 0) {
+      return { status: build.status, stdout: build.stdout ?? '', stderr: build.stderr ?? '' };
+    }
+    const result = spawnSync(join(dir, 'program'), [], { cwd: dir, encoding: 'utf-8', timeout: ms, maxBuffer: 256 * 1024 * 1024 });
+    return { status: result.status, stdout: result.stdout ?? '', stderr: result.stderr ?? '' };
+  });
+}
+
+/**
+ * Check that generated Go compiles and passes go vet
+ */
+export function vetGo(files: string | Record<string, string>): RunResult {
+  return goCommand(files, ['vet', '.']);
+}
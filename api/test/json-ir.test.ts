@@ -0,0 +1,24 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { IR_VERSION, readJSON, toIR, writeJSON } from '../src/json-ir';
+import { loadExample } from './helpers';
+
+test('IR round-trips the producer/consumer spec', () => {
+  const spec = loadExample('producer_consumer.json');
+  assert.deepEqual(readJSON(writeJSON(spec)), spec);
+});
+
+test('IR is versioned and classifies shared actions', () => {
+  const ir = toIR(loadExample('producer_consumer.json'));
+  assert.equal(ir.version, IR_VERSION);
+  const put = ir.actions.find(action => action.name === 'put')!;
+  const consume = ir.actions.find(action => action.name === 'consume')!;
+  assert.equal(put.shared, true);
+  assert.deepEqual(put.processes, ['BUFFER', 'PRODUCER']);
+  assert.equal(consume.shared, false);
+});
+
+test('IR with another version is rejected', () => {
+  const ir = { ...toIR(loadExample('producer_consumer.json')), version: IR_VERSION + 1 };
+  assert.throws(() => readJSON(JSON.stringify(ir)), /Unsupported IR version/);
+});
@@ -0,0 +1,23 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { displayWidth, writeTable } from '../src/table';
+import { loadExample, readGolden, runCLI } from './helpers';
+
+test('the producer/consumer table matches the golden text', () => {
+  const golden = readGolden('producer_consumer.txt');
+  assert.equal(writeTable(loadExample('producer_consumer.json')), golden);
+  assert.equal(runCLI(['show', '../examples/producer_consumer.json']).stdout, golden);
+});
+
+test('wide characters take two columns when aligning', () => {
+  assert.equal(displayWidth('待機'), 4);
+  assert.equal(displayWidth('é'), 1);
+  const table = writeTable({ processes: [{ name: 'P', initialState: '待機', transitions: [{ fromState: '待機', action: 'a', toState: 'DONE' }] }] });
+  assert.equal(table, `P
+┌──────┬────────┬──────────┬──────┐
+│ From │ Action │ Kind     │ To   │
+├──────┼────────┼──────────┼──────┤
+│ 待機 │ a      │ internal │ DONE │
+└──────┴────────┴──────────┴──────┘
+`);
+});
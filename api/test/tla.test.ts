@@ -0,0 +1,26 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { generateTLA } from '../src/tla';
+import { loadExample } from './helpers';
+
+test('the TLA+ module guards each producer/consumer action on its processes', () => {
+  const tla = generateTLA(loadExample('producer_consumer.json'));
+  const action = (name: string) => tla.match(new RegExp(`\\n${name} ==\\n((?: {4}.*\\n)+)`))?.[1];
+  assert.equal(action('put'), [
+    '    /\\ state.PRODUCER = "PRODUCING"',
+    '    /\\ state.BUFFER = "EMPTY"',
+    '    /\\ state\' = [state EXCEPT !.PRODUCER = "READY", !.BUFFER = "FULL"]',
+    '',
+  ].join('\n'));
+  assert.equal(action('get'), [
+    '    /\\ state.CONSUMER = "WAITING"',
+    '    /\\ state.BUFFER = "FULL"',
+    '    /\\ state\' = [state EXCEPT !.CONSUMER = "CONSUMING", !.BUFFER = "EMPTY"]',
+    '',
+  ].join('\n'));
+  assert.equal(action('consume'), '    /\\ state.CONSUMER = "CONSUMING"\n    /\\ state\' = [state EXCEPT !.CONSUMER = "WAITING"]\n');
+  assert.equal(action('start_produce'), '    /\\ state.PRODUCER = "READY"\n    /\\ state\' = [state EXCEPT !.PRODUCER = "PRODUCING"]\n');
+  assert.match(tla, /\nInit ==\n {4}state = \[PRODUCER \|-> "READY", CONSUMER \|-> "WAITING", BUFFER \|-> "EMPTY"\]\n/);
+  assert.match(tla, /\nNext ==\n {4}\\\/ consume\n {4}\\\/ get\n {4}\\\/ put\n {4}\\\/ start_produce\n/);
+  assert.match(tla, /\nSpec == Init \/\\ \[\]\[Next\]_vars\n/);
+});
@@ -0,0 +1,107 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { transpile } from '../src/transpiler';
+import { analyze } from '../src/analysis';
+import { autoNamespace, completeProcess, expandSpec } from '../src/transforms';
+import { HAS_GO, fsp, loadExample, runGo, vetGo } from './helpers';
+
+const CLOCKS = `
+CLOCK = (tick -> CLOCK).
+TIMER = (tick -> alarm -> TIMER).
+`;
+
+test('auto-namespacing turns an accidentally shared action into a local action of each process', () => {
+  const shared = transpile(fsp(CLOCKS));
+  assert.match(shared, /ch_tick = make\(chan struct\{\}\) \/\/ shared action: tick/);
+
+  const { spec, renamed } = autoNamespace(fsp(CLOCKS));
+  assert.deepEqual(renamed, [{ action: 'tick', names: { CLOCK: 'CLOCK.tick', TIMER: 'TIMER.tick' } }]);
+  const go = transpile(spec);
+  assert.doesNotMatch(go, /ch_/);
+  assert.doesNotMatch(go, /actionSink/);
+  assert.match(go, /\[CLOCK\] action: CLOCK\.tick /);
+  assert.match(go, /\[TIMER\] action: TIMER\.tick /);
+});
+
+test('auto-namespaced processes run independently to the step limit', { skip: !HAS_GO }, () => {
+  const { spec } = autoNamespace(fsp(CLOCKS));
+  const result = runGo(transpile(spec, { shutdownAfterSteps: 4 }), 30000);
+  assert.equal(result.status, 0, result.stderr);
+  for (const name of ['CLOCK', 'TIMER']) {
+    assert.ok(result.stdout.includes(`[${name}] Step limit reached (4), shutting down`), name);
+  }
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+  for (const backend of ['actor', 'mutex'] as const) {
+    const vet = vetGo(transpile(spec, { backend }));
+    assert.equal(vet.status, 0, `${backend}: ${vet.stderr}`);
+  }
+});
+
+test('a buffer of three cells expands into three indexed processes', () => {
+  const spec = expandSpec(loadExample('indexed_buffer.lts'), { N: 3 });
+  const cells = spec.processes.filter(p => p.name.startsWith('CELL'));
+  assert.deepEqual(cells.map(p => p.name), ['CELL_0', 'CELL_1', 'CELL_2']);
+  // Each cell passes the item on from its own index to the next
+  cells.forEach((cell, i) => {
+    assert.deepEqual(cell.transitions.map(t => t.action), [`move.${i}`, `move.${i + 1}`]);
+  });
+  assert.equal(spec.processes.find(p => p.name === 'CONSUMER')!.transitions[0].action, 'move.3');
+  const go = transpile(spec);
+  for (const name of ['Process_CELL_0', 'Process_CELL_1', 'Process_CELL_2']) {
+    assert.match(go, new RegExp(`go ${name}\\(&wg\\)`));
+  }
+});
+
+test('a process left out of the composition is parsed but not launched', () => {
+  const spec = fsp('P = (a -> P).\nQ = (a -> b -> Q).\nHELPER = (c -> HELPER).\n||SYS = (P || Q).');
+  assert.deepEqual(spec.processes.map(p => p.name), ['P', 'Q', 'HELPER']);
+  const go = transpile(spec);
+  assert.match(go, /\twg\.Add\(2\)\n/);
+  assert.match(go, /go Process_P\(&wg\)\n\tgo Process_Q\(&wg\)\n/);
+  assert.doesNotMatch(go, /HELPER/);
+});
+
+test('relabelling two actions to one name makes them synchronize on one channel', () => {
+  const spec = fsp('P = (out -> work -> P).\nQ = (in -> rest -> Q).\n||S = (P || Q)/{shared/out, shared/in}.');
+  assert.deepEqual(analyze(spec).alphabet, ['rest', 'shared', 'work']);
+  const go = transpile(spec);
+  assert.deepEqual(go.match(/ch_\w+ = make/g), ['ch_shared = make']);
+  assert.match(go, /ch_shared <- struct\{\}\{\} \/\/ send: shared/);
+  assert.match(go, /<-ch_shared \/\/ receive: shared/);
+  assert.doesNotMatch(go, /ch_out|ch_in\b/);
+});
+
+test('a hidden action leaves the external alphabet but still synchronizes', () => {
+  const spec = { ...loadExample('producer_consumer.json'), composition: { name: 'SYS', processes: ['PRODUCER', 'CONSUMER', 'BUFFER'], hide: ['put'] } };
+  const result = analyze(spec);
+  assert.deepEqual(result.alphabet, ['consume', 'get', 'start_produce']);
+  // Hiding does not let PRODUCER and BUFFER move apart: the state space is the same
+  assert.equal(result.stateCount, analyze(loadExample('producer_consumer.json')).stateCount);
+  const go = transpile(spec);
+  assert.match(go, /ch_put <- struct\{\}\{\} \/\/ send: put/);
+  assert.match(go, /\[PRODUCER\] tau: put \(PRODUCING -> READY\)/);
+});
+
+test('completing BUFFER over put and get routes the missing cases to ERROR', () => {
+  const buffer = loadExample('producer_consumer.json').processes.find(p => p.name === 'BUFFER')!;
+  const completed = completeProcess(buffer, ['put', 'get']);
+  assert.deepEqual(completed.transitions.map(t => [t.fromState, t.action, t.toState]), [
+    ['EMPTY', 'put', 'FULL'],
+    ['FULL', 'get', 'EMPTY'],
+    ['EMPTY', 'get', 'ERROR'],
+    ['FULL', 'put', 'ERROR'],
+  ]);
+  assert.equal(buffer.transitions.length, 2);
+});
+
+test('forall launches three workers that all take the dispatched job', { skip: !HAS_GO }, () => {
+  const spec = loadExample('worker_farm.lts');
+  const go = transpile(spec, { shutdownAfterSteps: 3 });
+  assert.match(go, /\twg\.Add\(4\)\n/);
+  assert.match(go, /\tgo Process_DISPATCHER\(&wg\)\n\tgo Process_WORKER_1\(&wg\)\n\tgo Process_WORKER_2\(&wg\)\n\tgo Process_WORKER_3\(&wg\)\n/);
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  for (const worker of ['WORKER_1', 'WORKER_2', 'WORKER_3']) {
+    assert.ok(result.stdout.includes(`[${worker}] action: job (WORKER -> 1)\n`), `${worker} never took a job`);
+  }
+});
@@ -0,0 +1,720 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { readFileSync } from 'fs';
+import { join } from 'path';
+import { transpile, transpileFiles, transpileParallel } from '../src/transpiler';
+import type { LTSSpec, ProcessDefinition } from '../src/transpiler';
+import { EXAMPLES, HAS_GO, fsp, goCommand, loadExample, readExample, runCLI, runGo, runGoFor, vetGo, withTempDir } from './helpers';
+
+test('shared action channels are unbuffered by default', () => {
+  const go = transpile(loadExample('producer_consumer.json'));
+  assert.match(go, /ch_put = make\(chan struct\{\}\) \/\/ shared action: put/);
+  assert.match(go, /ch_get = make\(chan struct\{\}\) \/\/ shared action: get/);
+});
+
+test('bufferSize sets the capacity of every shared action channel', () => {
+  const go = transpile(loadExample('producer_consumer.json'), { bufferSize: 3 });
+  assert.match(go, /ch_put = make\(chan struct\{\}, 3\) \/\/ shared action: put/);
+  assert.match(go, /ch_get = make\(chan struct\{\}, 3\) \/\/ shared action: get/);
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Step-limited shutdown
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Assert that a program with `--shutdown-after-steps` fired exactly `steps`
+ * actions in every process and then returned
+ */
+function assertCleanShutdown(name: string, steps: number): void {
+  const spec = loadExample(name);
+  const result = runGo(transpile(spec, { shutdownAfterSteps: steps }), 30000);
+  assert.equal(result.status, 0, result.stderr);
+  for (const proc of spec.processes) {
+    const actions = result.stdout.split('\n').filter(line => line.startsWith(`[${proc.name}] action:`));
+    assert.equal(actions.length, steps, `${proc.name} fired ${actions.length} actions`);
+    assert.ok(result.stdout.includes(`[${proc.name}] Step limit reached (${steps}), shutting down`));
+  }
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+}
+
+test('producer/consumer shuts down after the step limit', { skip: !HAS_GO }, () => {
+  assertCleanShutdown('producer_consumer.json', 6);
+});
+
+test('choice states with several peers unwind on shutdown', { skip: !HAS_GO }, () => {
+  assertCleanShutdown('producer_consumer_reset.json', 6);
+});
+
+test('a guarded buffer unwinds once the peers of its enabled guards are done', { skip: !HAS_GO }, () => {
+  for (const supervise of [false, true]) {
+    const result = runGo(transpile(loadExample('guarded_buffer.json'), { shutdownAfterSteps: 3, supervise }), 30000);
+    assert.equal(result.status, 0, result.stderr);
+    assert.ok(result.stdout.includes('[PRODUCER] Step limit reached (3), shutting down'));
+    assert.ok(result.stdout.includes('LTS Execution Complete'));
+  }
+});
+
+test('cancelling the context returns every goroutine', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { context: true, noMain: true, package: 'lts' });
+  const check = `package lts
+
+import (
+\t"context"
+\t"errors"
+\t"runtime"
+\t"testing"
+\t"time"
+)
+
+func TestCancel(t *testing.T) {
+\tbefore := runtime.NumGoroutine()
+\tctx, cancel := context.WithCancel(context.Background())
+\ttime.AfterFunc(50*time.Millisecond, cancel)
+\tif err := Run(ctx); !errors.Is(err, context.Canceled) {
+\t\tt.Fatalf("Run returned %v, want context.Canceled", err)
+\t}
+\tfor deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(10 * time.Millisecond) {
+\t\tif time.Now().After(deadline) {
+\t\t\tt.Fatalf("%d goroutine(s) still running after Run returned, %d before", runtime.NumGoroutine(), before)
+\t\t}
+\t}
+}
+`;
+  const result = goCommand({ 'lts.go': go, 'lts_test.go': check }, ['test', '-count=1', '.']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+});
+
+test('the generated main cancels its context once the processes stop', () => {
+  const go = transpile(loadExample('producer_consumer.json'), { context: true, shutdownAfterSteps: 4 });
+  assert.match(go, /defer cancel\(\)/);
+  assert.match(go, /\twg\.Wait\(\)\n\t\/\/ The processes have all returned[^\n]*\n\tcancel\(\)/);
+});
+
+test('a supervised process that panics is restarted from its initial state', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { supervise: true, hooks: true, shutdownAfterSteps: 4 });
+  // The observer runs on the process goroutine, so its panic is the process's
+  const observer = `package main
+
+type panicOnce struct{ done bool }
+
+func (p *panicOnce) OnTransition(process, from, action, to string) {
+\tif process == "CONSUMER" && action == "consume" && !p.done {
+\t\tp.done = true
+\t\tpanic("injected")
+\t}
+}
+
+func init() { Observer = &panicOnce{} }
+`;
+  const result = runGo({ 'main.go': go, 'observer.go': observer }, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  const lines = result.stdout.split('\n');
+  const panicked = lines.indexOf('[CONSUMER] Panic: injected');
+  const restart = lines.indexOf('[CONSUMER] Restarting from the initial state (1 of 3)');
+  assert.ok(panicked >= 0 && restart > panicked, result.stdout);
+  const after = lines.slice(restart + 1).filter(line => line.startsWith('[CONSUMER] action:'));
+  assert.equal(after[0], '[CONSUMER] action: get (WAITING -> CONSUMING)');
+  assert.ok(after.includes('[CONSUMER] action: consume (CONSUMING -> WAITING)'), 'CONSUMER did not carry on after restarting');
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+test('a guarded state picks its shutdown exit from the enabled offers', () => {
+  const go = transpile(loadExample('guarded_buffer.json'), { shutdownAfterSteps: 3 });
+  assert.match(go, /case offer0 != nil && offer1 != nil:\n\t+unwind = peersDone_CONSUMER_PRODUCER\n/);
+  assert.match(go, /case offer0 != nil:\n\t+unwind = done_PRODUCER\n/);
+  assert.match(go, /case offer1 != nil:\n\t+unwind = done_CONSUMER\n/);
+  assert.match(go, /case <-unwind:/);
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Benchmarks
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * Generate a program and its benchmark with the CLI
+ */
+function generateBench(name: string, flags: string[] = []): Record<string, string> {
+  return withTempDir(dir => {
+    const result = runCLI(['--no-cache', '--emit-bench', ...flags, join(EXAMPLES, name), join(dir, 'main.go')]);
+    assert.equal(result.status, 0, result.stderr);
+    return {
+      'main.go': readFileSync(join(dir, 'main.go'), 'utf-8'),
+      'main_bench_test.go': readFileSync(join(dir, 'main_bench_test.go'), 'utf-8'),
+    };
+  });
+}
+
+test('the benchmark compiles and runs a couple of iterations', { skip: !HAS_GO }, () => {
+  const result = goCommand(generateBench('producer_consumer.json'), ['test', '-run', '^$', '-bench', '.', '-benchtime', '2x']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+  assert.match(result.stdout, /BenchmarkSystem\s+2\s/);
+});
+
+test('resetBench only claims to drain channels that are buffered', () => {
+  const unbuffered = generateBench('producer_consumer.json')['main_bench_test.go'];
+  assert.doesNotMatch(unbuffered, /drained/);
+  assert.match(unbuffered, /func resetBench\(\) \{\n\tfor _, n := range actionCounts \{/);
+
+  const buffered = generateBench('producer_consumer.json', ['--buffer-size', '2'])['main_bench_test.go'];
+  assert.match(buffered, /those are drained/);
+  assert.match(buffered, /for len\(ch_put\) > 0 \{\n\t\t<-ch_put\n/);
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Parallel generation
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * A spec of `count` processes in pairs, each pair synchronizing on its own action
+ */
+function syntheticSpec(count: number): LTSSpec {
+  const processes: ProcessDefinition[] = [];
+  for (let i = 0; i < count; i++) {
+    const pair = Math.floor(i / 2);
+    processes.push({
+      name: `P${i}`,
+      initialState: 'IDLE',
+      transitions: [
+        { fromState: 'IDLE', toState: 'BUSY', action: `sync${pair}` },
+        { fromState: 'BUSY', toState: 'IDLE', action: `work${i}` },
+      ],
+    });
+  }
+  return { processes };
+}
+
+test('parallel generation gives the same bytes with 1 and 8 workers', async () => {
+  const spec = syntheticSpec(200);
+  const sequential = transpile(spec);
+  assert.equal(await transpileParallel(spec, {}, 1), sequential);
+  assert.equal(await transpileParallel(spec, {}, 8), sequential);
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Local choices
+// ─────────────────────────────────────────────────────────────────────────────
+
+/**
+ * The generated code of each state case of a process function
+ */
+function stateCases(go: string, process: string): Map<string, string> {
+  const body = go.slice(go.indexOf(`func Process_${process}(`));
+  const cases = new Map<string, string>();
+  for (const match of body.slice(0, body.indexOf('\n}\n')).matchAll(/\t\tcase "([^"]+)":\n((?:\t\t\t.*\n)*)/g)) {
+    cases.set(match[1], match[2]);
+  }
+  return cases;
+}
+
+test('an interrupt is selectable from every state of the interrupted process', () => {
+  const go = transpile(fsp('P = (work -> work -> STOP) /\\ (abort -> STOP).'));
+  const working = Array.from(stateCases(go, 'P')).filter(([, code]) => code.includes('action: work'));
+  assert.equal(working.length, 2);
+  for (const [state, code] of working) {
+    assert.match(code, /^\t\t\tselect \{\n/, state);
+    assert.match(code, /case <-always: \/\/ local: work\n/, state);
+    assert.match(code, /case <-always: \/\/ local: abort\n/, state);
+  }
+  assert.doesNotMatch(go, /picking first/);
+});
+
+test('a choice between local actions is made at random', () => {
+  const go = transpile(loadExample('choice_example.json'));
+  const dispense = stateCases(go, 'VENDING_MACHINE').get('VENDING_MACHINE_COIN_INSERTED')!;
+  assert.match(dispense, /case <-ch_dispense_coffee: \/\/ receive: dispense_coffee\n/);
+  assert.match(dispense, /case <-ch_dispense_tea: \/\/ receive: dispense_tea\n/);
+  assert.match(dispense, /case <-always: \/\/ local: refund\n/);
+
+  const local = stateCases(transpile(fsp('COIN = (heads -> COIN | tails -> COIN).')), 'COIN').get('COIN_COIN')!;
+  assert.match(local, /case <-always: \/\/ local: heads\n/);
+  assert.match(local, /case <-always: \/\/ local: tails\n/);
+
+  const actor = transpile(fsp('P = (work -> work -> STOP) /\\ (abort -> STOP).'), { backend: 'actor' });
+  assert.match(actor, /switch rand\.Intn\(2\) \{ \/\/ choice: work \| abort\n/);
+  assert.match(actor, /\t"math\/rand"\n/);
+});
+
+test('local choices compile under every backend', { skip: !HAS_GO }, () => {
+  for (const backend of ['channels', 'actor', 'mutex'] as const) {
+    const result = vetGo(transpile(fsp('P = (work -> work -> STOP) /\\ (abort -> STOP).'), { backend }));
+    assert.equal(result.status, 0, `${backend}: ${result.stderr}`);
+  }
+});
+
+test('an integer payload travels over typed channels', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer_payload.json'), { shutdownAfterSteps: 4 });
+  assert.match(go, /ch_put = make\(chan int\) \/\/ shared action: put/);
+  assert.match(go, /case ch_put <- item: \/\/ send: put/);
+  assert.match(go, /case item = <-ch_put: \/\/ receive: put/);
+  // consume carries nothing, and stays a plain local action
+  assert.doesNotMatch(go, /ch_consume/);
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /\[CONSUMER\] action: get\(0\) \(WAITING -> CONSUMING\)/);
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Actor and mutex backends
+// ─────────────────────────────────────────────────────────────────────────────
+
+interface LoggedAction {
+  process: string;
+  action: string;
+  from: string;
+  to: string;
+}
+
+/**
+ * The actions a program logged, up to the last complete line, after
+ * checking that each one leaves the state its process is in
+ */
+function followedActions(spec: LTSSpec, stdout: string): LoggedAction[] {
+  const states = new Map(spec.processes.map(p => [p.name, p.initialState]));
+  const logged: LoggedAction[] = [];
+  for (const line of stdout.slice(0, stdout.lastIndexOf('\n')).split('\n')) {
+    const match = /^\[(\w+)\] action: (\w+) \((\w+) -> (\w+)\)$/.exec(line);
+    if (!match) continue;
+    const [, process, action, from, to] = match;
+    assert.equal(from, states.get(process), `${process} took ${action} from ${from}, but was in ${states.get(process)}`);
+    const proc = spec.processes.find(p => p.name === process)!;
+    assert.ok(proc.transitions.some(t => t.fromState === from && t.action === action && t.toState === to), line);
+    states.set(process, to);
+    logged.push({ process, action, from, to });
+  }
+  return logged;
+}
+
+test('the actor backend runs the producer/consumer cycle', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer.json');
+  const go = transpile(spec, { backend: 'actor' });
+  assert.equal(vetGo(go).status, 0);
+  const logged = followedActions(spec, runGoFor(go, 500).stdout);
+  const count = (process: string, action: string) => logged.filter(a => a.process === process && a.action === action).length;
+  assert.ok(count('CONSUMER', 'consume') > 0, 'no item went through the buffer');
+  // Both ends of a shared action take it together, give or take the one in flight when the program stopped
+  for (const [action, peer] of [['put', 'PRODUCER'], ['get', 'CONSUMER']]) {
+    assert.ok(Math.abs(count('BUFFER', action) - count(peer, action)) <= 1, `BUFFER and ${peer} disagree on ${action}`);
+  }
+});
+
+test('the mutex backend keeps the producer/consumer ordering', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer.json');
+  const go = transpile(spec, { backend: 'mutex' });
+  assert.equal(vetGo(go).status, 0);
+  // One driver fires every action, so the log is the order the system took them in
+  const logged = followedActions(spec, runGoFor(go, 200).stdout);
+  assert.ok(logged.length > 12, `only ${logged.length} actions ran`);
+  let puts = 0;
+  let gets = 0;
+  for (const { process, action } of logged) {
+    if (action === 'put' && process === 'PRODUCER') puts++;
+    if (action === 'get' && process === 'CONSUMER') gets++;
+    assert.ok(gets <= puts && puts <= gets + 1, `${puts} puts and ${gets} gets: the buffer holds one item`);
+  }
+});
+
+test('the actor and mutex backends say which options they leave to the channels backend', () => {
+  for (const backend of ['actor', 'mutex'] as const) {
+    assert.throws(() => transpile(loadExample('producer_consumer.json'), { backend, shutdownAfterSteps: 4 }),
+      new RegExp(`The ${backend} backend does not support shutdownAfterSteps; only the channels backend does`));
+  }
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Local actions
+// ─────────────────────────────────────────────────────────────────────────────
+
+test('the checked-in producer/consumer sample is the generated program', () => {
+  assert.equal(readExample('producer_consumer.go'), runCLI(['--no-cache', join(EXAMPLES, 'producer_consumer.json')]).stdout);
+});
+
+test('a newly added local action fires in place without a channel', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer.json');
+  const consumer = spec.processes.find(proc => proc.name === 'CONSUMER')!;
+  const consume = consumer.transitions.find(t => t.action === 'consume')!;
+  consumer.transitions.push({ fromState: 'INSPECTING', toState: consume.toState, action: 'inspect' });
+  consume.toState = 'INSPECTING';
+
+  const go = transpile(spec, { shutdownAfterSteps: 6 });
+  assert.doesNotMatch(go, /ch_inspect|actionSink/);
+  assert.match(go, /action: inspect \(INSPECTING -> WAITING\)/);
+
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  assert.ok(result.stdout.includes('[CONSUMER] action: inspect (INSPECTING -> WAITING)'));
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+test('an action shared by three processes fires in all three together', { skip: !HAS_GO }, () => {
+  // B can always take x instead, so the coordinator has to back out of rounds that B leaves
+  const go = transpile(fsp('A = (sync -> A).\nB = (sync -> B | x -> B).\nC = (x -> sync -> C).'), { shutdownAfterSteps: 6 });
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  const syncs = result.stdout.split('\n').filter(line => line.includes('] action: sync')).map(line => line.slice(1, 2));
+  assert.ok(syncs.length > 0, 'sync never fired');
+  // Each round logs every participant once before any of them logs the next round
+  for (let i = 0; i < syncs.length; i += 3) {
+    assert.deepEqual(syncs.slice(i, i + 3).sort(), ['A', 'B', 'C'], `round ${i / 3 + 1}: ${syncs.join(' ')}`);
+  }
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+// ─────────────────────────────────────────────────────────────────────────────
+// Trace replay
+// ─────────────────────────────────────────────────────────────────────────────
+
+test('replay with a step limit declares no unused exits for choices with several peers', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer_reset.json');
+  const go = transpile(spec, { replay: 'trace.jsonl', shutdownAfterSteps: 6 });
+  assert.doesNotMatch(go, /peersDone_/);
+  const result = vetGo(go);
+  assert.equal(result.status, 0, result.stderr);
+});
+
+test('a short run writes one trace line per transition with its branch', { skip: !HAS_GO }, () => {
+  withTempDir(dir => {
+    const trace = join(dir, 'trace.jsonl');
+    const result = runGo(transpile(fsp('P = (a -> Q), Q = (b -> STOP | c -> STOP).'), { traceFile: trace }));
+    assert.equal(result.status, 0, result.stderr);
+    const lines = readFileSync(trace, 'utf-8').trimEnd().split('\n').map(line => JSON.parse(line));
+    assert.equal(lines.length, 2);
+    assert.deepEqual(lines[0], { seq: 1, process: 'P', from: 'P', action: 'a', to: 'Q', branch: 0 });
+    const chosen = lines[1].action as string;
+    assert.deepEqual(lines[1], { seq: 2, process: 'P', from: 'Q', action: chosen, to: 'STOP', branch: chosen === 'b' ? 0 : 1 });
+    assert.ok(result.stdout.includes(`[P] action: ${chosen} (Q -> STOP)`));
+  });
+});
+
+test('replaying a recorded trace reproduces the run', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer_reset.json');
+  withTempDir(dir => {
+    const trace = join(dir, 'trace.jsonl');
+    const actions = (output: string) => output.split('\n').filter(line => line.includes('] action: '));
+
+    const recorded = runGo(transpile(spec, { traceFile: trace, shutdownAfterSteps: 6 }), 30000);
+    assert.equal(recorded.status, 0, recorded.stderr);
+    const replayed = runGo(transpile(spec, { replay: trace, shutdownAfterSteps: 6 }), 30000);
+    assert.equal(replayed.status, 0, replayed.stderr);
+    assert.deepEqual(actions(replayed.stdout), actions(recorded.stdout));
+  });
+});
+
+test('a 10ms action timeout guards both ends of put with time.After', () => {
+  const go = transpile(loadExample('producer_consumer.json'), { actionTimeout: '10ms' });
+  assert.match(go, /var actionTimeout = 10 \* time\.Millisecond/);
+  assert.match(go, /case <-ch_put: \/\/ receive: put\n\t+case <-time\.After\(actionTimeout\):/);
+  assert.match(go, /case ch_put <- struct\{\}\{\}: \/\/ send: put\n\t+case <-time\.After\(actionTimeout\):/);
+  assert.throws(() => transpile(loadExample('producer_consumer.json'), { actionTimeout: 'soon' }), /actionTimeout must be a duration/);
+});
+
+test('slog mode logs each action as key/value pairs', { skip: !HAS_GO }, () => {
+  const spec = loadExample('producer_consumer.json');
+  assert.doesNotMatch(transpile(spec), /slog/);
+  const go = transpile(spec, { logger: 'slog', shutdownAfterSteps: 2 });
+  assert.match(go, /var logger = slog\.Default\(\)/);
+  assert.match(go, /logger\.Info\("action", "process", "PRODUCER", "action", "put", "from", "PRODUCING", "to", "READY"\)/);
+  assert.doesNotMatch(go, /fmt\.Printf\("\[PRODUCER\] action:/);
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stderr, /INFO action process=PRODUCER action=put from=PRODUCING to=READY/);
+  assert.match(result.stderr, /INFO action process=BUFFER action=get from=FULL to=EMPTY/);
+});
+
+test('split mode writes one file per process into a single package', { skip: !HAS_GO }, () => {
+  const files = transpileFiles(loadExample('producer_consumer.json'), { package: 'pc', noMain: true });
+  assert.deepEqual([...files.keys()], ['channels.go', 'run.go', 'producer.go', 'consumer.go', 'buffer.go']);
+  for (const [name, content] of files) {
+    assert.match(content, /^package pc\n/, name);
+  }
+  const declaring = [...files].filter(([, content]) => content.includes('// shared action: put')).map(([name]) => name);
+  assert.deepEqual(declaring, ['channels.go']);
+  const result = vetGo(Object.fromEntries(transpileFiles(loadExample('producer_consumer.json'))));
+  assert.equal(result.status, 0, result.stderr);
+});
+
+test('counters record as many puts as gets over a bounded run', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { counters: true, shutdownAfterSteps: 4, noMain: true, package: 'lts' });
+  assert.match(go, /var actionCounts = map\[string\]\*atomic\.Int64\{/);
+  const check = `package lts
+
+import (
+\t"context"
+\t"testing"
+)
+
+func TestCounts(t *testing.T) {
+\tif err := Run(context.Background()); err != nil {
+\t\tt.Fatal(err)
+\t}
+\tcounts := ActionCounts()
+\tif counts["put"] != 2 || counts["get"] != 2 {
+\t\tt.Fatalf("put fired %d times and get %d times, want 2 each", counts["put"], counts["get"])
+\t}
+}
+`;
+  const result = goCommand({ 'lts.go': go, 'lts_test.go': check }, ['test', '-count=1', '.']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+});
+
+test('a state offering get and reset selects between a receive and a send', { skip: !HAS_GO }, () => {
+  const spec = fsp(`PRODUCER = (put -> PRODUCER | reset -> PRODUCER).
+CONSUMER = (get -> CONSUMER | reset -> CONSUMER).
+BUFFER = (put -> get -> BUFFER).
+||SYS = (PRODUCER || CONSUMER || BUFFER).`);
+  const go = transpile(spec);
+  const consumer = go.slice(go.indexOf('func Process_CONSUMER'), go.indexOf('func Process_BUFFER'));
+  assert.match(consumer, /\t\t\tselect \{\n\t\t\tcase <-ch_get: \/\/ receive: get\n(.*\n){2}\t\t\tcase ch_reset <- struct\{\}\{\}: \/\/ send: reset\n/);
+  const result = vetGo(go);
+  assert.equal(result.status, 0, result.stderr);
+});
+
+test('a process that reaches STOP returns after its last action', { skip: !HAS_GO }, () => {
+  const result = runGo(transpile(fsp('P = (a -> STOP).')));
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /\[P\] action: a \(P -> STOP\)\n\[P\] Reached terminal state: STOP\n/);
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+test('entering ERROR panics with the name of the process', { skip: !HAS_GO }, () => {
+  const result = runGo(transpile(fsp('P = (a -> ERROR).')));
+  assert.notEqual(result.status, 0);
+  assert.match(result.stdout, /\[P\] Reached ERROR state\n/);
+  assert.match(result.stderr, /panic: LTS process P reached ERROR/);
+});
+
+test('a prioritized action is tried before the rest of the select', () => {
+  const go = transpile(fsp('P = (urgent -> P | routine -> P).\nQ = (urgent -> Q | routine -> Q).\n||SYS = (P || Q) << {urgent}.'));
+  assert.match(go, /\t\t\tselect \{\n\t\t\tcase ch_urgent <- struct\{\}\{\}: \/\/ send: urgent \(priority\)\n(.*\n){2}\t\t\tdefault:\n\t\t\t\tselect \{\n/);
+});
+
+test('the same seed replays the same choices', { skip: !HAS_GO }, () => {
+  const spec = fsp('P = (a -> P | b -> P).');
+  const run = (seed: number) => {
+    const result = runGo(transpile(spec, { seed, shutdownAfterSteps: 20 }), 30000);
+    assert.equal(result.status, 0, result.stderr);
+    return result.stdout;
+  };
+  const first = run(7);
+  assert.equal(run(7), first);
+  assert.notEqual(run(8), first);
+});
+
+test('the emitted producer/consumer tests compile and pass', { skip: !HAS_GO }, () => {
+  withTempDir(dir => {
+    const output = join(dir, 'main.go');
+    const generated = runCLI(['--no-cache', '--emit-tests', '-o', output, '../examples/producer_consumer.json']);
+    assert.equal(generated.status, 0, generated.stderr);
+    const tests = readFileSync(join(dir, 'main_test.go'), 'utf-8');
+    for (const name of ['PRODUCER', 'CONSUMER', 'BUFFER']) {
+      assert.match(tests, new RegExp(`func TestProcess_${name}\\(t \\*testing\\.T\\)`));
+    }
+    const result = goCommand({ 'main.go': readFileSync(output, 'utf-8'), 'main_test.go': tests }, ['test', '-count=1', '-v', '.']);
+    assert.equal(result.status, 0, result.stdout + result.stderr);
+    assert.match(result.stdout, /--- PASS: TestProcess_BUFFER/);
+  });
+});
+
+test('nonblocking mode gives up on a runtime deadlock with a warning', { skip: !HAS_GO }, () => {
+  const go = transpile(fsp('P = (a -> b -> P).\nQ = (b -> a -> Q).\n||S = (P || Q).'), { nonblocking: true });
+  assert.match(go, /\nvar deadlockThreshold = 1000\n/);
+  const result = runGo(go.replace('var deadlockThreshold = 1000', 'var deadlockThreshold = 50'), 30000);
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /\[P\] Possible deadlock: no progress on a after 50 attempts\n/);
+  assert.match(result.stdout, /\[Q\] Possible deadlock: no progress on b after 50 attempts\n/);
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+test('an Observer records the producer/consumer transitions', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { hooks: true, shutdownAfterSteps: 4, noMain: true, package: 'lts' });
+  const check = `package lts
+
+import (
+\t"context"
+\t"reflect"
+\t"sync"
+\t"testing"
+)
+
+type recorder struct {
+\tmu    sync.Mutex
+\tsteps map[string][]string
+}
+
+func (r *recorder) OnTransition(process, from, action, to string) {
+\tr.mu.Lock()
+\tdefer r.mu.Unlock()
+\tr.steps[process] = append(r.steps[process], from+" -"+action+"-> "+to)
+}
+
+func TestObserver(t *testing.T) {
+\tr := &recorder{steps: map[string][]string{}}
+\tObserver = r
+\tif err := Run(context.Background()); err != nil {
+\t\tt.Fatal(err)
+\t}
+\twant := map[string][]string{
+\t\t"PRODUCER": {"READY -start_produce-> PRODUCING", "PRODUCING -put-> READY", "READY -start_produce-> PRODUCING", "PRODUCING -put-> READY"},
+\t\t"CONSUMER": {"WAITING -get-> CONSUMING", "CONSUMING -consume-> WAITING", "WAITING -get-> CONSUMING", "CONSUMING -consume-> WAITING"},
+\t\t"BUFFER":   {"EMPTY -put-> FULL", "FULL -get-> EMPTY", "EMPTY -put-> FULL", "FULL -get-> EMPTY"},
+\t}
+\tif !reflect.DeepEqual(r.steps, want) {
+\t\tt.Fatalf("observed %v, want %v", r.steps, want)
+\t}
+}
+`;
+  const result = goCommand({ 'lts.go': go, 'lts_test.go': check }, ['test', '-count=1', '.']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+});
+
+test('a broadcast reaches both subscribers through their own channels', { skip: !HAS_GO }, () => {
+  const spec = fsp('PUB = (@broadcast news -> PUB).\nA = (news -> read_a -> A).\nB = (news -> read_b -> B).\n||S = (PUB || A || B).');
+  assert.deepEqual(spec.actions, { news: { broadcast: true, sender: 'PUB' } });
+  const go = transpile(spec, { shutdownAfterSteps: 4 });
+  assert.match(go, /\tgo broadcast\(ch_news, \[\]chan struct\{\}\{ch_news_A, ch_news_B\}, /);
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  for (const name of ['A', 'B']) {
+    assert.equal(result.stdout.split('\n').filter(line => line === `[${name}] action: news (${name} -> 1)`).length, 2, result.stdout);
+  }
+});
+
+test('tau changes state in place without a channel, even when two processes use it', () => {
+  const go = transpile(fsp('P = (a -> tau -> b -> STOP).\nQ = (a -> tau -> b -> STOP).\n||S = (P || Q).'));
+  assert.doesNotMatch(go, /ch_tau/);
+  // Each process takes its own tau, so the two never synchronize
+  assert.match(go, /\t\tcase "P_1":\n\t\t\tfmt\.Printf\("\[P\] tau: tau\.P \(1 -> 2\)\\n"\)\n\t\t\tstate = "P_2"\n/);
+  assert.match(go, /\t\tcase "Q_1":\n\t\t\tfmt\.Printf\("\[Q\] tau: tau\.Q \(1 -> 2\)\\n"\)\n\t\t\tstate = "Q_2"\n/);
+});
+
+test('fair choice fires every branch about equally often', { skip: !HAS_GO }, () => {
+  const go = transpile(fsp('P = (a -> P | b -> P | c -> P).'), { fair: true, shutdownAfterSteps: 300 });
+  assert.match(go, /\tvar taken_P \[3\]int\n/);
+  const result = runGo(go, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  const counts = ['a', 'b', 'c'].map(action => result.stdout.split(`[P] action: ${action} `).length - 1);
+  assert.equal(counts.reduce((sum, n) => sum + n), 300);
+  assert.ok(Math.max(...counts) - Math.min(...counts) <= 1, `counts ${counts.join(', ')}`);
+});
+
+test('--run-for 50ms times the whole system out from main', { skip: !HAS_GO }, () => {
+  const generated = runCLI(['--no-cache', '--run-for', '50ms', '../examples/producer_consumer.json']);
+  assert.equal(generated.status, 0, generated.stderr);
+  const main = generated.stdout.slice(generated.stdout.indexOf('func main()'));
+  assert.match(main, /\tctx, cancel := context\.WithTimeout\(context\.Background\(\), runFor\)\n/);
+  assert.match(main, /\tgo Process_PRODUCER\(ctx, &wg\)\n/);
+  const result = runGo(generated.stdout, 30000);
+  assert.equal(result.status, 0, result.stderr);
+  assert.ok(result.stdout.includes('LTS Execution Complete'));
+});
+
+test('--signals wires SIGINT and SIGTERM to the cancel of the shared context', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { context: true, signals: true });
+  assert.match(go, /\n\t"os\/signal"\n/);
+  assert.match(go, /\tsignal\.Notify\(signals, os\.Interrupt, syscall\.SIGTERM\)\n/);
+  assert.match(go, /\t\tcase sig := <-signals:\n(.*\n){4}\t\t\tcancel\(\)\n/);
+  assert.match(go, /\tgo Process_PRODUCER\(ctx, &wg\)\n/);
+  const result = vetGo(go);
+  assert.equal(result.status, 0, result.stderr);
+});
+
+test('integer states switch on typed constants and the benchmark runs', { skip: !HAS_GO }, () => {
+  const files = generateBench('producer_consumer.json', ['--int-states']);
+  const go = files['main.go'];
+  assert.match(go, /\tPRODUCER_PRODUCING state_PRODUCER = iota\n\tPRODUCER_READY\n/);
+  assert.match(go, /\tstate := PRODUCER_READY\n/);
+  assert.match(go, /\t\tcase PRODUCER_PRODUCING:\n/);
+  assert.doesNotMatch(go, /case "PRODUCER_/);
+  const result = goCommand(files, ['test', '-run', '^$', '-bench', '.', '-benchtime', '2x']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+  assert.match(result.stdout, /BenchmarkSystem\s+2\s/);
+});
+
+test('a process that stops closes its channels so no peer is left blocked', { skip: !HAS_GO }, () => {
+  const spec = fsp('P = (a -> b -> STOP).\nQ = (a -> Q | b -> Q).\n||S = (P || Q).');
+  const go = transpile(spec, { noMain: true, package: 'lts' });
+  assert.match(go, /\tdefer closeOnce_a\.Do\(func\(\) \{ close\(ch_a\) \}\)\n/);
+  assert.match(go, /\t\t\tcase _, ok = <-ch_a: \/\/ receive: a\n/);
+  const check = `package lts
+
+import (
+\t"context"
+\t"runtime"
+\t"testing"
+\t"time"
+)
+
+func TestNoneBlocked(t *testing.T) {
+\tbefore := runtime.NumGoroutine()
+\tif err := Run(context.Background()); err != nil {
+\t\tt.Fatal(err)
+\t}
+\tfor deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before; time.Sleep(10 * time.Millisecond) {
+\t\tif time.Now().After(deadline) {
+\t\t\tt.Fatalf("%d goroutine(s) still running after Run returned, %d before", runtime.NumGoroutine(), before)
+\t\t}
+\t}
+}
+`;
+  const result = goCommand({ 'lts.go': go, 'lts_test.go': check }, ['test', '-count=1', '-timeout', '20s', '.']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+});
+
+test('a sequential composition runs its parts one after the other', { skip: !HAS_GO }, () => {
+  const result = runGo(transpile(fsp('P = (a -> STOP) ; (b -> STOP).')));
+  assert.equal(result.status, 0, result.stderr);
+  assert.match(result.stdout, /\[P\] action: a \(P -> 2\.0\)\n\[P\] action: b \(2\.0 -> STOP\)\n\[P\] Reached terminal state: STOP\n/);
+});
+
+test('weighted choice fires its branches about as often as their weights say', { skip: !HAS_GO }, () => {
+  const spec = fsp('P = (0.7: ok -> P | 0.3: fail -> P).');
+  assert.deepEqual(spec.processes[0].transitions.map(t => [t.action, t.weight]), [['ok', 0.7], ['fail', 0.3]]);
+  const result = runGo(transpile(spec, { seed: 1, shutdownAfterSteps: 2000 }), 30000);
+  assert.equal(result.status, 0, result.stderr);
+  const ok = result.stdout.split('[P] action: ok ').length - 1;
+  const fail = result.stdout.split('[P] action: fail ').length - 1;
+  assert.equal(ok + fail, 2000);
+  assert.ok(Math.abs(ok / 2000 - 0.7) < 0.05, `ok fired ${ok} of 2000 times`);
+  assert.throws(() => transpile(fsp('P = (0: ok -> P | 1: fail -> P).')), /weight of P -ok-> P must be a positive number, got 0/);
+});
+
+test('tick@100ms waits on time.After before the tick fires', () => {
+  const spec = fsp('P = (tick@100ms -> P).');
+  assert.deepEqual(spec.actions, { tick: { delay: '100ms' } });
+  assert.match(transpile(spec), /\t\tcase "P_P":\n\t\t\t<-time\.After\(100 \* time\.Millisecond\) \/\/ delay: tick\n\t\t\tfmt\.Printf\("\[P\] action: tick \(P -> P\)\\n"\)\n/);
+});
+
+test('expvar publishes the action counts and states of the system', { skip: !HAS_GO }, () => {
+  const go = transpile(loadExample('producer_consumer.json'), { expvar: 'localhost:0', shutdownAfterSteps: 2 });
+  assert.match(go, /\tmetrics += expvar\.NewMap\("System"\)\n/);
+  const check = `package main
+
+import (
+\t"expvar"
+\t"testing"
+)
+
+func TestMetrics(t *testing.T) {
+\tmain()
+\twant := \`{"actions": {"consume": 1, "get": 1, "put": 1, "start_produce": 1}, "states": {"BUFFER": "EMPTY", "CONSUMER": "WAITING", "PRODUCER": "READY"}}\`
+\tif got := expvar.Get("System").String(); got != want {
+\t\tt.Fatalf("published %s, want %s", got, want)
+\t}
+}
+`;
+  const result = goCommand({ 'main.go': go, 'main_test.go': check }, ['test', '-count=1', '.']);
+  assert.equal(result.status, 0, result.stdout + result.stderr);
+});
+
+test('prometheus registers the action counter vec and serves it at /metrics', () => {
+  const go = transpile(loadExample('producer_consumer.json'), { prometheus: ':9090' });
+  assert.match(go, /\t"github\.com\/prometheus\/client_golang\/prometheus\/promauto"\n/);
+  assert.match(go, /\tpromActions = promauto\.NewCounterVec\(prometheus\.CounterOpts\{\n\t\tName: +"anvilts_action_total",\n[^]*?\}, \[\]string\{"process", "action"\}\)\n/);
+  assert.match(go, /\t\t\tpromActions\.WithLabelValues\("PRODUCER", "put"\)\.Inc\(\)\n/);
+  assert.match(go, /\t\tmux\.Handle\("\/metrics", promhttp\.Handler\(\)\)\n\t\tif err := http\.ListenAndServe\(":9090", mux\); err != nil \{\n/);
+  // Both sides of a shared action count it
+  assert.equal(go.match(/promActions\.WithLabelValues\("\w+", "put"\)\.Inc\(\)/g)?.length, 2);
+  const cli = runCLI(['--no-cache', '--prometheus', ':9090', '../examples/producer_consumer.json']);
+  assert.equal(cli.status, 0, cli.stderr);
+  assert.equal(cli.stdout, go);
+});
@@ -0,0 +1,115 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { duplicateTransitions, nondeterministicTransitions, unreachableStates, validateSpec } from '../src/validate';
+import { transpile } from '../src/transpiler';
+import { fsp, loadExample, runCLI } from './helpers';
+
+test('a shared action that only one process uses is a warning', () => {
+  const spec = { ...loadExample('producer_consumer.json'), shared: ['put', 'get', 'consume'] };
+  assert.deepEqual(validateSpec(spec), [{
+    severity: 'warning',
+    process: 'CONSUMER',
+    message: 'action consume is declared shared, but no other process uses it, so it can never happen',
+  }]);
+});
+
+test('declaring consume shared turns its log line into a channel', () => {
+  const plain = transpile(loadExample('producer_consumer.json'));
+  assert.doesNotMatch(plain, /ch_consume/);
+  const spec = { ...loadExample('producer_consumer.json'), shared: ['put', 'get', 'consume'] };
+  const go = transpile(spec);
+  assert.match(go, /ch_consume = make\(chan struct\{\}\) \/\/ shared action: consume/);
+  assert.match(go, /ch_consume <- struct\{\}\{\} \/\/ send: consume/);
+  assert.match(transpile(spec, { backend: 'mutex' }), /consume is declared shared, but only CONSUMER takes part/);
+  assert.doesNotThrow(() => transpile(spec, { backend: 'actor' }));
+});
+
+test('declared shared actions get channels and the rest stay local', () => {
+  const spec = { ...loadExample('producer_consumer.json'), shared: ['put', 'get'] };
+  assert.deepEqual(validateSpec(spec), []);
+  const go = transpile(spec);
+  assert.match(go, /ch_put = make/);
+  assert.match(go, /ch_get = make/);
+  assert.doesNotMatch(go, /ch_consume|ch_start_produce/);
+});
+
+test('a typo in the composition and a typo in a target are both reported', () => {
+  const spec = loadExample('producer_consumer.json');
+  spec.processes[0].transitions[1].toState = 'PRODUCER_REDY';
+  spec.composition = { name: 'SYS', processes: ['PRODUCER', 'CONSUMR', 'BUFFER'], line: 30 };
+  assert.deepEqual(validateSpec(spec), [
+    { severity: 'error', message: 'composition SYS refers to undefined process CONSUMR (line 30); did you mean CONSUMER?' },
+    { severity: 'error', process: 'PRODUCER', message: 'state PRODUCER_REDY is never defined, but PRODUCING -put-> leads to it' },
+  ]);
+});
+
+test('the composition error of a JSON spec points at its line', () => {
+  const spec = { processes: [{ name: 'P', initialState: 'S', transitions: [{ fromState: 'S', toState: 'S', action: 'a' }] }], composition: { name: 'SYS', processes: ['P', 'Q'] } };
+  const result = runCLI(['--no-cache', '-o', '/dev/null', '-'], JSON.stringify(spec, null, 2));
+  assert.notEqual(result.status, 0);
+  assert.match(result.stderr, /composition SYS refers to undefined process Q \(line 15\)/);
+});
+
+test('an orphaned state is flagged, and is fatal only under --strict', () => {
+  for (const proc of loadExample('producer_consumer.json').processes) {
+    assert.deepEqual(unreachableStates(proc), []);
+  }
+  const spec = {
+    processes: [{
+      name: 'P',
+      initialState: 'A',
+      transitions: [
+        { fromState: 'A', action: 'a', toState: 'A' },
+        { fromState: 'DEAD', action: 'b', toState: 'A' },
+      ],
+    }],
+  };
+  assert.deepEqual(unreachableStates(spec.processes[0]), ['DEAD']);
+  const loose = runCLI(['--no-cache', '-o', '/dev/null', '-'], JSON.stringify(spec));
+  assert.equal(loose.status, 0, loose.stderr);
+  assert.match(loose.stderr, /Warning: Process P: state DEAD is unreachable from initial state A/);
+  const strict = runCLI(['--no-cache', '--strict', '-o', '/dev/null', '-'], JSON.stringify(spec));
+  assert.equal(strict.status, 1);
+  assert.match(strict.stderr, /Error: 1 problem found, no code generated/);
+});
+
+test('two tosses to different sides are flagged as nondeterministic', () => {
+  for (const proc of loadExample('producer_consumer.json').processes) {
+    assert.deepEqual(nondeterministicTransitions(proc), []);
+  }
+  const spec = fsp('COIN = (toss -> HEADS | toss -> TAILS), HEADS = (heads -> COIN), TAILS = (tails -> COIN).');
+  assert.deepEqual(nondeterministicTransitions(spec.processes[0]).map(t => [t.fromState, t.action, t.toState]), [
+    ['COIN', 'toss', 'HEADS'],
+    ['COIN', 'toss', 'TAILS'],
+  ]);
+  assert.deepEqual(validateSpec(spec), [{
+    severity: 'warning',
+    process: 'COIN',
+    message: 'state COIN is nondeterministic on toss, which can lead to HEADS or TAILS',
+  }]);
+});
+
+test('a copy-pasted transition is reported with the lines of both copies', () => {
+  for (const proc of loadExample('producer_consumer.json').processes) {
+    assert.deepEqual(duplicateTransitions(proc), []);
+  }
+  const source = `{
+  "processes": [{
+    "name": "P", "initialState": "A",
+    "transitions": [
+      { "fromState": "A", "action": "a", "toState": "A" },
+      { "fromState": "A", "action": "a", "toState": "A" }
+    ]
+  }]
+}
+`;
+  const loose = runCLI(['--no-cache', '-o', '/dev/null', '-'], source);
+  assert.equal(loose.status, 0, loose.stderr);
+  assert.match(loose.stderr, /Warning: Process P: transition A -a-> A is defined 2 times \(lines 5, 6\)\n/);
+  assert.equal(runCLI(['--no-cache', '--strict', '-o', '/dev/null', '-'], source).status, 1);
+  assert.deepEqual(validateSpec(fsp('P = (a -> P | b -> P | a -> P).')), [{
+    severity: 'warning',
+    process: 'P',
+    message: 'transition P -a-> P is defined 2 times (line 1)',
+  }]);
+});
@@ -0,0 +1,32 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { walk } from '../src/visitor';
+import { loadExample } from './helpers';
+
+test('a counting visitor sees the six producer/consumer transitions in order', () => {
+  const seen: string[] = [];
+  let transitions = 0;
+  walk(loadExample('producer_consumer.json'), {
+    visitProcess: proc => void seen.push(proc.name),
+    visitState: (_, state) => void seen.push(state),
+    visitTransition: (_, t) => {
+      transitions++;
+      seen.push(`${t.fromState} -${t.action}->`);
+    },
+  });
+  assert.equal(transitions, 6);
+  assert.deepEqual(seen, [
+    'PRODUCER', 'READY', 'READY -start_produce->', 'PRODUCING', 'PRODUCING -put->',
+    'CONSUMER', 'WAITING', 'WAITING -get->', 'CONSUMING', 'CONSUMING -consume->',
+    'BUFFER', 'EMPTY', 'EMPTY -put->', 'FULL', 'FULL -get->',
+  ]);
+});
+
+test('returning false from visitProcess skips its states and transitions', () => {
+  let transitions = 0;
+  walk(loadExample('producer_consumer.json'), {
+    visitProcess: proc => proc.name !== 'BUFFER',
+    visitTransition: () => void transitions++,
+  });
+  assert.equal(transitions, 4);
+});
@@ -0,0 +1,28 @@
+import { test } from 'node:test';
+import assert from 'node:assert/strict';
+import { mkdtempSync, rmSync, writeFileSync } from 'fs';
+import { tmpdir } from 'os';
+import { join } from 'path';
+import { watchInput } from '../src/watch';
+
+const sleep = (ms: number) => new Promise(resolve => setTimeout(resolve, ms));
+
+test('touching the input regenerates once per burst of writes', async () => {
+  const dir = mkdtempSync(join(tmpdir(), 'anvilts-watch-'));
+  const file = join(dir, 'spec.lts');
+  writeFileSync(file, 'P = (a -> P).\n');
+  let changes = 0;
+  const stop = watchInput(file, () => changes++, { intervalMs: 10, debounceMs: 100 });
+  try {
+    await sleep(50);
+    assert.equal(changes, 0);
+    writeFileSync(file, 'P = (a -> b -> P).\n');
+    await sleep(30);
+    writeFileSync(file, 'P = (a -> b -> c -> P).\n');
+    await sleep(300);
+    assert.equal(changes, 1);
+  } finally {
+    stop();
+    rmSync(dir, { recursive: true, force: true });
+  }
+});
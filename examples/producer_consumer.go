@@ -6,12 +6,10 @@ import (
 )
 
 
-// Channels for action synchronization
+// Channels for action synchronization (shared actions only)
 var (
-	ch_consume = make(chan struct{}) // action: consume
-	ch_get = make(chan struct{}) // action: get
-	ch_put = make(chan struct{}) // action: put
-	ch_start_produce = make(chan struct{}) // action: start_produce
+	ch_get = make(chan struct{}) // shared action: get
+	ch_put = make(chan struct{}) // shared action: put
 )
 
 // Process_PRODUCER implements the PRODUCER process
@@ -28,7 +26,6 @@ func Process_PRODUCER(wg *sync.WaitGroup) {
 			fmt.Printf("[PRODUCER] action: put (PRODUCING -> READY)\n")
 			state = "PRODUCER_READY"
 		case "PRODUCER_READY":
-			ch_start_produce <- struct{}{} // action: start_produce
 			fmt.Printf("[PRODUCER] action: start_produce (READY -> PRODUCING)\n")
 			state = "PRODUCER_PRODUCING"
 		default:
@@ -48,7 +45,6 @@ func Process_CONSUMER(wg *sync.WaitGroup) {
 	for {
 		switch state {
 		case "CONSUMER_CONSUMING":
-			ch_consume <- struct{}{} // action: consume
 			fmt.Printf("[CONSUMER] action: consume (CONSUMING -> WAITING)\n")
 			state = "CONSUMER_WAITING"
 		case "CONSUMER_WAITING":
@@ -86,19 +82,6 @@ func Process_BUFFER(wg *sync.WaitGroup) {
 	}
 }
 
-// actionSink receives from non-shared action channels to prevent deadlock
-func actionSink(wg *sync.WaitGroup) {
-	defer wg.Done()
-	for {
-		select {
-		case <-ch_consume:
-			// sink for non-shared action: consume
-		case <-ch_start_produce:
-			// sink for non-shared action: start_produce
-		}
-	}
-}
-
 func main() {
 	fmt.Println("═══════════════════════════════════════════════════════════════")
 	fmt.Println("  LTS Execution Started")
@@ -107,16 +90,13 @@ func main() {
 
 	var wg sync.WaitGroup
 
-	wg.Add(4)
+	wg.Add(3)
 
 	// Launch process goroutines
 	go Process_PRODUCER(&wg)
 	go Process_CONSUMER(&wg)
 	go Process_BUFFER(&wg)
 
-	// Launch action sink for non-shared actions
-	go actionSink(&wg)
-
 	// Wait for all processes to complete
 	wg.Wait()
 
@@ -124,4 +104,4 @@ func main() {
 	fmt.Println("═══════════════════════════════════════════════════════════════")
 	fmt.Println("  LTS Execution Complete")
 	fmt.Println("═══════════════════════════════════════════════════════════════")
-}
\ No newline at end of file
+}
@@ -0,0 +1,124 @@
+use std::sync::mpsc::{self, Receiver, SyncSender};
+use std::thread;
+
+/// States of the PRODUCER process
+enum ProducerState {
+    Producing,
+    Ready,
+}
+
+/// States of the CONSUMER process
+enum ConsumerState {
+    Consuming,
+    Waiting,
+}
+
+/// States of the BUFFER process
+enum BufferState {
+    Empty,
+    Full,
+}
+
+/// Runs the PRODUCER process
+fn process_producer(put_rx: Receiver<()>) {
+    println!("[PRODUCER] Starting...");
+
+    let mut state = ProducerState::Ready;
+
+    loop {
+        state = match state {
+            ProducerState::Producing => {
+                if put_rx.recv().is_err() { // receive: put
+                    println!("[PRODUCER] put can no longer happen: BUFFER has stopped");
+                    return;
+                }
+                println!("[PRODUCER] action: put (PRODUCING -> READY)");
+                ProducerState::Ready
+            }
+            ProducerState::Ready => {
+                println!("[PRODUCER] action: start_produce (READY -> PRODUCING)");
+                ProducerState::Producing
+            }
+        };
+    }
+}
+
+/// Runs the CONSUMER process
+fn process_consumer(get_rx: Receiver<()>) {
+    println!("[CONSUMER] Starting...");
+
+    let mut state = ConsumerState::Waiting;
+
+    loop {
+        state = match state {
+            ConsumerState::Consuming => {
+                println!("[CONSUMER] action: consume (CONSUMING -> WAITING)");
+                ConsumerState::Waiting
+            }
+            ConsumerState::Waiting => {
+                if get_rx.recv().is_err() { // receive: get
+                    println!("[CONSUMER] get can no longer happen: BUFFER has stopped");
+                    return;
+                }
+                println!("[CONSUMER] action: get (WAITING -> CONSUMING)");
+                ConsumerState::Consuming
+            }
+        };
+    }
+}
+
+/// Runs the BUFFER process
+fn process_buffer(get_tx: SyncSender<()>, put_tx: SyncSender<()>) {
+    println!("[BUFFER] Starting...");
+
+    let mut state = BufferState::Empty;
+
+    loop {
+        state = match state {
+            BufferState::Empty => {
+                if put_tx.send(()).is_err() { // send: put
+                    println!("[BUFFER] put can no longer happen: PRODUCER has stopped");
+                    return;
+                }
+                println!("[BUFFER] action: put (EMPTY -> FULL)");
+                BufferState::Full
+            }
+            BufferState::Full => {
+                if get_tx.send(()).is_err() { // send: get
+                    println!("[BUFFER] get can no longer happen: CONSUMER has stopped");
+                    return;
+                }
+                println!("[BUFFER] action: get (FULL -> EMPTY)");
+                BufferState::Empty
+            }
+        };
+    }
+}
+
+fn main() {
+    println!("═══════════════════════════════════════════════════════════════");
+    println!("  LTS Execution Started");
+    println!("═══════════════════════════════════════════════════════════════");
+    println!();
+
+    // Channels for action synchronization (shared actions only)
+    let (get_tx, get_rx) = mpsc::sync_channel(0); // shared action: get
+    let (put_tx, put_rx) = mpsc::sync_channel(0); // shared action: put
+
+    // Launch process threads
+    let handles = vec![
+        thread::spawn(move || process_producer(put_rx)),
+        thread::spawn(move || process_consumer(get_rx)),
+        thread::spawn(move || process_buffer(get_tx, put_tx)),
+    ];
+
+    // Wait for all processes to complete
+    for handle in handles {
+        handle.join().unwrap();
+    }
+
+    println!();
+    println!("═══════════════════════════════════════════════════════════════");
+    println!("  LTS Execution Complete");
+    println!("═══════════════════════════════════════════════════════════════");
+}